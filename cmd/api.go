@@ -6,14 +6,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/sander-remitly/pack-calc/internal/api"
 	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/history"
 	"github.com/sander-remitly/pack-calc/internal/logger"
-	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/sander-remitly/pack-calc/internal/retention"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -35,39 +36,57 @@ func runAPI(cmd *cobra.Command, args []string) {
 	logger.Initialize()
 	defer logger.Sync()
 
-	// Ensure data directory exists
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		logger.Log.Fatal("Failed to create data directory", zap.Error(err))
-	}
+	// Initialize tracing; flushed after the history writer closes
+	shutdownTracing := setupTracing()
 
 	// Initialize repository
-	repository, err := repo.New(dbPath)
-	if err != nil {
-		logger.Log.Fatal("Failed to initialize repository", zap.Error(err))
-	}
+	repository := openRepository()
 	defer repository.Close()
 
-	// Initialize default pack sizes if none exist
-	packSizes, err := repository.GetPackSizes()
-	if err != nil {
-		logger.Log.Fatal("Failed to get pack sizes", zap.Error(err))
-	}
-	if len(packSizes) == 0 {
-		logger.Log.Info("Initializing default pack sizes...")
-		defaultSizes := []int{250, 500, 1000, 2000, 5000}
-		if err := repository.SetPackSizes(defaultSizes); err != nil {
-			logger.Log.Fatal("Failed to set default pack sizes", zap.Error(err))
-		}
-	}
-
 	// Initialize cache
 	cacheInstance := cache.NewCache()
 	defer cacheInstance.Close()
 
+	// Initialize cache warmer; stopped before the cache and repository close
+	warmCfg := warmer.LoadConfig()
+	cacheWarmer := warmer.New(cacheInstance, repository, warmCfg)
+	defer cacheWarmer.Stop()
+
+	// Enforce history retention; stopped before the repository closes
+	pruner := retention.New(repository, retention.LoadConfig())
+	pruner.Start()
+	defer pruner.Stop()
+
+	// Initialize history writer; closed after the server stops so that
+	// queued entries are saved
+	historyWriter := history.New(repository, history.LoadConfig())
+
+	// Initialize rate limiter
+	limiter, closeLimiter := newRateLimiter(repository)
+	defer closeLimiter()
+
+	// Initialize idempotency keys
+	idem, closeIdem := newIdempotencyGuard(repository)
+	defer closeIdem()
+
+	// Readiness checks; the startup probe passes after the cache warm-up
+	checker := newHealthChecker(repository, cacheInstance, historyWriter)
+
 	// Setup API handler
-	handler := api.NewHandler(repository, cacheInstance)
+	handler := api.NewHandler(repository, cacheInstance,
+		api.WithWarmer(cacheWarmer),
+		api.WithHistoryWriter(historyWriter),
+		api.WithAuth(newAuthenticator(repository)),
+		api.WithRateLimiter(limiter),
+		api.WithIdempotency(idem),
+		api.WithHealthChecker(checker),
+		api.WithSecurity(securityConfig()),
+	)
 	router := handler.SetupRouter()
 
+	// HTTP and gRPC share the certificate and its reloads
+	tlsConfig := serverTLS()
+
 	// Create server
 	addr := fmt.Sprintf(":%d", port)
 	server := &http.Server{
@@ -76,19 +95,26 @@ func runAPI(cmd *cobra.Command, args []string) {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
+	url := serverURL(server)
 
 	// Start server in goroutine
 	go func() {
 		logger.Log.Info("🚀 API server starting",
-			zap.String("url", fmt.Sprintf("http://localhost%s", addr)),
-			zap.String("health", fmt.Sprintf("http://localhost%s/api/health", addr)),
+			zap.String("url", url),
+			zap.String("health", url+"/api/health"),
 		)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(server); err != nil && err != http.ErrServerClosed {
 			logger.Log.Fatal("Server error", zap.Error(err))
 		}
 	}()
 
+	// Start the gRPC server on its own port
+	stopGRPC := startGRPC(handler, tlsConfig)
+
+	startWarmer(cacheWarmer, warmCfg, checker)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -100,8 +126,20 @@ func runAPI(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Log.Fatal("Server forced to shutdown", zap.Error(err))
+	shutdownErr := server.Shutdown(ctx)
+	stopGRPC(ctx)
+
+	if err := historyWriter.Close(ctx); err != nil {
+		logger.Log.Error("History entries lost on shutdown",
+			zap.Int("queued", historyWriter.Stats().QueueDepth),
+			zap.Error(err),
+		)
+	}
+
+	shutdownTracing(ctx)
+
+	if shutdownErr != nil {
+		logger.Log.Fatal("Server forced to shutdown", zap.Error(shutdownErr))
 	}
 
 	logger.Log.Info("Server stopped")
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sander-remitly/pack-calc/internal/api"
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/grpcapi"
+	"github.com/sander-remitly/pack-calc/internal/health"
+	"github.com/sander-remitly/pack-calc/internal/history"
+	"github.com/sander-remitly/pack-calc/internal/idempotency"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/sander-remitly/pack-calc/internal/servertls"
+	"github.com/sander-remitly/pack-calc/internal/tracing"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
+	"go.uber.org/zap"
+)
+
+// connectRepository opens the PostgreSQL database at dsn when set,
+// otherwise the SQLite database at dbPath, creating its directory if
+// needed. Failures are fatal.
+func connectRepository(opts ...repo.Option) *repo.Repository {
+	var (
+		repository *repo.Repository
+		err        error
+	)
+
+	if dsn != "" {
+		repository, err = repo.NewPostgres(dsn, opts...)
+	} else {
+		// Ensure data directory exists
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			logger.Log.Fatal("Failed to create data directory", zap.Error(err))
+		}
+		repository, err = repo.New(dbPath, opts...)
+	}
+	if err != nil {
+		logger.Log.Fatal("Failed to initialize repository", zap.Error(err))
+	}
+	metrics.SetDBStats(repository.PoolStats)
+
+	return repository
+}
+
+// openRepository connects to the database, applies pending migrations
+// unless --auto-migrate=false and creates the default pack sizes on first
+// use. Failures are fatal.
+func openRepository() repo.Store {
+	if autoMigrate {
+		return seedRepository(connectRepository())
+	}
+
+	repository := connectRepository(repo.WithoutMigrations())
+	pending, err := repository.PendingMigrations()
+	if err != nil {
+		logger.Log.Fatal("Failed to check schema migrations", zap.Error(err))
+	}
+	if pending > 0 {
+		logger.Log.Fatal("Database schema is out of date; run packcalc db migrate",
+			zap.Int("pending_migrations", pending),
+		)
+	}
+
+	return seedRepository(repository)
+}
+
+// seedRepository creates the default pack sizes if none exist
+func seedRepository(repository repo.Store) repo.Store {
+	packSizes, err := repository.GetPackSizes()
+	if err != nil {
+		logger.Log.Fatal("Failed to get pack sizes", zap.Error(err))
+	}
+	if len(packSizes) == 0 {
+		logger.Log.Info("Initializing default pack sizes...")
+		defaultSizes := []int{250, 500, 1000, 2000, 5000}
+		if err := repository.SetPackSizes(defaultSizes); err != nil {
+			logger.Log.Fatal("Failed to set default pack sizes", zap.Error(err))
+		}
+	}
+
+	return repository
+}
+
+// serverTLS loads the server certificate when TLS_CERT_FILE is set and
+// reloads it, with the client CA, on SIGHUP. It returns nil for plain
+// HTTP. Failures at startup are fatal; failed reloads keep the previous
+// certificate.
+func serverTLS() *tls.Config {
+	cfg := servertls.LoadConfig()
+	if !cfg.Enabled() {
+		return nil
+	}
+
+	reloader, err := servertls.New(cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to configure TLS", zap.Error(err))
+	}
+	logger.Log.Info("TLS enabled",
+		zap.String("client_auth", cfg.ClientAuth),
+		zap.Time("certificate_expires", reloader.Certificate().NotAfter),
+	)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				logger.Log.Error("Failed to reload TLS certificate; keeping the previous one", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("TLS certificate reloaded",
+				zap.Time("certificate_expires", reloader.Certificate().NotAfter),
+			)
+		}
+	}()
+
+	return reloader.TLSConfig()
+}
+
+// listenAndServe serves HTTPS when the server has a TLS configuration,
+// plain HTTP otherwise
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// serverURL returns the local URL of the server for log messages
+func serverURL(server *http.Server) string {
+	if server.TLSConfig != nil {
+		return "https://localhost" + server.Addr
+	}
+	return "http://localhost" + server.Addr
+}
+
+// startGRPC serves the gRPC API on --grpc-port, with the TLS configuration
+// of the HTTP server, unless the port is 0. The returned function stops it
+// gracefully.
+func startGRPC(handler *api.Handler, tlsConfig *tls.Config) func(ctx context.Context) {
+	if grpcPort == 0 {
+		return func(context.Context) {}
+	}
+
+	addr := fmt.Sprintf(":%d", grpcPort)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Log.Fatal("Failed to listen for gRPC", zap.String("addr", addr), zap.Error(err))
+	}
+
+	server := grpcapi.New(handler, grpcapi.WithTLS(tlsConfig))
+	go func() {
+		logger.Log.Info("🚀 gRPC server starting", zap.String("addr", addr), zap.Bool("tls", tlsConfig != nil))
+		if err := server.Serve(lis); err != nil {
+			logger.Log.Fatal("gRPC server error", zap.Error(err))
+		}
+	}()
+
+	return server.Shutdown
+}
+
+// setupTracing installs the trace exporter selected by
+// OTEL_TRACES_EXPORTER. The returned function flushes the spans still
+// buffered; call it after the last requests and history writes.
+func setupTracing() func(ctx context.Context) {
+	cfg := tracing.LoadConfig()
+	shutdown, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to set up tracing", zap.Error(err))
+	}
+	if cfg.Exporter != tracing.ExporterNone {
+		logger.Log.Info("Tracing enabled", zap.String("exporter", cfg.Exporter))
+	}
+
+	return func(ctx context.Context) {
+		if err := shutdown(ctx); err != nil {
+			logger.Log.Warn("Failed to flush traces", zap.Error(err))
+		}
+	}
+}
+
+// startWarmer starts a background warm-up of the most frequent
+// calculations when CACHE_WARM_ON_STARTUP is set, and marks the startup
+// done once it ends, whether or not it succeeded. Without a warm-up the
+// startup is done right away.
+func startWarmer(w *warmer.Warmer, cfg warmer.Config, checker *health.Checker) {
+	if !cfg.OnStartup {
+		checker.MarkStarted()
+		return
+	}
+
+	go func() {
+		defer checker.MarkStarted()
+		if _, err := w.Run(context.Background(), warmer.Job{Top: cfg.Top}); err != nil {
+			logger.Log.Warn("Cache warm-up on startup did not complete", zap.Error(err))
+		}
+	}()
+}
+
+// securityConfig loads the CORS policy and security headers. An invalid
+// policy is fatal.
+func securityConfig() api.SecurityConfig {
+	cfg, err := api.LoadSecurityConfig()
+	if err != nil {
+		logger.Log.Fatal("Failed to configure CORS", zap.Error(err))
+	}
+	return cfg
+}
+
+// newHealthChecker creates the readiness checks of the server's
+// dependencies, including the free disk space next to a SQLite database
+func newHealthChecker(repository repo.Store, c cache.Cache, w *history.Writer) *health.Checker {
+	deps := health.Dependencies{Database: repository, Cache: c, History: w}
+	if dsn == "" {
+		deps.DataDir = filepath.Dir(dbPath)
+	}
+	return health.New(health.LoadConfig(), deps)
+}
+
+// newAuthenticator creates the API key authenticator from AUTH_ENABLED and
+// AUTH_ANONYMOUS_SCOPES, warning when the admin endpoints are left open
+func newAuthenticator(repository repo.Store) *auth.Authenticator {
+	cfg := auth.LoadConfig()
+	if !cfg.Enabled {
+		logger.Log.Warn("API key authentication disabled; set AUTH_ENABLED=true to protect the admin endpoints")
+	} else {
+		logger.Log.Info("API key authentication enabled", zap.Strings("anonymous_scopes", cfg.AnonymousScopes))
+	}
+
+	return auth.New(repository, cfg)
+}
+
+// newRateLimiter creates the rate limiter from the RATE_LIMIT_* variables,
+// keeping its buckets in Redis with RATE_LIMIT_BACKEND=redis. The returned
+// function releases its Redis connection.
+func newRateLimiter(repository repo.Store) (*ratelimit.Limiter, func()) {
+	cfg := ratelimit.LoadConfig()
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	closeStore := func() {}
+	if cfg.Enabled && cfg.Backend == ratelimit.BackendRedis {
+		client, err := cache.LoadRedisConfig().NewClient()
+		if err != nil {
+			logger.Log.Fatal("Failed to configure Redis for rate limiting", zap.Error(err))
+		}
+		redisStore := ratelimit.NewRedisStore(client)
+		store = redisStore
+		closeStore = func() { redisStore.Close() }
+	}
+
+	if cfg.Enabled {
+		logger.Log.Info("Rate limiting enabled",
+			zap.String("backend", cfg.Backend),
+			zap.Any("limits", cfg.Limits),
+		)
+	}
+
+	return ratelimit.New(store, repository, cfg), closeStore
+}
+
+// newIdempotencyGuard creates the guard for Idempotency-Key headers from the
+// IDEMPOTENCY_* variables, keeping its records in Redis with
+// IDEMPOTENCY_BACKEND=redis. The returned function releases its Redis
+// connection.
+func newIdempotencyGuard(repository repo.Store) (*idempotency.Guard, func()) {
+	cfg := idempotency.LoadConfig()
+
+	var store idempotency.Store = idempotency.NewSQLStore(repository)
+	closeStore := func() {}
+	if cfg.Backend == idempotency.BackendRedis {
+		client, err := cache.LoadRedisConfig().NewClient()
+		if err != nil {
+			logger.Log.Fatal("Failed to configure Redis for idempotency keys", zap.Error(err))
+		}
+		redisStore := idempotency.NewRedisStore(client)
+		store = redisStore
+		closeStore = func() { redisStore.Close() }
+	}
+
+	logger.Log.Info("Idempotency keys enabled",
+		zap.String("backend", cfg.Backend),
+		zap.Duration("ttl", cfg.TTL),
+	)
+
+	return idempotency.New(store, cfg), closeStore
+}
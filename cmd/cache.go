@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	// cache warm flags
+	warmTop       int
+	warmItems     []int
+	warmFrom      int
+	warmTo        int
+	warmStep      int
+	warmPackSizes []int
+	warmRate      float64
+)
+
+// cacheCmd groups the cache maintenance commands
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the calculation cache",
+}
+
+// cacheWarmCmd represents the cache warm command
+var cacheWarmCmd = &cobra.Command{
+	Use:   "warm",
+	Short: "Precompute calculations into the cache",
+	Long: `Precompute calculations into the shared cache configured by CACHE_BACKEND
+and the REDIS_* variables.
+
+Without flags the most frequent (items, pack sizes) combinations from the
+history are warmed. --items and --from/--to/--step add explicit order sizes,
+calculated with --pack-sizes or the current pack configuration.`,
+	Example: `  packcalc cache warm --top 500
+  packcalc cache warm --from 1 --to 10000 --step 50 --rate 200
+  packcalc cache warm --items 263,12001 --pack-sizes 23,31,53`,
+	Run: runCacheWarm,
+}
+
+func init() {
+	cacheWarmCmd.Flags().IntVar(&warmTop, "top", 0, "Most frequent combinations to warm from history (default CACHE_WARM_TOP or 100)")
+	cacheWarmCmd.Flags().IntSliceVar(&warmItems, "items", nil, "Order sizes to warm")
+	cacheWarmCmd.Flags().IntVar(&warmFrom, "from", 0, "First order size of a range to warm")
+	cacheWarmCmd.Flags().IntVar(&warmTo, "to", 0, "Last order size of a range to warm")
+	cacheWarmCmd.Flags().IntVar(&warmStep, "step", 1, "Step between order sizes in the range")
+	cacheWarmCmd.Flags().IntSliceVar(&warmPackSizes, "pack-sizes", nil, "Pack sizes for --items and the range (default: current configuration)")
+	cacheWarmCmd.Flags().Float64Var(&warmRate, "rate", 0, "Calculations per second, 0 for unlimited (default CACHE_WARM_RATE or 50)")
+
+	cacheCmd.AddCommand(cacheWarmCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+func runCacheWarm(cmd *cobra.Command, args []string) {
+	// Initialize logger
+	logger.Initialize()
+	defer logger.Sync()
+
+	// An in-process cache would be discarded when this command exits
+	cacheCfg := cache.LoadConfig()
+	if cacheCfg.Backend != cache.BackendRedis && cacheCfg.Backend != cache.BackendTiered {
+		logger.Log.Fatal("Cache warming from the CLI needs a shared cache (CACHE_BACKEND=redis or tiered); use POST /api/cache/warm for the in-memory cache",
+			zap.String("backend", cacheCfg.Backend),
+		)
+	}
+
+	repository := openRepository()
+	defer repository.Close()
+
+	cacheInstance := cache.New(cacheCfg)
+	defer cacheInstance.Close()
+
+	warmCfg := warmer.LoadConfig()
+	if cmd.Flags().Changed("rate") {
+		warmCfg.Rate = warmRate
+	}
+
+	job := warmer.Job{
+		Top:       warmTop,
+		Items:     warmItems,
+		From:      warmFrom,
+		To:        warmTo,
+		Step:      warmStep,
+		PackSizes: warmPackSizes,
+	}
+
+	// Stop cleanly on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	progress, err := warmer.New(cacheInstance, repository, warmCfg).Run(ctx, job)
+	if err != nil {
+		logger.Log.Error("Cache warm-up failed", zap.Error(err))
+	}
+
+	fmt.Printf("Cache warm-up %s: %d warmed, %d already cached, %d failed (%d of %d processed)\n",
+		progress.State, progress.Warmed, progress.Skipped, progress.Failed, progress.Processed, progress.Total)
+
+	if err != nil {
+		logger.Sync()
+		os.Exit(1)
+	}
+}
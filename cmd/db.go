@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// rollbackSteps is the number of migrations db rollback reverts
+var rollbackSteps int
+
+// dbCmd groups the database maintenance commands
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database schema",
+	Long: `Manage the schema of the database selected by --db or --dsn.
+
+Schema changes are numbered migrations embedded in the binary and recorded
+in the schema_migrations table. api and serve apply pending migrations on
+startup unless --auto-migrate=false.`,
+}
+
+// dbMigrateCmd represents the db migrate command
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		runDB(func(repository *repo.Repository) error {
+			applied, err := repository.Migrate()
+			for _, m := range applied {
+				fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+			}
+			if err == nil && len(applied) == 0 {
+				fmt.Println("Schema is up to date")
+			}
+			return err
+		})
+	},
+}
+
+// dbStatusCmd represents the db status command
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending schema migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		runDB(func(repository *repo.Repository) error {
+			status, err := repository.MigrationStatus()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, s := range status {
+				state, appliedAt := "pending", ""
+				if s.Applied {
+					state, appliedAt = "applied", s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				if !s.Known {
+					state = "applied (unknown to this release)"
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// dbRollbackCmd represents the db rollback command
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Revert the latest schema migrations",
+	Long: `Revert the latest applied schema migrations using their down scripts.
+
+Rolling back the initial migration drops all tables and their data.`,
+	Example: `  packcalc db rollback
+  packcalc db rollback --steps 2`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDB(func(repository *repo.Repository) error {
+			reverted, err := repository.Rollback(rollbackSteps)
+			for _, m := range reverted {
+				fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+			}
+			if err == nil && len(reverted) == 0 {
+				fmt.Println("No migrations to roll back")
+			}
+			return err
+		})
+	},
+}
+
+func init() {
+	dbRollbackCmd.Flags().IntVar(&rollbackSteps, "steps", 1, "Number of migrations to revert")
+
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd, dbRollbackCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+// runDB opens the database without applying migrations and runs fn,
+// exiting with status 1 if it fails
+func runDB(fn func(repository *repo.Repository) error) {
+	// Initialize logger
+	logger.Initialize()
+	defer logger.Sync()
+
+	repository := connectRepository(repo.WithoutMigrations())
+	defer repository.Close()
+
+	if err := fn(repository); err != nil {
+		logger.Log.Error("Database command failed", zap.Error(err))
+		logger.Sync()
+		repository.Close()
+		os.Exit(1)
+	}
+}
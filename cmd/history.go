@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/retention"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	// history prune flags
+	pruneMaxAge  time.Duration
+	pruneMaxRows int
+	pruneRollup  bool
+	pruneVacuum  bool
+)
+
+// historyCmd groups the calculation history commands
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage the calculation history",
+}
+
+// historyPruneCmd represents the history prune command
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove calculations outside the retention policy",
+	Long: `Remove calculations older than --max-age or beyond the newest --max-rows.
+Unset flags fall back to HISTORY_MAX_AGE, HISTORY_MAX_ROWS and HISTORY_ROLLUP.
+
+With --rollup, pruned calculations are first added to daily aggregates so
+that /api/stats totals and series still include them. --vacuum then
+rewrites the database to return the freed space; on SQLite this blocks
+writers while it runs.`,
+	Example: `  packcalc history prune --max-age 720h --rollup
+  packcalc history prune --max-rows 1000000 --vacuum`,
+	Run: runHistoryPrune,
+}
+
+func init() {
+	historyPruneCmd.Flags().DurationVar(&pruneMaxAge, "max-age", 0, "Remove calculations older than this, e.g. 720h (default HISTORY_MAX_AGE)")
+	historyPruneCmd.Flags().IntVar(&pruneMaxRows, "max-rows", 0, "Keep at most this many of the latest calculations (default HISTORY_MAX_ROWS)")
+	historyPruneCmd.Flags().BoolVar(&pruneRollup, "rollup", false, "Aggregate pruned calculations into daily rollups (default HISTORY_ROLLUP)")
+	historyPruneCmd.Flags().BoolVar(&pruneVacuum, "vacuum", false, "Run a full vacuum after pruning")
+
+	historyCmd.AddCommand(historyPruneCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistoryPrune(cmd *cobra.Command, args []string) {
+	// Initialize logger
+	logger.Initialize()
+	defer logger.Sync()
+
+	cfg := retention.LoadConfig()
+	if cmd.Flags().Changed("max-age") {
+		cfg.Policy.MaxAge = pruneMaxAge
+	}
+	if cmd.Flags().Changed("max-rows") {
+		cfg.Policy.MaxRows = pruneMaxRows
+	}
+	if cmd.Flags().Changed("rollup") {
+		cfg.Policy.Rollup = pruneRollup
+	}
+	// Only vacuum fully when asked to
+	cfg.VacuumInterval = 0
+
+	if !cfg.Policy.Enabled() {
+		logger.Log.Fatal("No retention limit; set --max-age or --max-rows (or HISTORY_MAX_AGE / HISTORY_MAX_ROWS)")
+	}
+
+	repository := openRepository()
+	defer repository.Close()
+
+	result, err := retention.New(repository, cfg).Run()
+	if err != nil {
+		logger.Log.Fatal("History pruning failed", zap.Error(err))
+	}
+	fmt.Printf("Deleted %d calculations", result.Deleted)
+	if cfg.Policy.Rollup {
+		fmt.Printf(" (%d daily rollups updated)", result.RolledUp)
+	}
+	fmt.Println()
+
+	if pruneVacuum {
+		start := time.Now()
+		if err := repository.Vacuum(true); err != nil {
+			logger.Log.Fatal("Vacuum failed", zap.Error(err))
+		}
+		fmt.Printf("Vacuumed database in %s\n", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	// keys create flags
+	keyScopes     string
+	keyDailyQuota int64
+)
+
+// keysCmd groups the API key commands
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage API keys",
+	Long: `Manage the API keys accepted when AUTH_ENABLED=true.
+
+Keys are sent in the Authorization: Bearer or X-API-Key header. Each key
+grants a set of scopes: ` + strings.Join(auth.Scopes, ", ") + `.
+Requests without a key get AUTH_ANONYMOUS_SCOPES. A key with a daily quota
+is rejected with 429 once it has made that many requests in a UTC day.`,
+}
+
+// keysCreateCmd represents the keys create command
+var keysCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create an API key",
+	Long: `Create an API key and print it. Only a hash of the key is stored, so it
+cannot be shown again.`,
+	Example: `  packcalc keys create ci --scopes calculate,read:history --daily-quota 10000
+  packcalc keys create ops --scopes admin:config,admin:cache,admin:history`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runKeys(func(repository repo.Store) error {
+			scopes, err := auth.ParseScopes(keyScopes)
+			if err != nil {
+				return err
+			}
+			if len(scopes) == 0 {
+				return fmt.Errorf("--scopes must name at least one scope")
+			}
+
+			if keyDailyQuota < 0 {
+				return fmt.Errorf("--daily-quota must not be negative")
+			}
+
+			secret, prefix, hash, err := auth.NewKey()
+			if err != nil {
+				return err
+			}
+
+			key, err := repository.CreateAPIKey(models.APIKey{Name: args[0], Prefix: prefix, Scopes: scopes, DailyQuota: keyDailyQuota}, hash)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created API key %q with scopes %s\n\n", key.Name, strings.Join(key.Scopes, ", "))
+			fmt.Printf("  %s\n\n", secret)
+			fmt.Println("Store it now: it cannot be shown again.")
+			return nil
+		})
+	},
+}
+
+// keysListCmd represents the keys list command
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		runKeys(func(repository repo.Store) error {
+			keys, err := repository.ListAPIKeys()
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tPREFIX\tSCOPES\tREQUESTS TODAY\tCREATED AT\tSTATUS")
+			for _, k := range keys {
+				used, err := repository.GetAPIKeyUsage(k.ID, now)
+				if err != nil {
+					return err
+				}
+				requests := strconv.FormatInt(used, 10)
+				if k.DailyQuota > 0 {
+					requests += "/" + strconv.FormatInt(k.DailyQuota, 10)
+				}
+
+				status := "active"
+				if k.RevokedAt != nil {
+					status = "revoked " + k.RevokedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%s\t%s…\t%s\t%s\t%s\t%s\n", k.Name, k.Prefix, strings.Join(k.Scopes, ","), requests, k.CreatedAt.Local().Format("2006-01-02 15:04:05"), status)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// keysRevokeCmd represents the keys revoke command
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke NAME",
+	Short: "Revoke an API key",
+	Long:  `Revoke an API key. Requests using it are rejected with 401 from then on.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runKeys(func(repository repo.Store) error {
+			if err := repository.RevokeAPIKey(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked API key %q\n", args[0])
+			return nil
+		})
+	},
+}
+
+// keysQuotaCmd represents the keys quota command
+var keysQuotaCmd = &cobra.Command{
+	Use:     "quota NAME REQUESTS",
+	Short:   "Set the daily quota of an API key",
+	Long:    `Set the number of requests an API key may make per UTC day; 0 removes the quota.`,
+	Example: `  packcalc keys quota ci 50000`,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runKeys(func(repository repo.Store) error {
+			quota, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || quota < 0 {
+				return fmt.Errorf("quota must be a non-negative number of requests, got %q", args[1])
+			}
+			if err := repository.SetAPIKeyQuota(args[0], quota); err != nil {
+				return err
+			}
+			fmt.Printf("Set the daily quota of API key %q to %d requests\n", args[0], quota)
+			return nil
+		})
+	},
+}
+
+func init() {
+	keysCreateCmd.Flags().StringVar(&keyScopes, "scopes", "", "Comma-separated scopes granted to the key")
+	keysCreateCmd.Flags().Int64Var(&keyDailyQuota, "daily-quota", 0, "Requests allowed per UTC day (0 for no quota)")
+	keysCreateCmd.MarkFlagRequired("scopes")
+
+	keysCmd.AddCommand(keysCreateCmd, keysListCmd, keysRevokeCmd, keysQuotaCmd)
+	rootCmd.AddCommand(keysCmd)
+}
+
+// runKeys opens the database and runs fn, exiting with status 1 if it
+// fails
+func runKeys(fn func(repository repo.Store) error) {
+	// Initialize logger
+	logger.Initialize()
+	defer logger.Sync()
+
+	repository := openRepository()
+	defer repository.Close()
+
+	if err := fn(repository); err != nil {
+		logger.Log.Error("API key command failed", zap.Error(err))
+		logger.Sync()
+		repository.Close()
+		os.Exit(1)
+	}
+}
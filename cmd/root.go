@@ -9,9 +9,12 @@ import (
 
 var (
 	// Global flags
-	port    int
-	dbPath  string
-	verbose bool
+	port        int
+	grpcPort    int
+	dbPath      string
+	dsn         string
+	autoMigrate bool
+	verbose     bool
 )
 
 // rootCmd represents the base command
@@ -35,6 +38,9 @@ func Execute() {
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", 8080, "Server port")
+	rootCmd.PersistentFlags().IntVar(&grpcPort, "grpc-port", 0, "gRPC server port, e.g. 9090; 0 (the default) disables the gRPC server")
 	rootCmd.PersistentFlags().StringVarP(&dbPath, "db", "d", "./data/packcalc.db", "Database file path")
+	rootCmd.PersistentFlags().StringVar(&dsn, "dsn", os.Getenv("PACKCALC_DSN"), "PostgreSQL connection URL; overrides --db (env PACKCALC_DSN)")
+	rootCmd.PersistentFlags().BoolVar(&autoMigrate, "auto-migrate", true, "Apply pending schema migrations on startup")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose logging")
 }
@@ -6,14 +6,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/sander-remitly/pack-calc/internal/api"
 	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/history"
 	"github.com/sander-remitly/pack-calc/internal/logger"
-	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/sander-remitly/pack-calc/internal/retention"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
 	"github.com/sander-remitly/pack-calc/internal/web"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -36,37 +37,52 @@ func runServe(cmd *cobra.Command, args []string) {
 	logger.Initialize()
 	defer logger.Sync()
 
-	// Ensure data directory exists
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		logger.Log.Fatal("Failed to create data directory", zap.Error(err))
-	}
+	// Initialize tracing; flushed after the history writer closes
+	shutdownTracing := setupTracing()
 
 	// Initialize repository
-	repository, err := repo.New(dbPath)
-	if err != nil {
-		logger.Log.Fatal("Failed to initialize repository", zap.Error(err))
-	}
+	repository := openRepository()
 	defer repository.Close()
 
-	// Initialize default pack sizes if none exist
-	packSizes, err := repository.GetPackSizes()
-	if err != nil {
-		logger.Log.Fatal("Failed to get pack sizes", zap.Error(err))
-	}
-	if len(packSizes) == 0 {
-		logger.Log.Info("Initializing default pack sizes...")
-		defaultSizes := []int{250, 500, 1000, 2000, 5000}
-		if err := repository.SetPackSizes(defaultSizes); err != nil {
-			logger.Log.Fatal("Failed to set default pack sizes", zap.Error(err))
-		}
-	}
-
 	// Initialize cache
 	cacheInstance := cache.NewCache()
 	defer cacheInstance.Close()
 
+	// Initialize cache warmer; stopped before the cache and repository close
+	warmCfg := warmer.LoadConfig()
+	cacheWarmer := warmer.New(cacheInstance, repository, warmCfg)
+	defer cacheWarmer.Stop()
+
+	// Enforce history retention; stopped before the repository closes
+	pruner := retention.New(repository, retention.LoadConfig())
+	pruner.Start()
+	defer pruner.Stop()
+
+	// Initialize history writer; closed after the server stops so that
+	// queued entries are saved
+	historyWriter := history.New(repository, history.LoadConfig())
+
+	// Initialize rate limiter
+	limiter, closeLimiter := newRateLimiter(repository)
+	defer closeLimiter()
+
+	// Initialize idempotency keys
+	idem, closeIdem := newIdempotencyGuard(repository)
+	defer closeIdem()
+
+	// Readiness checks; the startup probe passes after the cache warm-up
+	checker := newHealthChecker(repository, cacheInstance, historyWriter)
+
 	// Setup API handler
-	apiHandler := api.NewHandler(repository, cacheInstance)
+	apiHandler := api.NewHandler(repository, cacheInstance,
+		api.WithWarmer(cacheWarmer),
+		api.WithHistoryWriter(historyWriter),
+		api.WithAuth(newAuthenticator(repository)),
+		api.WithRateLimiter(limiter),
+		api.WithIdempotency(idem),
+		api.WithHealthChecker(checker),
+		api.WithSecurity(securityConfig()),
+	)
 	router := apiHandler.SetupRouter()
 
 	// Setup web handler
@@ -76,6 +92,9 @@ func runServe(cmd *cobra.Command, args []string) {
 	}
 	webHandler.SetupRoutes(router)
 
+	// HTTP and gRPC share the certificate and its reloads
+	tlsConfig := serverTLS()
+
 	// Create server
 	addr := fmt.Sprintf(":%d", port)
 	server := &http.Server{
@@ -84,21 +103,28 @@ func runServe(cmd *cobra.Command, args []string) {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
+	url := serverURL(server)
 
 	// Start server in goroutine
 	go func() {
 		logger.Log.Info("🚀 Server starting",
-			zap.String("url", fmt.Sprintf("http://localhost%s", addr)),
-			zap.String("web_ui", fmt.Sprintf("http://localhost%s", addr)),
-			zap.String("api", fmt.Sprintf("http://localhost%s/api", addr)),
-			zap.String("health", fmt.Sprintf("http://localhost%s/api/health", addr)),
+			zap.String("url", url),
+			zap.String("web_ui", url),
+			zap.String("api", url+"/api"),
+			zap.String("health", url+"/api/health"),
 		)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(server); err != nil && err != http.ErrServerClosed {
 			logger.Log.Fatal("Server error", zap.Error(err))
 		}
 	}()
 
+	// Start the gRPC server on its own port
+	stopGRPC := startGRPC(apiHandler, tlsConfig)
+
+	startWarmer(cacheWarmer, warmCfg, checker)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -110,8 +136,20 @@ func runServe(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Log.Fatal("Server forced to shutdown", zap.Error(err))
+	shutdownErr := server.Shutdown(ctx)
+	stopGRPC(ctx)
+
+	if err := historyWriter.Close(ctx); err != nil {
+		logger.Log.Error("History entries lost on shutdown",
+			zap.Int("queued", historyWriter.Stats().QueueDepth),
+			zap.Error(err),
+		)
+	}
+
+	shutdownTracing(ctx)
+
+	if shutdownErr != nil {
+		logger.Log.Fatal("Server forced to shutdown", zap.Error(shutdownErr))
 	}
 
 	logger.Log.Info("Server stopped")
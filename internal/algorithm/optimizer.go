@@ -5,12 +5,18 @@ import (
 	"sort"
 )
 
+// Version identifies the optimization rules and their implementation. It
+// is recorded with every calculation in the history; change it whenever
+// the same order could get a different result.
+const Version = "dp-1"
+
 // Result represents the calculation result
 type Result struct {
 	PackCounts map[int]int // pack size -> count
 	TotalItems int         // total items delivered
 	TotalPacks int         // total number of packs
 	Waste      int         // items - order
+	TableSize  int         // entries in the DP table: order + largest pack size + 1
 }
 
 // Calculate finds the optimal pack combination for a given order quantity.
@@ -94,7 +100,7 @@ func Calculate(order int, packSizes []int) Result {
 
 	// If no solution found
 	if bestItems == -1 {
-		return Result{PackCounts: make(map[int]int)}
+		return Result{PackCounts: make(map[int]int), TableSize: len(dp)}
 	}
 
 	// Backtrack to find which packs were used
@@ -111,6 +117,7 @@ func Calculate(order int, packSizes []int) Result {
 		TotalItems: bestItems,
 		TotalPacks: bestPacks,
 		Waste:      bestItems - order,
+		TableSize:  len(dp),
 	}
 }
 
@@ -135,6 +135,11 @@ func TestCalculate_EdgeCase(t *testing.T) {
 		t.Errorf("Calculated total = %d, want 500000", total)
 	}
 
+	// The table covers every total up to the order plus the largest pack
+	if result.TableSize != 500000+53+1 {
+		t.Errorf("TableSize = %d, want %d", result.TableSize, 500000+53+1)
+	}
+
 	t.Logf("Edge case result: %+v", result.PackCounts)
 }
 
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+// errTrailingData is returned for bodies with more than one JSON value
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+// decodeJSON decodes a request body into v strictly: unknown fields and
+// anything after the first JSON value are errors
+func decodeJSON(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// respondInvalidBody answers 400 for a body decodeJSON rejected, naming
+// the offending field where the error tells it, or 413 for a body over
+// the limit
+func respondInvalidBody(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondJSON(w, http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:     "Request body too large",
+			Message:   fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+			Code:      http.StatusRequestEntityTooLarge,
+			ErrorCode: models.ErrorCodeBodyTooLarge,
+		})
+		return
+	}
+
+	response := models.ErrorResponse{
+		Error:     "Invalid request body",
+		Message:   err.Error(),
+		Code:      http.StatusBadRequest,
+		ErrorCode: models.ErrorCodeInvalidJSON,
+		Details:   fieldErrors(err),
+	}
+	if len(response.Details) > 0 {
+		response.ErrorCode = models.ErrorCodeValidation
+	}
+	respondJSON(w, http.StatusBadRequest, response)
+}
+
+// respondInvalidFields answers 400 with the problems found by a request
+// model's Validate method
+func respondInvalidFields(w http.ResponseWriter, errs []models.FieldError) {
+	respondJSON(w, http.StatusBadRequest, models.ErrorResponse{
+		Error:     "Invalid request body",
+		Code:      http.StatusBadRequest,
+		ErrorCode: models.ErrorCodeValidation,
+		Details:   errs,
+	})
+}
+
+// fieldErrors describes a decoding error per field
+func fieldErrors(err error) []models.FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []models.FieldError{{Field: typeErr.Field, Code: models.FieldType, Message: "must be " + describeType(typeErr.Type)}}
+	}
+
+	// encoding/json has no type for unknown field errors
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+		return []models.FieldError{{Field: name, Code: models.FieldUnknown, Message: "is not a known field"}}
+	}
+
+	return nil
+}
+
+// describeType names the JSON type that decodes into t
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
@@ -1,34 +1,185 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sander-remitly/pack-calc/internal/algorithm"
+	"github.com/sander-remitly/pack-calc/internal/auth"
 	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/coalesce"
+	"github.com/sander-remitly/pack-calc/internal/health"
+	"github.com/sander-remitly/pack-calc/internal/history"
+	"github.com/sander-remitly/pack-calc/internal/idempotency"
 	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
 	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/openapi"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
 	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/sander-remitly/pack-calc/internal/tracing"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 // Handler handles HTTP requests
 type Handler struct {
-	repo      *repo.Repository
-	cache     *cache.Cache
+	repo      repo.Store
+	cache     cache.Cache
+	calls     coalesce.Group[calculation]
+	warmer    *warmer.Warmer
+	history   *history.Writer
+	auth      *auth.Authenticator
+	limiter   *ratelimit.Limiter
+	idem      *idempotency.Guard
+	health    *health.Checker
+	security  SecurityConfig
+	spec      *openapi.Document
+	maxBody   int64
 	startTime time.Time
 }
 
+// Option configures optional Handler dependencies
+type Option func(*Handler)
+
+// WithWarmer sets the cache warmer used by the cache warm endpoints
+func WithWarmer(w *warmer.Warmer) Option {
+	return func(h *Handler) {
+		h.warmer = w
+	}
+}
+
+// WithHistoryWriter saves history entries through a batching writer
+// instead of one insert per request
+func WithHistoryWriter(w *history.Writer) Option {
+	return func(h *Handler) {
+		h.history = w
+	}
+}
+
+// WithAuth sets the authenticator that checks API keys and their scopes
+func WithAuth(a *auth.Authenticator) Option {
+	return func(h *Handler) {
+		h.auth = a
+	}
+}
+
+// WithRateLimiter sets the limiter for the rate limits and quotas
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(h *Handler) {
+		h.limiter = l
+	}
+}
+
+// WithIdempotency sets the guard that replays requests retried with an
+// Idempotency-Key
+func WithIdempotency(g *idempotency.Guard) Option {
+	return func(h *Handler) {
+		h.idem = g
+	}
+}
+
+// WithHealthChecker sets the checker behind the readiness and startup
+// probes
+func WithHealthChecker(c *health.Checker) Option {
+	return func(h *Handler) {
+		h.health = c
+	}
+}
+
+// WithSecurity sets the CORS policy and security headers, e.g. from
+// LoadSecurityConfig. Without it any origin may call the API, without
+// credentials.
+func WithSecurity(cfg SecurityConfig) Option {
+	return func(h *Handler) {
+		h.security = cfg.withDefaults()
+	}
+}
+
+// WithMaxBodyBytes sets the largest request body accepted; larger bodies
+// get 413
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.maxBody = n
+	}
+}
+
 // NewHandler creates a new API handler
-func NewHandler(repository *repo.Repository, cacheInstance *cache.Cache) *Handler {
-	return &Handler{
+func NewHandler(repository repo.Store, cacheInstance cache.Cache, opts ...Option) *Handler {
+	h := &Handler{
 		repo:      repository,
 		cache:     cacheInstance,
+		security:  SecurityConfig{}.withDefaults(),
+		spec:      Spec(),
 		startTime: time.Now(),
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.warmer == nil {
+		h.warmer = warmer.New(cacheInstance, repository, warmer.LoadConfig())
+	}
+	if h.auth == nil {
+		h.auth = auth.New(repository, auth.LoadConfig())
+	}
+	if h.limiter == nil {
+		h.limiter = ratelimit.New(ratelimit.NewMemoryStore(), repository, ratelimit.LoadConfig())
+	}
+	if h.idem == nil {
+		h.idem = idempotency.New(idempotency.NewSQLStore(repository), idempotency.LoadConfig())
+	}
+	if h.maxBody <= 0 {
+		h.maxBody = MaxBodyBytes()
+	}
+	if h.health == nil {
+		h.health = health.New(health.LoadConfig(), health.Dependencies{
+			Database: repository,
+			Cache:    cacheInstance,
+			History:  h.history,
+		})
+		// Nothing else would mark the startup done
+		h.health.MarkStarted()
+	}
+
+	return h
+}
+
+// Authenticator returns the API key authenticator, for other transports
+// to check keys the same way
+func (h *Handler) Authenticator() *auth.Authenticator {
+	return h.auth
+}
+
+// Limiter returns the rate limiter and quota counter, for other transports
+// to share the limits of the REST API
+func (h *Handler) Limiter() *ratelimit.Limiter {
+	return h.limiter
+}
+
+// Idempotency returns the idempotency key guard, for other transports to
+// share the keys of the REST API
+func (h *Handler) Idempotency() *idempotency.Guard {
+	return h.idem
+}
+
+// HealthChecker returns the readiness checks and startup state
+func (h *Handler) HealthChecker() *health.Checker {
+	return h.health
 }
 
 // SetupRouter configures the Chi router with all routes
@@ -39,22 +190,53 @@ func (h *Handler) SetupRouter() *chi.Mux {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(requestIDHeader)
 	r.Use(middleware.RealIP)
-	r.Use(corsMiddleware)
-
-	// API routes
+	r.Use(h.securityHeaders)
+	r.Use(h.cors)
+	r.Use(tracing.Middleware)
+	r.Use(metrics.Middleware)
+
+	// Prometheus metrics
+	r.Handle("/metrics", metrics.Handler())
+
+	// API routes; each scope is granted by an API key or, for requests
+	// without one, by the anonymous scopes. Calculations and admin
+	// endpoints are rate limited per client, and requests with a key to
+	// the endpoints other than health checks and docs count towards its
+	// daily quota once they pass the rate limit and validation. Bodies are
+	// capped at maxBody bytes, query parameters and bodies are validated
+	// against the OpenAPI document, and writes accept an Idempotency-Key so
+	// that retries are replayed rather than applied twice.
 	r.Route("/api", func(r chi.Router) {
-		r.Post("/calculate", h.HandleCalculate)
-		r.Get("/presets", h.HandlePresets)
-		r.Get("/history", h.HandleHistory)
-		r.Post("/history/clear", h.HandleClearHistory)
+		r.Use(h.limitBody)
+		r.Use(h.auth.Middleware)
+		require, limit, validate, quota, idempotent := h.auth.Require, h.limiter.Limit, h.spec.Middleware, h.limiter.Quota, h.idem.Middleware
+
+		r.With(require(auth.ScopeCalculate), limit(ratelimit.GroupCalculate), validate, quota, idempotent).Post("/calculate", h.HandleCalculate)
+		r.With(quota).Get("/presets", h.HandlePresets)
+		r.With(require(auth.ScopeReadHistory), validate, quota).Get("/history", h.HandleHistory)
+		r.With(require(auth.ScopeAdminHistory), limit(ratelimit.GroupAdmin), quota).Post("/history/clear", h.HandleClearHistory)
+		r.With(require(auth.ScopeReadHistory), validate, quota).Get("/stats", h.HandleStats)
 		r.Get("/health", h.HandleHealth)
-		r.Get("/packs/config", h.HandleGetPackConfig)
-		r.Post("/packs/config", h.HandleUpdatePackConfig)
+		r.Get("/health/live", h.HandleLiveness)
+		r.Get("/health/ready", h.HandleReadiness)
+		r.Get("/health/startup", h.HandleStartup)
+		r.With(quota).Get("/packs/config", h.HandleGetPackConfig)
+		r.With(require(auth.ScopeAdminConfig), limit(ratelimit.GroupAdmin), validate, quota, idempotent).Post("/packs/config", h.HandleUpdatePackConfig)
 
 		// Cache endpoints
-		r.Get("/cache/stats", h.HandleCacheStats)
-		r.Post("/cache/clear", h.HandleCacheClear)
+		r.Group(func(r chi.Router) {
+			r.Use(require(auth.ScopeAdminCache), limit(ratelimit.GroupAdmin), validate, quota)
+			r.Get("/cache/stats", h.HandleCacheStats)
+			r.Post("/cache/clear", h.HandleCacheClear)
+			r.Get("/cache/warm", h.HandleCacheWarmStatus)
+			r.Post("/cache/warm", h.HandleCacheWarm)
+		})
+
+		// API documentation
+		r.Get("/openapi.json", h.HandleOpenAPI)
+		r.Get("/docs", h.HandleDocs)
 	})
 
 	return r
@@ -62,110 +244,160 @@ func (h *Handler) SetupRouter() *chi.Mux {
 
 // HandleCalculate handles pack calculation requests
 func (h *Handler) HandleCalculate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "HandleCalculate")
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	var req models.CalculateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body", err)
+	if err := decodeJSON(r.Body, &req); err != nil {
+		respondInvalidBody(w, err)
 		return
 	}
 
-	// Validate input
-	if req.Items <= 0 {
-		respondError(w, http.StatusBadRequest, "Items must be greater than 0", nil)
+	response, err := h.Calculate(ctx, req, historyMetadata(r))
+	if err != nil {
+		respondServiceError(w, err)
 		return
 	}
 
-	// Get pack sizes (use provided or default from DB)
-	packSizes := req.PackSizes
-	if len(packSizes) == 0 {
-		var err error
-		packSizes, err = h.repo.GetPackSizes()
-		if err != nil {
-			respondError(w, http.StatusInternalServerError, "Failed to get pack sizes", err)
-			return
-		}
-	}
+	respondJSON(w, http.StatusOK, response)
+}
 
-	// Validate pack sizes
-	if !algorithm.Validate(packSizes) {
-		respondError(w, http.StatusBadRequest, "Invalid pack sizes", nil)
-		return
+// calculation is the outcome of a calculation shared by coalesced requests
+type calculation struct {
+	items     int
+	packSizes []int
+	result    algorithm.Result
+	duration  time.Duration
+}
+
+// calculate runs the optimizer and stores the result in the cache. The
+// history is left to the callers, since coalesced requests share one
+// calculation but each is recorded with its own metadata.
+func (h *Handler) calculate(ctx context.Context, items int, packSizes []int) calculation {
+	// Calculate
+	_, span := tracing.Start(ctx, "algorithm.Calculate", attribute.Int("items", items))
+	start := time.Now()
+	result := algorithm.Calculate(items, packSizes)
+	duration := time.Since(start)
+	span.SetAttributes(attribute.Int("dp_table_entries", result.TableSize), attribute.Int("waste", result.Waste))
+	span.End()
+	metrics.ObserveCalculation(items, duration, result)
+
+	// Save to cache
+	if err := h.cacheResult(ctx, items, packSizes, result, duration); err != nil {
+		logger.FromContext(ctx).Warn("Failed to cache result", zap.Error(err))
 	}
 
-	// Try to get from cache first
-	if cached, found := h.cache.Get(req.Items, packSizes); found {
-		logger.Log.Info("Cache HIT",
-			zap.Int("items", req.Items),
-			zap.Ints("pack_sizes", packSizes),
-			zap.Int("hit_count", cached.HitCount),
-			zap.Duration("ttl", cached.CurrentTTL),
-		)
+	return calculation{items: items, packSizes: packSizes, result: result, duration: duration}
+}
 
-		response := models.CalculateResponse{
-			Items:             cached.Items,
-			PackSizes:         cached.PackSizes,
-			Result:            cached.Result,
-			TotalItems:        cached.TotalItems,
-			TotalPacks:        cached.TotalPacks,
-			Waste:             cached.Waste,
-			CalculationTimeMs: cached.CalculationTimeMs,
-			Cached:            true,
-			CacheTTL:          cached.CurrentTTL.String(),
-			CacheHitCount:     cached.HitCount,
-		}
+// configuredPackSizes returns the pack sizes configured in the repository
+func (h *Handler) configuredPackSizes(ctx context.Context) ([]int, error) {
+	_, span := tracing.Start(ctx, "Repository.GetPackSizes")
+	defer span.End()
 
-		respondJSON(w, http.StatusOK, response)
-		return
-	}
+	packSizes, err := h.repo.GetPackSizes()
+	tracing.RecordError(span, err)
+	return packSizes, err
+}
 
-	logger.Log.Info("Cache MISS",
-		zap.Int("items", req.Items),
-		zap.Ints("pack_sizes", packSizes),
-	)
+// cachedResult looks a calculation up in the cache
+func (h *Handler) cachedResult(ctx context.Context, items int, packSizes []int) (*cache.CachedResult, bool) {
+	_, span := tracing.Start(ctx, "Cache.Get", attribute.Int("items", items))
+	defer span.End()
 
-	// Calculate
-	start := time.Now()
-	result := algorithm.Calculate(req.Items, packSizes)
-	duration := time.Since(start)
+	cached, found := h.cache.Get(items, packSizes)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	return cached, found
+}
 
-	// Save to cache
-	if err := h.cache.Set(
-		req.Items,
+// cacheResult stores a calculation in the cache
+func (h *Handler) cacheResult(ctx context.Context, items int, packSizes []int, result algorithm.Result, duration time.Duration) error {
+	_, span := tracing.Start(ctx, "Cache.Set", attribute.Int("items", items))
+	defer span.End()
+
+	err := h.cache.Set(
+		items,
 		packSizes,
 		result.PackCounts,
 		result.TotalItems,
 		result.TotalPacks,
 		result.Waste,
 		duration.Milliseconds(),
-	); err != nil {
-		logger.Log.Warn("Failed to cache result", zap.Error(err))
+	)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// historyMetadata returns a history entry holding who made the request
+// and how: the request ID, the client from the API key name, the common
+// name of a verified client certificate, the X-Client-ID header or the
+// client address, and the source from the X-Source header
+func historyMetadata(r *http.Request) models.HistoryEntry {
+	client := r.Header.Get("X-Client-ID")
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			client = cn
+		}
+	}
+	if key, ok := auth.FromContext(r.Context()); ok {
+		client = key.Name
+	}
+	if client == "" {
+		client = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client = host
+		}
 	}
 
-	// Save to history
-	if err := h.repo.SaveCalculation(
-		req.Items,
-		packSizes,
-		result.PackCounts,
-		result.TotalItems,
-		result.TotalPacks,
-		result.Waste,
-	); err != nil {
-		logger.Log.Warn("Failed to save calculation", zap.Error(err))
-		// Don't fail the request, just log
+	return HistoryMetadata(middleware.GetReqID(r.Context()), client, r.Header.Get("X-Source"))
+}
+
+// HistoryMetadata returns a history entry holding the request ID, the
+// client, cut to maxClientLength, the source (api unless it is another
+// known source) and the algorithm version
+func HistoryMetadata(requestID, client, source string) models.HistoryEntry {
+	if len(client) > maxClientLength {
+		client = client[:maxClientLength]
 	}
 
-	// Build response
-	response := models.CalculateResponse{
-		Items:             req.Items,
-		PackSizes:         packSizes,
-		Result:            result.PackCounts,
-		TotalItems:        result.TotalItems,
-		TotalPacks:        result.TotalPacks,
-		Waste:             result.Waste,
-		CalculationTimeMs: duration.Milliseconds(),
-		Cached:            false,
+	source = strings.ToLower(source)
+	switch source {
+	case models.SourceUI, models.SourceAPI, models.SourceBatch, models.SourceCLI:
+	default:
+		source = models.SourceAPI
 	}
 
-	respondJSON(w, http.StatusOK, response)
+	return models.HistoryEntry{
+		RequestID:        requestID,
+		Client:           client,
+		Source:           source,
+		AlgorithmVersion: algorithm.Version,
+	}
+}
+
+// recordHistory saves a calculation to the history, through the history
+// writer if there is one. Failures are logged, never returned: the request
+// has been answered either way.
+func (h *Handler) recordHistory(ctx context.Context, entry models.HistoryEntry) {
+	name := "Repository.SaveHistoryEntry"
+	if h.history != nil {
+		name = "history.Writer.Write"
+	}
+	ctx, span := tracing.Start(ctx, name)
+	defer span.End()
+
+	var err error
+	if h.history != nil {
+		err = h.history.Write(ctx, entry)
+	} else {
+		err = h.repo.SaveHistoryEntry(entry)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.FromContext(ctx).Warn("Failed to save calculation", zap.Error(err))
+	}
 }
 
 // HandlePresets returns predefined pack size configurations
@@ -176,18 +408,22 @@ func (h *Handler) HandlePresets(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, response)
 }
 
-// HandleHistory returns calculation history
+// HandleHistory returns calculation history, newest first unless sorted
+// otherwise. Query parameters filter the history and next_cursor pages
+// through it.
 func (h *Handler) HandleHistory(w http.ResponseWriter, r *http.Request) {
-	history, err := h.repo.GetHistory(20)
+	query, err := parseHistoryQuery(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get history", err)
+		respondError(w, http.StatusBadRequest, "Invalid history query", err)
 		return
 	}
 
-	response := models.HistoryResponse{
-		History: history,
-		Count:   len(history),
+	response, err := h.History(r.Context(), query)
+	if err != nil {
+		respondServiceError(w, err)
+		return
 	}
+
 	respondJSON(w, http.StatusOK, response)
 }
 
@@ -201,67 +437,158 @@ func (h *Handler) HandleClearHistory(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"message": "History cleared"})
 }
 
-// HandleHealth returns service health status
+// HandleStats returns history analytics for a time window (from, to and
+// bucket query parameters) and totals over the whole history
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	var query repo.StatsQuery
+	var err error
+	params := r.URL.Query()
+
+	if query.From, err = parseTimeParam(params, "from"); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid stats query", err)
+		return
+	}
+	if query.To, err = parseTimeParam(params, "to"); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid stats query", err)
+		return
+	}
+	query.Bucket = params.Get("bucket")
+
+	stats, err := h.repo.GetHistoryStats(query)
+	if errors.Is(err, repo.ErrInvalidQuery) {
+		respondError(w, http.StatusBadRequest, "Invalid stats query", err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get stats", err)
+		return
+	}
+
+	totals, err := h.repo.GetStats()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get stats", err)
+		return
+	}
+
+	response := models.StatsResponse{HistoryStats: stats}
+	response.AllTime.TotalCalculations, _ = totals["total_calculations"].(int)
+	response.AllTime.PackSizesCount, _ = totals["pack_sizes_count"].(int)
+	if latest, ok := totals["latest_calculation"].(time.Time); ok {
+		response.AllTime.LatestCalculation = &latest
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// HandleHealth returns service health status: the readiness checks plus
+// cache and history writer details. It answers 503 when a check is
+// unhealthy.
 func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Run(r.Context())
+
 	dbStatus := "connected"
-	if err := h.repo.Ping(); err != nil {
-		dbStatus = "disconnected"
+	for _, check := range report.Checks {
+		if check.Name == "database" && check.Status != health.StatusOK {
+			dbStatus = "disconnected"
+		}
 	}
 
 	uptime := time.Since(h.startTime).Round(time.Second).String()
 
+	cacheStatus := "disabled"
+	if h.cache.IsEnabled() {
+		cacheStatus = "enabled"
+	}
+
 	response := models.HealthResponse{
-		Status:    "ok",
+		Status:       string(report.Status),
+		Timestamp:    time.Now(),
+		Database:     dbStatus,
+		Cache:        cacheStatus,
+		CacheCircuit: h.circuitState(),
+		Uptime:       uptime,
+		Checks:       healthChecks(report),
+	}
+
+	if h.history != nil {
+		stats := h.history.Stats()
+		response.HistoryWriter = &models.HistoryWriterStats{
+			Policy:        stats.Policy,
+			QueueDepth:    stats.QueueDepth,
+			QueueCapacity: stats.QueueCapacity,
+			Written:       stats.Written,
+			Dropped:       stats.Dropped,
+			Failed:        stats.Failed,
+			Batches:       stats.Batches,
+		}
+	}
+
+	respondJSON(w, healthStatusCode(report.Status), response)
+}
+
+// HandleLiveness reports that the process is up and serving requests. It
+// checks no dependencies, so that a failing database or Redis does not
+// get the instance restarted.
+func (h *Handler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, models.HealthResponse{
+		Status:    string(health.StatusOK),
+		Timestamp: time.Now(),
+		Uptime:    time.Since(h.startTime).Round(time.Second).String(),
+	})
+}
+
+// HandleReadiness runs the dependency checks. Degraded instances still
+// answer 200 so that they keep getting traffic; unhealthy ones answer 503.
+func (h *Handler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Run(r.Context())
+
+	respondJSON(w, healthStatusCode(report.Status), models.HealthResponse{
+		Status:    string(report.Status),
 		Timestamp: time.Now(),
-		Database:  dbStatus,
-		Uptime:    uptime,
+		Checks:    healthChecks(report),
+	})
+}
+
+// HandleStartup answers 503 until migrations and the startup cache
+// warm-up are done, then 200
+func (h *Handler) HandleStartup(w http.ResponseWriter, r *http.Request) {
+	status, code := "starting", http.StatusServiceUnavailable
+	if h.health.Started() {
+		status, code = string(health.StatusOK), http.StatusOK
 	}
 
-	respondJSON(w, http.StatusOK, response)
+	respondJSON(w, code, models.HealthResponse{
+		Status:    status,
+		Timestamp: time.Now(),
+		Uptime:    time.Since(h.startTime).Round(time.Second).String(),
+	})
 }
 
 // HandleGetPackConfig returns the current pack configuration
 func (h *Handler) HandleGetPackConfig(w http.ResponseWriter, r *http.Request) {
-	packSizes, err := h.repo.GetPackSizes()
+	response, err := h.PackConfig(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get pack config", err)
+		respondServiceError(w, err)
 		return
 	}
 
-	response := models.PackConfig{
-		PackSizes: packSizes,
-		UpdatedAt: time.Now(),
-	}
-
 	respondJSON(w, http.StatusOK, response)
 }
 
 // HandleUpdatePackConfig updates the pack size configuration
 func (h *Handler) HandleUpdatePackConfig(w http.ResponseWriter, r *http.Request) {
 	var req models.ConfigUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body", err)
-		return
-	}
-
-	// Validate pack sizes
-	if !algorithm.Validate(req.PackSizes) {
-		respondError(w, http.StatusBadRequest, "Invalid pack sizes", nil)
+	if err := decodeJSON(r.Body, &req); err != nil {
+		respondInvalidBody(w, err)
 		return
 	}
 
-	// Update in database
-	if err := h.repo.SetPackSizes(req.PackSizes); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update pack config", err)
+	response, err := h.UpdatePackConfig(r.Context(), req)
+	if err != nil {
+		respondServiceError(w, err)
 		return
 	}
 
-	response := models.ConfigUpdateResponse{
-		PackSizes: req.PackSizes,
-		UpdatedAt: time.Now(),
-		Message:   "Pack sizes updated successfully",
-	}
-
 	respondJSON(w, http.StatusOK, response)
 }
 
@@ -274,30 +601,313 @@ func (h *Handler) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := models.CacheStatsResponse{
-		Enabled:    h.cache.IsEnabled(),
-		Hits:       stats.Hits,
-		Misses:     stats.Misses,
-		HitRate:    stats.HitRate,
-		TotalKeys:  stats.TotalKeys,
-		MemoryUsed: stats.MemoryUsed,
-		Uptime:     stats.Uptime,
+		Enabled:            h.cache.IsEnabled(),
+		Backend:            stats.Backend,
+		Hits:               stats.Hits,
+		Misses:             stats.Misses,
+		HitRate:            stats.HitRate,
+		TotalKeys:          stats.TotalKeys,
+		TotalKeysEstimated: stats.TotalKeysEstimated,
+		MemoryUsed:         stats.MemoryUsed,
+		Uptime:             stats.Uptime,
+		TTLPolicy:          stats.TTLPolicy,
+		Codec:              stats.Codec,
+		CircuitState:       h.circuitState(),
+		Coalescing:         coalescingStats(h.calls.Stats()),
+	}
+
+	for _, tier := range stats.Tiers {
+		response.Tiers = append(response.Tiers, models.CacheTierStats{
+			Backend:   tier.Backend,
+			Enabled:   tier.Enabled,
+			Hits:      tier.Hits,
+			Misses:    tier.Misses,
+			HitRate:   tier.HitRate,
+			TotalKeys: tier.TotalKeys,
+		})
 	}
 
 	respondJSON(w, http.StatusOK, response)
 }
 
-// HandleCacheClear clears all cache entries
+// HandleCacheClear clears all cache entries, or only the entries for one
+// pack set when the pack_sizes query parameter is given (e.g. ?pack_sizes=250,500)
 func (h *Handler) HandleCacheClear(w http.ResponseWriter, r *http.Request) {
+	if param := r.URL.Query().Get("pack_sizes"); param != "" {
+		packSizes, err := parsePackSizes(param)
+		if err != nil || !algorithm.Validate(packSizes) {
+			respondError(w, http.StatusBadRequest, "Invalid pack sizes", err)
+			return
+		}
+
+		deleted, err := h.cache.ClearPackSizes(packSizes)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to clear cache", err)
+			return
+		}
+
+		respondJSON(w, http.StatusOK, models.CacheClearResponse{
+			Message:   "Cache cleared for pack sizes",
+			PackSizes: packSizes,
+			Deleted:   deleted,
+		})
+		return
+	}
+
 	if err := h.cache.Clear(); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to clear cache", err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Cache cleared successfully"})
+	respondJSON(w, http.StatusOK, models.CacheClearResponse{Message: "Cache cleared successfully"})
+}
+
+// HandleCacheWarm starts a background cache warm-up and returns 202 with
+// its initial progress
+func (h *Handler) HandleCacheWarm(w http.ResponseWriter, r *http.Request) {
+	var req models.CacheWarmRequest
+	if err := decodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		respondInvalidBody(w, err)
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalidFields(w, errs)
+		return
+	}
+
+	err := h.warmer.Start(warmer.Job{
+		Top:       req.Top,
+		Items:     req.Items,
+		From:      req.From,
+		To:        req.To,
+		Step:      req.Step,
+		PackSizes: req.PackSizes,
+	})
+	switch {
+	case errors.Is(err, warmer.ErrInvalidJob):
+		respondError(w, http.StatusBadRequest, "Invalid warm-up request", err)
+		return
+	case errors.Is(err, warmer.ErrRunning):
+		respondError(w, http.StatusConflict, "Cache warm-up already running", nil)
+		return
+	case errors.Is(err, warmer.ErrCacheDisabled):
+		respondError(w, http.StatusServiceUnavailable, "Cache is disabled", nil)
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "Failed to start cache warm-up", err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, warmStatus(h.warmer.Progress()))
+}
+
+// HandleCacheWarmStatus returns the progress of the current or last cache warm-up
+func (h *Handler) HandleCacheWarmStatus(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, warmStatus(h.warmer.Progress()))
 }
 
 // Helper functions
 
+// healthChecks converts the outcome of the readiness checks for the API
+func healthChecks(report health.Report) []models.HealthCheck {
+	checks := make([]models.HealthCheck, len(report.Checks))
+	for i, result := range report.Checks {
+		checks[i] = models.HealthCheck{
+			Name:      result.Name,
+			Status:    string(result.Status),
+			LatencyMs: float64(result.Latency.Microseconds()) / 1000,
+			Error:     result.Error,
+		}
+	}
+	return checks
+}
+
+// healthStatusCode is the HTTP status of a health report: only unhealthy
+// instances answer 503
+func healthStatusCode(status health.Status) int {
+	if status == health.StatusUnhealthy {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// circuitState returns the cache circuit breaker state, if the cache has one
+func (h *Handler) circuitState() string {
+	if reporter, ok := h.cache.(cache.CircuitReporter); ok {
+		return string(reporter.CircuitState())
+	}
+	return ""
+}
+
+// trackPackSizes tells a config-aware cache the configured pack sizes, so
+// that TTL policies tied to the configuration follow changes made here or
+// by other instances
+func (h *Handler) trackPackSizes(packSizes []int) {
+	if aware, ok := h.cache.(cache.ConfigAware); ok {
+		aware.SetCurrentPackSizes(packSizes)
+	}
+}
+
+// cacheTTL formats the TTL of a cached result
+func cacheTTL(ttl time.Duration) string {
+	if ttl == cache.NoExpiry {
+		return "never"
+	}
+	return ttl.String()
+}
+
+// calculationKey normalizes a calculation request for coalescing
+func calculationKey(items int, packSizes []int) string {
+	sorted := make([]int, len(packSizes))
+	copy(sorted, packSizes)
+	sort.Ints(sorted)
+	return fmt.Sprintf("%d:%v", items, sorted)
+}
+
+// coalescingStats converts coalescing counters to the API model
+func coalescingStats(stats coalesce.Stats) models.CoalescingStats {
+	return models.CoalescingStats{
+		Calculations: stats.Executions,
+		Coalesced:    stats.Coalesced,
+		InFlight:     stats.InFlight,
+	}
+}
+
+// warmStatus converts warm-up progress to the API model
+func warmStatus(p warmer.Progress) models.CacheWarmStatus {
+	status := models.CacheWarmStatus{
+		State:     p.State,
+		Total:     p.Total,
+		Processed: p.Processed,
+		Warmed:    p.Warmed,
+		Skipped:   p.Skipped,
+		Failed:    p.Failed,
+		Error:     p.Error,
+	}
+	if !p.StartedAt.IsZero() {
+		status.StartedAt = &p.StartedAt
+	}
+	if !p.FinishedAt.IsZero() {
+		status.FinishedAt = &p.FinishedAt
+	}
+	return status
+}
+
+// parseTimeParam parses an optional RFC 3339 time or YYYY-MM-DD date
+// (midnight UTC) query parameter
+func parseTimeParam(params url.Values, name string) (time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
+}
+
+// parsePackSizes parses a comma-separated list of pack sizes
+func parsePackSizes(value string) ([]int, error) {
+	parts := strings.Split(value, ",")
+	sizes := make([]int, 0, len(parts))
+	for _, part := range parts {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pack size %q", part)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// maxClientLength bounds the client identity recorded in the history
+const maxClientLength = 128
+
+// parseHistoryQuery reads the GET /api/history query parameters:
+// limit, cursor, sort, order, from, to, min_items, max_items, pack_sizes,
+// min_waste, cached, request_id, client, source, algorithm_version and
+// min_duration_us. Dates are RFC 3339 or YYYY-MM-DD.
+func parseHistoryQuery(r *http.Request) (repo.HistoryQuery, error) {
+	params := r.URL.Query()
+	q := repo.HistoryQuery{
+		Limit:  repo.DefaultHistoryLimit,
+		Cursor: params.Get("cursor"),
+		Sort:   params.Get("sort"),
+		Order:  strings.ToLower(params.Get("order")),
+
+		RequestID:        params.Get("request_id"),
+		Client:           params.Get("client"),
+		Source:           strings.ToLower(params.Get("source")),
+		AlgorithmVersion: params.Get("algorithm_version"),
+	}
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"limit", &q.Limit},
+		{"min_items", &q.MinItems},
+		{"max_items", &q.MaxItems},
+		{"min_waste", &q.MinWaste},
+	}
+	for _, p := range ints {
+		value := params.Get(p.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("%s must be a non-negative integer", p.name)
+		}
+		*p.dest = n
+	}
+
+	if q.Limit == 0 || q.Limit > repo.MaxHistoryLimit {
+		return q, fmt.Errorf("limit must be between 1 and %d", repo.MaxHistoryLimit)
+	}
+	if q.MaxItems > 0 && q.MinItems > q.MaxItems {
+		return q, fmt.Errorf("min_items must not exceed max_items")
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTimeParam(params, "to"); err != nil {
+		return q, err
+	}
+
+	if value := params.Get("pack_sizes"); value != "" {
+		packSizes, err := parsePackSizes(value)
+		if err != nil {
+			return q, err
+		}
+		q.PackSizes = packSizes
+	}
+
+	if value := params.Get("min_duration_us"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("min_duration_us must be a non-negative integer")
+		}
+		q.MinDurationUs = n
+	}
+
+	if value := params.Get("cached"); value != "" {
+		cached, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, fmt.Errorf("cached must be true or false")
+		}
+		q.Cached = &cached
+	}
+
+	return q, nil
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -316,8 +926,9 @@ func respondError(w http.ResponseWriter, status int, message string, err error)
 	}
 
 	response := models.ErrorResponse{
-		Error: message,
-		Code:  status,
+		Error:     message,
+		Code:      status,
+		ErrorCode: models.ErrorCodeForStatus(status),
 	}
 
 	if err != nil {
@@ -327,17 +938,14 @@ func respondError(w http.ResponseWriter, status int, message string, err error)
 	respondJSON(w, status, response)
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// requestIDHeader returns the request ID set by middleware.RequestID in
+// the X-Request-Id response header, so that clients can find their
+// calculations in the history
+func requestIDHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
@@ -2,16 +2,34 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/sander-remitly/pack-calc/internal/algorithm"
+	"github.com/sander-remitly/pack-calc/internal/auth"
 	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/health"
+	"github.com/sander-remitly/pack-calc/internal/history"
+	"github.com/sander-remitly/pack-calc/internal/idempotency"
 	"github.com/sander-remitly/pack-calc/internal/logger"
 	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
 	"github.com/sander-remitly/pack-calc/internal/repo"
+	"github.com/sander-remitly/pack-calc/internal/tracing"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
 )
 
 func init() {
@@ -156,6 +174,70 @@ func TestHandleCalculate_DefaultPackSizes(t *testing.T) {
 	}
 }
 
+func TestHandleCalculate_CoalescesConcurrentRequests(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	const requests = 20
+	body, _ := json.Marshal(models.CalculateRequest{
+		Items:     500000,
+		PackSizes: []int{23, 31, 53},
+	})
+
+	var wg sync.WaitGroup
+	responses := make([]models.CalculateResponse, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/calculate", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.HandleCalculate(w, req)
+			json.NewDecoder(w.Body).Decode(&responses[i])
+		}(i)
+	}
+	wg.Wait()
+
+	coalesced := 0
+	for _, response := range responses {
+		if response.Result[53] != 9429 {
+			t.Errorf("Expected 9429 packs of 53, got %v", response.Result)
+		}
+		if response.Coalesced {
+			coalesced++
+		}
+	}
+
+	// Every request either ran the calculation or shared one
+	stats := handler.calls.Stats()
+	if stats.Executions+stats.Coalesced != requests {
+		t.Errorf("Expected %d requests accounted for, got %+v", requests, stats)
+	}
+
+	if int64(coalesced) != stats.Coalesced {
+		t.Errorf("Expected %d coalesced responses, got %d", stats.Coalesced, coalesced)
+	}
+
+	// Coalesced requests are recorded in the history too
+	entries, err := handler.repo.GetHistory(requests * 2)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(entries) != requests {
+		t.Errorf("Expected %d history entries, got %d", requests, len(entries))
+	}
+}
+
+func TestCalculationKey(t *testing.T) {
+	if calculationKey(250, []int{500, 250}) != calculationKey(250, []int{250, 500}) {
+		t.Error("Expected pack size order not to affect the key")
+	}
+
+	if calculationKey(250, []int{250, 500}) == calculationKey(251, []int{250, 500}) {
+		t.Error("Expected different items to produce different keys")
+	}
+}
+
 func TestHandlePresets(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -206,6 +288,371 @@ func TestHandleHealth(t *testing.T) {
 	}
 }
 
+func TestHandleCalculate_HistoryWriter(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	writer := history.New(handler.repo, history.Config{BatchSize: 10, FlushInterval: time.Hour})
+	handler.history = writer
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", bytes.NewBufferString(`{"items": 251, "pack_sizes": [250, 500]}`))
+		w := httptest.NewRecorder()
+		handler.HandleCalculate(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	// Entries wait in the queue until a batch fills or the writer closes
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	w := httptest.NewRecorder()
+	handler.HandleHealth(w, req)
+
+	var health models.HealthResponse
+	json.NewDecoder(w.Body).Decode(&health)
+	if health.HistoryWriter == nil {
+		t.Fatal("Expected history writer stats in the health response")
+	}
+	if queued := health.HistoryWriter.QueueDepth; queued != 3 {
+		t.Errorf("Expected 3 queued entries, got %d", queued)
+	}
+
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close history writer: %v", err)
+	}
+
+	entries, err := handler.repo.GetHistory(10)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 history entries after closing the writer, got %d", len(entries))
+	}
+	if stats := writer.Stats(); stats.Written != 3 || stats.Batches != 1 {
+		t.Errorf("Expected 3 entries written in 1 batch, got %+v", stats)
+	}
+}
+
+func TestHandleCalculate_HistoryMetadata(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := handler.SetupRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", bytes.NewBufferString(`{"items": 251, "pack_sizes": [250, 500]}`))
+	req.Header.Set("X-Client-ID", "acme")
+	req.Header.Set("X-Source", "UI")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	requestID := w.Header().Get("X-Request-Id")
+	if requestID == "" {
+		t.Fatal("Expected an X-Request-Id response header")
+	}
+
+	entries, err := handler.repo.GetHistory(10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 history entry, got %d (%v)", len(entries), err)
+	}
+	got := entries[0]
+	if got.RequestID != requestID || got.Client != "acme" || got.Source != models.SourceUI || got.AlgorithmVersion != algorithm.Version || got.DurationUs < 0 {
+		t.Errorf("Unexpected metadata: %+v", got)
+	}
+}
+
+func TestSetupRouter_Auth(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.auth = auth.New(handler.repo, auth.Config{Enabled: true, AnonymousScopes: []string{auth.ScopeCalculate}})
+	router := handler.SetupRouter()
+
+	key, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if _, err := handler.repo.CreateAPIKey(models.APIKey{Name: "ops", Prefix: prefix, Scopes: []string{auth.ScopeAdminConfig}}, hash); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{"public endpoint", http.MethodGet, "/api/health", "", http.StatusOK},
+		{"anonymous scope", http.MethodPost, "/api/calculate", "", http.StatusOK},
+		{"anonymous admin", http.MethodPost, "/api/packs/config", "", http.StatusUnauthorized},
+		{"anonymous history", http.MethodGet, "/api/history", "", http.StatusUnauthorized},
+		{"invalid key", http.MethodGet, "/api/health", "pk_invalid", http.StatusUnauthorized},
+		{"key with scope", http.MethodPost, "/api/packs/config", key, http.StatusOK},
+		{"key without scope", http.MethodPost, "/api/cache/clear", key, http.StatusForbidden},
+		{"key without anonymous scope", http.MethodPost, "/api/calculate", key, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"items": 251, "pack_sizes": [250, 500]}`
+			if tt.path == "/api/packs/config" {
+				// Unknown fields are rejected
+				body = `{"pack_sizes": [250, 500]}`
+			}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code < http.StatusBadRequest {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.Code != tt.wantStatus {
+				t.Errorf("Expected an error response with code %d, got %+v (%v)", tt.wantStatus, response, err)
+			}
+		})
+	}
+}
+
+func TestSetupRouter_RateLimit(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.limiter = ratelimit.New(ratelimit.NewMemoryStore(), handler.repo, ratelimit.Config{
+		Enabled: true,
+		Limits:  map[string]ratelimit.Limit{ratelimit.GroupCalculate: {Rate: 0.01, Burst: 2}},
+	})
+	router := handler.SetupRouter()
+
+	wantStatus := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, want := range wantStatus {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", bytes.NewBufferString(`{"items": 251}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Fatalf("Request %d: expected status %d, got %d", i+1, want, w.Code)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: expected rate limit headers, got %v", i+1, w.Header())
+		}
+	}
+
+	// Other route groups are limited separately
+	req := httptest.NewRequest(http.MethodGet, "/api/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected history to stay available, got %d", w.Code)
+	}
+}
+
+func TestSetupRouter_Quota(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.auth = auth.New(handler.repo, auth.Config{Enabled: true})
+	handler.limiter = ratelimit.New(ratelimit.NewMemoryStore(), handler.repo, ratelimit.Config{
+		Enabled: true,
+		Limits:  map[string]ratelimit.Limit{ratelimit.GroupCalculate: {Rate: 0.01, Burst: 2}},
+	})
+	router := handler.SetupRouter()
+
+	key, prefix, hash, _ := auth.NewKey()
+	if _, err := handler.repo.CreateAPIKey(models.APIKey{Name: "ci", Prefix: prefix, Scopes: []string{auth.ScopeCalculate}, DailyQuota: 10}, hash); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	// Only requests that pass the rate limit and validation on metered
+	// routes are charged
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{"health check", http.MethodGet, "/api/health", "", http.StatusOK, ""},
+		{"docs", http.MethodGet, "/api/openapi.json", "", http.StatusOK, ""},
+		{"invalid body", http.MethodPost, "/api/calculate", `{"items": "many"}`, http.StatusBadRequest, ""},
+		{"calculation", http.MethodPost, "/api/calculate", `{"items": 251}`, http.StatusOK, "9"},
+		{"rate limited", http.MethodPost, "/api/calculate", `{"items": 251}`, http.StatusTooManyRequests, ""},
+		{"presets", http.MethodGet, "/api/presets", "", http.StatusOK, "8"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.name, tt.wantStatus, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != tt.wantRemaining {
+			t.Errorf("%s: expected X-Quota-Remaining %q, got %q", tt.name, tt.wantRemaining, got)
+		}
+	}
+}
+
+func TestSetupRouter_Idempotency(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	router := handler.SetupRouter()
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set(idempotency.Header, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("/api/calculate", "order-1", `{"items": 251, "pack_sizes": [250, 500]}`)
+	retry := send("/api/calculate", "order-1", `{"items": 251, "pack_sizes": [250, 500]}`)
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 twice, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Errorf("Expected the retry replayed, got %v %s", retry.Header(), retry.Body.String())
+	}
+
+	entries, err := handler.repo.GetHistory(10)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected 1 history entry for the retried calculation, got %d (%v)", len(entries), err)
+	}
+
+	if w := send("/api/calculate", "order-1", `{"items": 500}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a reused key, got %d", w.Code)
+	}
+
+	// Config updates are applied once
+	send("/api/packs/config", "config-1", `{"pack_sizes": [100, 200]}`)
+	send("/api/packs/config", "config-2", `{"pack_sizes": [300, 400]}`)
+	if w := send("/api/packs/config", "config-1", `{"pack_sizes": [100, 200]}`); w.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Errorf("Expected the config update replayed, got %d %v", w.Code, w.Header())
+	}
+
+	sizes, err := handler.repo.GetPackSizes()
+	if err != nil || !reflect.DeepEqual(sizes, []int{300, 400}) {
+		t.Errorf("Expected the later config to stay, got %v (%v)", sizes, err)
+	}
+}
+
+func TestHistoryMetadata_ClientCertificate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", nil)
+	req.Header.Set("X-Client-ID", "acme")
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "billing-service"}},
+	}}}
+
+	// A verified certificate names the client better than a header
+	if meta := historyMetadata(req); meta.Client != "billing-service" {
+		t.Errorf("Expected client billing-service, got %q", meta.Client)
+	}
+}
+
+func TestHandleCalculate_HistoryClientFromAPIKey(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.auth = auth.New(handler.repo, auth.Config{Enabled: true})
+	router := handler.SetupRouter()
+
+	key, prefix, hash, _ := auth.NewKey()
+	handler.repo.CreateAPIKey(models.APIKey{Name: "ci", Prefix: prefix, Scopes: []string{auth.ScopeCalculate}}, hash)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", bytes.NewBufferString(`{"items": 251, "pack_sizes": [250, 500]}`))
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set("X-Client-ID", "someone-else")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	entries, err := handler.repo.GetHistory(10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 history entry, got %d (%v)", len(entries), err)
+	}
+	if entries[0].Client != "ci" {
+		t.Errorf("Expected the API key name as client, got %q", entries[0].Client)
+	}
+}
+
+func TestHistoryMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantClient string
+		wantSource string
+	}{
+		{"defaults", nil, "192.0.2.1", models.SourceAPI},
+		{"client header", map[string]string{"X-Client-ID": "acme"}, "acme", models.SourceAPI},
+		{"batch source", map[string]string{"X-Source": "batch"}, "192.0.2.1", models.SourceBatch},
+		{"unknown source", map[string]string{"X-Source": "cron"}, "192.0.2.1", models.SourceAPI},
+		{"long client", map[string]string{"X-Client-ID": strings.Repeat("x", 200)}, strings.Repeat("x", maxClientLength), models.SourceAPI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/calculate", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			meta := historyMetadata(req)
+			if meta.Client != tt.wantClient || meta.Source != tt.wantSource || meta.AlgorithmVersion != algorithm.Version {
+				t.Errorf("Expected client %q and source %q, got %+v", tt.wantClient, tt.wantSource, meta)
+			}
+		})
+	}
+}
+
+func TestHandleHealth_CacheStatus(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	w := httptest.NewRecorder()
+	handler.HandleHealth(w, req)
+
+	var response models.HealthResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if response.Cache != "disabled" {
+		t.Errorf("Expected cache 'disabled', got '%s'", response.Cache)
+	}
+
+	// A cache without a circuit breaker reports no circuit state
+	handler.cache = cache.NewMemoryCache(10, 0)
+	w = httptest.NewRecorder()
+	handler.HandleHealth(w, req)
+
+	response = models.HealthResponse{}
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if response.Cache != "enabled" {
+		t.Errorf("Expected cache 'enabled', got '%s'", response.Cache)
+	}
+
+	if response.CacheCircuit != "" {
+		t.Errorf("Expected no circuit state, got '%s'", response.CacheCircuit)
+	}
+}
+
 func TestHandleGetPackConfig(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -329,19 +776,442 @@ func TestHandleCacheClear(t *testing.T) {
 	}
 }
 
-func TestCorsMiddleware(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+func TestHandleCacheClear_PackSizes(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"Valid pack sizes", "?pack_sizes=250,500,1000", http.StatusOK},
+		{"Pack sizes with spaces", "?pack_sizes=23,%2031,%2053", http.StatusOK},
+		{"Non-numeric pack size", "?pack_sizes=250,abc", http.StatusBadRequest},
+		{"Zero pack size", "?pack_sizes=0,250", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/cache/clear"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.HandleCacheClear(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleCacheWarm(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// Warming a disabled cache is refused
+	req := httptest.NewRequest(http.MethodPost, "/api/cache/warm", nil)
+	w := httptest.NewRecorder()
+	handler.HandleCacheWarm(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 with caching disabled, got %d", w.Code)
+	}
+
+	memoryCache := cache.NewMemoryCache(100, 0)
+	handler.cache = memoryCache
+	handler.warmer = warmer.New(memoryCache, handler.repo, warmer.Config{})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"Invalid JSON", `{"items":`, http.StatusBadRequest},
+		{"Reversed range", `{"from":100,"to":1}`, http.StatusBadRequest},
+		{"Items list", `{"items":[250,501],"pack_sizes":[250,500]}`, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/cache/warm", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.HandleCacheWarm(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+
+	// Poll the status endpoint until the warm-up finishes
+	var status models.CacheWarmStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for status.State != warmer.StateCompleted && time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		handler.HandleCacheWarmStatus(w, httptest.NewRequest(http.MethodGet, "/api/cache/warm", nil))
+		status = models.CacheWarmStatus{}
+		json.NewDecoder(w.Body).Decode(&status)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status.State != warmer.StateCompleted || status.Warmed != 2 {
+		t.Fatalf("Expected 2 entries warmed, got %+v", status)
+	}
+
+	if !memoryCache.Contains(501, []int{250, 500}) {
+		t.Error("Expected warmed result to be cached")
+	}
+}
+
+func TestHandleCalculate_NeverTTLPolicy(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.cache = cache.New(cache.Config{
+		Backend: cache.BackendMemory,
+		TTL:     cache.TTLConfig{Policy: cache.TTLNever, Initial: time.Minute, Max: time.Hour, Factor: 2},
 	})
 
-	wrapped := corsMiddleware(handler)
+	// Calculations with the configured pack sizes are pinned in the cache
+	var response models.CalculateResponse
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items": 251}`))
+		w := httptest.NewRecorder()
+		handler.HandleCalculate(w, req)
+
+		response = models.CalculateResponse{}
+		json.NewDecoder(w.Body).Decode(&response)
+	}
+
+	if !response.Cached || response.CacheTTL != "never" {
+		t.Errorf("Expected cached result that never expires, got cached=%v ttl=%q", response.Cached, response.CacheTTL)
+	}
+
+	// Updating the configuration releases the pinned entries
+	req := httptest.NewRequest(http.MethodPost, "/api/packs/config", strings.NewReader(`{"pack_sizes": [23, 31, 53]}`))
+	handler.HandleUpdatePackConfig(httptest.NewRecorder(), req)
+
+	if handler.cache.Contains(251, response.PackSizes) {
+		t.Error("Expected entries for the previous configuration to be removed")
+	}
+
+	w := httptest.NewRecorder()
+	handler.HandleCacheStats(w, httptest.NewRequest(http.MethodGet, "/api/cache/stats", nil))
+
+	var stats models.CacheStatsResponse
+	json.NewDecoder(w.Body).Decode(&stats)
+	if !strings.HasPrefix(stats.TTLPolicy, cache.TTLNever) {
+		t.Errorf("Expected never policy in cache stats, got %q", stats.TTLPolicy)
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.cache = cache.New(cache.Config{Backend: cache.BackendMemory})
+
+	// 251 is calculated, then served from the cache
+	for _, body := range []string{
+		`{"items": 251, "pack_sizes": [250, 500]}`,
+		`{"items": 251, "pack_sizes": [250, 500]}`,
+		`{"items": 263, "pack_sizes": [23, 31, 53]}`,
+		`{"items": 12001, "pack_sizes": [250, 500, 1000, 2000, 5000]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body))
+		handler.HandleCalculate(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantItems  []int
+		wantCursor bool
+	}{
+		{"Default", "", http.StatusOK, []int{12001, 263, 251, 251}, false},
+		{"Cached only", "?cached=true", http.StatusOK, []int{251}, false},
+		{"Computed only", "?cached=false&min_items=252", http.StatusOK, []int{12001, 263}, false},
+		{"Pack set", "?pack_sizes=53,23,31", http.StatusOK, []int{263}, false},
+		{"Waste threshold", "?min_waste=200&sort=items&order=asc", http.StatusOK, []int{251, 251, 12001}, false},
+		{"First page", "?limit=3", http.StatusOK, []int{12001, 263, 251}, true},
+		{"Date range", "?from=2000-01-01&to=2000-01-02", http.StatusOK, nil, false},
+		{"Source", "?source=API&client=192.0.2.1", http.StatusOK, []int{12001, 263, 251, 251}, false},
+		{"Other source", "?source=ui", http.StatusOK, nil, false},
+		{"Algorithm version", "?algorithm_version=dp-0", http.StatusOK, nil, false},
+		{"Invalid limit", "?limit=0", http.StatusBadRequest, nil, false},
+		{"Invalid cached", "?cached=sometimes", http.StatusBadRequest, nil, false},
+		{"Invalid date", "?from=yesterday", http.StatusBadRequest, nil, false},
+		{"Invalid items range", "?min_items=10&max_items=5", http.StatusBadRequest, nil, false},
+		{"Invalid sort", "?sort=result", http.StatusBadRequest, nil, false},
+		{"Invalid cursor", "?cursor=abc", http.StatusBadRequest, nil, false},
+		{"Invalid duration", "?min_duration_us=-5", http.StatusBadRequest, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/history"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.HandleHistory(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response models.HistoryResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			var items []int
+			for _, entry := range response.History {
+				items = append(items, entry.Items)
+			}
+			if fmt.Sprint(items) != fmt.Sprint(tt.wantItems) {
+				t.Errorf("Expected items %v, got %v", tt.wantItems, items)
+			}
+			if response.Count != len(tt.wantItems) {
+				t.Errorf("Expected count %d, got %d", len(tt.wantItems), response.Count)
+			}
+			if (response.NextCursor != "") != tt.wantCursor {
+				t.Errorf("Expected next cursor %v, got %q", tt.wantCursor, response.NextCursor)
+			}
+		})
+	}
+
+	// The cursor continues where the first page ended
+	w := httptest.NewRecorder()
+	handler.HandleHistory(w, httptest.NewRequest(http.MethodGet, "/api/history?limit=3", nil))
+	var first models.HistoryResponse
+	json.NewDecoder(w.Body).Decode(&first)
+
+	w = httptest.NewRecorder()
+	handler.HandleHistory(w, httptest.NewRequest(http.MethodGet, "/api/history?limit=3&cursor="+first.NextCursor, nil))
+	var second models.HistoryResponse
+	json.NewDecoder(w.Body).Decode(&second)
+
+	if second.Count != 1 || second.History[0].ID >= first.History[2].ID || second.NextCursor != "" {
+		t.Errorf("Expected the last entry on the second page, got %+v", second)
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.cache = cache.New(cache.Config{Backend: cache.BackendMemory})
+
+	for _, body := range []string{
+		`{"items": 251, "pack_sizes": [250, 500]}`,
+		`{"items": 251, "pack_sizes": [250, 500]}`,
+		`{"items": 12001, "pack_sizes": [250, 500, 1000, 2000, 5000]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body))
+		handler.HandleCalculate(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCalcs  int
+		wantBucket string
+	}{
+		{"Default window", "", http.StatusOK, 3, "day"},
+		{"Last day hourly", "?from=" + url.QueryEscape(time.Now().Add(-24*time.Hour).Format(time.RFC3339)), http.StatusOK, 3, "hour"},
+		{"Past window", "?from=2000-01-01&to=2000-01-08", http.StatusOK, 0, "day"},
+		{"Invalid date", "?from=last-week", http.StatusBadRequest, 0, ""},
+		{"Invalid bucket", "?bucket=minute", http.StatusBadRequest, 0, ""},
+		{"Too many buckets", "?from=2000-01-01&bucket=hour", http.StatusBadRequest, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.HandleStats(w, httptest.NewRequest(http.MethodGet, "/api/stats"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response models.StatsResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Calculations != tt.wantCalcs || response.Bucket != tt.wantBucket {
+				t.Errorf("Expected %d calculations in %s buckets, got %d in %s", tt.wantCalcs, tt.wantBucket, response.Calculations, response.Bucket)
+			}
+			if response.AllTime.TotalCalculations != 3 || response.AllTime.LatestCalculation == nil {
+				t.Errorf("Unexpected all-time stats: %+v", response.AllTime)
+			}
+			if tt.wantCalcs > 0 && (response.CachedCalculations != 1 || len(response.PackSizes) == 0 || len(response.OrderSizes) == 0) {
+				t.Errorf("Expected cache share and distributions, got %+v", response.HistoryStats)
+			}
+		})
+	}
+}
+
+func TestSetupRouter_Metrics(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	router := handler.SetupRouter()
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items": 251}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
 	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	for _, want := range []string{
+		`packcalc_http_requests_total{method="POST",route="/api/calculate",status="200"}`,
+		`packcalc_calculation_duration_seconds_count{order_size="1-999"}`,
+		`packcalc_dp_table_entries_count`,
+		`packcalc_history_write_duration_seconds_count`,
+		`packcalc_build_info{`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %s in the metrics", want)
+		}
+	}
+}
 
-	wrapped.ServeHTTP(w, req)
+func TestSetupRouter_Tracing(t *testing.T) {
+	spans := tracing.InMemory()
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
 
-	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
-		t.Error("Expected CORS header to be set")
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items": 251}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.SetupRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	// Every span continues the trace of the traceparent header
+	got := make(map[string]bool)
+	for _, span := range spans.GetSpans() {
+		got[span.Name] = true
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("Expected span %s in trace %s, got %s", span.Name, traceID, span.SpanContext.TraceID())
+		}
+	}
+	for _, name := range []string{
+		"POST /api/calculate",
+		"HandleCalculate",
+		"Repository.GetPackSizes",
+		"Cache.Get",
+		"algorithm.Calculate",
+		"Cache.Set",
+		"Repository.SaveHistoryEntry",
+	} {
+		if !got[name] {
+			t.Errorf("Expected a %s span, got %v", name, got)
+		}
+	}
+}
+
+func TestHealthProbes_DatabaseDown(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := handler.SetupRouter()
+
+	handler.repo.Close()
+
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantStatus string
+	}{
+		{"/api/health/live", http.StatusOK, "ok"},
+		{"/api/health/ready", http.StatusServiceUnavailable, "unhealthy"},
+		{"/api/health", http.StatusServiceUnavailable, "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.wantCode, w.Code)
+		}
+
+		var response models.HealthResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.path, err)
+		}
+		if response.Status != tt.wantStatus {
+			t.Errorf("%s: expected status %q, got %q", tt.path, tt.wantStatus, response.Status)
+		}
+	}
+}
+
+func TestHandleReadiness_Checks(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	checker := health.New(health.Config{}, health.Dependencies{Database: handler.repo})
+	checker.Add("redis", func(context.Context) (health.Status, error) {
+		return health.StatusDegraded, fmt.Errorf("connection refused")
+	})
+	handler.health = checker
+
+	w := httptest.NewRecorder()
+	handler.HandleReadiness(w, httptest.NewRequest(http.MethodGet, "/api/health/ready", nil))
+
+	// Degraded instances keep getting traffic
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response models.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "degraded" || len(response.Checks) != 2 {
+		t.Fatalf("Expected a degraded report with 2 checks, got %+v", response)
+	}
+	if db := response.Checks[0]; db.Name != "database" || db.Status != "ok" || db.LatencyMs < 0 {
+		t.Errorf("Expected an ok database check, got %+v", db)
+	}
+	if redis := response.Checks[1]; redis.Status != "degraded" || redis.Error != "connection refused" {
+		t.Errorf("Expected a degraded redis check with its error, got %+v", redis)
+	}
+}
+
+func TestHandleStartup(t *testing.T) {
+	repository, err := repo.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repository.Close()
+
+	checker := health.New(health.Config{}, health.Dependencies{Database: repository})
+	handler := NewHandler(repository, cache.NewMemoryCache(10, 0), WithHealthChecker(checker))
+
+	w := httptest.NewRecorder()
+	handler.HandleStartup(w, httptest.NewRequest(http.MethodGet, "/api/health/startup", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"starting"`) {
+		t.Errorf("Expected 503 starting before startup, got %d: %s", w.Code, w.Body.String())
+	}
+
+	checker.MarkStarted()
+	w = httptest.NewRecorder()
+	handler.HandleStartup(w, httptest.NewRequest(http.MethodGet, "/api/health/startup", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after startup, got %d", w.Code)
 	}
 }
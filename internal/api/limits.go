@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+// DefaultMaxBodyBytes is the request body limit unless
+// MAX_REQUEST_BODY_BYTES sets another
+const DefaultMaxBodyBytes = 1 << 20
+
+// MaxBodyBytes returns the request body limit from MAX_REQUEST_BODY_BYTES
+func MaxBodyBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_REQUEST_BODY_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return DefaultMaxBodyBytes
+}
+
+// limitBody caps request bodies at h.maxBody bytes. Bodies that declare a
+// larger Content-Length are rejected up front; the rest fail with an
+// *http.MaxBytesError when read past the limit, which the validation
+// middleware and respondInvalidBody answer with 413.
+func (h *Handler) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > h.maxBody {
+			respondJSON(w, http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Error:     "Request body too large",
+				Message:   fmt.Sprintf("request body must not exceed %d bytes", h.maxBody),
+				Code:      http.StatusRequestEntityTooLarge,
+				ErrorCode: models.ErrorCodeBodyTooLarge,
+			})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBody)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/openapi"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// operation documents one route of the API. SetupRouter registers the
+// routes themselves; TestOpenAPI_MatchesRouter keeps the two in sync.
+type operation struct {
+	method   string
+	path     string
+	id       string
+	summary  string
+	tag      string
+	scope    string // API key scope, if the route needs one
+	params   []openapi.Parameter
+	request  any  // Request body model, if any
+	optional bool // Whether the request body may be omitted
+	status   int  // Success status
+	response any  // Success response model; nil for HTML
+	probe    bool // Whether the response model also comes with 503, as for health probes
+}
+
+// operations lists every route under /api
+var operations = []operation{
+	{
+		method: http.MethodPost, path: "/api/calculate", id: "calculate", tag: "Calculations",
+		summary: "Calculate the packs for an order",
+		scope:   auth.ScopeCalculate, request: models.CalculateRequest{},
+		status: http.StatusOK, response: models.CalculateResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/presets", id: "listPresets", tag: "Configuration",
+		summary: "List predefined pack size configurations",
+		status:  http.StatusOK, response: models.PresetsResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/history", id: "queryHistory", tag: "History",
+		summary: "Query the calculation history",
+		scope:   auth.ScopeReadHistory, params: historyParams,
+		status: http.StatusOK, response: models.HistoryResponse{},
+	},
+	{
+		method: http.MethodPost, path: "/api/history/clear", id: "clearHistory", tag: "History",
+		summary: "Delete the calculation history",
+		scope:   auth.ScopeAdminHistory,
+		status:  http.StatusOK, response: map[string]string{},
+	},
+	{
+		method: http.MethodGet, path: "/api/stats", id: "getStats", tag: "History",
+		summary: "Analyse the history over a time window",
+		scope:   auth.ScopeReadHistory, params: statsParams,
+		status: http.StatusOK, response: models.StatsResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/health", id: "getHealth", tag: "Service",
+		summary: "Report service health",
+		status:  http.StatusOK, response: models.HealthResponse{}, probe: true,
+	},
+	{
+		method: http.MethodGet, path: "/api/health/live", id: "getLiveness", tag: "Service",
+		summary: "Liveness probe",
+		status:  http.StatusOK, response: models.HealthResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/health/ready", id: "getReadiness", tag: "Service",
+		summary: "Readiness probe with dependency checks",
+		status:  http.StatusOK, response: models.HealthResponse{}, probe: true,
+	},
+	{
+		method: http.MethodGet, path: "/api/health/startup", id: "getStartup", tag: "Service",
+		summary: "Startup probe",
+		status:  http.StatusOK, response: models.HealthResponse{}, probe: true,
+	},
+	{
+		method: http.MethodGet, path: "/api/packs/config", id: "getPackConfig", tag: "Configuration",
+		summary: "Get the configured pack sizes",
+		status:  http.StatusOK, response: models.PackConfig{},
+	},
+	{
+		method: http.MethodPost, path: "/api/packs/config", id: "updatePackConfig", tag: "Configuration",
+		summary: "Replace the configured pack sizes",
+		scope:   auth.ScopeAdminConfig, request: models.ConfigUpdateRequest{},
+		status: http.StatusOK, response: models.ConfigUpdateResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/cache/stats", id: "getCacheStats", tag: "Cache",
+		summary: "Report cache statistics",
+		scope:   auth.ScopeAdminCache,
+		status:  http.StatusOK, response: models.CacheStatsResponse{},
+	},
+	{
+		method: http.MethodPost, path: "/api/cache/clear", id: "clearCache", tag: "Cache",
+		summary: "Clear the cache, or the entries of one pack set",
+		scope:   auth.ScopeAdminCache,
+		params: []openapi.Parameter{
+			query("pack_sizes", "Comma-separated pack sizes whose entries to clear, e.g. 250,500", &openapi.Schema{Type: "string"}),
+		},
+		status: http.StatusOK, response: models.CacheClearResponse{},
+	},
+	{
+		method: http.MethodGet, path: "/api/cache/warm", id: "getCacheWarmStatus", tag: "Cache",
+		summary: "Report the progress of the current or last cache warm-up",
+		scope:   auth.ScopeAdminCache,
+		status:  http.StatusOK, response: models.CacheWarmStatus{},
+	},
+	{
+		method: http.MethodPost, path: "/api/cache/warm", id: "warmCache", tag: "Cache",
+		summary: "Start a background cache warm-up",
+		scope:   auth.ScopeAdminCache, request: models.CacheWarmRequest{}, optional: true,
+		status: http.StatusAccepted, response: models.CacheWarmStatus{},
+	},
+	{
+		method: http.MethodGet, path: "/api/openapi.json", id: "getOpenAPI", tag: "Service",
+		summary: "Get this OpenAPI document",
+		status:  http.StatusOK, response: map[string]any{},
+	},
+	{
+		method: http.MethodGet, path: "/api/docs", id: "getDocs", tag: "Service",
+		summary: "Browse this OpenAPI document",
+		status:  http.StatusOK,
+	},
+}
+
+// historyParams are the query parameters of GET /api/history
+var historyParams = []openapi.Parameter{
+	query("limit", "Page size", &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(repo.MaxHistoryLimit)}),
+	query("cursor", "next_cursor of the previous page", &openapi.Schema{Type: "string"}),
+	query("sort", "Sort field", &openapi.Schema{Type: "string", Enum: []string{repo.SortTimestamp, repo.SortItems, repo.SortWaste, repo.SortTotalPacks, repo.SortDuration}}),
+	query("order", "asc or desc", &openapi.Schema{Type: "string"}),
+	query("from", "Earliest timestamp, RFC 3339 or YYYY-MM-DD", &openapi.Schema{Type: "string"}),
+	query("to", "Latest timestamp, RFC 3339 or YYYY-MM-DD", &openapi.Schema{Type: "string"}),
+	query("min_items", "Smallest order size", &openapi.Schema{Type: "integer", Minimum: float(0)}),
+	query("max_items", "Largest order size", &openapi.Schema{Type: "integer", Minimum: float(0)}),
+	query("pack_sizes", "Comma-separated pack sizes used", &openapi.Schema{Type: "string"}),
+	query("min_waste", "Smallest waste", &openapi.Schema{Type: "integer", Minimum: float(0)}),
+	query("cached", "Whether the result came from the cache", &openapi.Schema{Type: "boolean"}),
+	query("request_id", "X-Request-Id of the calculation", &openapi.Schema{Type: "string"}),
+	query("client", "Client that asked", &openapi.Schema{Type: "string"}),
+	query("source", "ui, api, batch or cli", &openapi.Schema{Type: "string"}),
+	query("algorithm_version", "Algorithm version that produced the result", &openapi.Schema{Type: "string"}),
+	query("min_duration_us", "Shortest calculation time in microseconds", &openapi.Schema{Type: "integer", Minimum: float(0)}),
+}
+
+// statsParams are the query parameters of GET /api/stats
+var statsParams = []openapi.Parameter{
+	query("from", "Start of the window, RFC 3339 or YYYY-MM-DD", &openapi.Schema{Type: "string"}),
+	query("to", "End of the window, RFC 3339 or YYYY-MM-DD", &openapi.Schema{Type: "string"}),
+	query("bucket", "Series bucket", &openapi.Schema{Type: "string", Enum: []string{repo.BucketHour, repo.BucketDay}}),
+}
+
+// Spec returns the OpenAPI document of the API
+var Spec = sync.OnceValue(buildSpec)
+
+func buildSpec() *openapi.Document {
+	schemas := openapi.NewSchemas()
+	errorResponse := openapi.Response{
+		Description: "Error",
+		Content:     jsonContent(schemas.For(models.ErrorResponse{})),
+	}
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Pack Calculator API",
+			Description: "Calculates the packs that fulfil an order with the fewest items, then the fewest packs.",
+			Version:     "1.0.0",
+		},
+		Paths: make(map[string]*openapi.PathItem),
+	}
+
+	for _, o := range operations {
+		op := &openapi.Operation{
+			OperationID: o.id,
+			Summary:     o.summary,
+			Tags:        []string{o.tag},
+			Parameters:  o.params,
+			Responses:   map[string]openapi.Response{"default": errorResponse},
+		}
+
+		success := openapi.Response{Description: http.StatusText(o.status)}
+		if o.response != nil {
+			success.Content = jsonContent(schemas.For(o.response))
+		} else {
+			success.Content = map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}
+		}
+		op.Responses[strconv.Itoa(o.status)] = success
+		if o.probe {
+			op.Responses[strconv.Itoa(http.StatusServiceUnavailable)] = openapi.Response{
+				Description: http.StatusText(http.StatusServiceUnavailable),
+				Content:     success.Content,
+			}
+		}
+
+		if o.request != nil {
+			op.RequestBody = &openapi.RequestBody{Required: !o.optional, Content: jsonContent(schemas.For(o.request))}
+		}
+
+		if o.scope != "" {
+			op.Scope = o.scope
+			op.Description = "Requires the " + o.scope + " scope."
+			op.Security = []map[string][]string{{"ApiKey": {}}, {"Bearer": {}}}
+			if o.scope == auth.ScopeCalculate || o.scope == auth.ScopeReadHistory {
+				// Granted to anonymous requests unless AUTH_ANONYMOUS_SCOPES says otherwise
+				op.Description += " Anonymous requests have it by default."
+				op.Security = append(op.Security, map[string][]string{})
+			}
+		}
+
+		item, ok := doc.Paths[o.path]
+		if !ok {
+			item = &openapi.PathItem{}
+			doc.Paths[o.path] = item
+		}
+		(*item)[strings.ToLower(o.method)] = op
+	}
+
+	doc.Components = openapi.Components{
+		Schemas: schemas.Components(),
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"ApiKey": {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key created with packcalc keys create"},
+			"Bearer": {Type: "http", Scheme: "bearer", Description: "API key as a bearer token"},
+		},
+	}
+
+	return doc
+}
+
+// query describes a query parameter
+func query(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: schema}}
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// HandleOpenAPI returns the OpenAPI document of the API
+func (h *Handler) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.spec)
+}
+
+// HandleDocs serves a Swagger UI page for the OpenAPI document
+func (h *Handler) HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/warmer"
+)
+
+// TestOpenAPI_MatchesRouter fails when a route under /api is added to
+// SetupRouter without documenting it in operations, or the other way round
+func TestOpenAPI_MatchesRouter(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var routed []string
+	err := chi.Walk(handler.SetupRouter(), func(method, route string, h http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, "/api/") {
+			routed = append(routed, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk the router: %v", err)
+	}
+
+	var documented []string
+	for path, item := range Spec().Paths {
+		for method := range *item {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(routed)
+	sort.Strings(documented)
+	if !reflect.DeepEqual(routed, documented) {
+		t.Errorf("Routes and OpenAPI document differ:\nrouted:     %v\ndocumented: %v", routed, documented)
+	}
+}
+
+// TestOpenAPI_Responses sends a request to every documented operation and
+// fails when a response does not match the schema the document gives it
+func TestOpenAPI_Responses(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	memoryCache := cache.NewMemoryCache(100, 0)
+	handler.cache = memoryCache
+	handler.warmer = warmer.New(memoryCache, handler.repo, warmer.Config{})
+	router := handler.SetupRouter()
+	spec := Spec()
+
+	// In order: later requests read what earlier ones wrote
+	requests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{http.MethodPost, "/api/calculate", `{"items": 251, "pack_sizes": [250, 500]}`, http.StatusOK},
+		{http.MethodPost, "/api/calculate", `{"items": 0}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/presets", "", http.StatusOK},
+		{http.MethodGet, "/api/history?limit=5", "", http.StatusOK},
+		{http.MethodGet, "/api/stats?bucket=day", "", http.StatusOK},
+		{http.MethodGet, "/api/health", "", http.StatusOK},
+		{http.MethodGet, "/api/health/live", "", http.StatusOK},
+		{http.MethodGet, "/api/health/ready", "", http.StatusOK},
+		{http.MethodGet, "/api/health/startup", "", http.StatusOK},
+		{http.MethodPost, "/api/packs/config", `{"pack_sizes": [23, 31, 53]}`, http.StatusOK},
+		{http.MethodGet, "/api/packs/config", "", http.StatusOK},
+		{http.MethodGet, "/api/cache/stats", "", http.StatusOK},
+		{http.MethodPost, "/api/cache/warm", `{"items": [263]}`, http.StatusAccepted},
+		{http.MethodGet, "/api/cache/warm", "", http.StatusOK},
+		{http.MethodPost, "/api/cache/clear?pack_sizes=250,500", "", http.StatusOK},
+		{http.MethodPost, "/api/history/clear", "", http.StatusOK},
+		{http.MethodGet, "/api/openapi.json", "", http.StatusOK},
+		{http.MethodGet, "/api/docs", "", http.StatusOK},
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range requests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			op := spec.Operation(tt.method, req.URL.Path)
+			if op == nil {
+				t.Fatal("Operation is not documented")
+			}
+			covered[tt.method+" "+req.URL.Path] = true
+
+			response, ok := op.Responses[strconv.Itoa(w.Code)]
+			if !ok {
+				response = op.Responses["default"]
+			}
+			media, ok := response.Content["application/json"]
+			if !ok {
+				if _, ok := response.Content[strings.Split(w.Header().Get("Content-Type"), ";")[0]]; !ok {
+					t.Errorf("Content type %q is not documented", w.Header().Get("Content-Type"))
+				}
+				return
+			}
+
+			dec := json.NewDecoder(w.Body)
+			dec.UseNumber()
+			var body any
+			if err := dec.Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if errs := spec.Validate(media.Schema, body); len(errs) > 0 {
+				t.Errorf("Response does not match the document: %+v", errs)
+			}
+		})
+	}
+
+	for _, o := range operations {
+		if !covered[o.method+" "+o.path] {
+			t.Errorf("No request covers %s %s", o.method, o.path)
+		}
+	}
+}
+
+func TestSetupRouter_Validation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	router := handler.SetupRouter()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		wantError   string
+		wantDetails []models.FieldError
+	}{
+		{
+			name: "Unknown field", method: http.MethodPost, path: "/api/calculate",
+			body:        `{"items": 251, "packs": [250]}`,
+			wantError:   "Invalid request body",
+			wantDetails: []models.FieldError{{Field: "packs", Code: models.FieldUnknown, Message: "is not a known field"}},
+		},
+		{
+			name: "Wrong types", method: http.MethodPost, path: "/api/calculate",
+			body:      `{"items": "251", "pack_sizes": [250, -1]}`,
+			wantError: "Invalid request body",
+			wantDetails: []models.FieldError{
+				{Field: "items", Code: models.FieldType, Message: "must be an integer"},
+				{Field: "pack_sizes[1]", Code: models.FieldTooSmall, Message: "must be at least 1"},
+			},
+		},
+		{
+			name: "Limits", method: http.MethodPost, path: "/api/calculate",
+			body:      `{"items": 1000001, "pack_sizes": [250, 2000000, 250]}`,
+			wantError: "Invalid request body",
+			wantDetails: []models.FieldError{
+				{Field: "items", Code: models.FieldTooLarge, Message: "must be at most 1000000"},
+				{Field: "pack_sizes[1]", Code: models.FieldTooLarge, Message: "must be at most 1000000"},
+				{Field: "pack_sizes[2]", Code: models.FieldDuplicate, Message: "repeats pack_sizes[0]"},
+			},
+		},
+		{
+			name: "Missing field", method: http.MethodPost, path: "/api/packs/config",
+			body:        `{}`,
+			wantError:   "Invalid request body",
+			wantDetails: []models.FieldError{{Field: "pack_sizes", Code: models.FieldRequired, Message: "is required"}},
+		},
+		{
+			name: "Empty list", method: http.MethodPost, path: "/api/packs/config",
+			body:        `{"pack_sizes": []}`,
+			wantError:   "Invalid request body",
+			wantDetails: []models.FieldError{{Field: "pack_sizes", Code: models.FieldTooSmall, Message: "must not be empty"}},
+		},
+		{
+			name: "Query parameter", method: http.MethodGet, path: "/api/history?limit=many&sort=result",
+			wantError: "Invalid query parameters",
+			wantDetails: []models.FieldError{
+				{Field: "limit", Code: models.FieldType, Message: "must be an integer"},
+				{Field: "sort", Code: models.FieldInvalid, Message: "must be one of timestamp, items, waste, total_packs, duration"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", w.Code)
+			}
+			var response models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Error != tt.wantError || !reflect.DeepEqual(response.Details, tt.wantDetails) {
+				t.Errorf("Expected %q with %+v, got %q with %+v", tt.wantError, tt.wantDetails, response.Error, response.Details)
+			}
+			if response.ErrorCode != models.ErrorCodeValidation {
+				t.Errorf("Expected error code %s, got %q", models.ErrorCodeValidation, response.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     bool
+		wantDetails []models.FieldError
+	}{
+		{"Valid", `{"items": 251}`, false, nil},
+		{"Unknown field", `{"items": 251, "extra": true}`, true, []models.FieldError{{Field: "extra", Code: models.FieldUnknown, Message: "is not a known field"}}},
+		{"Wrong type", `{"items": [251]}`, true, []models.FieldError{{Field: "items", Code: models.FieldType, Message: "must be an integer"}}},
+		{"Trailing data", `{"items": 251} x`, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req models.CalculateRequest
+			err := decodeJSON(strings.NewReader(tt.body), &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				return
+			}
+			if got := fieldErrors(err); !reflect.DeepEqual(got, tt.wantDetails) {
+				t.Errorf("Expected details %+v, got %+v", tt.wantDetails, got)
+			}
+		})
+	}
+}
+
+// TestOpenAPI_MatchesModelValidation checks that the Validate methods of
+// the request models and the constraints in their openapi tags agree
+func TestOpenAPI_MatchesModelValidation(t *testing.T) {
+	spec := Spec()
+	tooMany := `[` + strings.Repeat(`1, `, models.MaxPackSizes) + `1]`
+
+	tests := []struct {
+		path  string
+		model interface{ Validate() []models.FieldError }
+		body  string
+	}{
+		{"/api/calculate", &models.CalculateRequest{}, `{"items": 251}`},
+		{"/api/calculate", &models.CalculateRequest{}, `{"items": 0}`},
+		{"/api/calculate", &models.CalculateRequest{}, `{"items": 1000001}`},
+		{"/api/calculate", &models.CalculateRequest{}, `{"items": 1, "pack_sizes": [0, 1000001, 5, 5]}`},
+		{"/api/calculate", &models.CalculateRequest{}, `{"items": 1, "pack_sizes": ` + tooMany + `}`},
+		{"/api/packs/config", &models.ConfigUpdateRequest{}, `{"pack_sizes": [250, 500]}`},
+		{"/api/packs/config", &models.ConfigUpdateRequest{}, `{"pack_sizes": []}`},
+		{"/api/packs/config", &models.ConfigUpdateRequest{}, `{"pack_sizes": [-1, 250, 250]}`},
+		{"/api/cache/warm", &models.CacheWarmRequest{}, `{"top": 10}`},
+		{"/api/cache/warm", &models.CacheWarmRequest{}, `{"top": -1, "from": -1, "to": 1000001, "step": -1}`},
+		{"/api/cache/warm", &models.CacheWarmRequest{}, `{"items": [0, 1000001], "pack_sizes": [3, 3]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.body, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.body), tt.model); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			want := tt.model.Validate()
+
+			got, err := spec.ValidateBody(spec.Operation(http.MethodPost, tt.path).RequestBody, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to validate body: %v", err)
+			}
+			// The document checks fields in name order, Validate in struct order
+			for _, errs := range [][]models.FieldError{got, want} {
+				sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("The OpenAPI document found %+v, Validate found %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetupRouter_BodyLimit(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.maxBody = 64
+	router := handler.SetupRouter()
+
+	padded := `{"items": 251` + strings.Repeat(" ", 64) + `}`
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"Content-Length over the limit", httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(padded))},
+		{"Body over the limit", httptest.NewRequest(http.MethodPost, "/api/packs/config", io.NopCloser(strings.NewReader(padded)))},
+	}
+	tests[1].req.ContentLength = -1
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+
+			var response models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&response)
+			if w.Code != http.StatusRequestEntityTooLarge || response.ErrorCode != models.ErrorCodeBodyTooLarge {
+				t.Errorf("Expected 413 with %s, got %d with %+v", models.ErrorCodeBodyTooLarge, w.Code, response)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items": 251}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected bodies under the limit to pass, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCSP is the Content-Security-Policy unless SECURITY_CSP sets
+// another. The web UI and the API docs load HTMX and Swagger UI from
+// unpkg and use inline scripts and styles.
+const DefaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"frame-ancestors 'none'; base-uri 'self'; form-action 'self'"
+
+// Headers shared with browsers through CORS
+const (
+	corsAllowHeaders  = "Content-Type, Authorization, X-API-Key, X-Request-Id, X-Client-ID, X-Source, Idempotency-Key, traceparent, tracestate"
+	corsExposeHeaders = "X-Request-Id, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset, Idempotent-Replayed"
+)
+
+// ErrWildcardCredentials is returned when credentials are allowed from any
+// origin; they need an explicit list of origins
+var ErrWildcardCredentials = errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list the allowed origins instead of *")
+
+// SecurityConfig controls CORS and the security headers of every response
+type SecurityConfig struct {
+	AllowedOrigins   []string      // Origins allowed to call the API; "*" allows any
+	AllowedMethods   []string      // Methods allowed in cross-origin requests
+	AllowCredentials bool          // Whether browsers may send cookies and credentials; needs listed origins
+	CSP              string        // Content-Security-Policy; "off" sends none
+	HSTSMaxAge       time.Duration // Strict-Transport-Security max-age on TLS connections; negative sends none
+}
+
+// LoadSecurityConfig reads the CORS and security header settings from the
+// environment. Allowing credentials without listing the origins fails with
+// ErrWildcardCredentials.
+func LoadSecurityConfig() (SecurityConfig, error) {
+	cfg := SecurityConfig{
+		AllowedOrigins:   splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		AllowedMethods:   splitList(strings.ToUpper(os.Getenv("CORS_ALLOWED_METHODS"))),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		CSP:              os.Getenv("SECURITY_CSP"),
+	}
+
+	// SECURITY_HSTS_MAX_AGE=0 turns HSTS off
+	if v, err := time.ParseDuration(os.Getenv("SECURITY_HSTS_MAX_AGE")); err == nil {
+		cfg.HSTSMaxAge = v
+		if v <= 0 {
+			cfg.HSTSMaxAge = -1
+		}
+	}
+
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return SecurityConfig{}, err
+	}
+	return cfg, nil
+}
+
+// withDefaults fills in unset fields
+func (c SecurityConfig) withDefaults() SecurityConfig {
+	if len(c.AllowedOrigins) == 0 {
+		c.AllowedOrigins = []string{"*"}
+	}
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	if c.CSP == "" {
+		c.CSP = DefaultCSP
+	}
+	if c.HSTSMaxAge == 0 {
+		c.HSTSMaxAge = 365 * 24 * time.Hour
+	}
+	return c
+}
+
+// validate checks that credentials are only allowed from listed origins,
+// since echoing any origin would let every site make credentialed requests
+func (c SecurityConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return ErrWildcardCredentials
+	}
+	return nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" when the origin is not allowed
+func (c SecurityConfig) allowOrigin(origin string) string {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(c.AllowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// cors sets the CORS headers allowed by h.security and answers preflight
+// requests. Requests from other origins get no Access-Control-Allow-Origin,
+// which makes browsers block them.
+func (h *Handler) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.security
+		header := w.Header()
+		if !slices.Equal(cfg.AllowedOrigins, []string{"*"}) {
+			header.Add("Vary", "Origin")
+		}
+
+		if origin := cfg.allowOrigin(r.Header.Get("Origin")); origin != "" {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			if cfg.AllowCredentials && origin != "*" {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// securityHeaders sets the security headers of every response. HSTS is
+// only sent over TLS, where browsers honour it.
+func (h *Handler) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		if h.security.CSP != "off" {
+			header.Set("Content-Security-Policy", h.security.CSP)
+		}
+		if r.TLS != nil && h.security.HSTSMaxAge > 0 {
+			header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(h.security.HSTSMaxAge.Seconds()))+"; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             SecurityConfig
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"any origin", SecurityConfig{}, "", "*", ""},
+		{"listed origin", SecurityConfig{AllowedOrigins: []string{"https://shop.example"}}, "https://shop.example", "https://shop.example", ""},
+		{"listed origin with credentials", SecurityConfig{AllowedOrigins: []string{"https://shop.example"}, AllowCredentials: true}, "https://shop.example", "https://shop.example", "true"},
+		{"any origin with credentials", SecurityConfig{AllowCredentials: true}, "https://shop.example", "*", ""},
+		{"unlisted origin", SecurityConfig{AllowedOrigins: []string{"https://shop.example"}}, "https://evil.example", "", ""},
+		{"no origin", SecurityConfig{AllowedOrigins: []string{"https://shop.example"}}, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{security: tt.cfg.withDefaults()}
+			wrapped := h.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			wrapped.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.wantOrigin, got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Expected Access-Control-Allow-Credentials %q, got %q", tt.wantCredentials, got)
+			}
+		})
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	h := &Handler{security: SecurityConfig{AllowedMethods: []string{"GET", "POST"}}.withDefaults()}
+	called := false
+	wrapped := h.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/calculate", nil)
+	req.Header.Set("Origin", "https://shop.example")
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+
+	if called || w.Code != http.StatusOK {
+		t.Errorf("Expected the preflight to be answered with 200, got %d (handler called: %v)", w.Code, called)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Expected the configured methods, got %q", got)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := &Handler{security: SecurityConfig{}.withDefaults()}
+	wrapped := h.securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for header, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   DefaultCSP,
+		"Strict-Transport-Security": "", // Plain HTTP
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Expected HSTS over TLS, got %q", got)
+	}
+
+	// CSP and HSTS can be turned off
+	h.security.CSP, h.security.HSTSMaxAge = "off", -1
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if w.Header().Get("Content-Security-Policy") != "" || w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("Expected no CSP or HSTS, got %v", w.Header())
+	}
+}
+
+func TestLoadSecurityConfig(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://shop.example, https://admin.example")
+	t.Setenv("CORS_ALLOWED_METHODS", "get,post")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("SECURITY_CSP", "")
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "0s")
+
+	want := SecurityConfig{
+		AllowedOrigins:   []string{"https://shop.example", "https://admin.example"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowCredentials: true,
+		CSP:              DefaultCSP,
+		HSTSMaxAge:       -1,
+	}
+	if cfg, err := LoadSecurityConfig(); err != nil || !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Expected %+v, got %+v (%v)", want, cfg, err)
+	}
+
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "")
+	if cfg, _ := LoadSecurityConfig(); cfg.HSTSMaxAge != 365*24*time.Hour {
+		t.Errorf("Expected HSTS for a year by default, got %v", cfg.HSTSMaxAge)
+	}
+
+	// Credentials need the origins listed
+	for _, origins := range []string{"", "*", "https://shop.example,*"} {
+		t.Setenv("CORS_ALLOWED_ORIGINS", origins)
+		if _, err := LoadSecurityConfig(); !errors.Is(err, ErrWildcardCredentials) {
+			t.Errorf("Origins %q: expected ErrWildcardCredentials, got %v", origins, err)
+		}
+	}
+}
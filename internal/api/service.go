@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/algorithm"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// The methods in this file hold the logic behind the REST endpoints
+// without the HTTP around it, so that the gRPC server answers the same
+// way: same validation, cache, coalescing and history.
+
+// ErrInvalidPackSizes is returned when the configured pack sizes cannot be
+// used for a calculation
+var ErrInvalidPackSizes = errors.New("invalid pack sizes")
+
+// ValidationError lists the invalid fields of a request
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(problems, "; ")
+}
+
+// failure is an error of the repository or the cache, with the message the
+// REST API reports it with
+type failure struct {
+	message string
+	err     error
+}
+
+func (f *failure) Error() string { return f.message + ": " + f.err.Error() }
+
+func (f *failure) Unwrap() error { return f.err }
+
+// Calculate answers a calculation request from the cache, or by running
+// the optimizer, and records it in the history with the request metadata
+// in meta. Concurrent identical requests share a single calculation.
+func (h *Handler) Calculate(ctx context.Context, req models.CalculateRequest, meta models.HistoryEntry) (models.CalculateResponse, error) {
+	log := logger.FromContext(ctx)
+
+	if errs := req.Validate(); len(errs) > 0 {
+		return models.CalculateResponse{}, &ValidationError{Fields: errs}
+	}
+
+	// Get pack sizes (use provided or default from DB)
+	packSizes := req.PackSizes
+	if len(packSizes) == 0 {
+		var err error
+		packSizes, err = h.configuredPackSizes(ctx)
+		if err != nil {
+			return models.CalculateResponse{}, &failure{"Failed to get pack sizes", err}
+		}
+		h.trackPackSizes(packSizes)
+	}
+
+	// Validate pack sizes
+	if !algorithm.Validate(packSizes) {
+		return models.CalculateResponse{}, ErrInvalidPackSizes
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("items", req.Items), attribute.IntSlice("pack_sizes", packSizes))
+
+	// Try to get from cache first
+	lookupStart := time.Now()
+	if cached, found := h.cachedResult(ctx, req.Items, packSizes); found {
+		log.Info("Cache HIT",
+			zap.Int("items", req.Items),
+			zap.Ints("pack_sizes", packSizes),
+			zap.Int("hit_count", cached.HitCount),
+			zap.Duration("ttl", cached.CurrentTTL),
+		)
+
+		// Record the hit so the history reflects every answered request
+		entry := meta
+		entry.Items = cached.Items
+		entry.PackSizes = packSizes
+		entry.Result = cached.Result
+		entry.TotalItems = cached.TotalItems
+		entry.TotalPacks = cached.TotalPacks
+		entry.Waste = cached.Waste
+		entry.Cached = true
+		entry.DurationUs = time.Since(lookupStart).Microseconds()
+		h.recordHistory(ctx, entry)
+
+		return models.CalculateResponse{
+			Items:             cached.Items,
+			PackSizes:         cached.PackSizes,
+			Result:            cached.Result,
+			TotalItems:        cached.TotalItems,
+			TotalPacks:        cached.TotalPacks,
+			Waste:             cached.Waste,
+			CalculationTimeMs: cached.CalculationTimeMs,
+			Cached:            true,
+			CacheTTL:          cacheTTL(cached.CurrentTTL),
+			CacheHitCount:     cached.HitCount,
+		}, nil
+	}
+
+	log.Info("Cache MISS",
+		zap.Int("items", req.Items),
+		zap.Ints("pack_sizes", packSizes),
+	)
+
+	// Concurrent identical requests share a single calculation
+	calc, err, shared := h.calls.Do(calculationKey(req.Items, packSizes), func() (calculation, error) {
+		return h.calculate(ctx, req.Items, packSizes), nil
+	})
+	if err != nil {
+		return models.CalculateResponse{}, &failure{"Failed to calculate packs", err}
+	}
+
+	// Every caller records its own entry, coalesced or not
+	entry := meta
+	entry.Items = calc.items
+	entry.PackSizes = calc.packSizes
+	entry.Result = calc.result.PackCounts
+	entry.TotalItems = calc.result.TotalItems
+	entry.TotalPacks = calc.result.TotalPacks
+	entry.Waste = calc.result.Waste
+	entry.DurationUs = calc.duration.Microseconds()
+	h.recordHistory(ctx, entry)
+
+	return models.CalculateResponse{
+		Items:             calc.items,
+		PackSizes:         calc.packSizes,
+		Result:            calc.result.PackCounts,
+		TotalItems:        calc.result.TotalItems,
+		TotalPacks:        calc.result.TotalPacks,
+		Waste:             calc.result.Waste,
+		CalculationTimeMs: calc.duration.Milliseconds(),
+		Cached:            false,
+		Coalesced:         shared,
+	}, nil
+}
+
+// PackConfig returns the configured pack sizes
+func (h *Handler) PackConfig(ctx context.Context) (models.PackConfig, error) {
+	packSizes, err := h.configuredPackSizes(ctx)
+	if err != nil {
+		return models.PackConfig{}, &failure{"Failed to get pack config", err}
+	}
+
+	return models.PackConfig{
+		PackSizes: packSizes,
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+// UpdatePackConfig validates and saves new pack sizes
+func (h *Handler) UpdatePackConfig(ctx context.Context, req models.ConfigUpdateRequest) (models.ConfigUpdateResponse, error) {
+	if errs := req.Validate(); len(errs) > 0 {
+		return models.ConfigUpdateResponse{}, &ValidationError{Fields: errs}
+	}
+
+	// Update in database
+	if err := h.repo.SetPackSizes(req.PackSizes); err != nil {
+		return models.ConfigUpdateResponse{}, &failure{"Failed to update pack config", err}
+	}
+	h.trackPackSizes(req.PackSizes)
+
+	return models.ConfigUpdateResponse{
+		PackSizes: req.PackSizes,
+		UpdatedAt: time.Now(),
+		Message:   "Pack sizes updated successfully",
+	}, nil
+}
+
+// History returns a page of the calculation history. Invalid queries fail
+// with repo.ErrInvalidQuery or repo.ErrInvalidCursor.
+func (h *Handler) History(ctx context.Context, query repo.HistoryQuery) (models.HistoryResponse, error) {
+	page, err := h.repo.QueryHistory(query)
+	if errors.Is(err, repo.ErrInvalidQuery) || errors.Is(err, repo.ErrInvalidCursor) {
+		return models.HistoryResponse{}, err
+	}
+	if err != nil {
+		return models.HistoryResponse{}, &failure{"Failed to get history", err}
+	}
+
+	return models.HistoryResponse{
+		History:    page.Entries,
+		Count:      len(page.Entries),
+		NextCursor: page.NextCursor,
+	}, nil
+}
+
+// respondServiceError answers an error of the methods above
+func respondServiceError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	var failed *failure
+	switch {
+	case errors.As(err, &invalid):
+		respondInvalidFields(w, invalid.Fields)
+	case errors.Is(err, ErrInvalidPackSizes):
+		respondError(w, http.StatusBadRequest, "Invalid pack sizes", nil)
+	case errors.Is(err, repo.ErrInvalidQuery), errors.Is(err, repo.ErrInvalidCursor):
+		respondError(w, http.StatusBadRequest, "Invalid history query", err)
+	case errors.As(err, &failed):
+		respondError(w, http.StatusInternalServerError, failed.message, failed.err)
+	default:
+		respondError(w, http.StatusInternalServerError, "Internal error", err)
+	}
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+)
+
+// Scopes granted to API keys
+const (
+	ScopeCalculate    = "calculate"     // POST /api/calculate
+	ScopeReadHistory  = "read:history"  // Query the history and its analytics
+	ScopeAdminHistory = "admin:history" // Clear the history
+	ScopeAdminConfig  = "admin:config"  // Change the pack sizes
+	ScopeAdminCache   = "admin:cache"   // Inspect, clear and warm the cache
+)
+
+// Scopes lists every scope
+var Scopes = []string{ScopeCalculate, ScopeReadHistory, ScopeAdminHistory, ScopeAdminConfig, ScopeAdminCache}
+
+// keyPrefix starts every API key, so leaked keys are easy to recognize
+const keyPrefix = "pk_"
+
+// displayLength is the number of leading key characters stored in the
+// clear to tell keys apart
+const displayLength = len(keyPrefix) + 8
+
+// Store looks up API keys. It is satisfied by *repo.Repository.
+type Store interface {
+	GetAPIKey(hash string) (models.APIKey, error)
+}
+
+// Config controls API key authentication
+type Config struct {
+	Enabled         bool
+	AnonymousScopes []string // Scopes of requests without a key
+}
+
+// LoadConfig reads the authentication configuration from the environment.
+// AUTH_ANONYMOUS_SCOPES defaults to calculate and read:history, which the
+// web UI needs; set it empty to require a key for every endpoint.
+func LoadConfig() Config {
+	cfg := Config{
+		Enabled:         os.Getenv("AUTH_ENABLED") == "true",
+		AnonymousScopes: []string{ScopeCalculate, ScopeReadHistory},
+	}
+
+	if v, ok := os.LookupEnv("AUTH_ANONYMOUS_SCOPES"); ok {
+		scopes, err := ParseScopes(v)
+		if err != nil {
+			logger.Log.Warn("Ignoring invalid AUTH_ANONYMOUS_SCOPES", zap.Error(err))
+		} else {
+			cfg.AnonymousScopes = scopes
+		}
+	}
+
+	return cfg
+}
+
+// ParseScopes parses a comma-separated list of scopes
+func ParseScopes(value string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !ValidScope(s) {
+			return nil, fmt.Errorf("unknown scope %q (valid: %s)", s, strings.Join(Scopes, ", "))
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes, nil
+}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	return contains(Scopes, scope)
+}
+
+// NewKey generates an API key and returns it with its display prefix and
+// the hash to store
+func NewKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:displayLength], HashKey(key), nil
+}
+
+// HashKey returns the stored form of a key. Keys are random, so a fast
+// hash is enough: there is nothing to guess from a leaked hash.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// contextKey is the type of the request context key holding the API key
+type contextKey struct{}
+
+// FromContext returns the API key that authenticated a request
+func FromContext(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(contextKey{}).(models.APIKey)
+	return key, ok
+}
+
+// Authenticator checks API keys and their scopes
+type Authenticator struct {
+	store Store
+	cfg   Config
+}
+
+// New creates an authenticator for the given store
+func New(store Store, cfg Config) *Authenticator {
+	return &Authenticator{store: store, cfg: cfg}
+}
+
+// Enabled reports whether requests are authenticated
+func (a *Authenticator) Enabled() bool {
+	return a.cfg.Enabled
+}
+
+// Middleware identifies the caller from the Authorization: Bearer or
+// X-API-Key header. Requests without a key continue anonymously; unknown
+// and revoked keys are rejected with 401.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret := requestKey(r)
+		if secret == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := a.store.GetAPIKey(HashKey(secret))
+		if errors.Is(err, repo.ErrAPIKeyNotFound) {
+			unauthorized(w, "Invalid API key")
+			return
+		}
+		if err != nil {
+			logger.Log.Error("Failed to look up API key", zap.Error(err))
+			respond(w, http.StatusServiceUnavailable, "Failed to verify API key")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, key)))
+	})
+}
+
+// Require returns middleware that lets requests through only if their key,
+// or the anonymous scopes for requests without one, grant scope. It must
+// run after Middleware.
+func (a *Authenticator) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !a.cfg.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := FromContext(r.Context())
+			switch {
+			case ok && key.HasScope(scope):
+				next.ServeHTTP(w, r)
+			case ok:
+				respond(w, http.StatusForbidden, fmt.Sprintf("API key %q lacks the %s scope", key.Name, scope))
+			case contains(a.cfg.AnonymousScopes, scope):
+				next.ServeHTTP(w, r)
+			default:
+				unauthorized(w, fmt.Sprintf("An API key with the %s scope is required", scope))
+			}
+		})
+	}
+}
+
+// Errors returned by Authorize
+var (
+	ErrInvalidKey   = errors.New("invalid API key")
+	ErrKeyRequired  = errors.New("API key required")
+	ErrMissingScope = errors.New("API key lacks the scope")
+)
+
+// Authorize is Middleware and Require for transports other than HTTP.
+// It checks that secret, or the anonymous scopes when secret is empty,
+// grants scope, and returns ctx with the API key for FromContext. Other
+// errors than ErrInvalidKey, ErrKeyRequired and ErrMissingScope mean the
+// key could not be looked up.
+func (a *Authenticator) Authorize(ctx context.Context, secret, scope string) (context.Context, error) {
+	if !a.cfg.Enabled {
+		return ctx, nil
+	}
+
+	if secret == "" {
+		if scope == "" || contains(a.cfg.AnonymousScopes, scope) {
+			return ctx, nil
+		}
+		return ctx, fmt.Errorf("%w: an API key with the %s scope is required", ErrKeyRequired, scope)
+	}
+
+	key, err := a.store.GetAPIKey(HashKey(secret))
+	if errors.Is(err, repo.ErrAPIKeyNotFound) {
+		return ctx, ErrInvalidKey
+	}
+	if err != nil {
+		return ctx, fmt.Errorf("failed to verify API key: %w", err)
+	}
+	if scope != "" && !key.HasScope(scope) {
+		return ctx, fmt.Errorf("%w: API key %q lacks the %s scope", ErrMissingScope, key.Name, scope)
+	}
+
+	return context.WithValue(ctx, contextKey{}, key), nil
+}
+
+// requestKey returns the API key sent with a request, if any
+func requestKey(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// contains reports whether scopes includes scope
+func contains(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// unauthorized responds with 401 and the authentication scheme to use
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="packcalc"`)
+	respond(w, http.StatusUnauthorized, message)
+}
+
+// respond writes an error in the API's ErrorResponse shape
+func respond(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: status, ErrorCode: models.ErrorCodeForStatus(status)})
+}
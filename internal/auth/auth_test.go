@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// fakeStore holds keys by hash
+type fakeStore struct {
+	keys map[string]models.APIKey
+	err  error
+}
+
+func (s *fakeStore) GetAPIKey(hash string) (models.APIKey, error) {
+	if s.err != nil {
+		return models.APIKey{}, s.err
+	}
+	key, ok := s.keys[hash]
+	if !ok {
+		return key, repo.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func TestNewKey(t *testing.T) {
+	key, prefix, hash, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+
+	if !strings.HasPrefix(key, "pk_") || len(key) != 46 {
+		t.Errorf("Expected a pk_ key of 46 characters, got %q", key)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != 11 {
+		t.Errorf("Expected the first 11 characters as prefix, got %q", prefix)
+	}
+	if hash != HashKey(key) || strings.Contains(hash, key) {
+		t.Errorf("Expected the hash of the key, got %q", hash)
+	}
+
+	other, _, _, _ := NewKey()
+	if other == key {
+		t.Error("Expected different keys")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	store := &fakeStore{keys: map[string]models.APIKey{
+		HashKey("pk_admin"): {Name: "ops", Scopes: []string{ScopeAdminCache}},
+		HashKey("pk_calc"):  {Name: "ci", Scopes: []string{ScopeCalculate}},
+	}}
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		store      Store
+		headers    map[string]string
+		scope      string
+		wantStatus int
+		wantKey    string
+	}{
+		{"disabled", Config{}, store, nil, ScopeAdminCache, http.StatusOK, ""},
+		{"disabled ignores keys", Config{}, store, map[string]string{"X-API-Key": "pk_wrong"}, ScopeAdminCache, http.StatusOK, ""},
+		{"bearer key", Config{Enabled: true}, store, map[string]string{"Authorization": "Bearer pk_admin"}, ScopeAdminCache, http.StatusOK, "ops"},
+		{"header key", Config{Enabled: true}, store, map[string]string{"X-API-Key": "pk_calc"}, ScopeCalculate, http.StatusOK, "ci"},
+		{"missing scope", Config{Enabled: true}, store, map[string]string{"X-API-Key": "pk_calc"}, ScopeAdminCache, http.StatusForbidden, ""},
+		{"unknown key", Config{Enabled: true, AnonymousScopes: []string{ScopeCalculate}}, store, map[string]string{"X-API-Key": "pk_wrong"}, ScopeCalculate, http.StatusUnauthorized, ""},
+		{"anonymous scope", Config{Enabled: true, AnonymousScopes: []string{ScopeCalculate}}, store, nil, ScopeCalculate, http.StatusOK, ""},
+		{"anonymous", Config{Enabled: true, AnonymousScopes: []string{ScopeCalculate}}, store, nil, ScopeAdminConfig, http.StatusUnauthorized, ""},
+		{"basic auth", Config{Enabled: true}, store, map[string]string{"Authorization": "Basic b3BzOnBr"}, ScopeCalculate, http.StatusUnauthorized, ""},
+		{"store error", Config{Enabled: true}, &fakeStore{err: errors.New("database is locked")}, map[string]string{"X-API-Key": "pk_admin"}, ScopeAdminCache, http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(tt.store, tt.cfg)
+
+			var gotKey string
+			handler := a.Middleware(a.Require(tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key, _ := FromContext(r.Context())
+				gotKey = key.Name
+			})))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/cache/clear", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if gotKey != tt.wantKey {
+				t.Errorf("Expected key %q in the context, got %q", tt.wantKey, gotKey)
+			}
+			if w.Code == http.StatusOK {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if response.Code != tt.wantStatus || response.ErrorCode != models.ErrorCodeForStatus(tt.wantStatus) || response.Error == "" {
+				t.Errorf("Unexpected error response: %+v", response)
+			}
+			if wantChallenge := tt.wantStatus == http.StatusUnauthorized; (w.Header().Get("WWW-Authenticate") != "") != wantChallenge {
+				t.Errorf("Expected WWW-Authenticate only on 401, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Authorize(t *testing.T) {
+	store := &fakeStore{keys: map[string]models.APIKey{
+		HashKey("pk_calc"): {Name: "ci", Scopes: []string{ScopeCalculate}},
+	}}
+	enabled := Config{Enabled: true, AnonymousScopes: []string{ScopeCalculate}}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		store   Store
+		secret  string
+		scope   string
+		wantErr error
+		wantKey string
+	}{
+		{"disabled", Config{}, store, "pk_wrong", ScopeAdminConfig, nil, ""},
+		{"key with scope", enabled, store, "pk_calc", ScopeCalculate, nil, "ci"},
+		{"key without scope", enabled, store, "pk_calc", ScopeAdminConfig, ErrMissingScope, ""},
+		{"no scope needed", enabled, store, "pk_calc", "", nil, "ci"},
+		{"unknown key", enabled, store, "pk_wrong", ScopeCalculate, ErrInvalidKey, ""},
+		{"anonymous scope", enabled, store, "", ScopeCalculate, nil, ""},
+		{"anonymous", enabled, store, "", ScopeAdminConfig, ErrKeyRequired, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := New(tt.store, tt.cfg).Authorize(context.Background(), tt.secret, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if key, _ := FromContext(ctx); key.Name != tt.wantKey {
+				t.Errorf("Expected key %q in the context, got %q", tt.wantKey, key.Name)
+			}
+		})
+	}
+
+	// Store failures are none of the sentinel errors
+	_, err := New(&fakeStore{err: errors.New("database is locked")}, enabled).Authorize(context.Background(), "pk_calc", ScopeCalculate)
+	if err == nil || errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected a lookup error, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		want      Config
+		setScopes bool
+	}{
+		{"defaults", nil, Config{AnonymousScopes: []string{ScopeCalculate, ScopeReadHistory}}, false},
+		{"enabled", map[string]string{"AUTH_ENABLED": "true", "AUTH_ANONYMOUS_SCOPES": "calculate"}, Config{Enabled: true, AnonymousScopes: []string{ScopeCalculate}}, true},
+		{"no anonymous access", map[string]string{"AUTH_ENABLED": "true", "AUTH_ANONYMOUS_SCOPES": ""}, Config{Enabled: true, AnonymousScopes: []string{}}, true},
+		{"invalid scopes", map[string]string{"AUTH_ANONYMOUS_SCOPES": "calculate,everything"}, Config{AnonymousScopes: []string{ScopeCalculate, ScopeReadHistory}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTH_ENABLED", tt.env["AUTH_ENABLED"])
+			if tt.setScopes {
+				t.Setenv("AUTH_ANONYMOUS_SCOPES", tt.env["AUTH_ANONYMOUS_SCOPES"])
+			}
+
+			if cfg := LoadConfig(); !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a call is rejected by an open circuit
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	StateClosed   BreakerState = "closed"    // Calls pass through
+	StateOpen     BreakerState = "open"      // Calls are rejected
+	StateHalfOpen BreakerState = "half-open" // A single trial call is allowed
+)
+
+// BreakerConfig configures a circuit breaker
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the circuit
+	OpenTimeout      time.Duration // Time spent open before a trial call
+}
+
+// LoadBreakerConfig reads the Redis circuit breaker settings from the environment
+func LoadBreakerConfig() BreakerConfig {
+	cfg := BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("REDIS_BREAKER_FAILURE_THRESHOLD")); err == nil && v > 0 {
+		cfg.FailureThreshold = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("REDIS_BREAKER_OPEN_TIMEOUT")); err == nil && v > 0 {
+		cfg.OpenTimeout = v
+	}
+
+	return cfg
+}
+
+// CircuitBreaker stops calling a failing dependency. After FailureThreshold
+// consecutive failures it opens and rejects calls; once OpenTimeout has
+// passed it lets one trial call through and closes again if it succeeds.
+// Each state change starts a new generation, and outcomes of calls allowed
+// in an earlier one are ignored, so that a slow call cannot close a
+// breaker that opened meanwhile.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	gen      uint64 // Generation of the current state
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial call is in flight
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+
+	return &CircuitBreaker{
+		cfg:   cfg,
+		state: StateClosed,
+		now:   time.Now,
+	}
+}
+
+// Allow reports whether a call may proceed, and the generation it belongs
+// to. Every allowed call must be followed by Success or Failure with that
+// generation.
+func (b *CircuitBreaker) Allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return b.gen, false
+		}
+		b.setState(StateHalfOpen)
+		b.trial = true
+		return b.gen, true
+	case StateHalfOpen:
+		if b.trial {
+			return b.gen, false
+		}
+		b.trial = true
+		return b.gen, true
+	default:
+		return b.gen, true
+	}
+}
+
+// Success records a successful call of generation gen
+func (b *CircuitBreaker) Success(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		return
+	}
+
+	b.failures = 0
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+// Failure records a failed call of generation gen
+func (b *CircuitBreaker) Failure(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.setState(StateOpen)
+		b.openedAt = b.now()
+	}
+}
+
+// Reset closes the breaker, e.g. once a health check has found the
+// dependency reachable again. Calls still in flight are ignored.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.setState(StateClosed)
+}
+
+// setState moves to state, starting a new generation
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	b.gen++
+	b.trial = false
+}
+
+// State returns the current state. An open circuit whose timeout has
+// passed is reported as half-open.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// CircuitReporter is implemented by caches guarded by a circuit breaker
+type CircuitReporter interface {
+	CircuitState() BreakerState
+}
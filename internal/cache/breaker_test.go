@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, timeout time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Now()
+	b := NewCircuitBreaker(BreakerConfig{FailureThreshold: threshold, OpenTimeout: timeout})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// fail runs a failed call through b
+func fail(b *CircuitBreaker) {
+	gen, _ := b.Allow()
+	b.Failure(gen)
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		gen, ok := b.Allow()
+		if !ok {
+			t.Fatal("Expected closed breaker to allow calls")
+		}
+		b.Failure(gen)
+	}
+
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed below threshold, got %s", b.State())
+	}
+
+	fail(b)
+
+	if b.State() != StateOpen {
+		t.Errorf("Expected open at threshold, got %s", b.State())
+	}
+
+	if _, ok := b.Allow(); ok {
+		t.Error("Expected open breaker to reject calls")
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+
+	fail(b)
+	gen, _ := b.Allow()
+	b.Success(gen)
+	fail(b)
+
+	if b.State() != StateClosed {
+		t.Errorf("Expected failures to be consecutive, got %s", b.State())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenTrial(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+
+	fail(b)
+
+	*now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open after timeout, got %s", b.State())
+	}
+
+	gen, ok := b.Allow()
+	if !ok {
+		t.Fatal("Expected a trial call to be allowed")
+	}
+
+	if _, ok := b.Allow(); ok {
+		t.Error("Expected only one concurrent trial call")
+	}
+
+	b.Success(gen)
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed after successful trial, got %s", b.State())
+	}
+}
+
+func TestCircuitBreaker_FailedTrialReopens(t *testing.T) {
+	b, now := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		fail(b)
+	}
+
+	*now = now.Add(time.Minute)
+	fail(b)
+
+	if b.State() != StateOpen {
+		t.Errorf("Expected open after failed trial, got %s", b.State())
+	}
+
+	if _, ok := b.Allow(); ok {
+		t.Error("Expected a new open period after a failed trial")
+	}
+}
+
+func TestCircuitBreaker_IgnoresStaleCalls(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+
+	// A slow call started while closed finishes after the breaker opened
+	slow, _ := b.Allow()
+	fail(b)
+	b.Success(slow)
+	if b.State() != StateOpen {
+		t.Fatalf("Expected a stale success not to close the breaker, got %s", b.State())
+	}
+
+	// Nor does it fail the trial call or extend the open period
+	*now = now.Add(time.Minute)
+	trial, ok := b.Allow()
+	if !ok {
+		t.Fatal("Expected a trial call to be allowed")
+	}
+	b.Failure(slow)
+	if b.State() != StateHalfOpen {
+		t.Errorf("Expected a stale failure to be ignored, got %s", b.State())
+	}
+	b.Success(trial)
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed after successful trial, got %s", b.State())
+	}
+}
+
+func TestCircuitBreaker_Reset(t *testing.T) {
+	b, _ := newTestBreaker(1, time.Minute)
+
+	fail(b)
+	b.Reset()
+	if _, ok := b.Allow(); !ok || b.State() != StateClosed {
+		t.Errorf("Expected a reset breaker to be closed, got %s", b.State())
+	}
+}
+
+func TestLoadBreakerConfig(t *testing.T) {
+	t.Setenv("REDIS_BREAKER_FAILURE_THRESHOLD", "10")
+	t.Setenv("REDIS_BREAKER_OPEN_TIMEOUT", "5s")
+
+	cfg := LoadBreakerConfig()
+	if cfg.FailureThreshold != 10 || cfg.OpenTimeout != 5*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
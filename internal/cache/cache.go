@@ -1,29 +1,43 @@
 package cache
 
 import (
-	"context"
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"sort"
 	"strconv"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
 	"go.uber.org/zap"
 )
 
 const (
-	// Cache TTL constants
+	// Default TTL policy: start at InitialTTL and double on every hit up to MaxTTL
 	InitialTTL = 5 * time.Minute
 	MaxTTL     = 24 * time.Hour
 
 	// Cache key prefix
 	CacheKeyPrefix = "packcalc:"
 
+	// EntryKeyPrefix namespaces calculation entries. Keys have the form
+	// packcalc:calc:<pack set hash>:<items> so that all entries for one
+	// pack set can be matched with a single SCAN pattern.
+	EntryKeyPrefix = CacheKeyPrefix + "calc:"
+
+	// legacyEntryPattern matches entries written before EntryKeyPrefix,
+	// keyed packcalc:<32 hex digits>, so that Clear removes them too
+	legacyEntryPattern = CacheKeyPrefix + "[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]" +
+		"[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]" +
+		"[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]" +
+		"[0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f][0-9a-f]"
+
+	// SCAN tuning: keys requested per SCAN call and the number of calls
+	// spent counting keys before falling back to an estimate.
+	scanBatchSize     = 1000
+	maxCountScanCalls = 20
+
 	// Stats keys
 	StatsHitsKey   = "packcalc:stats:hits"
 	StatsMissesKey = "packcalc:stats:misses"
@@ -43,270 +57,205 @@ type CachedResult struct {
 	CurrentTTL        time.Duration `json:"current_ttl"`
 }
 
+// Backend names accepted by CACHE_BACKEND
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendTiered = "tiered"
+)
+
 // CacheStats represents cache statistics
 type CacheStats struct {
-	Hits       int64   `json:"hits"`
-	Misses     int64   `json:"misses"`
-	HitRate    float64 `json:"hit_rate"`
-	TotalKeys  int64   `json:"total_keys"`
-	MemoryUsed string  `json:"memory_used"`
-	Uptime     string  `json:"uptime"`
-}
-
-// Cache handles Redis caching operations
-type Cache struct {
-	client  *redis.Client
-	enabled bool
-	ctx     context.Context
-}
-
-// NewCache creates a new cache instance
-func NewCache() *Cache {
-	enabled := os.Getenv("REDIS_ENABLED") == "true"
-
-	if !enabled {
-		logger.Log.Info("Redis cache is disabled")
-		return &Cache{enabled: false, ctx: context.Background()}
-	}
-
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
-	}
-
-	client := redis.NewClient(&redis.Options{
-		Addr:         redisAddr,
-		Password:     os.Getenv("REDIS_PASSWORD"),
-		DB:           0,
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-		PoolSize:     10,
-		MinIdleConns: 5,
-	})
-
-	ctx := context.Background()
-
-	// Test connection
-	if err := client.Ping(ctx).Err(); err != nil {
-		logger.Log.Warn("Failed to connect to Redis. Cache disabled.",
-			zap.String("address", redisAddr),
-			zap.Error(err),
-		)
-		return &Cache{enabled: false, ctx: ctx}
-	}
-
-	logger.Log.Info("Redis cache enabled", zap.String("address", redisAddr))
-	return &Cache{
-		client:  client,
-		enabled: true,
-		ctx:     ctx,
-	}
+	Backend            string  `json:"backend"`
+	Enabled            bool    `json:"enabled"`
+	Hits               int64   `json:"hits"`
+	Misses             int64   `json:"misses"`
+	HitRate            float64 `json:"hit_rate"`
+	TotalKeys          int64   `json:"total_keys"`
+	TotalKeysEstimated bool    `json:"total_keys_estimated"`
+	MemoryUsed         string  `json:"memory_used"`
+	Uptime             string  `json:"uptime"`
+	TTLPolicy          string  `json:"ttl_policy,omitempty"`
+
+	// Codec is the serialization format of stored entries (Redis backend only)
+	Codec string `json:"codec,omitempty"`
+
+	// CircuitState is the Redis circuit breaker state (Redis backend only)
+	CircuitState BreakerState `json:"circuit_state,omitempty"`
+
+	// Tiers holds per-tier stats for the tiered backend (L1 first)
+	Tiers []*CacheStats `json:"tiers,omitempty"`
 }
 
-// IsEnabled returns whether caching is enabled
-func (c *Cache) IsEnabled() bool {
-	return c.enabled
+// Cache is implemented by every cache backend
+type Cache interface {
+	// Get retrieves a cached result and extends its TTL
+	Get(items int, packSizes []int) (*CachedResult, bool)
+	// Contains reports whether a result is cached without counting a hit
+	// or extending its TTL
+	Contains(items int, packSizes []int) bool
+	// Set stores a calculation result
+	Set(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int, calcTime int64) error
+	// GetStats returns cache statistics
+	GetStats() (*CacheStats, error)
+	// Clear removes all cache entries
+	Clear() error
+	// ClearPackSizes removes the entries for one pack set
+	ClearPackSizes(packSizes []int) (int64, error)
+	// IsEnabled returns whether caching is enabled
+	IsEnabled() bool
+	// Close releases the backend's resources
+	Close() error
 }
 
-// generateKey creates a cache key from items and pack sizes
-func (c *Cache) generateKey(items int, packSizes []int) string {
-	// Sort pack sizes to ensure consistent keys
-	sorted := make([]int, len(packSizes))
-	copy(sorted, packSizes)
-	sort.Ints(sorted)
-
-	// Create a deterministic string representation
-	data := fmt.Sprintf("%d:%v", items, sorted)
-
-	// Hash it for a shorter key
-	hash := sha256.Sum256([]byte(data))
-	return fmt.Sprintf("%s%x", CacheKeyPrefix, hash[:16])
+// Config selects and sizes the cache backend
+type Config struct {
+	Backend          string        // none, memory, redis or tiered
+	MemoryMaxEntries int           // Capacity of the in-process LRU
+	L1TTL            time.Duration // Upper bound on L1 entry lifetime in tiered mode
+	TTL              TTLConfig     // Entry lifetime policy
+	Redis            RedisConfig   // Connection settings for the redis and tiered backends
 }
 
-// Get retrieves a cached result and updates its TTL
-func (c *Cache) Get(items int, packSizes []int) (*CachedResult, bool) {
-	if !c.enabled {
-		return nil, false
+// LoadConfig reads the cache configuration from the environment.
+// Without CACHE_BACKEND, REDIS_ENABLED=true selects Redis and anything
+// else disables caching, as in earlier releases.
+func LoadConfig() Config {
+	cfg := Config{
+		Backend:          os.Getenv("CACHE_BACKEND"),
+		MemoryMaxEntries: 10000,
+		L1TTL:            time.Minute,
+		TTL:              LoadTTLConfig(),
+		Redis:            LoadRedisConfig(),
 	}
 
-	key := c.generateKey(items, packSizes)
-
-	// Get the cached data
-	data, err := c.client.Get(c.ctx, key).Bytes()
-	if err == redis.Nil {
-		// Cache miss
-		c.incrementMisses()
-		return nil, false
-	} else if err != nil {
-		log.Printf("Cache get error: %v", err)
-		c.incrementMisses()
-		return nil, false
-	}
-
-	// Deserialize
-	var result CachedResult
-	if err := json.Unmarshal(data, &result); err != nil {
-		log.Printf("Cache unmarshal error: %v", err)
-		c.incrementMisses()
-		return nil, false
+	if cfg.Backend == "" {
+		cfg.Backend = BackendNone
+		if os.Getenv("REDIS_ENABLED") == "true" {
+			cfg.Backend = BackendRedis
+		}
 	}
 
-	// Cache hit! Update TTL (double it, up to max)
-	result.HitCount++
-	newTTL := result.CurrentTTL * 2
-	if newTTL > MaxTTL {
-		newTTL = MaxTTL
+	if v, err := strconv.Atoi(os.Getenv("CACHE_MEMORY_MAX_ENTRIES")); err == nil && v > 0 {
+		cfg.MemoryMaxEntries = v
 	}
-	result.CurrentTTL = newTTL
 
-	// Save back with updated TTL and hit count
-	if err := c.set(key, &result, newTTL); err != nil {
-		log.Printf("Failed to update cache TTL: %v", err)
+	if v, err := time.ParseDuration(os.Getenv("CACHE_L1_TTL")); err == nil && v > 0 {
+		cfg.L1TTL = v
 	}
 
-	c.incrementHits()
-	return &result, true
+	return cfg
 }
 
-// Set stores a calculation result in cache
-func (c *Cache) Set(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int, calcTime int64) error {
-	if !c.enabled {
-		return nil
-	}
-
-	key := c.generateKey(items, packSizes)
-
-	cached := &CachedResult{
-		Items:             items,
-		PackSizes:         packSizes,
-		Result:            result,
-		TotalItems:        totalItems,
-		TotalPacks:        totalPacks,
-		Waste:             waste,
-		CalculationTimeMs: calcTime,
-		CachedAt:          time.Now(),
-		HitCount:          0,
-		CurrentTTL:        InitialTTL,
-	}
-
-	return c.set(key, cached, InitialTTL)
+// NewCache creates a cache instance configured from the environment
+func NewCache() Cache {
+	return New(LoadConfig())
 }
 
-// set is an internal method to store data with a specific TTL
-func (c *Cache) set(key string, result *CachedResult, ttl time.Duration) error {
-	data, err := json.Marshal(result)
-	if err != nil {
-		return fmt.Errorf("failed to marshal cache data: %w", err)
-	}
-
-	if err := c.client.Set(c.ctx, key, data, ttl).Err(); err != nil {
-		return fmt.Errorf("failed to set cache: %w", err)
-	}
-
-	return nil
-}
-
-// GetStats returns cache statistics
-func (c *Cache) GetStats() (*CacheStats, error) {
-	if !c.enabled {
-		return &CacheStats{}, nil
-	}
-
-	// Get hit/miss counts
-	hits, _ := c.client.Get(c.ctx, StatsHitsKey).Int64()
-	misses, _ := c.client.Get(c.ctx, StatsMissesKey).Int64()
-
-	total := hits + misses
-	hitRate := 0.0
-	if total > 0 {
-		hitRate = float64(hits) / float64(total) * 100
-	}
-
-	// Get total keys matching our prefix
-	keys, err := c.client.Keys(c.ctx, CacheKeyPrefix+"*").Result()
-	if err != nil {
-		log.Printf("Failed to get cache keys: %v", err)
-	}
-
-	// Get memory info
-	info, err := c.client.Info(c.ctx, "memory", "server").Result()
-	memoryUsed := "N/A"
-	uptime := "N/A"
-
-	if err == nil {
-		// Parse memory and uptime from info string
-		memoryUsed = parseInfoField(info, "used_memory_human")
-		uptimeSecs := parseInfoField(info, "uptime_in_seconds")
-		if secs, err := strconv.Atoi(uptimeSecs); err == nil {
-			uptime = (time.Duration(secs) * time.Second).String()
+// New creates the cache backend selected by cfg
+func New(cfg Config) Cache {
+	switch cfg.Backend {
+	case BackendMemory:
+		ttl := configuredTTLPolicy(cfg.TTL)
+		logger.Log.Info("In-memory cache enabled",
+			zap.Int("max_entries", cfg.MemoryMaxEntries),
+			zap.String("ttl_policy", ttl.Name()),
+		)
+		memoryCache := NewMemoryCache(cfg.MemoryMaxEntries, 0)
+		memoryCache.ttl = ttl
+		return memoryCache
+	case BackendRedis:
+		redisCache, err := NewRedisCache(cfg.Redis)
+		if err != nil {
+			logger.Log.Error("Invalid Redis configuration. Cache disabled.", zap.Error(err))
+			return noopCache{}
+		}
+		redisCache.ttl = configuredTTLPolicy(cfg.TTL)
+		return redisCache
+	case BackendTiered:
+		ttl := configuredTTLPolicy(cfg.TTL)
+		logger.Log.Info("Tiered cache enabled",
+			zap.Int("l1_max_entries", cfg.MemoryMaxEntries),
+			zap.Duration("l1_ttl", cfg.L1TTL),
+			zap.String("ttl_policy", ttl.Name()),
+		)
+		l1 := NewMemoryCache(cfg.MemoryMaxEntries, cfg.L1TTL)
+		l1.ttl = ttl
+		redisCache, err := NewRedisCache(cfg.Redis)
+		if err != nil {
+			logger.Log.Error("Invalid Redis configuration. Using L1 cache only.", zap.Error(err))
+			return l1
 		}
+		redisCache.ttl = ttl
+		return NewTieredCache(l1, redisCache)
+	case BackendNone:
+		logger.Log.Info("Cache is disabled")
+	default:
+		logger.Log.Warn("Unknown cache backend. Cache disabled.", zap.String("backend", cfg.Backend))
 	}
-
-	return &CacheStats{
-		Hits:       hits,
-		Misses:     misses,
-		HitRate:    hitRate,
-		TotalKeys:  int64(len(keys)),
-		MemoryUsed: memoryUsed,
-		Uptime:     uptime,
-	}, nil
+	return noopCache{}
 }
 
-// Clear removes all cache entries
-func (c *Cache) Clear() error {
-	if !c.enabled {
-		return nil
+// configuredTTLPolicy creates the configured TTL policy, falling back to
+// the default policy when the configuration is unset or invalid
+func configuredTTLPolicy(cfg TTLConfig) TTLPolicy {
+	if cfg == (TTLConfig{}) {
+		return defaultTTLPolicy()
 	}
 
-	keys, err := c.client.Keys(c.ctx, CacheKeyPrefix+"*").Result()
+	policy, err := NewTTLPolicy(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to get cache keys: %w", err)
+		logger.Log.Error("Invalid cache TTL policy. Using the default policy.", zap.Error(err))
+		return defaultTTLPolicy()
 	}
+	return policy
+}
 
-	if len(keys) > 0 {
-		if err := c.client.Del(c.ctx, keys...).Err(); err != nil {
-			return fmt.Errorf("failed to delete cache keys: %w", err)
-		}
-	}
+// entryKey creates a cache key from items and pack sizes
+func entryKey(items int, packSizes []int) string {
+	return fmt.Sprintf("%s%d", packSetPrefix(packSizes), items)
+}
 
-	// Reset stats
-	c.client.Del(c.ctx, StatsHitsKey, StatsMissesKey)
+// packSetPrefix returns the key prefix shared by all entries for a pack set
+func packSetPrefix(packSizes []int) string {
+	// Sort pack sizes to ensure consistent keys
+	sorted := make([]int, len(packSizes))
+	copy(sorted, packSizes)
+	sort.Ints(sorted)
 
-	return nil
+	// Hash the canonical representation for a short, fixed-length segment
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v", sorted)))
+	return fmt.Sprintf("%s%x:", EntryKeyPrefix, hash[:8])
 }
 
-// Close closes the Redis connection
-func (c *Cache) Close() error {
-	if c.enabled && c.client != nil {
-		return c.client.Close()
+// countLookup records a cache lookup in the Prometheus metrics
+func countLookup(backend string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
 	}
-	return nil
+	metrics.CacheRequests.WithLabelValues(backend, result).Inc()
 }
 
-// incrementHits increments the cache hit counter
-func (c *Cache) incrementHits() {
-	c.client.Incr(c.ctx, StatsHitsKey)
+// hitPercentage returns the hit percentage for the given counters
+func hitPercentage(hits, misses int64) float64 {
+	if total := hits + misses; total > 0 {
+		return float64(hits) / float64(total) * 100
+	}
+	return 0
 }
 
-// incrementMisses increments the cache miss counter
-func (c *Cache) incrementMisses() {
-	c.client.Incr(c.ctx, StatsMissesKey)
-}
+// noopCache is used when caching is disabled
+type noopCache struct{}
 
-// parseInfoField extracts a field value from Redis INFO output
-func parseInfoField(info, field string) string {
-	lines := []byte(info)
-	start := 0
-	for i := 0; i < len(lines); i++ {
-		if lines[i] == '\n' {
-			line := string(lines[start:i])
-			start = i + 1
-
-			if len(line) > len(field)+1 && line[:len(field)] == field && line[len(field)] == ':' {
-				return line[len(field)+1:]
-			}
-		}
-	}
-	return ""
+func (noopCache) Get(int, []int) (*CachedResult, bool) { return nil, false }
+func (noopCache) Contains(int, []int) bool             { return false }
+func (noopCache) Set(int, []int, map[int]int, int, int, int, int64) error {
+	return nil
 }
+func (noopCache) GetStats() (*CacheStats, error)      { return &CacheStats{Backend: BackendNone}, nil }
+func (noopCache) Clear() error                        { return nil }
+func (noopCache) ClearPackSizes([]int) (int64, error) { return 0, nil }
+func (noopCache) IsEnabled() bool                     { return false }
+func (noopCache) Close() error                        { return nil }
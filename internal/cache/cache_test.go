@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
@@ -15,7 +16,7 @@ func init() {
 	logger.Initialize()
 }
 
-func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *Cache) {
+func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisCache) {
 	// Create a miniredis server
 	mr, err := miniredis.Run()
 	if err != nil {
@@ -27,11 +28,8 @@ func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *Cache) {
 		Addr: mr.Addr(),
 	})
 
-	cache := &Cache{
-		client:  client,
-		enabled: true,
-		ctx:     context.Background(),
-	}
+	cache := newRedisCache(client, LoadBreakerConfig())
+	cache.enabled.Store(true)
 
 	return mr, cache
 }
@@ -42,7 +40,7 @@ func TestNewCache_Disabled(t *testing.T) {
 
 	cache := NewCache()
 
-	if cache.enabled {
+	if cache.IsEnabled() {
 		t.Error("Expected cache to be disabled")
 	}
 }
@@ -164,6 +162,27 @@ func TestCache_GetMiss(t *testing.T) {
 	}
 }
 
+func TestCache_Contains(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	if cache.Contains(250, []int{250, 500}) {
+		t.Error("Expected Contains to be false before Set")
+	}
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if !cache.Contains(250, []int{500, 250}) {
+		t.Error("Expected Contains to be true after Set")
+	}
+
+	// Contains must not count as a hit
+	stats, _ := cache.GetStats()
+	if stats.Hits != 0 {
+		t.Errorf("Expected 0 hits after Contains, got %d", stats.Hits)
+	}
+}
+
 func TestCache_AdaptiveTTL(t *testing.T) {
 	mr, cache := setupTestRedis(t)
 	defer mr.Close()
@@ -289,9 +308,8 @@ func TestCache_Stats(t *testing.T) {
 }
 
 func TestCache_Disabled(t *testing.T) {
-	cache := &Cache{
-		enabled: false,
-		ctx:     context.Background(),
+	cache := &RedisCache{
+		ctx: context.Background(),
 	}
 
 	// All operations should be no-ops
@@ -313,3 +331,170 @@ func TestCache_Disabled(t *testing.T) {
 		t.Errorf("Expected no error for disabled cache, got: %v", err)
 	}
 }
+
+func TestCache_ClearPackSizes(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	// Entries for two different pack sets
+	for i := 1; i <= 3; i++ {
+		cache.Set(i*100, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+		cache.Set(i*100, []int{23, 31, 53}, map[int]int{23: 1}, 23, 1, 0, 0)
+	}
+
+	// Clearing is independent of the pack size order
+	deleted, err := cache.ClearPackSizes([]int{500, 250})
+	if err != nil {
+		t.Fatalf("Failed to clear pack sizes: %v", err)
+	}
+
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted entries, got %d", deleted)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, found := cache.Get(i*100, []int{250, 500}); found {
+			t.Errorf("Expected entry for items %d with [250 500] to be cleared", i*100)
+		}
+		if _, found := cache.Get(i*100, []int{23, 31, 53}); !found {
+			t.Errorf("Expected entry for items %d with [23 31 53] to survive", i*100)
+		}
+	}
+}
+
+func TestCache_ClearKeepsForeignKeys(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	mr.Set("other-app:key", "value")
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Failed to clear cache: %v", err)
+	}
+
+	if !mr.Exists("other-app:key") {
+		t.Error("Expected keys outside the cache prefix to be left alone")
+	}
+}
+
+func TestCache_ClearLegacyKeys(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	// Entries keyed packcalc:<hash> before the calc: namespace
+	legacy := "packcalc:0123456789abcdef0123456789abcdef"
+	mr.Set(legacy, `{"items":250}`)
+	mr.SetTTL(legacy, 24*time.Hour)
+	mr.Set("packcalc:ratelimit:client", "1")
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Failed to clear cache: %v", err)
+	}
+
+	if mr.Exists(legacy) {
+		t.Error("Expected the legacy entry to be cleared")
+	}
+	if !mr.Exists("packcalc:ratelimit:client") {
+		t.Error("Expected other packcalc keys to be left alone")
+	}
+}
+
+func TestCache_StatsTotalKeys(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	mr.Set("other-app:key", "value")
+	for i := 1; i <= 4; i++ {
+		cache.Set(i*100, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+	}
+	cache.Get(100, []int{250, 500}) // Creates the hits counter key
+
+	stats, err := cache.GetStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	// Counter keys and foreign keys must not be counted
+	if stats.TotalKeys != 4 {
+		t.Errorf("Expected 4 keys, got %d", stats.TotalKeys)
+	}
+
+	if stats.TotalKeysEstimated {
+		t.Error("Expected an exact count for a small keyspace")
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisCache_ProberTogglesCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	// Starts disabled, as if Redis was unreachable at startup
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	cache := newRedisCache(client, LoadBreakerConfig())
+	cache.startProber(10 * time.Millisecond)
+	defer cache.Close()
+
+	waitFor(t, "cache to be enabled", cache.IsEnabled)
+
+	mr.Close()
+	waitFor(t, "cache to be disabled", func() bool { return !cache.IsEnabled() })
+
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("Failed to restart miniredis: %v", err)
+	}
+	waitFor(t, "cache to be re-enabled", cache.IsEnabled)
+}
+
+func TestRedisCache_CircuitBreakerOpens(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	cache := newRedisCache(client, BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	cache.enabled.Store(true)
+	defer cache.Close()
+
+	// Redis dies before the prober notices
+	mr.Close()
+
+	cache.Get(250, []int{250, 500})
+	if cache.CircuitState() != StateOpen {
+		t.Fatalf("Expected open circuit after failures, got %s", cache.CircuitState())
+	}
+
+	// Calls are rejected without touching Redis
+	if err := cache.do(func() error { t.Error("Expected call to be rejected"); return nil }); err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+
+	if err := cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0); err != nil {
+		t.Errorf("Expected writes to be skipped silently, got %v", err)
+	}
+
+	stats, err := cache.GetStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.CircuitState != StateOpen {
+		t.Errorf("Expected stats to report open circuit, got %s", stats.CircuitState)
+	}
+}
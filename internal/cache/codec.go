@@ -0,0 +1,345 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Codec formats accepted by CACHE_CODEC
+const (
+	CodecJSON   = "json"
+	CodecBinary = "binary"
+)
+
+// Compression algorithms accepted by CACHE_COMPRESSION
+const (
+	CompressionNone    = "none"
+	CompressionDeflate = "deflate"
+)
+
+// Encoded entries other than legacy JSON start with a three byte header:
+// codecMagic, the format ID and a flags byte. Legacy entries are bare JSON
+// objects and always start with '{', which never matches codecMagic.
+const (
+	codecMagic      byte = 0xC5
+	codecHeaderSize      = 3
+
+	formatJSON     byte = 1 // JSON, as stored by earlier releases
+	formatBinaryV1 byte = 2 // Varint encoding, see encodeBinary
+
+	flagDeflate byte = 1 << 0 // Payload is deflate-compressed
+
+	// maxDecodedSize bounds decompression of a single entry
+	maxDecodedSize = 1 << 20
+)
+
+// ErrCorruptEntry is returned for cache entries that cannot be decoded
+var ErrCorruptEntry = errors.New("corrupt cache entry")
+
+// CodecConfig selects how results are serialized in Redis
+type CodecConfig struct {
+	Format      string // json or binary
+	Compression string // none or deflate
+	MinCompress int    // Payloads smaller than this are stored uncompressed
+}
+
+// LoadCodecConfig reads the codec configuration from the environment
+func LoadCodecConfig() CodecConfig {
+	cfg := CodecConfig{
+		Format:      os.Getenv("CACHE_CODEC"),
+		Compression: os.Getenv("CACHE_COMPRESSION"),
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("CACHE_COMPRESSION_MIN_BYTES")); err == nil && v >= 0 {
+		cfg.MinCompress = v
+	} else {
+		cfg.MinCompress = 256
+	}
+
+	return cfg
+}
+
+// Codec encodes cached results for storage. Decoding accepts every
+// format regardless of the configured one, so the codec can be changed
+// without flushing the cache.
+type Codec struct {
+	format      byte
+	compress    bool
+	minCompress int
+}
+
+// NewCodec creates a codec. The zero config selects the binary format
+// without compression.
+func NewCodec(cfg CodecConfig) (*Codec, error) {
+	c := &Codec{minCompress: cfg.MinCompress}
+
+	switch cfg.Format {
+	case CodecBinary, "":
+		c.format = formatBinaryV1
+	case CodecJSON:
+		c.format = formatJSON
+	default:
+		return nil, fmt.Errorf("unknown cache codec %q", cfg.Format)
+	}
+
+	switch cfg.Compression {
+	case CompressionNone, "":
+	case CompressionDeflate:
+		c.compress = true
+	default:
+		return nil, fmt.Errorf("unknown cache compression %q", cfg.Compression)
+	}
+
+	return c, nil
+}
+
+// Name describes the codec, e.g. "binary" or "json+deflate"
+func (c *Codec) Name() string {
+	name := CodecBinary
+	if c.format == formatJSON {
+		name = CodecJSON
+	}
+	if c.compress {
+		name += "+" + CompressionDeflate
+	}
+	return name
+}
+
+// Encode serializes a result
+func (c *Codec) Encode(result *CachedResult) ([]byte, error) {
+	var payload []byte
+	if c.format == formatJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed JSON is written without a header so that older
+		// releases can still read it during a rolling upgrade
+		if !c.compress {
+			return data, nil
+		}
+		payload = data
+	} else {
+		payload = encodeBinary(result)
+	}
+
+	var flags byte
+	if c.compress && len(payload) >= c.minCompress {
+		compressed, err := deflate(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(payload) {
+			payload = compressed
+			flags |= flagDeflate
+		}
+	}
+
+	data := make([]byte, 0, codecHeaderSize+len(payload))
+	data = append(data, codecMagic, c.format, flags)
+	return append(data, payload...), nil
+}
+
+// Decode deserializes a result written by any codec configuration,
+// including bare JSON from earlier releases
+func (c *Codec) Decode(data []byte) (*CachedResult, error) {
+	var result CachedResult
+
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptEntry, err)
+		}
+		return &result, nil
+	}
+
+	if len(data) < codecHeaderSize || data[0] != codecMagic {
+		return nil, fmt.Errorf("%w: unknown format", ErrCorruptEntry)
+	}
+
+	format, flags, payload := data[1], data[2], data[codecHeaderSize:]
+
+	if flags&flagDeflate != 0 {
+		var err error
+		if payload, err = inflate(payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptEntry, err)
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		if err := json.Unmarshal(payload, &result); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptEntry, err)
+		}
+	case formatBinaryV1:
+		if err := decodeBinary(payload, &result); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown format %d", ErrCorruptEntry, format)
+	}
+
+	return &result, nil
+}
+
+// encodeBinary writes a result as a sequence of signed varints:
+//
+//	items, total items, total packs, waste, calculation ms,
+//	cached at (Unix ns, 0 for the zero time), hit count, TTL (ns),
+//	pack size count, pack sizes...,
+//	result count, (pack size, count) pairs sorted by pack size
+func encodeBinary(r *CachedResult) []byte {
+	buf := make([]byte, 0, 64+binary.MaxVarintLen64*(len(r.PackSizes)+2*len(r.Result)))
+
+	var cachedAt int64
+	if !r.CachedAt.IsZero() {
+		cachedAt = r.CachedAt.UnixNano()
+	}
+
+	for _, v := range []int64{
+		int64(r.Items),
+		int64(r.TotalItems),
+		int64(r.TotalPacks),
+		int64(r.Waste),
+		r.CalculationTimeMs,
+		cachedAt,
+		int64(r.HitCount),
+		int64(r.CurrentTTL),
+	} {
+		buf = binary.AppendVarint(buf, v)
+	}
+
+	buf = binary.AppendVarint(buf, int64(len(r.PackSizes)))
+	for _, size := range r.PackSizes {
+		buf = binary.AppendVarint(buf, int64(size))
+	}
+
+	sizes := make([]int, 0, len(r.Result))
+	for size := range r.Result {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+
+	buf = binary.AppendVarint(buf, int64(len(sizes)))
+	for _, size := range sizes {
+		buf = binary.AppendVarint(buf, int64(size))
+		buf = binary.AppendVarint(buf, int64(r.Result[size]))
+	}
+
+	return buf
+}
+
+// decodeBinary reads a result written by encodeBinary
+func decodeBinary(data []byte, r *CachedResult) error {
+	d := varintReader{data: data}
+
+	r.Items = int(d.next())
+	r.TotalItems = int(d.next())
+	r.TotalPacks = int(d.next())
+	r.Waste = int(d.next())
+	r.CalculationTimeMs = d.next()
+	if cachedAt := d.next(); cachedAt != 0 {
+		r.CachedAt = time.Unix(0, cachedAt)
+	}
+	r.HitCount = int(d.next())
+	r.CurrentTTL = time.Duration(d.next())
+
+	n := d.length()
+	r.PackSizes = make([]int, n)
+	for i := range r.PackSizes {
+		r.PackSizes[i] = int(d.next())
+	}
+
+	n = d.length()
+	r.Result = make(map[int]int, n)
+	for i := 0; i < n; i++ {
+		size := int(d.next())
+		r.Result[size] = int(d.next())
+	}
+
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%w: %d trailing bytes", ErrCorruptEntry, len(d.data))
+	}
+	return d.err
+}
+
+// varintReader reads signed varints and remembers the first error
+type varintReader struct {
+	data []byte
+	err  error
+}
+
+// next returns the next varint, or 0 once an error has occurred
+func (d *varintReader) next() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: truncated varint", ErrCorruptEntry)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// length returns the next varint as a slice length. Each element takes at
+// least one byte, which bounds allocations for corrupt input.
+func (d *varintReader) length() int {
+	n := d.next()
+	if d.err == nil && (n < 0 || n > int64(len(d.data))) {
+		d.err = fmt.Errorf("%w: invalid length %d", ErrCorruptEntry, n)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// flateWriters reuses compressors, which are expensive to allocate
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// deflate compresses data
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflate decompresses data, refusing output over maxDecodedSize
+func inflate(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecodedSize {
+		return nil, errors.New("decoded entry too large")
+	}
+	return out, nil
+}
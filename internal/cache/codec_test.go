@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sampleResult returns a cached result for a pack set of n sizes
+func sampleResult(n int) *CachedResult {
+	packSizes := make([]int, n)
+	result := make(map[int]int, n)
+	for i := range packSizes {
+		packSizes[i] = 250 * (i + 1)
+		result[packSizes[i]] = i + 1
+	}
+
+	return &CachedResult{
+		Items:             12001,
+		PackSizes:         packSizes,
+		Result:            result,
+		TotalItems:        12250,
+		TotalPacks:        4,
+		Waste:             249,
+		CalculationTimeMs: 3,
+		CachedAt:          time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC),
+		HitCount:          7,
+		CurrentTTL:        40 * time.Minute,
+	}
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  CodecConfig
+		size int
+	}{
+		{"binary", CodecConfig{Format: CodecBinary}, 5},
+		{"json", CodecConfig{Format: CodecJSON}, 5},
+		{"binary deflate", CodecConfig{Format: CodecBinary, Compression: CompressionDeflate}, 500},
+		{"json deflate", CodecConfig{Format: CodecJSON, Compression: CompressionDeflate}, 500},
+		{"below compression threshold", CodecConfig{Compression: CompressionDeflate, MinCompress: 1 << 20}, 500},
+		{"empty pack set", CodecConfig{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := NewCodec(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create codec: %v", err)
+			}
+
+			want := sampleResult(tt.size)
+			data, err := codec.Encode(want)
+			if err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+
+			got, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+
+			if !got.CachedAt.Equal(want.CachedAt) {
+				t.Errorf("Expected cached at %v, got %v", want.CachedAt, got.CachedAt)
+			}
+			got.CachedAt = want.CachedAt
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Round trip mismatch:\nwant %+v\ngot  %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestCodec_ReadsOtherFormats(t *testing.T) {
+	want := sampleResult(5)
+
+	// Entries written before the codec existed are bare JSON
+	legacy, _ := json.Marshal(want)
+
+	jsonCodec, _ := NewCodec(CodecConfig{Format: CodecJSON, Compression: CompressionDeflate})
+	jsonData, _ := jsonCodec.Encode(sampleResult(500))
+
+	binaryCodec, _ := NewCodec(CodecConfig{Format: CodecBinary})
+	for name, data := range map[string][]byte{"legacy JSON": legacy, "compressed JSON": jsonData} {
+		if _, err := binaryCodec.Decode(data); err != nil {
+			t.Errorf("Binary codec failed to decode %s: %v", name, err)
+		}
+	}
+
+	got, _ := binaryCodec.Decode(legacy)
+	if got.Items != want.Items || got.Result[500] != 2 || got.CurrentTTL != want.CurrentTTL {
+		t.Errorf("Unexpected legacy result: %+v", got)
+	}
+}
+
+func TestCodec_UncompressedJSONHasNoHeader(t *testing.T) {
+	codec, _ := NewCodec(CodecConfig{Format: CodecJSON})
+	data, _ := codec.Encode(sampleResult(3))
+
+	// Older releases can only read bare JSON
+	var result CachedResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Errorf("Expected bare JSON, got error: %v", err)
+	}
+}
+
+func TestCodec_BinaryIsSmaller(t *testing.T) {
+	codec, _ := NewCodec(CodecConfig{Format: CodecBinary})
+
+	for _, size := range []int{3, 50} {
+		result := sampleResult(size)
+		legacy, _ := json.Marshal(result)
+		data, _ := codec.Encode(result)
+
+		if len(data)*2 > len(legacy) {
+			t.Errorf("Pack set of %d: expected binary (%d bytes) to be under half of JSON (%d bytes)", size, len(data), len(legacy))
+		}
+	}
+}
+
+func TestCodec_CorruptEntries(t *testing.T) {
+	codec, _ := NewCodec(CodecConfig{})
+	valid, _ := codec.Encode(sampleResult(5))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown magic", []byte{0x00, formatBinaryV1, 0}},
+		{"header only", valid[:codecHeaderSize]},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+		{"unknown format", []byte{codecMagic, 99, 0}},
+		{"bad deflate", []byte{codecMagic, formatBinaryV1, flagDeflate, 0xFF, 0xFF}},
+		{"huge length", []byte{codecMagic, formatBinaryV1, 0, 2, 2, 2, 2, 2, 2, 2, 2, 0xFE, 0xFF, 0xFF, 0xFF, 0x0F}},
+		{"broken JSON", []byte(`{"items":`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := codec.Decode(tt.data); !errors.Is(err, ErrCorruptEntry) {
+				t.Errorf("Expected ErrCorruptEntry, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewCodec_Invalid(t *testing.T) {
+	if _, err := NewCodec(CodecConfig{Format: "msgpack"}); err == nil {
+		t.Error("Expected error for unknown codec")
+	}
+
+	if _, err := NewCodec(CodecConfig{Compression: "zstd"}); err == nil {
+		t.Error("Expected error for unknown compression")
+	}
+}
+
+func TestLoadCodecConfig(t *testing.T) {
+	t.Setenv("CACHE_CODEC", "json")
+	t.Setenv("CACHE_COMPRESSION", "deflate")
+	t.Setenv("CACHE_COMPRESSION_MIN_BYTES", "")
+
+	cfg := LoadCodecConfig()
+	if cfg.Format != CodecJSON || cfg.Compression != CompressionDeflate || cfg.MinCompress != 256 {
+		t.Errorf("Unexpected codec config: %+v", cfg)
+	}
+
+	codec, err := NewCodec(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	if codec.Name() != "json+deflate" {
+		t.Errorf("Expected codec name json+deflate, got %s", codec.Name())
+	}
+}
+
+func TestRedisCache_ReadsLegacyJSON(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	legacy, _ := json.Marshal(sampleResult(5))
+	key := cache.generateKey(12001, sampleResult(5).PackSizes)
+	mr.Set(key, string(legacy))
+
+	cached, found := cache.Get(12001, sampleResult(5).PackSizes)
+	if !found {
+		t.Fatal("Expected legacy JSON entry to be read")
+	}
+
+	if cached.HitCount != 8 {
+		t.Errorf("Expected hit count 8, got %d", cached.HitCount)
+	}
+
+	// The hit rewrites the entry with the configured codec
+	stored, _ := mr.Get(key)
+	if stored[0] != codecMagic {
+		t.Error("Expected entry to be rewritten in the binary format")
+	}
+}
+
+// Benchmarks compare the legacy JSON path with the configurable codecs
+
+func benchmarkEncode(b *testing.B, cfg CodecConfig, size int) {
+	codec, _ := NewCodec(cfg)
+	result := sampleResult(size)
+	data, _ := codec.Encode(result)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		codec.Encode(result)
+	}
+
+	b.ReportMetric(float64(len(data)), "bytes/entry")
+}
+
+func benchmarkDecode(b *testing.B, cfg CodecConfig, size int) {
+	codec, _ := NewCodec(cfg)
+	data, _ := codec.Encode(sampleResult(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		codec.Decode(data)
+	}
+}
+
+var (
+	benchJSON          = CodecConfig{Format: CodecJSON}
+	benchBinary        = CodecConfig{Format: CodecBinary}
+	benchBinaryDeflate = CodecConfig{Format: CodecBinary, Compression: CompressionDeflate}
+)
+
+func BenchmarkEncode_JSON_Small(b *testing.B)          { benchmarkEncode(b, benchJSON, 5) }
+func BenchmarkEncode_Binary_Small(b *testing.B)        { benchmarkEncode(b, benchBinary, 5) }
+func BenchmarkEncode_JSON_Large(b *testing.B)          { benchmarkEncode(b, benchJSON, 200) }
+func BenchmarkEncode_Binary_Large(b *testing.B)        { benchmarkEncode(b, benchBinary, 200) }
+func BenchmarkEncode_BinaryDeflate_Large(b *testing.B) { benchmarkEncode(b, benchBinaryDeflate, 200) }
+
+func BenchmarkDecode_JSON_Small(b *testing.B)          { benchmarkDecode(b, benchJSON, 5) }
+func BenchmarkDecode_Binary_Small(b *testing.B)        { benchmarkDecode(b, benchBinary, 5) }
+func BenchmarkDecode_JSON_Large(b *testing.B)          { benchmarkDecode(b, benchJSON, 200) }
+func BenchmarkDecode_Binary_Large(b *testing.B)        { benchmarkDecode(b, benchBinary, 200) }
+func BenchmarkDecode_BinaryDeflate_Large(b *testing.B) { benchmarkDecode(b, benchBinaryDeflate, 200) }
@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"container/list"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryCache is an in-process LRU cache with the same adaptive TTL
+// behaviour as the Redis backend. Stats are local to the process.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxTTL     time.Duration // Caps entry lifetime; 0 means no cap
+	order      *list.List    // Front is most recently used
+	entries    map[string]*list.Element
+	ttl        TTLPolicy
+	hits       atomic.Int64
+	misses     atomic.Int64
+	startTime  time.Time
+	now        func() time.Time
+}
+
+// memoryEntry is a single LRU element
+type memoryEntry struct {
+	key       string
+	result    CachedResult
+	expiresAt time.Time // Zero for entries that never expire
+}
+
+// NewMemoryCache creates an in-memory cache holding at most maxEntries
+// results. A non-zero maxTTL caps how long any entry is kept.
+func NewMemoryCache(maxEntries int, maxTTL time.Duration) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxTTL:     maxTTL,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		ttl:        defaultTTLPolicy(),
+		startTime:  time.Now(),
+		now:        time.Now,
+	}
+}
+
+// IsEnabled returns whether caching is enabled
+func (c *MemoryCache) IsEnabled() bool {
+	return true
+}
+
+// Get retrieves a cached result and updates its TTL
+func (c *MemoryCache) Get(items int, packSizes []int) (*CachedResult, bool) {
+	key := entryKey(items, packSizes)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		countLookup(BackendMemory, false)
+		return nil, false
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	now := c.now()
+	if entry.expired(now) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		countLookup(BackendMemory, false)
+		return nil, false
+	}
+
+	// Cache hit! Update TTL as the policy dictates
+	entry.result.HitCount++
+	entry.result.CurrentTTL = c.ttl.Next(&entry.result, now)
+	entry.expiresAt = c.expiry(now, entry.result.CurrentTTL)
+	c.order.MoveToFront(elem)
+
+	c.hits.Add(1)
+	countLookup(BackendMemory, true)
+	result := entry.result.clone()
+	return &result, true
+}
+
+// Contains reports whether an unexpired result is cached
+func (c *MemoryCache) Contains(items int, packSizes []int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[entryKey(items, packSizes)]
+	return ok && !elem.Value.(*memoryEntry).expired(c.now())
+}
+
+// Set stores a calculation result in cache
+func (c *MemoryCache) Set(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int, calcTime int64) error {
+	c.store(entryKey(items, packSizes), &CachedResult{
+		Items:             items,
+		PackSizes:         packSizes,
+		Result:            result,
+		TotalItems:        totalItems,
+		TotalPacks:        totalPacks,
+		Waste:             waste,
+		CalculationTimeMs: calcTime,
+		CachedAt:          c.now(),
+		HitCount:          0,
+		CurrentTTL:        c.ttl.Initial(packSizes),
+	})
+	return nil
+}
+
+// store inserts or replaces an entry, keeping the result's current TTL.
+// The entry keeps its own copy of the result, and Get hands out copies, so
+// callers mutating theirs cannot corrupt it.
+func (c *MemoryCache) store(key string, result *CachedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored := result.clone()
+	result = &stored
+
+	expiresAt := c.expiry(c.now(), result.CurrentTTL)
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.result = *result
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{
+		key:       key,
+		result:    *result,
+		expiresAt: expiresAt,
+	})
+
+	// Evict least recently used entries over capacity
+	for c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// GetStats returns cache statistics
+func (c *MemoryCache) GetStats() (*CacheStats, error) {
+	c.mu.Lock()
+	totalKeys := int64(len(c.entries))
+	c.mu.Unlock()
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+
+	return &CacheStats{
+		Backend:    BackendMemory,
+		Enabled:    true,
+		Hits:       hits,
+		Misses:     misses,
+		HitRate:    hitPercentage(hits, misses),
+		TotalKeys:  totalKeys,
+		TTLPolicy:  c.ttl.Name(),
+		MemoryUsed: "N/A",
+		Uptime:     time.Since(c.startTime).Round(time.Second).String(),
+	}, nil
+}
+
+// Clear removes all cache entries and resets stats
+func (c *MemoryCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.hits.Store(0)
+	c.misses.Store(0)
+	return nil
+}
+
+// ClearPackSizes removes the cache entries for a single pack set
+func (c *MemoryCache) ClearPackSizes(packSizes []int) (int64, error) {
+	prefix := packSetPrefix(packSizes)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deleted int64
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(elem)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// SetCurrentPackSizes reports the configured pack sizes to the TTL
+// policy. With the never policy, entries pinned for the previous
+// configuration are removed.
+func (c *MemoryCache) SetCurrentPackSizes(packSizes []int) {
+	if unpinned := updateCurrentPackSizes(c.ttl, packSizes); unpinned != nil {
+		c.ClearPackSizes(unpinned)
+	}
+}
+
+// Close is a no-op for the in-memory cache
+func (c *MemoryCache) Close() error {
+	return nil
+}
+
+// expiry returns when an entry stored at now with the given TTL expires,
+// applying the cache's maximum entry lifetime
+func (c *MemoryCache) expiry(now time.Time, ttl time.Duration) time.Time {
+	if c.maxTTL > 0 && (ttl == NoExpiry || ttl > c.maxTTL) {
+		ttl = c.maxTTL
+	}
+	if ttl == NoExpiry {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// expired reports whether the entry has expired at now
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// removeElement unlinks an entry; the caller must hold c.mu
+func (c *MemoryCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*memoryEntry).key)
+}
+
+// clone returns a copy of r that shares no slice or map with it
+func (r CachedResult) clone() CachedResult {
+	r.PackSizes = slices.Clone(r.PackSizes)
+	r.Result = maps.Clone(r.Result)
+	return r
+}
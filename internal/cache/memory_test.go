@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+)
+
+func TestMemoryCache_SetAndGet(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+
+	err := cache.Set(250, []int{250, 500, 1000}, map[int]int{250: 1}, 250, 1, 0, 5)
+	if err != nil {
+		t.Fatalf("Failed to set cache: %v", err)
+	}
+
+	// Pack size order must not matter
+	cached, found := cache.Get(250, []int{1000, 500, 250})
+	if !found {
+		t.Fatal("Expected cache hit, got miss")
+	}
+
+	if cached.TotalItems != 250 {
+		t.Errorf("Expected total items 250, got %d", cached.TotalItems)
+	}
+
+	if cached.HitCount != 1 {
+		t.Errorf("Expected hit count 1, got %d", cached.HitCount)
+	}
+
+	if _, found := cache.Get(999, []int{250, 500, 1000}); found {
+		t.Error("Expected cache miss for unknown items")
+	}
+}
+
+func TestMemoryCache_Isolation(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+
+	packSizes := []int{250, 500}
+	result := map[int]int{250: 1}
+	cache.Set(250, packSizes, result, 250, 1, 0, 5)
+
+	// Neither the caller's values nor a hit share the cached entry
+	packSizes[0] = 1
+	result[250] = 99
+	cached, _ := cache.Get(250, []int{250, 500})
+	cached.Result[500] = 7
+	cached.PackSizes[1] = 2
+
+	cached, _ = cache.Get(250, []int{250, 500})
+	if len(cached.Result) != 1 || cached.Result[250] != 1 || cached.PackSizes[0] != 250 || cached.PackSizes[1] != 500 {
+		t.Errorf("Expected the cached entry unchanged, got %+v", cached)
+	}
+}
+
+func TestMemoryCache_Metrics(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+	hits := metrics.CacheRequests.WithLabelValues(BackendMemory, "hit")
+	misses := metrics.CacheRequests.WithLabelValues(BackendMemory, "miss")
+	beforeHits, beforeMisses := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 5)
+	cache.Get(250, []int{250, 500})
+	cache.Get(250, []int{250, 500})
+	cache.Get(251, []int{250, 500})
+
+	if got := testutil.ToFloat64(hits) - beforeHits; got != 2 {
+		t.Errorf("Expected 2 hits, got %v", got)
+	}
+	if got := testutil.ToFloat64(misses) - beforeMisses; got != 1 {
+		t.Errorf("Expected 1 miss, got %v", got)
+	}
+}
+
+func TestMemoryCache_AdaptiveTTL(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	for i, want := range []time.Duration{InitialTTL * 2, InitialTTL * 4, InitialTTL * 8} {
+		cached, found := cache.Get(250, []int{250, 500})
+		if !found {
+			t.Fatal("Expected cache hit")
+		}
+		if cached.CurrentTTL != want {
+			t.Errorf("Hit %d: expected TTL %v, got %v", i+1, want, cached.CurrentTTL)
+		}
+	}
+}
+
+func TestMemoryCache_Expiry(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	// Still valid just before the initial TTL runs out
+	now = now.Add(InitialTTL - time.Second)
+	if _, found := cache.Get(250, []int{250, 500}); !found {
+		t.Fatal("Expected cache hit before expiry")
+	}
+
+	// The hit doubled the TTL, measured from the hit
+	now = now.Add(InitialTTL*2 + time.Second)
+	if _, found := cache.Get(250, []int{250, 500}); found {
+		t.Error("Expected cache miss after expiry")
+	}
+
+	stats, _ := cache.GetStats()
+	if stats.TotalKeys != 0 {
+		t.Errorf("Expected expired entry to be removed, got %d keys", stats.TotalKeys)
+	}
+}
+
+func TestMemoryCache_MaxTTLCap(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	now = now.Add(time.Minute + time.Second)
+	if _, found := cache.Get(250, []int{250, 500}); found {
+		t.Error("Expected entry lifetime to be capped at maxTTL")
+	}
+}
+
+func TestMemoryCache_Contains(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if !cache.Contains(250, []int{250, 500}) {
+		t.Fatal("Expected Contains to be true after Set")
+	}
+
+	// Contains must not extend the TTL or count a hit
+	now = now.Add(InitialTTL)
+	if cache.Contains(250, []int{250, 500}) {
+		t.Error("Expected Contains to be false after expiry")
+	}
+
+	stats, _ := cache.GetStats()
+	if stats.Hits != 0 {
+		t.Errorf("Expected 0 hits after Contains, got %d", stats.Hits)
+	}
+}
+
+func TestMemoryCache_LRUEviction(t *testing.T) {
+	cache := NewMemoryCache(2, 0)
+
+	cache.Set(100, []int{250}, map[int]int{250: 1}, 250, 1, 150, 0)
+	cache.Set(200, []int{250}, map[int]int{250: 1}, 250, 1, 50, 0)
+
+	// Touch 100 so that 200 becomes the least recently used entry
+	cache.Get(100, []int{250})
+	cache.Set(300, []int{250}, map[int]int{250: 2}, 500, 2, 200, 0)
+
+	if _, found := cache.Get(200, []int{250}); found {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+
+	for _, items := range []int{100, 300} {
+		if _, found := cache.Get(items, []int{250}); !found {
+			t.Errorf("Expected entry for items %d to be kept", items)
+		}
+	}
+}
+
+func TestMemoryCache_ClearPackSizes(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+
+	cache.Set(100, []int{250, 500}, map[int]int{250: 1}, 250, 1, 150, 0)
+	cache.Set(200, []int{250, 500}, map[int]int{250: 1}, 250, 1, 50, 0)
+	cache.Set(100, []int{23, 31}, map[int]int{23: 5}, 115, 5, 15, 0)
+
+	deleted, err := cache.ClearPackSizes([]int{500, 250})
+	if err != nil {
+		t.Fatalf("Failed to clear pack sizes: %v", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted entries, got %d", deleted)
+	}
+
+	if _, found := cache.Get(100, []int{23, 31}); !found {
+		t.Error("Expected entries for other pack sets to survive")
+	}
+}
+
+func TestMemoryCache_StatsAndClear(t *testing.T) {
+	cache := NewMemoryCache(10, 0)
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+	cache.Get(250, []int{250, 500}) // Hit
+	cache.Get(999, []int{250, 500}) // Miss
+
+	stats, err := cache.GetStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.Backend != BackendMemory {
+		t.Errorf("Expected backend %s, got %s", BackendMemory, stats.Backend)
+	}
+
+	if stats.Hits != 1 || stats.Misses != 1 || stats.HitRate != 50 {
+		t.Errorf("Expected 1 hit, 1 miss and 50%% hit rate, got %+v", stats)
+	}
+
+	if stats.TotalKeys != 1 {
+		t.Errorf("Expected 1 key, got %d", stats.TotalKeys)
+	}
+
+	cache.Clear()
+
+	stats, _ = cache.GetStats()
+	if stats.TotalKeys != 0 || stats.Hits != 0 {
+		t.Errorf("Expected empty cache after clear, got %+v", stats)
+	}
+}
@@ -0,0 +1,584 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// RedisCache handles Redis caching operations. A background prober
+// enables and disables the cache as Redis comes and goes, and every call
+// goes through a circuit breaker so an unhealthy Redis fails fast.
+type RedisCache struct {
+	client    redis.UniversalClient
+	enabled   atomic.Bool // Redis answered the last health probe
+	breaker   *CircuitBreaker
+	codec     *Codec
+	ttl       TTLPolicy
+	now       func() time.Time
+	ctx       context.Context
+	stopProbe context.CancelFunc
+	probeDone chan struct{}
+}
+
+// NewRedisCache creates a Redis-backed cache. If Redis cannot be reached
+// the cache starts disabled and is enabled once the prober reaches it.
+// An error is returned only for invalid configuration.
+func NewRedisCache(cfg RedisConfig) (*RedisCache, error) {
+	codec, err := NewCodec(LoadCodecConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := cfg.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newRedisCache(client, LoadBreakerConfig())
+	c.codec = codec
+
+	// Test connection
+	if err := c.Ping(); err != nil {
+		logger.Log.Warn("Failed to connect to Redis. Cache disabled until it becomes reachable.",
+			zap.String("mode", cfg.Mode),
+			zap.String("address", cfg.Endpoint()),
+			zap.Error(err),
+		)
+	} else {
+		c.enabled.Store(true)
+		logger.Log.Info("Redis cache enabled",
+			zap.String("mode", cfg.Mode),
+			zap.String("address", cfg.Endpoint()),
+			zap.Bool("tls", cfg.TLS.Enabled || strings.HasPrefix(cfg.URL, "rediss://")),
+			zap.String("codec", codec.Name()),
+		)
+	}
+
+	c.startProber(healthInterval())
+	return c, nil
+}
+
+// newRedisCache wraps a client without probing it, using the default codec
+func newRedisCache(client redis.UniversalClient, breakerCfg BreakerConfig) *RedisCache {
+	codec, _ := NewCodec(CodecConfig{})
+	return &RedisCache{
+		client:  client,
+		breaker: NewCircuitBreaker(breakerCfg),
+		codec:   codec,
+		ttl:     defaultTTLPolicy(),
+		now:     time.Now,
+		ctx:     context.Background(),
+	}
+}
+
+// healthInterval returns the Redis health probe interval
+func healthInterval() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("REDIS_HEALTH_INTERVAL")); err == nil && v > 0 {
+		return v
+	}
+	return 5 * time.Second
+}
+
+// startProber pings Redis periodically and flips the enabled flag when
+// reachability changes
+func (c *RedisCache) startProber(interval time.Duration) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.stopProbe = cancel
+	c.probeDone = make(chan struct{})
+
+	go func() {
+		defer close(c.probeDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.probe()
+			}
+		}
+	}()
+}
+
+// probe runs one health check
+func (c *RedisCache) probe() {
+	err := c.Ping()
+	healthy := err == nil
+
+	if c.enabled.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		// Redis is back: don't wait for the breaker's open timeout
+		c.breaker.Reset()
+		logger.Log.Info("Redis is reachable again. Cache enabled.")
+	} else {
+		logger.Log.Warn("Redis health check failed. Cache disabled.", zap.Error(err))
+	}
+}
+
+// Ping checks the connection, bypassing the circuit breaker
+func (c *RedisCache) Ping() error {
+	ctx, cancel := context.WithTimeout(c.ctx, 2*time.Second)
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// do runs a Redis call through the circuit breaker. redis.Nil is a normal
+// reply, not a failure.
+func (c *RedisCache) do(call func() error) error {
+	gen, ok := c.breaker.Allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	err := call()
+	if err != nil && err != redis.Nil {
+		c.breaker.Failure(gen)
+		metrics.CacheErrors.WithLabelValues(BackendRedis).Inc()
+	} else {
+		c.breaker.Success(gen)
+	}
+	return err
+}
+
+// IsEnabled returns whether caching is enabled
+func (c *RedisCache) IsEnabled() bool {
+	return c.enabled.Load()
+}
+
+// CircuitState returns the state of the Redis circuit breaker
+func (c *RedisCache) CircuitState() BreakerState {
+	if c.breaker == nil {
+		return StateClosed
+	}
+	return c.breaker.State()
+}
+
+// generateKey creates a cache key from items and pack sizes
+func (c *RedisCache) generateKey(items int, packSizes []int) string {
+	return entryKey(items, packSizes)
+}
+
+// Get retrieves a cached result and updates its TTL
+func (c *RedisCache) Get(items int, packSizes []int) (*CachedResult, bool) {
+	if !c.IsEnabled() {
+		return nil, false
+	}
+
+	key := c.generateKey(items, packSizes)
+
+	// Get the cached data
+	var data []byte
+	err := c.do(func() (err error) {
+		data, err = c.client.Get(c.ctx, key).Bytes()
+		return err
+	})
+	if err == ErrCircuitOpen {
+		// Don't touch Redis at all while the circuit is open
+		countLookup(BackendRedis, false)
+		return nil, false
+	} else if err == redis.Nil {
+		// Cache miss
+		c.incrementMisses()
+		countLookup(BackendRedis, false)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Cache get error: %v", err)
+		c.incrementMisses()
+		countLookup(BackendRedis, false)
+		return nil, false
+	}
+
+	// Deserialize
+	result, err := c.codec.Decode(data)
+	if err != nil {
+		log.Printf("Cache decode error: %v", err)
+		metrics.CacheErrors.WithLabelValues(BackendRedis).Inc()
+		c.incrementMisses()
+		countLookup(BackendRedis, false)
+		return nil, false
+	}
+
+	// Cache hit! Update TTL as the policy dictates
+	result.HitCount++
+	newTTL := c.ttl.Next(result, c.now())
+	result.CurrentTTL = newTTL
+
+	// Save back with updated TTL and hit count
+	if err := c.set(key, result, newTTL); err != nil {
+		log.Printf("Failed to update cache TTL: %v", err)
+	}
+
+	c.incrementHits()
+	countLookup(BackendRedis, true)
+	return result, true
+}
+
+// Contains reports whether a result is cached
+func (c *RedisCache) Contains(items int, packSizes []int) bool {
+	if !c.IsEnabled() {
+		return false
+	}
+
+	var exists int64
+	err := c.do(func() (err error) {
+		exists, err = c.client.Exists(c.ctx, c.generateKey(items, packSizes)).Result()
+		return err
+	})
+	return err == nil && exists > 0
+}
+
+// Set stores a calculation result in cache
+func (c *RedisCache) Set(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int, calcTime int64) error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	key := c.generateKey(items, packSizes)
+	ttl := c.ttl.Initial(packSizes)
+
+	cached := &CachedResult{
+		Items:             items,
+		PackSizes:         packSizes,
+		Result:            result,
+		TotalItems:        totalItems,
+		TotalPacks:        totalPacks,
+		Waste:             waste,
+		CalculationTimeMs: calcTime,
+		CachedAt:          c.now(),
+		HitCount:          0,
+		CurrentTTL:        ttl,
+	}
+
+	// Skipping the write while the circuit is open is not an error
+	if err := c.set(key, cached, ttl); err != nil && !errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+	return nil
+}
+
+// set is an internal method to store data with a specific TTL. A TTL of
+// NoExpiry stores the entry without expiry.
+func (c *RedisCache) set(key string, result *CachedResult, ttl time.Duration) error {
+	data, err := c.codec.Encode(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache data: %w", err)
+	}
+
+	if err := c.do(func() error { return c.client.Set(c.ctx, key, data, ttl).Err() }); err != nil {
+		return fmt.Errorf("failed to set cache: %w", err)
+	}
+
+	return nil
+}
+
+// GetStats returns cache statistics
+func (c *RedisCache) GetStats() (*CacheStats, error) {
+	if !c.IsEnabled() || c.CircuitState() == StateOpen {
+		return &CacheStats{
+			Backend:      BackendRedis,
+			TTLPolicy:    c.ttl.Name(),
+			Codec:        c.codec.Name(),
+			CircuitState: c.CircuitState(),
+		}, nil
+	}
+
+	// Get hit/miss counts
+	var hits, misses int64
+	c.do(func() (err error) {
+		hits, err = c.client.Get(c.ctx, StatsHitsKey).Int64()
+		return err
+	})
+	c.do(func() (err error) {
+		misses, err = c.client.Get(c.ctx, StatsMissesKey).Int64()
+		return err
+	})
+
+	total := hits + misses
+	hitRate := 0.0
+	if total > 0 {
+		hitRate = float64(hits) / float64(total) * 100
+	}
+
+	// Count entries without blocking Redis
+	totalKeys, estimated, err := c.countKeys()
+	if err != nil {
+		log.Printf("Failed to count cache keys: %v", err)
+	}
+
+	// Get memory info
+	var info string
+	err = c.do(func() (err error) {
+		info, err = c.client.Info(c.ctx, "memory", "server").Result()
+		return err
+	})
+	memoryUsed := "N/A"
+	uptime := "N/A"
+
+	if err == nil {
+		// Parse memory and uptime from info string
+		memoryUsed = parseInfoField(info, "used_memory_human")
+		uptimeSecs := parseInfoField(info, "uptime_in_seconds")
+		if secs, err := strconv.Atoi(uptimeSecs); err == nil {
+			uptime = (time.Duration(secs) * time.Second).String()
+		}
+	}
+
+	return &CacheStats{
+		Backend:            BackendRedis,
+		Enabled:            true,
+		Hits:               hits,
+		Misses:             misses,
+		HitRate:            hitRate,
+		TotalKeys:          totalKeys,
+		TotalKeysEstimated: estimated,
+		MemoryUsed:         memoryUsed,
+		Uptime:             uptime,
+		TTLPolicy:          c.ttl.Name(),
+		Codec:              c.codec.Name(),
+		CircuitState:       c.CircuitState(),
+	}, nil
+}
+
+// Clear removes all cache entries, including those in the key format used
+// before EntryKeyPrefix
+func (c *RedisCache) Clear() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	for _, pattern := range []string{EntryKeyPrefix + "*", legacyEntryPattern} {
+		if _, err := c.unlinkMatching(pattern); err != nil {
+			return err
+		}
+	}
+
+	// Reset stats
+	c.do(func() error { return c.client.Del(c.ctx, StatsHitsKey, StatsMissesKey).Err() })
+
+	return nil
+}
+
+// ClearPackSizes removes the cache entries for a single pack set and
+// returns the number of keys removed. Hit/miss counters are left intact.
+func (c *RedisCache) ClearPackSizes(packSizes []int) (int64, error) {
+	if !c.IsEnabled() {
+		return 0, nil
+	}
+
+	return c.unlinkMatching(packSetPrefix(packSizes) + "*")
+}
+
+// SetCurrentPackSizes reports the configured pack sizes to the TTL
+// policy. With the never policy, entries pinned for the previous
+// configuration are removed.
+func (c *RedisCache) SetCurrentPackSizes(packSizes []int) {
+	if unpinned := updateCurrentPackSizes(c.ttl, packSizes); unpinned != nil {
+		if _, err := c.ClearPackSizes(unpinned); err != nil {
+			log.Printf("Failed to remove entries for previous pack sizes: %v", err)
+		}
+	}
+}
+
+// forEachNode calls fn with every node that holds a share of the keyspace:
+// each master in cluster mode, the client itself otherwise.
+func (c *RedisCache) forEachNode(fn func(node redis.Cmdable) error) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(c.ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(node)
+		})
+	}
+	return fn(c.client)
+}
+
+// unlinkMatching iterates the keyspace with SCAN and removes matching keys
+// in batches with UNLINK, so Redis is never blocked by a single large call.
+func (c *RedisCache) unlinkMatching(pattern string) (int64, error) {
+	_, isCluster := c.client.(*redis.ClusterClient)
+	var deleted atomic.Int64
+
+	err := c.forEachNode(func(node redis.Cmdable) error {
+		var cursor uint64
+		for {
+			var keys []string
+			var next uint64
+			err := c.do(func() (err error) {
+				keys, next, err = node.Scan(c.ctx, cursor, pattern, scanBatchSize).Result()
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to scan cache keys: %w", err)
+			}
+
+			if len(keys) > 0 {
+				n, err := c.unlink(node, keys, isCluster)
+				if err != nil {
+					return fmt.Errorf("failed to delete cache keys: %w", err)
+				}
+				deleted.Add(n)
+			}
+
+			cursor = next
+			if cursor == 0 {
+				return nil
+			}
+		}
+	})
+
+	return deleted.Load(), err
+}
+
+// unlink removes a batch of keys from one node. Cluster nodes reject
+// multi-key commands spanning hash slots, so there each key is unlinked
+// separately in a single pipeline.
+func (c *RedisCache) unlink(node redis.Cmdable, keys []string, perKey bool) (int64, error) {
+	if !perKey {
+		var n int64
+		err := c.do(func() (err error) {
+			n, err = node.Unlink(c.ctx, keys...).Result()
+			return err
+		})
+		return n, err
+	}
+
+	var n int64
+	err := c.do(func() error {
+		cmds, err := node.Pipelined(c.ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Unlink(c.ctx, key)
+			}
+			return nil
+		})
+		for _, cmd := range cmds {
+			n += cmd.(*redis.IntCmd).Val()
+		}
+		return err
+	})
+	return n, err
+}
+
+// countKeys counts cache entries with a bounded SCAN on every node. Small
+// keyspaces are counted exactly; once a node's scan budget is spent, its
+// count is extrapolated from the share of entry keys seen and DBSIZE.
+func (c *RedisCache) countKeys() (int64, bool, error) {
+	var mu sync.Mutex
+	var total int64
+	var estimated bool
+
+	err := c.forEachNode(func(node redis.Cmdable) error {
+		count, sampled, err := c.countNodeKeys(node)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		total += count
+		estimated = estimated || sampled
+		mu.Unlock()
+		return nil
+	})
+
+	return total, estimated, err
+}
+
+// countNodeKeys counts the cache entries held by a single node
+func (c *RedisCache) countNodeKeys(node redis.Cmdable) (int64, bool, error) {
+	var scanned, matched int64
+	var cursor uint64
+
+	for i := 0; i < maxCountScanCalls; i++ {
+		var keys []string
+		var next uint64
+		err := c.do(func() (err error) {
+			keys, next, err = node.Scan(c.ctx, cursor, "", scanBatchSize).Result()
+			return err
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to scan cache keys: %w", err)
+		}
+
+		scanned += int64(len(keys))
+		for _, key := range keys {
+			if strings.HasPrefix(key, EntryKeyPrefix) {
+				matched++
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return matched, false, nil
+		}
+	}
+
+	var size int64
+	err := c.do(func() (err error) {
+		size, err = node.DBSize(c.ctx).Result()
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get database size: %w", err)
+	}
+	if scanned == 0 {
+		return 0, true, nil
+	}
+
+	return int64(float64(matched) / float64(scanned) * float64(size)), true, nil
+}
+
+// Close stops the health prober and closes the Redis connection
+func (c *RedisCache) Close() error {
+	if c.stopProbe != nil {
+		c.stopProbe()
+		<-c.probeDone
+	}
+
+	if c.client != nil {
+		return c.client.Close()
+	}
+	return nil
+}
+
+// incrementHits increments the cache hit counter
+func (c *RedisCache) incrementHits() {
+	c.do(func() error { return c.client.Incr(c.ctx, StatsHitsKey).Err() })
+}
+
+// incrementMisses increments the cache miss counter
+func (c *RedisCache) incrementMisses() {
+	c.do(func() error { return c.client.Incr(c.ctx, StatsMissesKey).Err() })
+}
+
+// parseInfoField extracts a field value from Redis INFO output
+func parseInfoField(info, field string) string {
+	lines := []byte(info)
+	start := 0
+	for i := 0; i < len(lines); i++ {
+		if lines[i] == '\n' {
+			line := string(lines[start:i])
+			start = i + 1
+
+			if len(line) > len(field)+1 && line[:len(field)] == field && line[len(field)] == ':' {
+				return line[len(field)+1:]
+			}
+		}
+	}
+	return ""
+}
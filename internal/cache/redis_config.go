@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis deployment modes accepted by REDIS_MODE
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+// RedisConfig describes how to connect to Redis
+type RedisConfig struct {
+	Mode     string   // standalone, sentinel or cluster
+	URL      string   // redis:// or rediss:// URL (standalone only); Username, Password and DB override its own
+	Addrs    []string // Server address, sentinel addresses or cluster seed nodes
+	Username string   // ACL user
+	Password string
+	DB       int  // Database number (not supported in cluster mode)
+	DBSet    bool // Whether DB was given, so that it overrides the URL's even when 0
+
+	// Sentinel settings
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+
+	TLS RedisTLSConfig
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolSize     int
+	MinIdleConns int
+}
+
+// RedisTLSConfig configures TLS for Redis connections
+type RedisTLSConfig struct {
+	Enabled            bool
+	CAFile             string // PEM bundle used to verify the server; system roots if empty
+	CertFile           string // Client certificate for mutual TLS
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// LoadRedisConfig reads the Redis connection settings from the environment
+func LoadRedisConfig() RedisConfig {
+	cfg := RedisConfig{
+		Mode:             strings.ToLower(os.Getenv("REDIS_MODE")),
+		URL:              os.Getenv("REDIS_URL"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		MasterName:       os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelUsername: os.Getenv("REDIS_SENTINEL_USERNAME"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		TLS: RedisTLSConfig{
+			Enabled:            os.Getenv("REDIS_TLS") == "true",
+			CAFile:             os.Getenv("REDIS_TLS_CA_FILE"),
+			CertFile:           os.Getenv("REDIS_TLS_CERT_FILE"),
+			KeyFile:            os.Getenv("REDIS_TLS_KEY_FILE"),
+			ServerName:         os.Getenv("REDIS_TLS_SERVER_NAME"),
+			InsecureSkipVerify: os.Getenv("REDIS_TLS_INSECURE_SKIP_VERIFY") == "true",
+		},
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+		PoolSize:     10,
+		MinIdleConns: 5,
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = RedisModeStandalone
+	}
+
+	addrs := os.Getenv("REDIS_ADDRS")
+	if addrs == "" {
+		addrs = os.Getenv("REDIS_ADDR")
+	}
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Addrs = append(cfg.Addrs, addr)
+		}
+	}
+	if len(cfg.Addrs) == 0 && cfg.URL == "" {
+		cfg.Addrs = []string{"localhost:6379"}
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		cfg.DB, cfg.DBSet = v, true
+	}
+
+	return cfg
+}
+
+// Endpoint returns a printable description of the configured server(s)
+func (cfg RedisConfig) Endpoint() string {
+	if cfg.URL != "" && cfg.Mode == RedisModeStandalone {
+		// Never log credentials embedded in the URL
+		if opts, err := redis.ParseURL(cfg.URL); err == nil {
+			return opts.Addr
+		}
+		return "invalid URL"
+	}
+	endpoint := strings.Join(cfg.Addrs, ",")
+	if cfg.Mode == RedisModeSentinel {
+		endpoint = cfg.MasterName + "@" + endpoint
+	}
+	return endpoint
+}
+
+// NewClient creates a Redis client for the configured mode
+func (cfg RedisConfig) NewClient() (redis.UniversalClient, error) {
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.URL != "" && cfg.Mode != RedisModeStandalone {
+		return nil, fmt.Errorf("REDIS_URL is only supported in standalone mode, use REDIS_ADDRS in %s mode", cfg.Mode)
+	}
+
+	switch cfg.Mode {
+	case RedisModeStandalone:
+		opts := &redis.Options{
+			Username: cfg.Username,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}
+		if cfg.URL != "" {
+			if opts, err = redis.ParseURL(cfg.URL); err != nil {
+				return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+			}
+			// Explicit settings take precedence over those in the URL
+			if cfg.Username != "" {
+				opts.Username = cfg.Username
+			}
+			if cfg.Password != "" {
+				opts.Password = cfg.Password
+			}
+			if cfg.DBSet || cfg.DB != 0 {
+				opts.DB = cfg.DB
+			}
+		} else if len(cfg.Addrs) > 0 {
+			opts.Addr = cfg.Addrs[0]
+		} else {
+			opts.Addr = "localhost:6379"
+		}
+		if tlsConfig != nil {
+			opts.TLSConfig = tlsConfig
+		} else if opts.TLSConfig != nil && cfg.TLS.ServerName != "" {
+			// rediss:// URL: keep its TLS config but honour an explicit server name
+			opts.TLSConfig.ServerName = cfg.TLS.ServerName
+		}
+		opts.DialTimeout = cfg.DialTimeout
+		opts.ReadTimeout = cfg.ReadTimeout
+		opts.WriteTimeout = cfg.WriteTimeout
+		opts.PoolSize = cfg.PoolSize
+		opts.MinIdleConns = cfg.MinIdleConns
+		return redis.NewClient(opts), nil
+
+	case RedisModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("REDIS_SENTINEL_MASTER is required in sentinel mode")
+		}
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("REDIS_ADDRS is required in sentinel mode")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelUsername: cfg.SentinelUsername,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+			DialTimeout:      cfg.DialTimeout,
+			ReadTimeout:      cfg.ReadTimeout,
+			WriteTimeout:     cfg.WriteTimeout,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+		}), nil
+
+	case RedisModeCluster:
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("REDIS_DB is not supported in cluster mode")
+		}
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("REDIS_ADDRS is required in cluster mode")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			TLSConfig:    tlsConfig,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown REDIS_MODE %q", cfg.Mode)
+	}
+}
+
+// build returns the TLS configuration, or nil when TLS is disabled
+func (t RedisTLSConfig) build() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
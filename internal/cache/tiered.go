@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"go.uber.org/zap"
+)
+
+// TieredCache checks a local L1 cache before a shared L2 cache. L2 hits
+// are copied into L1, and writes go to both tiers.
+type TieredCache struct {
+	l1        *MemoryCache
+	l2        Cache
+	hits      atomic.Int64
+	misses    atomic.Int64
+	startTime time.Time
+}
+
+// NewTieredCache creates a two-level cache
+func NewTieredCache(l1 *MemoryCache, l2 Cache) *TieredCache {
+	return &TieredCache{
+		l1:        l1,
+		l2:        l2,
+		startTime: time.Now(),
+	}
+}
+
+// IsEnabled returns whether caching is enabled. L1 is always available,
+// so the tiered cache keeps working when L2 is down.
+func (c *TieredCache) IsEnabled() bool {
+	return true
+}
+
+// Get checks L1, then L2
+func (c *TieredCache) Get(items int, packSizes []int) (*CachedResult, bool) {
+	if result, found := c.l1.Get(items, packSizes); found {
+		c.hits.Add(1)
+		return result, true
+	}
+
+	result, found := c.l2.Get(items, packSizes)
+	if !found {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	// Promote to L1 with the TTL L2 just granted
+	promoted := *result
+	c.l1.store(entryKey(items, packSizes), &promoted)
+
+	c.hits.Add(1)
+	return result, true
+}
+
+// Contains reports whether either tier holds the result
+func (c *TieredCache) Contains(items int, packSizes []int) bool {
+	return c.l1.Contains(items, packSizes) || c.l2.Contains(items, packSizes)
+}
+
+// Set stores a calculation result in both tiers
+func (c *TieredCache) Set(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int, calcTime int64) error {
+	c.l1.Set(items, packSizes, result, totalItems, totalPacks, waste, calcTime)
+	return c.l2.Set(items, packSizes, result, totalItems, totalPacks, waste, calcTime)
+}
+
+// GetStats returns combined stats plus a breakdown per tier. Hits count
+// requests served by either tier; key and memory figures come from L2.
+func (c *TieredCache) GetStats() (*CacheStats, error) {
+	l1Stats, err := c.l1.GetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	l2Stats, err := c.l2.GetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+
+	return &CacheStats{
+		Backend:            BackendTiered,
+		Enabled:            true,
+		Hits:               hits,
+		Misses:             misses,
+		HitRate:            hitPercentage(hits, misses),
+		TotalKeys:          l2Stats.TotalKeys,
+		TotalKeysEstimated: l2Stats.TotalKeysEstimated,
+		MemoryUsed:         l2Stats.MemoryUsed,
+		TTLPolicy:          l1Stats.TTLPolicy,
+		Codec:              l2Stats.Codec,
+		Uptime:             time.Since(c.startTime).Round(time.Second).String(),
+		Tiers:              []*CacheStats{l1Stats, l2Stats},
+	}, nil
+}
+
+// Clear removes all entries from both tiers. Other processes keep their
+// own L1 entries until they expire.
+func (c *TieredCache) Clear() error {
+	c.l1.Clear()
+	c.hits.Store(0)
+	c.misses.Store(0)
+	return c.l2.Clear()
+}
+
+// ClearPackSizes removes the entries for one pack set from both tiers and
+// returns the number removed from L2
+func (c *TieredCache) ClearPackSizes(packSizes []int) (int64, error) {
+	c.l1.ClearPackSizes(packSizes)
+	return c.l2.ClearPackSizes(packSizes)
+}
+
+// SetCurrentPackSizes reports the configured pack sizes to the TTL
+// policy, which both tiers share. With the never policy, entries pinned
+// for the previous configuration are removed from both tiers.
+func (c *TieredCache) SetCurrentPackSizes(packSizes []int) {
+	if unpinned := updateCurrentPackSizes(c.l1.ttl, packSizes); unpinned != nil {
+		if _, err := c.ClearPackSizes(unpinned); err != nil {
+			logger.Log.Warn("Failed to remove entries for previous pack sizes", zap.Error(err))
+		}
+	}
+}
+
+// CircuitState returns the L2 circuit breaker state
+func (c *TieredCache) CircuitState() BreakerState {
+	if reporter, ok := c.l2.(CircuitReporter); ok {
+		return reporter.CircuitState()
+	}
+	return StateClosed
+}
+
+// Ping checks the connection to L2, if it has one
+func (c *TieredCache) Ping() error {
+	if pinger, ok := c.l2.(interface{ Ping() error }); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Close closes both tiers
+func (c *TieredCache) Close() error {
+	c.l1.Close()
+	return c.l2.Close()
+}
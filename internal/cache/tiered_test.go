@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTieredCache_PromotesL2Hits(t *testing.T) {
+	mr, l2 := setupTestRedis(t)
+	defer mr.Close()
+
+	l1 := NewMemoryCache(10, time.Minute)
+	cache := NewTieredCache(l1, l2)
+
+	// Entry written by another replica: only present in L2
+	l2.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if _, found := cache.Get(250, []int{250, 500}); !found {
+		t.Fatal("Expected L2 hit")
+	}
+
+	// The next lookup is served from L1 even once the L2 entry is gone
+	mr.Del(l2.generateKey(250, []int{250, 500}))
+	if _, found := cache.Get(250, []int{250, 500}); !found {
+		t.Error("Expected L1 hit after promotion")
+	}
+
+	stats, err := cache.GetStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.Backend != BackendTiered || len(stats.Tiers) != 2 {
+		t.Fatalf("Expected tiered stats with 2 tiers, got %+v", stats)
+	}
+
+	if stats.Hits != 2 {
+		t.Errorf("Expected 2 hits, got %d", stats.Hits)
+	}
+
+	if stats.Tiers[0].Backend != BackendMemory || stats.Tiers[0].Hits != 1 {
+		t.Errorf("Expected 1 L1 hit, got %+v", stats.Tiers[0])
+	}
+
+	if stats.Tiers[1].Backend != BackendRedis || stats.Tiers[1].Hits != 1 {
+		t.Errorf("Expected 1 L2 hit, got %+v", stats.Tiers[1])
+	}
+}
+
+func TestTieredCache_SetWritesBothTiers(t *testing.T) {
+	mr, l2 := setupTestRedis(t)
+	defer mr.Close()
+
+	l1 := NewMemoryCache(10, time.Minute)
+	cache := NewTieredCache(l1, l2)
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	if _, found := l1.Get(250, []int{250, 500}); !found {
+		t.Error("Expected entry in L1")
+	}
+
+	if _, found := l2.Get(250, []int{250, 500}); !found {
+		t.Error("Expected entry in L2")
+	}
+
+	deleted, err := cache.ClearPackSizes([]int{250, 500})
+	if err != nil || deleted != 1 {
+		t.Errorf("Expected 1 L2 entry to be cleared, got %d (%v)", deleted, err)
+	}
+
+	if _, found := cache.Get(250, []int{250, 500}); found {
+		t.Error("Expected entry to be cleared from both tiers")
+	}
+}
+
+func TestTieredCache_WorksWithoutL2(t *testing.T) {
+	l2 := &RedisCache{ctx: context.Background()}
+	cache := NewTieredCache(NewMemoryCache(10, time.Minute), l2)
+
+	if err := cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0); err != nil {
+		t.Fatalf("Expected no error with L2 disabled, got: %v", err)
+	}
+
+	if _, found := cache.Get(250, []int{250, 500}); !found {
+		t.Error("Expected L1 hit with L2 disabled")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		backend string
+	}{
+		{"Default is disabled", map[string]string{}, BackendNone},
+		{"Legacy REDIS_ENABLED", map[string]string{"REDIS_ENABLED": "true"}, BackendRedis},
+		{"Explicit backend wins", map[string]string{"REDIS_ENABLED": "true", "CACHE_BACKEND": "tiered"}, BackendTiered},
+		{"Memory backend", map[string]string{"CACHE_BACKEND": "memory"}, BackendMemory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDIS_ENABLED", "")
+			t.Setenv("CACHE_BACKEND", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			if cfg := LoadConfig(); cfg.Backend != tt.backend {
+				t.Errorf("Expected backend %s, got %s", tt.backend, cfg.Backend)
+			}
+		})
+	}
+}
+
+func TestNew_MemoryBackend(t *testing.T) {
+	cache := New(Config{Backend: BackendMemory, MemoryMaxEntries: 10})
+	defer cache.Close()
+
+	if !cache.IsEnabled() {
+		t.Fatal("Expected memory cache to be enabled")
+	}
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+	if _, found := cache.Get(250, []int{250, 500}); !found {
+		t.Error("Expected cache hit")
+	}
+}
@@ -0,0 +1,313 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TTL policy names accepted by CACHE_TTL_POLICY
+const (
+	TTLFixed     = "fixed"
+	TTLDoubling  = "doubling"
+	TTLFrequency = "frequency"
+	TTLNever     = "never"
+)
+
+// NoExpiry is the TTL of entries that never expire
+const NoExpiry time.Duration = 0
+
+// TTLPolicy decides how long cache entries live. Policies receive the
+// current time instead of reading the clock, so they can be tested
+// without waiting.
+type TTLPolicy interface {
+	// Name describes the policy and its parameters
+	Name() string
+	// Initial returns the TTL of a newly stored result
+	Initial(packSizes []int) time.Duration
+	// Next returns the TTL after a hit. The entry's HitCount already
+	// includes the hit and CurrentTTL still holds the previous TTL.
+	Next(entry *CachedResult, now time.Time) time.Duration
+}
+
+// ConfigAware is implemented by caches whose TTL policy depends on the
+// configured pack sizes
+type ConfigAware interface {
+	// SetCurrentPackSizes reports the configured pack sizes
+	SetCurrentPackSizes(packSizes []int)
+}
+
+// TTLConfig selects and tunes the TTL policy
+type TTLConfig struct {
+	Policy  string        // fixed, doubling, frequency or never
+	Initial time.Duration // TTL of new entries; the whole lifetime for fixed
+	Max     time.Duration // Upper bound for doubling and frequency
+	Factor  float64       // Growth per hit for doubling
+	PerHit  time.Duration // TTL granted per hit per hour for frequency
+}
+
+// DefaultTTLConfig returns the doubling policy used by earlier releases
+func DefaultTTLConfig() TTLConfig {
+	return TTLConfig{
+		Policy:  TTLDoubling,
+		Initial: InitialTTL,
+		Max:     MaxTTL,
+		Factor:  2,
+		PerHit:  time.Minute,
+	}
+}
+
+// LoadTTLConfig reads the TTL policy configuration from the environment
+func LoadTTLConfig() TTLConfig {
+	cfg := DefaultTTLConfig()
+
+	if v := os.Getenv("CACHE_TTL_POLICY"); v != "" {
+		cfg.Policy = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("CACHE_TTL_INITIAL")); err == nil && v > 0 {
+		cfg.Initial = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("CACHE_TTL_MAX")); err == nil && v > 0 {
+		cfg.Max = v
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv("CACHE_TTL_FACTOR"), 64); err == nil && v >= 1 {
+		cfg.Factor = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("CACHE_TTL_PER_HIT")); err == nil && v > 0 {
+		cfg.PerHit = v
+	}
+
+	return cfg
+}
+
+// NewTTLPolicy creates the policy selected by cfg
+func NewTTLPolicy(cfg TTLConfig) (TTLPolicy, error) {
+	if cfg.Initial <= 0 {
+		return nil, fmt.Errorf("initial TTL must be positive")
+	}
+
+	switch cfg.Policy {
+	case TTLFixed:
+		return fixedPolicy{ttl: cfg.Initial}, nil
+	case TTLDoubling, "":
+		return newDoublingPolicy(cfg)
+	case TTLFrequency:
+		if cfg.Max < cfg.Initial {
+			return nil, fmt.Errorf("maximum TTL %v is below the initial TTL %v", cfg.Max, cfg.Initial)
+		}
+		if cfg.PerHit <= 0 {
+			return nil, fmt.Errorf("TTL per hit must be positive")
+		}
+		return frequencyPolicy{initial: cfg.Initial, perHit: cfg.PerHit, max: cfg.Max}, nil
+	case TTLNever:
+		fallback, err := newDoublingPolicy(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &neverPolicy{fallback: fallback}, nil
+	default:
+		return nil, fmt.Errorf("unknown TTL policy %q", cfg.Policy)
+	}
+}
+
+// newDoublingPolicy validates and creates a doubling policy
+func newDoublingPolicy(cfg TTLConfig) (doublingPolicy, error) {
+	if cfg.Max < cfg.Initial {
+		return doublingPolicy{}, fmt.Errorf("maximum TTL %v is below the initial TTL %v", cfg.Max, cfg.Initial)
+	}
+	if cfg.Factor < 1 {
+		return doublingPolicy{}, fmt.Errorf("TTL factor must be at least 1")
+	}
+	return doublingPolicy{initial: cfg.Initial, factor: cfg.Factor, max: cfg.Max}, nil
+}
+
+// defaultTTLPolicy returns the policy backends use unless configured
+func defaultTTLPolicy() TTLPolicy {
+	policy, _ := NewTTLPolicy(DefaultTTLConfig())
+	return policy
+}
+
+// fixedPolicy expires entries a fixed time after they were stored,
+// however often they are hit
+type fixedPolicy struct {
+	ttl time.Duration
+}
+
+func (p fixedPolicy) Name() string {
+	return fmt.Sprintf("%s(ttl=%v)", TTLFixed, p.ttl)
+}
+
+func (p fixedPolicy) Initial([]int) time.Duration {
+	return p.ttl
+}
+
+func (p fixedPolicy) Next(entry *CachedResult, now time.Time) time.Duration {
+	// Keep the original expiry; rewriting an entry needs a positive TTL
+	remaining := p.ttl - now.Sub(entry.CachedAt)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	return remaining
+}
+
+// doublingPolicy multiplies the TTL by a factor on every hit, up to a cap
+type doublingPolicy struct {
+	initial time.Duration
+	factor  float64
+	max     time.Duration
+}
+
+func (p doublingPolicy) Name() string {
+	return fmt.Sprintf("%s(initial=%v, factor=%g, max=%v)", TTLDoubling, p.initial, p.factor, p.max)
+}
+
+func (p doublingPolicy) Initial([]int) time.Duration {
+	return p.initial
+}
+
+func (p doublingPolicy) Next(entry *CachedResult, _ time.Time) time.Duration {
+	// Entries without a TTL (e.g. pinned by the never policy) start over
+	if entry.CurrentTTL <= 0 {
+		return p.initial
+	}
+
+	next := time.Duration(float64(entry.CurrentTTL) * p.factor)
+	if next > p.max || next <= 0 {
+		next = p.max
+	}
+	return next
+}
+
+// frequencyPolicy sets the TTL from the entry's hit rate since it was
+// stored, so frequently used entries live long and entries that are no
+// longer requested decay back to the initial TTL
+type frequencyPolicy struct {
+	initial time.Duration
+	perHit  time.Duration
+	max     time.Duration
+}
+
+func (p frequencyPolicy) Name() string {
+	return fmt.Sprintf("%s(initial=%v, per_hit=%v, max=%v)", TTLFrequency, p.initial, p.perHit, p.max)
+}
+
+func (p frequencyPolicy) Initial([]int) time.Duration {
+	return p.initial
+}
+
+func (p frequencyPolicy) Next(entry *CachedResult, now time.Time) time.Duration {
+	// Measure over at least an hour so a few hits right after storing an
+	// entry do not look like a high rate
+	age := now.Sub(entry.CachedAt)
+	if age < time.Hour {
+		age = time.Hour
+	}
+
+	hitsPerHour := float64(entry.HitCount) / age.Hours()
+	ttl := time.Duration(hitsPerHour * float64(p.perHit))
+
+	if ttl < p.initial {
+		return p.initial
+	}
+	if ttl > p.max {
+		return p.max
+	}
+	return ttl
+}
+
+// neverPolicy keeps entries for the configured pack sizes until the
+// configuration changes. Other pack sets follow the fallback policy.
+type neverPolicy struct {
+	fallback TTLPolicy
+
+	mu      sync.RWMutex
+	current []int // Sorted configured pack sizes; nil until reported
+}
+
+func (p *neverPolicy) Name() string {
+	return fmt.Sprintf("%s(current pack sizes; otherwise %s)", TTLNever, p.fallback.Name())
+}
+
+func (p *neverPolicy) Initial(packSizes []int) time.Duration {
+	if p.isCurrent(packSizes) {
+		return NoExpiry
+	}
+	return p.fallback.Initial(packSizes)
+}
+
+func (p *neverPolicy) Next(entry *CachedResult, now time.Time) time.Duration {
+	if p.isCurrent(entry.PackSizes) {
+		return NoExpiry
+	}
+	return p.fallback.Next(entry, now)
+}
+
+// isCurrent reports whether packSizes is the configured pack set
+func (p *neverPolicy) isCurrent(packSizes []int) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current != nil && samePackSet(p.current, sortedCopy(packSizes))
+}
+
+// setCurrent records the configured pack sizes. It returns the previous
+// configuration when it changed, so its pinned entries can be dropped.
+func (p *neverPolicy) setCurrent(packSizes []int) (previous []int, changed bool) {
+	// Called on every request that uses the configuration, which rarely
+	// changes; check under the read lock first
+	if p.isCurrent(packSizes) {
+		return nil, false
+	}
+
+	sorted := sortedCopy(packSizes)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current != nil && samePackSet(p.current, sorted) {
+		return nil, false
+	}
+	previous, p.current = p.current, sorted
+	return previous, true
+}
+
+// updateCurrentPackSizes passes the configured pack sizes to a never
+// policy and returns the pack set whose entries are no longer pinned
+func updateCurrentPackSizes(policy TTLPolicy, packSizes []int) (unpinned []int) {
+	never, ok := policy.(*neverPolicy)
+	if !ok {
+		return nil
+	}
+	previous, changed := never.setCurrent(packSizes)
+	if !changed {
+		return nil
+	}
+	return previous
+}
+
+// sortedCopy returns a sorted copy of packSizes
+func sortedCopy(packSizes []int) []int {
+	sorted := make([]int, len(packSizes))
+	copy(sorted, packSizes)
+	sort.Ints(sorted)
+	return sorted
+}
+
+// samePackSet compares two sorted pack sets
+func samePackSet(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTLPolicies_Next(t *testing.T) {
+	cachedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		cfg        TTLConfig
+		currentTTL time.Duration
+		hitCount   int
+		age        time.Duration
+		want       time.Duration
+	}{
+		{"doubling", DefaultTTLConfig(), 5 * time.Minute, 1, 0, 10 * time.Minute},
+		{"doubling capped", DefaultTTLConfig(), 20 * time.Hour, 5, 0, 24 * time.Hour},
+		{"doubling factor 3", TTLConfig{Policy: TTLDoubling, Initial: time.Minute, Max: time.Hour, Factor: 3}, 2 * time.Minute, 2, 0, 6 * time.Minute},
+		{"doubling restarts unpinned entries", DefaultTTLConfig(), NoExpiry, 3, 0, 5 * time.Minute},
+		{"fixed keeps the original expiry", TTLConfig{Policy: TTLFixed, Initial: 10 * time.Minute}, 10 * time.Minute, 4, 4 * time.Minute, 6 * time.Minute},
+		{"fixed past expiry", TTLConfig{Policy: TTLFixed, Initial: 10 * time.Minute}, 10 * time.Minute, 4, time.Hour, time.Millisecond},
+		{"frequency rare", TTLConfig{Policy: TTLFrequency, Initial: 5 * time.Minute, Max: time.Hour, PerHit: time.Minute}, 5 * time.Minute, 1, time.Hour, 5 * time.Minute},
+		{"frequency busy", TTLConfig{Policy: TTLFrequency, Initial: 5 * time.Minute, Max: time.Hour, PerHit: time.Minute}, 5 * time.Minute, 20, time.Hour, 20 * time.Minute},
+		{"frequency capped", TTLConfig{Policy: TTLFrequency, Initial: 5 * time.Minute, Max: time.Hour, PerHit: time.Minute}, 5 * time.Minute, 500, time.Hour, time.Hour},
+		{"frequency burst after store", TTLConfig{Policy: TTLFrequency, Initial: 5 * time.Minute, Max: time.Hour, PerHit: time.Minute}, 5 * time.Minute, 1, time.Second, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewTTLPolicy(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create policy: %v", err)
+			}
+
+			entry := &CachedResult{
+				PackSizes:  []int{250, 500},
+				CachedAt:   cachedAt,
+				HitCount:   tt.hitCount,
+				CurrentTTL: tt.currentTTL,
+			}
+
+			if got := policy.Next(entry, cachedAt.Add(tt.age)); got != tt.want {
+				t.Errorf("Expected TTL %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNeverPolicy(t *testing.T) {
+	policy, _ := NewTTLPolicy(TTLConfig{Policy: TTLNever, Initial: time.Minute, Max: time.Hour, Factor: 2})
+	never := policy.(*neverPolicy)
+
+	// Until the configuration is known every pack set uses the fallback
+	if got := policy.Initial([]int{250, 500}); got != time.Minute {
+		t.Errorf("Expected fallback TTL before configuration, got %v", got)
+	}
+
+	if unpinned := updateCurrentPackSizes(policy, []int{500, 250}); unpinned != nil {
+		t.Errorf("Expected nothing to unpin on first configuration, got %v", unpinned)
+	}
+
+	if got := policy.Initial([]int{250, 500}); got != NoExpiry {
+		t.Errorf("Expected configured pack set not to expire, got %v", got)
+	}
+
+	entry := &CachedResult{PackSizes: []int{23, 31, 53}, CurrentTTL: time.Minute}
+	if got := policy.Next(entry, time.Now()); got != 2*time.Minute {
+		t.Errorf("Expected other pack sets to follow the fallback, got %v", got)
+	}
+
+	// Reporting the same configuration again changes nothing
+	if unpinned := updateCurrentPackSizes(policy, []int{250, 500}); unpinned != nil {
+		t.Errorf("Expected nothing to unpin for an unchanged configuration, got %v", unpinned)
+	}
+
+	unpinned := updateCurrentPackSizes(policy, []int{23, 31, 53})
+	if !samePackSet(unpinned, []int{250, 500}) {
+		t.Errorf("Expected previous configuration to be unpinned, got %v", unpinned)
+	}
+
+	if !never.isCurrent([]int{53, 31, 23}) {
+		t.Error("Expected new configuration to be current")
+	}
+}
+
+func TestNewTTLPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TTLConfig
+	}{
+		{"unknown policy", TTLConfig{Policy: "lru", Initial: time.Minute}},
+		{"zero initial", TTLConfig{Policy: TTLFixed}},
+		{"max below initial", TTLConfig{Policy: TTLDoubling, Initial: time.Hour, Max: time.Minute, Factor: 2}},
+		{"factor below one", TTLConfig{Policy: TTLDoubling, Initial: time.Minute, Max: time.Hour, Factor: 0.5}},
+		{"frequency without per hit", TTLConfig{Policy: TTLFrequency, Initial: time.Minute, Max: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTTLPolicy(tt.cfg); err == nil {
+				t.Error("Expected error for invalid TTL config")
+			}
+		})
+	}
+}
+
+func TestLoadTTLConfig(t *testing.T) {
+	t.Setenv("CACHE_TTL_POLICY", "frequency")
+	t.Setenv("CACHE_TTL_INITIAL", "1m")
+	t.Setenv("CACHE_TTL_MAX", "2h")
+	t.Setenv("CACHE_TTL_FACTOR", "")
+	t.Setenv("CACHE_TTL_PER_HIT", "30s")
+
+	cfg := LoadTTLConfig()
+	want := TTLConfig{Policy: TTLFrequency, Initial: time.Minute, Max: 2 * time.Hour, Factor: 2, PerHit: 30 * time.Second}
+	if cfg != want {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+
+	policy, err := NewTTLPolicy(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	if policy.Name() != "frequency(initial=1m0s, per_hit=30s, max=2h0m0s)" {
+		t.Errorf("Unexpected policy name %q", policy.Name())
+	}
+}
+
+func TestMemoryCache_NeverPolicy(t *testing.T) {
+	now := time.Now()
+	cache := New(Config{
+		Backend: BackendMemory,
+		TTL:     TTLConfig{Policy: TTLNever, Initial: time.Minute, Max: time.Hour, Factor: 2},
+	}).(*MemoryCache)
+	cache.now = func() time.Time { return now }
+
+	cache.SetCurrentPackSizes([]int{250, 500})
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+	cache.Set(23, []int{23, 31, 53}, map[int]int{23: 1}, 23, 1, 0, 0)
+
+	now = now.Add(365 * 24 * time.Hour)
+	if !cache.Contains(250, []int{250, 500}) {
+		t.Error("Expected entry for the configured pack sizes not to expire")
+	}
+	if cache.Contains(23, []int{23, 31, 53}) {
+		t.Error("Expected entry for another pack set to expire")
+	}
+
+	stats, _ := cache.GetStats()
+	if !strings.HasPrefix(stats.TTLPolicy, TTLNever) {
+		t.Errorf("Expected never policy in stats, got %q", stats.TTLPolicy)
+	}
+
+	// Changing the configuration drops the pinned entries
+	cache.SetCurrentPackSizes([]int{23, 31, 53})
+	if cache.Contains(250, []int{250, 500}) {
+		t.Error("Expected entries for the previous configuration to be removed")
+	}
+}
+
+func TestMemoryCache_FixedPolicy(t *testing.T) {
+	now := time.Now()
+	cache := New(Config{
+		Backend: BackendMemory,
+		TTL:     TTLConfig{Policy: TTLFixed, Initial: 10 * time.Minute},
+	}).(*MemoryCache)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+
+	// Hits do not extend a fixed TTL
+	for i := 0; i < 3; i++ {
+		now = now.Add(3 * time.Minute)
+		if _, found := cache.Get(250, []int{250, 500}); !found {
+			t.Fatalf("Expected hit after %d minutes", 3*(i+1))
+		}
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, found := cache.Get(250, []int{250, 500}); found {
+		t.Error("Expected entry to expire 10 minutes after it was stored")
+	}
+}
+
+func TestRedisCache_NeverPolicy(t *testing.T) {
+	mr, cache := setupTestRedis(t)
+	defer mr.Close()
+
+	cache.ttl, _ = NewTTLPolicy(TTLConfig{Policy: TTLNever, Initial: time.Minute, Max: time.Hour, Factor: 2})
+	cache.SetCurrentPackSizes([]int{250, 500})
+
+	cache.Set(250, []int{250, 500}, map[int]int{250: 1}, 250, 1, 0, 0)
+	cache.Set(23, []int{23, 31, 53}, map[int]int{23: 1}, 23, 1, 0, 0)
+
+	pinned := cache.generateKey(250, []int{250, 500})
+	if ttl := mr.TTL(pinned); ttl != 0 {
+		t.Errorf("Expected no expiry for the configured pack sizes, got %v", ttl)
+	}
+
+	if ttl := mr.TTL(cache.generateKey(23, []int{23, 31, 53})); ttl != time.Minute {
+		t.Errorf("Expected fallback TTL for another pack set, got %v", ttl)
+	}
+
+	cache.SetCurrentPackSizes([]int{23, 31, 53})
+	if mr.Exists(pinned) {
+		t.Error("Expected entries for the previous configuration to be removed")
+	}
+}
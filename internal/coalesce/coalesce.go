@@ -0,0 +1,90 @@
+package coalesce
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Group runs at most one call per key at a time. Callers that arrive while
+// a call for their key is in flight wait for it and share its result.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+
+	executions atomic.Int64
+	coalesced  atomic.Int64
+}
+
+// call is an in-flight or completed Do call
+type call[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// Stats reports how many calls ran and how many callers were coalesced
+type Stats struct {
+	Executions int64 `json:"executions"` // Calls that actually ran
+	Coalesced  int64 `json:"coalesced"`  // Callers that shared another call's result
+	InFlight   int   `json:"in_flight"`  // Keys currently being computed
+}
+
+// Do executes fn for key unless a call for key is already in flight, in
+// which case it waits for that call. shared reports whether the result
+// came from another caller's execution.
+func (g *Group[T]) Do(key string, fn func() (T, error)) (val T, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		g.coalesced.Add(1)
+		<-c.done
+		return c.val, c.err, true
+	}
+
+	c := &call[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	g.executions.Add(1)
+	g.run(key, c, fn)
+	return c.val, c.err, false
+}
+
+// run executes fn and releases the waiters, even if fn panics
+func (g *Group[T]) run(key string, c *call[T], fn func() (T, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("coalesced call panicked: %v", r)
+			g.finish(key, c)
+			panic(r)
+		}
+		g.finish(key, c)
+	}()
+
+	c.val, c.err = fn()
+}
+
+// finish removes the call and wakes its waiters
+func (g *Group[T]) finish(key string, c *call[T]) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// Stats returns the group's counters
+func (g *Group[T]) Stats() Stats {
+	g.mu.Lock()
+	inFlight := len(g.calls)
+	g.mu.Unlock()
+
+	return Stats{
+		Executions: g.executions.Load(),
+		Coalesced:  g.coalesced.Load(),
+		InFlight:   inFlight,
+	}
+}
@@ -0,0 +1,131 @@
+package coalesce
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group[int]
+
+	val, err, shared := g.Do("key", func() (int, error) { return 42, nil })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if val != 42 {
+		t.Errorf("Expected 42, got %d", val)
+	}
+
+	if shared {
+		t.Error("Expected an uncontended call not to be shared")
+	}
+}
+
+func TestGroup_CoalescesConcurrentCalls(t *testing.T) {
+	var g Group[int]
+	var runs atomic.Int32
+	release := make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	sharedCount := atomic.Int32{}
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, _, shared := g.Do("key", func() (int, error) {
+				runs.Add(1)
+				<-release
+				return 7, nil
+			})
+			results[i] = val
+			if shared {
+				sharedCount.Add(1)
+			}
+		}(i)
+	}
+
+	// Wait until every caller is either running or waiting
+	deadline := time.Now().Add(2 * time.Second)
+	for g.Stats().Executions+g.Stats().Coalesced < callers {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for callers")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("Expected 1 execution, got %d", runs.Load())
+	}
+
+	for i, val := range results {
+		if val != 7 {
+			t.Errorf("Caller %d: expected 7, got %d", i, val)
+		}
+	}
+
+	stats := g.Stats()
+	if stats.Executions != 1 || stats.Coalesced != callers-1 || stats.InFlight != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if sharedCount.Load() != callers-1 {
+		t.Errorf("Expected %d shared results, got %d", callers-1, sharedCount.Load())
+	}
+}
+
+func TestGroup_DifferentKeysRunIndependently(t *testing.T) {
+	var g Group[string]
+
+	a, _, _ := g.Do("a", func() (string, error) { return "a", nil })
+	b, _, _ := g.Do("b", func() (string, error) { return "b", nil })
+
+	if a != "a" || b != "b" {
+		t.Errorf("Expected independent results, got %q and %q", a, b)
+	}
+
+	if stats := g.Stats(); stats.Executions != 2 || stats.Coalesced != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestGroup_ErrorIsShared(t *testing.T) {
+	var g Group[int]
+	want := errors.New("boom")
+
+	_, err, _ := g.Do("key", func() (int, error) { return 0, want })
+	if !errors.Is(err, want) {
+		t.Errorf("Expected %v, got %v", want, err)
+	}
+
+	// A completed call does not block the next one
+	val, err, _ := g.Do("key", func() (int, error) { return 1, nil })
+	if err != nil || val != 1 {
+		t.Errorf("Expected a fresh call after completion, got %d, %v", val, err)
+	}
+}
+
+func TestGroup_PanicReleasesWaiters(t *testing.T) {
+	var g Group[int]
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic to propagate")
+			}
+		}()
+		g.Do("key", func() (int, error) { panic("boom") })
+	}()
+
+	if stats := g.Stats(); stats.InFlight != 0 {
+		t.Errorf("Expected no in-flight calls after panic, got %d", stats.InFlight)
+	}
+}
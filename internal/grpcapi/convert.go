@@ -0,0 +1,93 @@
+package grpcapi
+
+import (
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// calculateRequest converts a calculation request. Empty pack sizes stay
+// nil, so that the configured ones are used.
+func calculateRequest(req *packcalcv1.CalculateRequest) models.CalculateRequest {
+	return models.CalculateRequest{
+		Items:     int(req.GetItems()),
+		PackSizes: ints(req.GetPackSizes()),
+	}
+}
+
+// calculateResponse converts a calculation response
+func calculateResponse(r models.CalculateResponse) *packcalcv1.CalculateResponse {
+	return &packcalcv1.CalculateResponse{
+		Items:             int32(r.Items),
+		PackSizes:         int32s(r.PackSizes),
+		Result:            packCounts(r.Result),
+		TotalItems:        int32(r.TotalItems),
+		TotalPacks:        int32(r.TotalPacks),
+		Waste:             int32(r.Waste),
+		CalculationTimeMs: r.CalculationTimeMs,
+		Cached:            r.Cached,
+		CacheTtl:          r.CacheTTL,
+		CacheHitCount:     int32(r.CacheHitCount),
+		Coalesced:         r.Coalesced,
+	}
+}
+
+// historyEntry converts a history entry
+func historyEntry(e models.HistoryEntry) *packcalcv1.HistoryEntry {
+	return &packcalcv1.HistoryEntry{
+		Id:               int64(e.ID),
+		Items:            int32(e.Items),
+		PackSizes:        int32s(e.PackSizes),
+		Result:           packCounts(e.Result),
+		TotalItems:       int32(e.TotalItems),
+		TotalPacks:       int32(e.TotalPacks),
+		Waste:            int32(e.Waste),
+		Cached:           e.Cached,
+		Timestamp:        timestamp(e.Timestamp),
+		RequestId:        e.RequestID,
+		Client:           e.Client,
+		Source:           e.Source,
+		DurationUs:       e.DurationUs,
+		AlgorithmVersion: e.AlgorithmVersion,
+	}
+}
+
+// packCounts converts a pack size -> count map
+func packCounts(counts map[int]int) map[int32]int32 {
+	out := make(map[int32]int32, len(counts))
+	for size, count := range counts {
+		out[int32(size)] = int32(count)
+	}
+	return out
+}
+
+// ints converts a list of int32, keeping nil for an empty one
+func ints(values []int32) []int {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// int32s converts a list of int
+func int32s(values []int) []int32 {
+	out := make([]int32, len(values))
+	for i, v := range values {
+		out[i] = int32(v)
+	}
+	return out
+}
+
+// timestamp converts a time, leaving the zero time unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
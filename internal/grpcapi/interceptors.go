@@ -0,0 +1,353 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1"
+	"github.com/sander-remitly/pack-calc/internal/idempotency"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
+	"github.com/sander-remitly/pack-calc/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Metadata keys
+const (
+	// requestIDKey carries the request ID, sent back in the response
+	// header like X-Request-Id
+	requestIDKey = "x-request-id"
+	// idempotencyKey carries an idempotency key, like Idempotency-Key
+	idempotencyKey = "idempotency-key"
+	// replayedKey is set in the response header of replayed responses,
+	// like Idempotent-Replayed
+	replayedKey = "idempotent-replayed"
+)
+
+// Content types of the responses stored for idempotency keys
+const (
+	replyContentType  = "application/x-protobuf"
+	statusContentType = "application/x-protobuf; messageType=google.rpc.Status"
+)
+
+// scopes maps each method to the API key scope it needs, as the REST
+// routes do. Methods not listed, like GetPackConfig, the health service
+// and reflection, are open to everyone.
+var scopes = map[string]string{
+	packcalcv1.PackCalculator_Calculate_FullMethodName:        auth.ScopeCalculate,
+	packcalcv1.PackCalculator_CalculateBatch_FullMethodName:   auth.ScopeCalculate,
+	packcalcv1.PackCalculator_CalculateStream_FullMethodName:  auth.ScopeCalculate,
+	packcalcv1.PackCalculator_UpdatePackConfig_FullMethodName: auth.ScopeAdminConfig,
+	packcalcv1.PackCalculator_GetHistory_FullMethodName:       auth.ScopeReadHistory,
+}
+
+// groups maps methods to the rate limit group of their REST route. Every
+// PackCalculator method counts towards the daily quota of its API key,
+// except batches and streams, which the service charges one unit per order.
+var groups = map[string]string{
+	packcalcv1.PackCalculator_Calculate_FullMethodName:        ratelimit.GroupCalculate,
+	packcalcv1.PackCalculator_UpdatePackConfig_FullMethodName: ratelimit.GroupAdmin,
+}
+
+// chargedPerOrder lists the methods charged by the service for each order
+var chargedPerOrder = map[string]bool{
+	packcalcv1.PackCalculator_CalculateBatch_FullMethodName:  true,
+	packcalcv1.PackCalculator_CalculateStream_FullMethodName: true,
+}
+
+// replies maps the methods that accept an idempotency key, as their REST
+// routes do, to a new message of their response type
+var replies = map[string]func() proto.Message{
+	packcalcv1.PackCalculator_Calculate_FullMethodName:        func() proto.Message { return &packcalcv1.CalculateResponse{} },
+	packcalcv1.PackCalculator_CalculateBatch_FullMethodName:   func() proto.Message { return &packcalcv1.CalculateBatchResponse{} },
+	packcalcv1.PackCalculator_UpdatePackConfig_FullMethodName: func() proto.Message { return &packcalcv1.UpdatePackConfigResponse{} },
+}
+
+// requestIDContextKey is the context key of the request ID
+type requestIDContextKey struct{}
+
+// requestID returns the request ID of an RPC
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// unaryInterceptor traces, authorizes, rate limits, applies idempotency
+// keys to and logs unary RPCs
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, finish := s.begin(ctx, info.FullMethod)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID(ctx))); err != nil {
+		logger.FromContext(ctx).Warn("Failed to send the request ID", zap.Error(err))
+	}
+
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err == nil {
+		err = s.charge(ctx, info.FullMethod)
+	}
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+
+	resp, err := s.idempotent(ctx, info.FullMethod, req, handler)
+	finish(err)
+	return resp, err
+}
+
+// streamInterceptor traces, authorizes, rate limits and logs streaming
+// RPCs
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, finish := s.begin(ss.Context(), info.FullMethod)
+	if err := ss.SetHeader(metadata.Pairs(requestIDKey, requestID(ctx))); err != nil {
+		logger.FromContext(ctx).Warn("Failed to send the request ID", zap.Error(err))
+	}
+
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err == nil {
+		err = s.charge(ctx, info.FullMethod)
+	}
+	if err != nil {
+		finish(err)
+		return err
+	}
+
+	err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	finish(err)
+	return err
+}
+
+// begin starts the server span of an RPC, continuing the trace of the
+// traceparent metadata if there is one, and assigns its request ID: the
+// x-request-id metadata or a random one. The returned function ends the
+// span and logs the RPC.
+func (s *Server) begin(ctx context.Context, method string) (context.Context, func(error)) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := otel.Tracer(tracing.ScopeName).Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+		),
+	)
+
+	id := first(md, requestIDKey)
+	if id == "" {
+		id = newRequestID()
+	}
+	ctx = context.WithValue(ctx, requestIDContextKey{}, id)
+
+	start := time.Now()
+	return ctx, func(err error) {
+		code := status.Code(err)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+		if code != codes.OK {
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+
+		logger.FromContext(ctx).Info("gRPC request",
+			zap.String("method", method),
+			zap.String("code", code.String()),
+			zap.String("request_id", id),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// authorize checks the API key from the authorization (Bearer) or
+// x-api-key metadata against the scope the method needs
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	secret := first(md, "x-api-key")
+	if header := first(md, "authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			secret = strings.TrimSpace(token)
+		}
+	}
+
+	ctx, err := s.auth.Authorize(ctx, secret, scopes[method])
+	switch {
+	case err == nil:
+		return ctx, nil
+	case errors.Is(err, auth.ErrInvalidKey), errors.Is(err, auth.ErrKeyRequired):
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrMissingScope):
+		return ctx, status.Error(codes.PermissionDenied, err.Error())
+	default:
+		logger.FromContext(ctx).Error("Failed to look up API key", zap.Error(err))
+		return ctx, status.Error(codes.Unavailable, "Failed to verify API key")
+	}
+}
+
+// charge counts a PackCalculator RPC against the rate limit of its method
+// and the quota of its API key, unless the service charges it per order.
+// Like the REST health checks, the health service and reflection are not
+// charged. Limits used up fail with ResourceExhausted and a RetryInfo
+// detail.
+func (s *Server) charge(ctx context.Context, method string) error {
+	if chargedPerOrder[method] || !strings.HasPrefix(method, "/"+packcalcv1.PackCalculator_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+	return exhaustedError(s.limiter.Charge(ctx, groups[method], peerAddress(ctx)))
+}
+
+// exhaustedError converts an error of ratelimit.Limiter.Charge to a gRPC
+// status
+func exhaustedError(err error) error {
+	var exceeded *ratelimit.Exceeded
+	if !errors.As(err, &exceeded) {
+		return err
+	}
+
+	st := status.New(codes.ResourceExhausted, exceeded.Message)
+	if detailed, derr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(exceeded.RetryAfter)}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// idempotent runs a unary RPC, applying the idempotency-key metadata like
+// the REST API's Idempotency-Key header: retries with the same key and
+// request get the first response, or its InvalidArgument error, with the
+// idempotent-replayed header. Reusing a key for another request fails with
+// InvalidArgument and retrying while the first request runs with Aborted.
+func (s *Server) idempotent(ctx context.Context, method string, req any, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := first(md, idempotencyKey)
+	reply, ok := replies[method]
+	if !ok || key == "" {
+		return handler(ctx, req)
+	}
+
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var resp any
+	var respErr error
+	stored, replayed, err := s.idem.Run(ctx, key, peerAddress(ctx), method, payload, func() idempotency.Response {
+		resp, respErr = handler(ctx, req)
+		return storedResponse(resp, respErr)
+	})
+	switch {
+	case errors.Is(err, idempotency.ErrKeyTooLong), errors.Is(err, idempotency.ErrKeyReused):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, idempotency.ErrInProgress):
+		return nil, status.Error(codes.Aborted, err.Error())
+	case err != nil:
+		logger.FromContext(ctx).Error("Failed to reserve idempotency key", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "Failed to check idempotency key")
+	case !replayed:
+		return resp, respErr
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(replayedKey, "true")); err != nil {
+		logger.FromContext(ctx).Warn("Failed to send the replayed header", zap.Error(err))
+	}
+	return replayedResponse(stored, reply())
+}
+
+// storedResponse encodes the outcome of an RPC for the idempotency store
+// with the HTTP status of its REST equivalent: responses as 200 and
+// InvalidArgument errors as 400 with their google.rpc.Status. Other errors
+// become 500, which is not stored, so those RPCs can be retried.
+func storedResponse(resp any, err error) idempotency.Response {
+	if err != nil {
+		st := status.Convert(err)
+		if st.Code() != codes.InvalidArgument {
+			return idempotency.Response{StatusCode: http.StatusInternalServerError}
+		}
+		body, merr := proto.Marshal(st.Proto())
+		if merr != nil {
+			return idempotency.Response{StatusCode: http.StatusInternalServerError}
+		}
+		return idempotency.Response{StatusCode: http.StatusBadRequest, ContentType: statusContentType, Body: body}
+	}
+
+	body, err := proto.Marshal(resp.(proto.Message))
+	if err != nil {
+		return idempotency.Response{StatusCode: http.StatusInternalServerError}
+	}
+	return idempotency.Response{StatusCode: http.StatusOK, ContentType: replyContentType, Body: body}
+}
+
+// replayedResponse decodes a response stored by storedResponse into reply
+func replayedResponse(stored idempotency.Response, reply proto.Message) (any, error) {
+	if stored.ContentType == statusContentType {
+		var st spb.Status
+		if err := proto.Unmarshal(stored.Body, &st); err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to decode stored error: %v", err)
+		}
+		return nil, status.FromProto(&st).Err()
+	}
+
+	if err := proto.Unmarshal(stored.Body, reply); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to decode stored response: %v", err)
+	}
+	return reply, nil
+}
+
+// serverStream replaces the context of a stream with the authorized one
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier lets the trace propagator read incoming metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return first(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// first returns the first value of key in md
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,1271 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: packcalc/v1/packcalc.proto
+
+package packcalcv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CalculateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Items int32                  `protobuf:"varint,1,opt,name=items,proto3" json:"items,omitempty"`
+	// Uses the configured pack sizes when empty
+	PackSizes     []int32 `protobuf:"varint,2,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateRequest) Reset() {
+	*x = CalculateRequest{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateRequest) ProtoMessage() {}
+
+func (x *CalculateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateRequest.ProtoReflect.Descriptor instead.
+func (*CalculateRequest) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CalculateRequest) GetItems() int32 {
+	if x != nil {
+		return x.Items
+	}
+	return 0
+}
+
+func (x *CalculateRequest) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+type CalculateResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Items     int32                  `protobuf:"varint,1,opt,name=items,proto3" json:"items,omitempty"`
+	PackSizes []int32                `protobuf:"varint,2,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	// Pack size -> count
+	Result            map[int32]int32 `protobuf:"bytes,3,rep,name=result,proto3" json:"result,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	TotalItems        int32           `protobuf:"varint,4,opt,name=total_items,json=totalItems,proto3" json:"total_items,omitempty"`
+	TotalPacks        int32           `protobuf:"varint,5,opt,name=total_packs,json=totalPacks,proto3" json:"total_packs,omitempty"`
+	Waste             int32           `protobuf:"varint,6,opt,name=waste,proto3" json:"waste,omitempty"`
+	CalculationTimeMs int64           `protobuf:"varint,7,opt,name=calculation_time_ms,json=calculationTimeMs,proto3" json:"calculation_time_ms,omitempty"`
+	Cached            bool            `protobuf:"varint,8,opt,name=cached,proto3" json:"cached,omitempty"`
+	// Current cache TTL, or "never"; set when cached
+	CacheTtl      string `protobuf:"bytes,9,opt,name=cache_ttl,json=cacheTtl,proto3" json:"cache_ttl,omitempty"`
+	CacheHitCount int32  `protobuf:"varint,10,opt,name=cache_hit_count,json=cacheHitCount,proto3" json:"cache_hit_count,omitempty"`
+	// Whether the result was shared with a concurrent identical request
+	Coalesced     bool `protobuf:"varint,11,opt,name=coalesced,proto3" json:"coalesced,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateResponse) Reset() {
+	*x = CalculateResponse{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateResponse) ProtoMessage() {}
+
+func (x *CalculateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateResponse.ProtoReflect.Descriptor instead.
+func (*CalculateResponse) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CalculateResponse) GetItems() int32 {
+	if x != nil {
+		return x.Items
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+func (x *CalculateResponse) GetResult() map[int32]int32 {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *CalculateResponse) GetTotalItems() int32 {
+	if x != nil {
+		return x.TotalItems
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetTotalPacks() int32 {
+	if x != nil {
+		return x.TotalPacks
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetWaste() int32 {
+	if x != nil {
+		return x.Waste
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetCalculationTimeMs() int64 {
+	if x != nil {
+		return x.CalculationTimeMs
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *CalculateResponse) GetCacheTtl() string {
+	if x != nil {
+		return x.CacheTtl
+	}
+	return ""
+}
+
+func (x *CalculateResponse) GetCacheHitCount() int32 {
+	if x != nil {
+		return x.CacheHitCount
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetCoalesced() bool {
+	if x != nil {
+		return x.Coalesced
+	}
+	return false
+}
+
+type CalculateBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*CalculateRequest    `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateBatchRequest) Reset() {
+	*x = CalculateBatchRequest{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateBatchRequest) ProtoMessage() {}
+
+func (x *CalculateBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateBatchRequest.ProtoReflect.Descriptor instead.
+func (*CalculateBatchRequest) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CalculateBatchRequest) GetRequests() []*CalculateRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+type CalculateBatchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One result per request, in the same order
+	Results       []*CalculateResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateBatchResponse) Reset() {
+	*x = CalculateBatchResponse{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateBatchResponse) ProtoMessage() {}
+
+func (x *CalculateBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateBatchResponse.ProtoReflect.Descriptor instead.
+func (*CalculateBatchResponse) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CalculateBatchResponse) GetResults() []*CalculateResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// CalculateResult is the outcome of one order of a batch or stream
+type CalculateResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Outcome:
+	//
+	//	*CalculateResult_Response
+	//	*CalculateResult_Error
+	Outcome       isCalculateResult_Outcome `protobuf_oneof:"outcome"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateResult) Reset() {
+	*x = CalculateResult{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateResult) ProtoMessage() {}
+
+func (x *CalculateResult) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateResult.ProtoReflect.Descriptor instead.
+func (*CalculateResult) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CalculateResult) GetOutcome() isCalculateResult_Outcome {
+	if x != nil {
+		return x.Outcome
+	}
+	return nil
+}
+
+func (x *CalculateResult) GetResponse() *CalculateResponse {
+	if x != nil {
+		if x, ok := x.Outcome.(*CalculateResult_Response); ok {
+			return x.Response
+		}
+	}
+	return nil
+}
+
+func (x *CalculateResult) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Outcome.(*CalculateResult_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isCalculateResult_Outcome interface {
+	isCalculateResult_Outcome()
+}
+
+type CalculateResult_Response struct {
+	Response *CalculateResponse `protobuf:"bytes,1,opt,name=response,proto3,oneof"`
+}
+
+type CalculateResult_Error struct {
+	Error *Error `protobuf:"bytes,2,opt,name=error,proto3,oneof"`
+}
+
+func (*CalculateResult_Response) isCalculateResult_Outcome() {}
+
+func (*CalculateResult_Error) isCalculateResult_Outcome() {}
+
+// Error mirrors the REST API's error response
+type Error struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// One of the REST API's error codes, e.g. validation_failed
+	Code          string        `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string        `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Details       []*FieldError `protobuf:"bytes,3,rep,name=details,proto3" json:"details,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetDetails() []*FieldError {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+type FieldError struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// e.g. pack_sizes[1]
+	Field string `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	// too_small, too_large, duplicate, ...
+	Code          string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FieldError) Reset() {
+	*x = FieldError{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldError) ProtoMessage() {}
+
+func (x *FieldError) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldError.ProtoReflect.Descriptor instead.
+func (*FieldError) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FieldError) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *FieldError) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *FieldError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type GetPackConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPackConfigRequest) Reset() {
+	*x = GetPackConfigRequest{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPackConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPackConfigRequest) ProtoMessage() {}
+
+func (x *GetPackConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPackConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetPackConfigRequest) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{7}
+}
+
+type PackConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PackSizes     []int32                `protobuf:"varint,1,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PackConfig) Reset() {
+	*x = PackConfig{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PackConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PackConfig) ProtoMessage() {}
+
+func (x *PackConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PackConfig.ProtoReflect.Descriptor instead.
+func (*PackConfig) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PackConfig) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+func (x *PackConfig) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type UpdatePackConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PackSizes     []int32                `protobuf:"varint,1,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePackConfigRequest) Reset() {
+	*x = UpdatePackConfigRequest{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePackConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePackConfigRequest) ProtoMessage() {}
+
+func (x *UpdatePackConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePackConfigRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePackConfigRequest) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UpdatePackConfigRequest) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+type UpdatePackConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PackSizes     []int32                `protobuf:"varint,1,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePackConfigResponse) Reset() {
+	*x = UpdatePackConfigResponse{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePackConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePackConfigResponse) ProtoMessage() {}
+
+func (x *UpdatePackConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePackConfigResponse.ProtoReflect.Descriptor instead.
+func (*UpdatePackConfigResponse) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdatePackConfigResponse) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+func (x *UpdatePackConfigResponse) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *UpdatePackConfigResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// GetHistoryRequest takes the filters of GET /api/history
+type GetHistoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 20 when unset, at most 1000
+	Limit            int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor           string                 `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Sort             string                 `protobuf:"bytes,3,opt,name=sort,proto3" json:"sort,omitempty"`
+	Order            string                 `protobuf:"bytes,4,opt,name=order,proto3" json:"order,omitempty"`
+	From             *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=from,proto3" json:"from,omitempty"`
+	To               *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=to,proto3" json:"to,omitempty"`
+	MinItems         int32                  `protobuf:"varint,7,opt,name=min_items,json=minItems,proto3" json:"min_items,omitempty"`
+	MaxItems         int32                  `protobuf:"varint,8,opt,name=max_items,json=maxItems,proto3" json:"max_items,omitempty"`
+	PackSizes        []int32                `protobuf:"varint,9,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	MinWaste         int32                  `protobuf:"varint,10,opt,name=min_waste,json=minWaste,proto3" json:"min_waste,omitempty"`
+	Cached           *bool                  `protobuf:"varint,11,opt,name=cached,proto3,oneof" json:"cached,omitempty"`
+	RequestId        string                 `protobuf:"bytes,12,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Client           string                 `protobuf:"bytes,13,opt,name=client,proto3" json:"client,omitempty"`
+	Source           string                 `protobuf:"bytes,14,opt,name=source,proto3" json:"source,omitempty"`
+	AlgorithmVersion string                 `protobuf:"bytes,15,opt,name=algorithm_version,json=algorithmVersion,proto3" json:"algorithm_version,omitempty"`
+	MinDurationUs    int64                  `protobuf:"varint,16,opt,name=min_duration_us,json=minDurationUs,proto3" json:"min_duration_us,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GetHistoryRequest) Reset() {
+	*x = GetHistoryRequest{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryRequest) ProtoMessage() {}
+
+func (x *GetHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryRequest.ProtoReflect.Descriptor instead.
+func (*GetHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetHistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetOrder() string {
+	if x != nil {
+		return x.Order
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GetHistoryRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *GetHistoryRequest) GetMinItems() int32 {
+	if x != nil {
+		return x.MinItems
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetMaxItems() int32 {
+	if x != nil {
+		return x.MaxItems
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+func (x *GetHistoryRequest) GetMinWaste() int32 {
+	if x != nil {
+		return x.MinWaste
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetCached() bool {
+	if x != nil && x.Cached != nil {
+		return *x.Cached
+	}
+	return false
+}
+
+func (x *GetHistoryRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetAlgorithmVersion() string {
+	if x != nil {
+		return x.AlgorithmVersion
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetMinDurationUs() int64 {
+	if x != nil {
+		return x.MinDurationUs
+	}
+	return 0
+}
+
+type GetHistoryResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	History []*HistoryEntry        `protobuf:"bytes,1,rep,name=history,proto3" json:"history,omitempty"`
+	// Pass as cursor to get the next page; empty on the last page
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHistoryResponse) Reset() {
+	*x = GetHistoryResponse{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryResponse) ProtoMessage() {}
+
+func (x *GetHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryResponse.ProtoReflect.Descriptor instead.
+func (*GetHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetHistoryResponse) GetHistory() []*HistoryEntry {
+	if x != nil {
+		return x.History
+	}
+	return nil
+}
+
+func (x *GetHistoryResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type HistoryEntry struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Items            int32                  `protobuf:"varint,2,opt,name=items,proto3" json:"items,omitempty"`
+	PackSizes        []int32                `protobuf:"varint,3,rep,packed,name=pack_sizes,json=packSizes,proto3" json:"pack_sizes,omitempty"`
+	Result           map[int32]int32        `protobuf:"bytes,4,rep,name=result,proto3" json:"result,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	TotalItems       int32                  `protobuf:"varint,5,opt,name=total_items,json=totalItems,proto3" json:"total_items,omitempty"`
+	TotalPacks       int32                  `protobuf:"varint,6,opt,name=total_packs,json=totalPacks,proto3" json:"total_packs,omitempty"`
+	Waste            int32                  `protobuf:"varint,7,opt,name=waste,proto3" json:"waste,omitempty"`
+	Cached           bool                   `protobuf:"varint,8,opt,name=cached,proto3" json:"cached,omitempty"`
+	Timestamp        *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	RequestId        string                 `protobuf:"bytes,10,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Client           string                 `protobuf:"bytes,11,opt,name=client,proto3" json:"client,omitempty"`
+	Source           string                 `protobuf:"bytes,12,opt,name=source,proto3" json:"source,omitempty"`
+	DurationUs       int64                  `protobuf:"varint,13,opt,name=duration_us,json=durationUs,proto3" json:"duration_us,omitempty"`
+	AlgorithmVersion string                 `protobuf:"bytes,14,opt,name=algorithm_version,json=algorithmVersion,proto3" json:"algorithm_version,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *HistoryEntry) Reset() {
+	*x = HistoryEntry{}
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryEntry) ProtoMessage() {}
+
+func (x *HistoryEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_packcalc_v1_packcalc_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryEntry.ProtoReflect.Descriptor instead.
+func (*HistoryEntry) Descriptor() ([]byte, []int) {
+	return file_packcalc_v1_packcalc_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *HistoryEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetItems() int32 {
+	if x != nil {
+		return x.Items
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetPackSizes() []int32 {
+	if x != nil {
+		return x.PackSizes
+	}
+	return nil
+}
+
+func (x *HistoryEntry) GetResult() map[int32]int32 {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *HistoryEntry) GetTotalItems() int32 {
+	if x != nil {
+		return x.TotalItems
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetTotalPacks() int32 {
+	if x != nil {
+		return x.TotalPacks
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetWaste() int32 {
+	if x != nil {
+		return x.Waste
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *HistoryEntry) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *HistoryEntry) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetDurationUs() int64 {
+	if x != nil {
+		return x.DurationUs
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetAlgorithmVersion() string {
+	if x != nil {
+		return x.AlgorithmVersion
+	}
+	return ""
+}
+
+var File_packcalc_v1_packcalc_proto protoreflect.FileDescriptor
+
+const file_packcalc_v1_packcalc_proto_rawDesc = "" +
+	"\n" +
+	"\x1apackcalc/v1/packcalc.proto\x12\vpackcalc.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"G\n" +
+	"\x10CalculateRequest\x12\x14\n" +
+	"\x05items\x18\x01 \x01(\x05R\x05items\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x02 \x03(\x05R\tpackSizes\"\xca\x03\n" +
+	"\x11CalculateResponse\x12\x14\n" +
+	"\x05items\x18\x01 \x01(\x05R\x05items\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x02 \x03(\x05R\tpackSizes\x12B\n" +
+	"\x06result\x18\x03 \x03(\v2*.packcalc.v1.CalculateResponse.ResultEntryR\x06result\x12\x1f\n" +
+	"\vtotal_items\x18\x04 \x01(\x05R\n" +
+	"totalItems\x12\x1f\n" +
+	"\vtotal_packs\x18\x05 \x01(\x05R\n" +
+	"totalPacks\x12\x14\n" +
+	"\x05waste\x18\x06 \x01(\x05R\x05waste\x12.\n" +
+	"\x13calculation_time_ms\x18\a \x01(\x03R\x11calculationTimeMs\x12\x16\n" +
+	"\x06cached\x18\b \x01(\bR\x06cached\x12\x1b\n" +
+	"\tcache_ttl\x18\t \x01(\tR\bcacheTtl\x12&\n" +
+	"\x0fcache_hit_count\x18\n" +
+	" \x01(\x05R\rcacheHitCount\x12\x1c\n" +
+	"\tcoalesced\x18\v \x01(\bR\tcoalesced\x1a9\n" +
+	"\vResultEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"R\n" +
+	"\x15CalculateBatchRequest\x129\n" +
+	"\brequests\x18\x01 \x03(\v2\x1d.packcalc.v1.CalculateRequestR\brequests\"P\n" +
+	"\x16CalculateBatchResponse\x126\n" +
+	"\aresults\x18\x01 \x03(\v2\x1c.packcalc.v1.CalculateResultR\aresults\"\x86\x01\n" +
+	"\x0fCalculateResult\x12<\n" +
+	"\bresponse\x18\x01 \x01(\v2\x1e.packcalc.v1.CalculateResponseH\x00R\bresponse\x12*\n" +
+	"\x05error\x18\x02 \x01(\v2\x12.packcalc.v1.ErrorH\x00R\x05errorB\t\n" +
+	"\aoutcome\"h\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x121\n" +
+	"\adetails\x18\x03 \x03(\v2\x17.packcalc.v1.FieldErrorR\adetails\"P\n" +
+	"\n" +
+	"FieldError\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\x16\n" +
+	"\x14GetPackConfigRequest\"f\n" +
+	"\n" +
+	"PackConfig\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x01 \x03(\x05R\tpackSizes\x129\n" +
+	"\n" +
+	"updated_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"8\n" +
+	"\x17UpdatePackConfigRequest\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x01 \x03(\x05R\tpackSizes\"\x8e\x01\n" +
+	"\x18UpdatePackConfigResponse\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x01 \x03(\x05R\tpackSizes\x129\n" +
+	"\n" +
+	"updated_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\x89\x04\n" +
+	"\x11GetHistoryRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\x12\x12\n" +
+	"\x04sort\x18\x03 \x01(\tR\x04sort\x12\x14\n" +
+	"\x05order\x18\x04 \x01(\tR\x05order\x12.\n" +
+	"\x04from\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12\x1b\n" +
+	"\tmin_items\x18\a \x01(\x05R\bminItems\x12\x1b\n" +
+	"\tmax_items\x18\b \x01(\x05R\bmaxItems\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\t \x03(\x05R\tpackSizes\x12\x1b\n" +
+	"\tmin_waste\x18\n" +
+	" \x01(\x05R\bminWaste\x12\x1b\n" +
+	"\x06cached\x18\v \x01(\bH\x00R\x06cached\x88\x01\x01\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\f \x01(\tR\trequestId\x12\x16\n" +
+	"\x06client\x18\r \x01(\tR\x06client\x12\x16\n" +
+	"\x06source\x18\x0e \x01(\tR\x06source\x12+\n" +
+	"\x11algorithm_version\x18\x0f \x01(\tR\x10algorithmVersion\x12&\n" +
+	"\x0fmin_duration_us\x18\x10 \x01(\x03R\rminDurationUsB\t\n" +
+	"\a_cached\"j\n" +
+	"\x12GetHistoryResponse\x123\n" +
+	"\ahistory\x18\x01 \x03(\v2\x19.packcalc.v1.HistoryEntryR\ahistory\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"\x94\x04\n" +
+	"\fHistoryEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05items\x18\x02 \x01(\x05R\x05items\x12\x1d\n" +
+	"\n" +
+	"pack_sizes\x18\x03 \x03(\x05R\tpackSizes\x12=\n" +
+	"\x06result\x18\x04 \x03(\v2%.packcalc.v1.HistoryEntry.ResultEntryR\x06result\x12\x1f\n" +
+	"\vtotal_items\x18\x05 \x01(\x05R\n" +
+	"totalItems\x12\x1f\n" +
+	"\vtotal_packs\x18\x06 \x01(\x05R\n" +
+	"totalPacks\x12\x14\n" +
+	"\x05waste\x18\a \x01(\x05R\x05waste\x12\x16\n" +
+	"\x06cached\x18\b \x01(\bR\x06cached\x128\n" +
+	"\ttimestamp\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\n" +
+	" \x01(\tR\trequestId\x12\x16\n" +
+	"\x06client\x18\v \x01(\tR\x06client\x12\x16\n" +
+	"\x06source\x18\f \x01(\tR\x06source\x12\x1f\n" +
+	"\vduration_us\x18\r \x01(\x03R\n" +
+	"durationUs\x12+\n" +
+	"\x11algorithm_version\x18\x0e \x01(\tR\x10algorithmVersion\x1a9\n" +
+	"\vResultEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x012\x88\x04\n" +
+	"\x0ePackCalculator\x12J\n" +
+	"\tCalculate\x12\x1d.packcalc.v1.CalculateRequest\x1a\x1e.packcalc.v1.CalculateResponse\x12Y\n" +
+	"\x0eCalculateBatch\x12\".packcalc.v1.CalculateBatchRequest\x1a#.packcalc.v1.CalculateBatchResponse\x12R\n" +
+	"\x0fCalculateStream\x12\x1d.packcalc.v1.CalculateRequest\x1a\x1c.packcalc.v1.CalculateResult(\x010\x01\x12K\n" +
+	"\rGetPackConfig\x12!.packcalc.v1.GetPackConfigRequest\x1a\x17.packcalc.v1.PackConfig\x12_\n" +
+	"\x10UpdatePackConfig\x12$.packcalc.v1.UpdatePackConfigRequest\x1a%.packcalc.v1.UpdatePackConfigResponse\x12M\n" +
+	"\n" +
+	"GetHistory\x12\x1e.packcalc.v1.GetHistoryRequest\x1a\x1f.packcalc.v1.GetHistoryResponseBLZJgithub.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1;packcalcv1b\x06proto3"
+
+var (
+	file_packcalc_v1_packcalc_proto_rawDescOnce sync.Once
+	file_packcalc_v1_packcalc_proto_rawDescData []byte
+)
+
+func file_packcalc_v1_packcalc_proto_rawDescGZIP() []byte {
+	file_packcalc_v1_packcalc_proto_rawDescOnce.Do(func() {
+		file_packcalc_v1_packcalc_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_packcalc_v1_packcalc_proto_rawDesc), len(file_packcalc_v1_packcalc_proto_rawDesc)))
+	})
+	return file_packcalc_v1_packcalc_proto_rawDescData
+}
+
+var file_packcalc_v1_packcalc_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_packcalc_v1_packcalc_proto_goTypes = []any{
+	(*CalculateRequest)(nil),         // 0: packcalc.v1.CalculateRequest
+	(*CalculateResponse)(nil),        // 1: packcalc.v1.CalculateResponse
+	(*CalculateBatchRequest)(nil),    // 2: packcalc.v1.CalculateBatchRequest
+	(*CalculateBatchResponse)(nil),   // 3: packcalc.v1.CalculateBatchResponse
+	(*CalculateResult)(nil),          // 4: packcalc.v1.CalculateResult
+	(*Error)(nil),                    // 5: packcalc.v1.Error
+	(*FieldError)(nil),               // 6: packcalc.v1.FieldError
+	(*GetPackConfigRequest)(nil),     // 7: packcalc.v1.GetPackConfigRequest
+	(*PackConfig)(nil),               // 8: packcalc.v1.PackConfig
+	(*UpdatePackConfigRequest)(nil),  // 9: packcalc.v1.UpdatePackConfigRequest
+	(*UpdatePackConfigResponse)(nil), // 10: packcalc.v1.UpdatePackConfigResponse
+	(*GetHistoryRequest)(nil),        // 11: packcalc.v1.GetHistoryRequest
+	(*GetHistoryResponse)(nil),       // 12: packcalc.v1.GetHistoryResponse
+	(*HistoryEntry)(nil),             // 13: packcalc.v1.HistoryEntry
+	nil,                              // 14: packcalc.v1.CalculateResponse.ResultEntry
+	nil,                              // 15: packcalc.v1.HistoryEntry.ResultEntry
+	(*timestamppb.Timestamp)(nil),    // 16: google.protobuf.Timestamp
+}
+var file_packcalc_v1_packcalc_proto_depIdxs = []int32{
+	14, // 0: packcalc.v1.CalculateResponse.result:type_name -> packcalc.v1.CalculateResponse.ResultEntry
+	0,  // 1: packcalc.v1.CalculateBatchRequest.requests:type_name -> packcalc.v1.CalculateRequest
+	4,  // 2: packcalc.v1.CalculateBatchResponse.results:type_name -> packcalc.v1.CalculateResult
+	1,  // 3: packcalc.v1.CalculateResult.response:type_name -> packcalc.v1.CalculateResponse
+	5,  // 4: packcalc.v1.CalculateResult.error:type_name -> packcalc.v1.Error
+	6,  // 5: packcalc.v1.Error.details:type_name -> packcalc.v1.FieldError
+	16, // 6: packcalc.v1.PackConfig.updated_at:type_name -> google.protobuf.Timestamp
+	16, // 7: packcalc.v1.UpdatePackConfigResponse.updated_at:type_name -> google.protobuf.Timestamp
+	16, // 8: packcalc.v1.GetHistoryRequest.from:type_name -> google.protobuf.Timestamp
+	16, // 9: packcalc.v1.GetHistoryRequest.to:type_name -> google.protobuf.Timestamp
+	13, // 10: packcalc.v1.GetHistoryResponse.history:type_name -> packcalc.v1.HistoryEntry
+	15, // 11: packcalc.v1.HistoryEntry.result:type_name -> packcalc.v1.HistoryEntry.ResultEntry
+	16, // 12: packcalc.v1.HistoryEntry.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 13: packcalc.v1.PackCalculator.Calculate:input_type -> packcalc.v1.CalculateRequest
+	2,  // 14: packcalc.v1.PackCalculator.CalculateBatch:input_type -> packcalc.v1.CalculateBatchRequest
+	0,  // 15: packcalc.v1.PackCalculator.CalculateStream:input_type -> packcalc.v1.CalculateRequest
+	7,  // 16: packcalc.v1.PackCalculator.GetPackConfig:input_type -> packcalc.v1.GetPackConfigRequest
+	9,  // 17: packcalc.v1.PackCalculator.UpdatePackConfig:input_type -> packcalc.v1.UpdatePackConfigRequest
+	11, // 18: packcalc.v1.PackCalculator.GetHistory:input_type -> packcalc.v1.GetHistoryRequest
+	1,  // 19: packcalc.v1.PackCalculator.Calculate:output_type -> packcalc.v1.CalculateResponse
+	3,  // 20: packcalc.v1.PackCalculator.CalculateBatch:output_type -> packcalc.v1.CalculateBatchResponse
+	4,  // 21: packcalc.v1.PackCalculator.CalculateStream:output_type -> packcalc.v1.CalculateResult
+	8,  // 22: packcalc.v1.PackCalculator.GetPackConfig:output_type -> packcalc.v1.PackConfig
+	10, // 23: packcalc.v1.PackCalculator.UpdatePackConfig:output_type -> packcalc.v1.UpdatePackConfigResponse
+	12, // 24: packcalc.v1.PackCalculator.GetHistory:output_type -> packcalc.v1.GetHistoryResponse
+	19, // [19:25] is the sub-list for method output_type
+	13, // [13:19] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_packcalc_v1_packcalc_proto_init() }
+func file_packcalc_v1_packcalc_proto_init() {
+	if File_packcalc_v1_packcalc_proto != nil {
+		return
+	}
+	file_packcalc_v1_packcalc_proto_msgTypes[4].OneofWrappers = []any{
+		(*CalculateResult_Response)(nil),
+		(*CalculateResult_Error)(nil),
+	}
+	file_packcalc_v1_packcalc_proto_msgTypes[11].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_packcalc_v1_packcalc_proto_rawDesc), len(file_packcalc_v1_packcalc_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_packcalc_v1_packcalc_proto_goTypes,
+		DependencyIndexes: file_packcalc_v1_packcalc_proto_depIdxs,
+		MessageInfos:      file_packcalc_v1_packcalc_proto_msgTypes,
+	}.Build()
+	File_packcalc_v1_packcalc_proto = out.File
+	file_packcalc_v1_packcalc_proto_goTypes = nil
+	file_packcalc_v1_packcalc_proto_depIdxs = nil
+}
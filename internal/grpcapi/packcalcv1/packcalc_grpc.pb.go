@@ -0,0 +1,332 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: packcalc/v1/packcalc.proto
+
+package packcalcv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PackCalculator_Calculate_FullMethodName        = "/packcalc.v1.PackCalculator/Calculate"
+	PackCalculator_CalculateBatch_FullMethodName   = "/packcalc.v1.PackCalculator/CalculateBatch"
+	PackCalculator_CalculateStream_FullMethodName  = "/packcalc.v1.PackCalculator/CalculateStream"
+	PackCalculator_GetPackConfig_FullMethodName    = "/packcalc.v1.PackCalculator/GetPackConfig"
+	PackCalculator_UpdatePackConfig_FullMethodName = "/packcalc.v1.PackCalculator/UpdatePackConfig"
+	PackCalculator_GetHistory_FullMethodName       = "/packcalc.v1.PackCalculator/GetHistory"
+)
+
+// PackCalculatorClient is the client API for PackCalculator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PackCalculator is the gRPC counterpart of the REST API. It shares the
+// cache, the history and the request validation with POST /api/calculate.
+type PackCalculatorClient interface {
+	// Calculate finds the packs for one order. Needs the calculate scope.
+	Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error)
+	// CalculateBatch answers up to 100 orders. A failed order does not fail
+	// the others. Needs the calculate scope.
+	CalculateBatch(ctx context.Context, in *CalculateBatchRequest, opts ...grpc.CallOption) (*CalculateBatchResponse, error)
+	// CalculateStream answers every order sent on the stream, in order. A
+	// failed order does not end the stream. Needs the calculate scope.
+	CalculateStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateRequest, CalculateResult], error)
+	// GetPackConfig returns the configured pack sizes
+	GetPackConfig(ctx context.Context, in *GetPackConfigRequest, opts ...grpc.CallOption) (*PackConfig, error)
+	// UpdatePackConfig replaces the configured pack sizes. Needs the
+	// admin:config scope.
+	UpdatePackConfig(ctx context.Context, in *UpdatePackConfigRequest, opts ...grpc.CallOption) (*UpdatePackConfigResponse, error)
+	// GetHistory pages through the calculation history, newest first unless
+	// sorted otherwise. Needs the read:history scope.
+	GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error)
+}
+
+type packCalculatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPackCalculatorClient(cc grpc.ClientConnInterface) PackCalculatorClient {
+	return &packCalculatorClient{cc}
+}
+
+func (c *packCalculatorClient) Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateResponse)
+	err := c.cc.Invoke(ctx, PackCalculator_Calculate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packCalculatorClient) CalculateBatch(ctx context.Context, in *CalculateBatchRequest, opts ...grpc.CallOption) (*CalculateBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateBatchResponse)
+	err := c.cc.Invoke(ctx, PackCalculator_CalculateBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packCalculatorClient) CalculateStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateRequest, CalculateResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PackCalculator_ServiceDesc.Streams[0], PackCalculator_CalculateStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CalculateRequest, CalculateResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackCalculator_CalculateStreamClient = grpc.BidiStreamingClient[CalculateRequest, CalculateResult]
+
+func (c *packCalculatorClient) GetPackConfig(ctx context.Context, in *GetPackConfigRequest, opts ...grpc.CallOption) (*PackConfig, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PackConfig)
+	err := c.cc.Invoke(ctx, PackCalculator_GetPackConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packCalculatorClient) UpdatePackConfig(ctx context.Context, in *UpdatePackConfigRequest, opts ...grpc.CallOption) (*UpdatePackConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdatePackConfigResponse)
+	err := c.cc.Invoke(ctx, PackCalculator_UpdatePackConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packCalculatorClient) GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetHistoryResponse)
+	err := c.cc.Invoke(ctx, PackCalculator_GetHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PackCalculatorServer is the server API for PackCalculator service.
+// All implementations must embed UnimplementedPackCalculatorServer
+// for forward compatibility.
+//
+// PackCalculator is the gRPC counterpart of the REST API. It shares the
+// cache, the history and the request validation with POST /api/calculate.
+type PackCalculatorServer interface {
+	// Calculate finds the packs for one order. Needs the calculate scope.
+	Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error)
+	// CalculateBatch answers up to 100 orders. A failed order does not fail
+	// the others. Needs the calculate scope.
+	CalculateBatch(context.Context, *CalculateBatchRequest) (*CalculateBatchResponse, error)
+	// CalculateStream answers every order sent on the stream, in order. A
+	// failed order does not end the stream. Needs the calculate scope.
+	CalculateStream(grpc.BidiStreamingServer[CalculateRequest, CalculateResult]) error
+	// GetPackConfig returns the configured pack sizes
+	GetPackConfig(context.Context, *GetPackConfigRequest) (*PackConfig, error)
+	// UpdatePackConfig replaces the configured pack sizes. Needs the
+	// admin:config scope.
+	UpdatePackConfig(context.Context, *UpdatePackConfigRequest) (*UpdatePackConfigResponse, error)
+	// GetHistory pages through the calculation history, newest first unless
+	// sorted otherwise. Needs the read:history scope.
+	GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error)
+	mustEmbedUnimplementedPackCalculatorServer()
+}
+
+// UnimplementedPackCalculatorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPackCalculatorServer struct{}
+
+func (UnimplementedPackCalculatorServer) Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Calculate not implemented")
+}
+func (UnimplementedPackCalculatorServer) CalculateBatch(context.Context, *CalculateBatchRequest) (*CalculateBatchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CalculateBatch not implemented")
+}
+func (UnimplementedPackCalculatorServer) CalculateStream(grpc.BidiStreamingServer[CalculateRequest, CalculateResult]) error {
+	return status.Error(codes.Unimplemented, "method CalculateStream not implemented")
+}
+func (UnimplementedPackCalculatorServer) GetPackConfig(context.Context, *GetPackConfigRequest) (*PackConfig, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetPackConfig not implemented")
+}
+func (UnimplementedPackCalculatorServer) UpdatePackConfig(context.Context, *UpdatePackConfigRequest) (*UpdatePackConfigResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdatePackConfig not implemented")
+}
+func (UnimplementedPackCalculatorServer) GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedPackCalculatorServer) mustEmbedUnimplementedPackCalculatorServer() {}
+func (UnimplementedPackCalculatorServer) testEmbeddedByValue()                        {}
+
+// UnsafePackCalculatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PackCalculatorServer will
+// result in compilation errors.
+type UnsafePackCalculatorServer interface {
+	mustEmbedUnimplementedPackCalculatorServer()
+}
+
+func RegisterPackCalculatorServer(s grpc.ServiceRegistrar, srv PackCalculatorServer) {
+	// If the following call panics, it indicates UnimplementedPackCalculatorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PackCalculator_ServiceDesc, srv)
+}
+
+func _PackCalculator_Calculate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackCalculatorServer).Calculate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackCalculator_Calculate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackCalculatorServer).Calculate(ctx, req.(*CalculateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackCalculator_CalculateBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackCalculatorServer).CalculateBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackCalculator_CalculateBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackCalculatorServer).CalculateBatch(ctx, req.(*CalculateBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackCalculator_CalculateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PackCalculatorServer).CalculateStream(&grpc.GenericServerStream[CalculateRequest, CalculateResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackCalculator_CalculateStreamServer = grpc.BidiStreamingServer[CalculateRequest, CalculateResult]
+
+func _PackCalculator_GetPackConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPackConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackCalculatorServer).GetPackConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackCalculator_GetPackConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackCalculatorServer).GetPackConfig(ctx, req.(*GetPackConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackCalculator_UpdatePackConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePackConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackCalculatorServer).UpdatePackConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackCalculator_UpdatePackConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackCalculatorServer).UpdatePackConfig(ctx, req.(*UpdatePackConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackCalculator_GetHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackCalculatorServer).GetHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackCalculator_GetHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackCalculatorServer).GetHistory(ctx, req.(*GetHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PackCalculator_ServiceDesc is the grpc.ServiceDesc for PackCalculator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PackCalculator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "packcalc.v1.PackCalculator",
+	HandlerType: (*PackCalculatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Calculate",
+			Handler:    _PackCalculator_Calculate_Handler,
+		},
+		{
+			MethodName: "CalculateBatch",
+			Handler:    _PackCalculator_CalculateBatch_Handler,
+		},
+		{
+			MethodName: "GetPackConfig",
+			Handler:    _PackCalculator_GetPackConfig_Handler,
+		},
+		{
+			MethodName: "UpdatePackConfig",
+			Handler:    _PackCalculator_UpdatePackConfig_Handler,
+		},
+		{
+			MethodName: "GetHistory",
+			Handler:    _PackCalculator_GetHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CalculateStream",
+			Handler:       _PackCalculator_CalculateStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "packcalc/v1/packcalc.proto",
+}
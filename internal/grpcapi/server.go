@@ -0,0 +1,147 @@
+// Package grpcapi serves the PackCalculator gRPC service, the gRPC health
+// service and server reflection. Requests are answered by the same
+// api.Handler as the REST API, so they share its validation, cache,
+// history and API keys.
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/api"
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1"
+	"github.com/sander-remitly/pack-calc/internal/health"
+	"github.com/sander-remitly/pack-calc/internal/idempotency"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// defaultHealthInterval is how often the readiness checks update the
+// gRPC health status
+const defaultHealthInterval = 5 * time.Second
+
+// Server is the gRPC server
+type Server struct {
+	grpc           *grpc.Server
+	health         *grpchealth.Server
+	checker        *health.Checker
+	auth           *auth.Authenticator
+	limiter        *ratelimit.Limiter
+	idem           *idempotency.Guard
+	healthInterval time.Duration
+	tls            *tls.Config
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Option configures optional Server settings
+type Option func(*Server)
+
+// WithTLS serves gRPC over TLS with cfg, e.g. the REST API's configuration
+// with its client certificate authentication. Nil means plaintext.
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = cfg
+	}
+}
+
+// New creates a gRPC server that answers through handler, checks API keys
+// with its authenticator and applies its rate limits, quotas and
+// idempotency keys. Messages are capped at the REST API's body limit.
+func New(handler *api.Handler, opts ...Option) *Server {
+	s := &Server{
+		health:         grpchealth.NewServer(),
+		checker:        handler.HealthChecker(),
+		auth:           handler.Authenticator(),
+		limiter:        handler.Limiter(),
+		idem:           handler.Idempotency(),
+		healthInterval: defaultHealthInterval,
+		stop:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(int(api.MaxBodyBytes())),
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}
+	if s.tls != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.tls)))
+	}
+
+	s.grpc = grpc.NewServer(serverOpts...)
+	packcalcv1.RegisterPackCalculatorServer(s.grpc, &service{handler: handler, limiter: s.limiter})
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	reflection.Register(s.grpc)
+
+	s.updateHealth(context.Background())
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown. It keeps the health
+// status up to date meanwhile.
+func (s *Server) Serve(lis net.Listener) error {
+	go s.watchHealth()
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown reports the service as not serving, then stops accepting
+// connections and waits for open RPCs until ctx is done, when it cancels
+// them
+func (s *Server) Shutdown(ctx context.Context) {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// watchHealth runs the readiness checks every healthInterval until
+// Shutdown
+func (s *Server) watchHealth() {
+	ticker := time.NewTicker(s.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.updateHealth(context.Background())
+		}
+	}
+}
+
+// updateHealth sets the health status of the server and of the
+// PackCalculator service: serving once started and unless a readiness
+// check is unhealthy, as the readiness probe of the REST API
+func (s *Server) updateHealth(ctx context.Context) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if s.checker.Started() && s.checker.Run(ctx).Status != health.StatusUnhealthy {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(packcalcv1.PackCalculator_ServiceDesc.ServiceName, status)
+}
@@ -0,0 +1,551 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/api"
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1"
+	"github.com/sander-remitly/pack-calc/internal/health"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// testServer is a gRPC server on an in-process listener
+type testServer struct {
+	server *Server
+	repo   *repo.Repository
+	conn   *grpc.ClientConn
+	client packcalcv1.PackCalculatorClient
+}
+
+// startServer serves a handler on a fresh SQLite database over bufconn
+func startServer(t *testing.T, opts ...api.Option) *testServer {
+	t.Helper()
+
+	repository, err := repo.New(filepath.Join(t.TempDir(), "packcalc.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+
+	handler := api.NewHandler(repository, cache.NewMemoryCache(100, 0), opts...)
+	server := New(handler)
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &testServer{server: server, repo: repository, conn: conn, client: packcalcv1.NewPackCalculatorClient(conn)}
+}
+
+func TestCalculate(t *testing.T) {
+	ts := startServer(t)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-client-id", "billing", "x-request-id", "req-1")
+	var header metadata.MD
+	resp, err := ts.client.Calculate(ctx, &packcalcv1.CalculateRequest{Items: 501, PackSizes: []int32{250, 500, 1000}}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+
+	if resp.TotalItems != 750 || resp.TotalPacks != 2 || resp.Result[500] != 1 || resp.Result[250] != 1 || resp.Cached {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+	if got := header.Get(requestIDKey); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("Expected the request ID in the header, got %v", got)
+	}
+
+	// The second answer comes from the cache the REST API shares
+	resp, err = ts.client.Calculate(ctx, &packcalcv1.CalculateRequest{Items: 501, PackSizes: []int32{250, 500, 1000}})
+	if err != nil || !resp.Cached {
+		t.Errorf("Expected a cached response, got %v (%v)", resp, err)
+	}
+
+	entries, err := ts.repo.GetHistory(10)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d (%v)", len(entries), err)
+	}
+	if got := entries[0]; got.RequestID != "req-1" || got.Client != "billing" || got.Source != models.SourceAPI {
+		t.Errorf("Unexpected history metadata: %+v", got)
+	}
+}
+
+func TestCalculate_InvalidArgument(t *testing.T) {
+	ts := startServer(t)
+
+	_, err := ts.client.Calculate(context.Background(), &packcalcv1.CalculateRequest{Items: 0, PackSizes: []int32{250, 250}})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.FieldViolations {
+				fields = append(fields, v.Field+":"+v.Reason)
+			}
+		}
+	}
+	want := []string{"items:" + models.FieldTooSmall, "pack_sizes[1]:" + models.FieldDuplicate}
+	if len(fields) != len(want) || fields[0] != want[0] || fields[1] != want[1] {
+		t.Errorf("Expected field violations %v, got %v", want, fields)
+	}
+}
+
+func TestCalculateBatch(t *testing.T) {
+	ts := startServer(t)
+
+	resp, err := ts.client.CalculateBatch(context.Background(), &packcalcv1.CalculateBatchRequest{Requests: []*packcalcv1.CalculateRequest{
+		{Items: 1, PackSizes: []int32{250, 500}},
+		{Items: -5, PackSizes: []int32{250, 500}},
+		{Items: 12001, PackSizes: []int32{250, 500, 1000, 2000, 5000}},
+	}})
+	if err != nil {
+		t.Fatalf("CalculateBatch failed: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(resp.Results))
+	}
+
+	if r := resp.Results[0].GetResponse(); r == nil || r.TotalItems != 250 {
+		t.Errorf("Expected 250 items for the first order, got %v", resp.Results[0])
+	}
+	if e := resp.Results[1].GetError(); e == nil || e.Code != models.ErrorCodeValidation || len(e.Details) != 1 || e.Details[0].Field != "items" {
+		t.Errorf("Expected a validation error for the second order, got %v", resp.Results[1])
+	}
+	if r := resp.Results[2].GetResponse(); r == nil || r.TotalItems != 12250 || r.TotalPacks != 4 {
+		t.Errorf("Expected 12250 items in 4 packs for the third order, got %v", resp.Results[2])
+	}
+
+	// Failed orders are not recorded; batches are recorded as such
+	entries, _ := ts.repo.GetHistory(10)
+	if len(entries) != 2 || entries[0].Source != models.SourceBatch {
+		t.Errorf("Expected 2 batch history entries, got %+v", entries)
+	}
+
+	tooMany := make([]*packcalcv1.CalculateRequest, MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = &packcalcv1.CalculateRequest{Items: 1}
+	}
+	_, err = ts.client.CalculateBatch(context.Background(), &packcalcv1.CalculateBatchRequest{Requests: tooMany})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for %d requests, got %v", len(tooMany), err)
+	}
+}
+
+func TestCalculateStream(t *testing.T) {
+	ts := startServer(t)
+
+	stream, err := ts.client.CalculateStream(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateStream failed: %v", err)
+	}
+
+	items := []int32{1, 0, 501}
+	for _, n := range items {
+		if err := stream.Send(&packcalcv1.CalculateRequest{Items: n, PackSizes: []int32{250, 500}}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend failed: %v", err)
+	}
+
+	var results []*packcalcv1.CalculateResult
+	for {
+		result, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != len(items) {
+		t.Fatalf("Expected %d results, got %d", len(items), len(results))
+	}
+	if results[0].GetResponse().GetItems() != 1 || results[1].GetError() == nil || results[2].GetResponse().GetTotalItems() != 750 {
+		t.Errorf("Unexpected results: %v", results)
+	}
+}
+
+func TestPackConfig(t *testing.T) {
+	ts := startServer(t)
+	ctx := context.Background()
+
+	updated, err := ts.client.UpdatePackConfig(ctx, &packcalcv1.UpdatePackConfigRequest{PackSizes: []int32{23, 31, 53}})
+	if err != nil {
+		t.Fatalf("UpdatePackConfig failed: %v", err)
+	}
+	if len(updated.PackSizes) != 3 || updated.UpdatedAt == nil {
+		t.Errorf("Unexpected update response: %v", updated)
+	}
+
+	config, err := ts.client.GetPackConfig(ctx, &packcalcv1.GetPackConfigRequest{})
+	if err != nil {
+		t.Fatalf("GetPackConfig failed: %v", err)
+	}
+	if len(config.PackSizes) != 3 || config.PackSizes[0] != 23 || config.PackSizes[2] != 53 {
+		t.Errorf("Expected pack sizes [23 31 53], got %v", config.PackSizes)
+	}
+
+	// Orders without pack sizes use the configured ones
+	resp, err := ts.client.Calculate(ctx, &packcalcv1.CalculateRequest{Items: 500000})
+	if err != nil || resp.TotalItems != 500000 || len(resp.PackSizes) != 3 {
+		t.Errorf("Expected 500000 items in the configured pack sizes, got %v (%v)", resp, err)
+	}
+
+	_, err = ts.client.UpdatePackConfig(ctx, &packcalcv1.UpdatePackConfigRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for no pack sizes, got %v", err)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	ts := startServer(t)
+	ctx := context.Background()
+
+	for _, items := range []int32{1, 251, 501} {
+		if _, err := ts.client.Calculate(ctx, &packcalcv1.CalculateRequest{Items: items, PackSizes: []int32{250, 500}}); err != nil {
+			t.Fatalf("Calculate failed: %v", err)
+		}
+	}
+
+	page, err := ts.client.GetHistory(ctx, &packcalcv1.GetHistoryRequest{Limit: 2, Sort: repo.SortItems, Order: repo.OrderAsc})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(page.History) != 2 || page.History[0].Items != 1 || page.History[1].Items != 251 || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %v", page)
+	}
+	if page.History[0].Result[250] != 1 || page.History[0].Timestamp == nil {
+		t.Errorf("Expected the result and timestamp of the entry, got %v", page.History[0])
+	}
+
+	page, err = ts.client.GetHistory(ctx, &packcalcv1.GetHistoryRequest{Limit: 2, Sort: repo.SortItems, Order: repo.OrderAsc, Cursor: page.NextCursor})
+	if err != nil || len(page.History) != 1 || page.History[0].Items != 501 || page.NextCursor != "" {
+		t.Errorf("Unexpected last page: %v (%v)", page, err)
+	}
+
+	tests := []struct {
+		name string
+		req  *packcalcv1.GetHistoryRequest
+	}{
+		{"unknown sort", &packcalcv1.GetHistoryRequest{Sort: "price"}},
+		{"limit too large", &packcalcv1.GetHistoryRequest{Limit: repo.MaxHistoryLimit + 1}},
+		{"negative filter", &packcalcv1.GetHistoryRequest{MinWaste: -1}},
+		{"bad cursor", &packcalcv1.GetHistoryRequest{Cursor: "nope"}},
+	}
+	for _, tt := range tests {
+		if _, err := ts.client.GetHistory(ctx, tt.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tt.name, err)
+		}
+	}
+}
+
+// keyStore holds API keys by hash
+type keyStore map[string]models.APIKey
+
+func (s keyStore) GetAPIKey(hash string) (models.APIKey, error) {
+	key, ok := s[hash]
+	if !ok {
+		return key, repo.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func TestAuth(t *testing.T) {
+	store := keyStore{
+		auth.HashKey("pk_admin"): {Name: "ops", Scopes: []string{auth.ScopeAdminConfig}},
+		auth.HashKey("pk_calc"):  {Name: "ci", Scopes: []string{auth.ScopeCalculate}},
+	}
+	ts := startServer(t, api.WithAuth(auth.New(store, auth.Config{Enabled: true, AnonymousScopes: []string{auth.ScopeCalculate}})))
+
+	withKey := func(md ...string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), md...)
+	}
+	update := &packcalcv1.UpdatePackConfigRequest{PackSizes: []int32{10, 20}}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"anonymous", context.Background(), codes.Unauthenticated},
+		{"unknown key", withKey("x-api-key", "pk_wrong"), codes.Unauthenticated},
+		{"key without scope", withKey("x-api-key", "pk_calc"), codes.PermissionDenied},
+		{"bearer key with scope", withKey("authorization", "Bearer pk_admin"), codes.OK},
+	}
+	for _, tt := range tests {
+		if _, err := ts.client.UpdatePackConfig(tt.ctx, update); status.Code(err) != tt.want {
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Anonymous calculations are allowed; keyed ones are recorded under
+	// the key name
+	if _, err := ts.client.Calculate(context.Background(), &packcalcv1.CalculateRequest{Items: 1, PackSizes: []int32{10}}); err != nil {
+		t.Errorf("Expected an anonymous calculation to pass, got %v", err)
+	}
+	if _, err := ts.client.Calculate(withKey("x-api-key", "pk_calc", "x-client-id", "spoofed"), &packcalcv1.CalculateRequest{Items: 2, PackSizes: []int32{10}}); err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	entries, _ := ts.repo.GetHistory(1)
+	if len(entries) != 1 || entries[0].Client != "ci" {
+		t.Errorf("Expected the key name as client, got %+v", entries)
+	}
+
+	// Streams are authorized too
+	stream, err := ts.client.CalculateStream(withKey("x-api-key", "pk_wrong"))
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected an unknown key to be rejected on streams, got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := ratelimit.Config{Enabled: true, Limits: map[string]ratelimit.Limit{ratelimit.GroupCalculate: {Rate: 0.01, Burst: 3}}}
+	ts := startServer(t, api.WithRateLimiter(ratelimit.New(ratelimit.NewMemoryStore(), nil, cfg)))
+	ctx := context.Background()
+	order := &packcalcv1.CalculateRequest{Items: 1, PackSizes: []int32{250, 500}}
+
+	// Batches take one request per order
+	resp, err := ts.client.CalculateBatch(ctx, &packcalcv1.CalculateBatchRequest{Requests: []*packcalcv1.CalculateRequest{order, order}})
+	if err != nil {
+		t.Fatalf("CalculateBatch failed: %v", err)
+	}
+	if resp.Results[0].GetResponse() == nil || resp.Results[1].GetResponse() == nil {
+		t.Errorf("Expected both orders answered, got %v", resp.Results)
+	}
+
+	// So do streams, answering orders over the limit with an error
+	stream, err := ts.client.CalculateStream(ctx)
+	if err != nil {
+		t.Fatalf("CalculateStream failed: %v", err)
+	}
+	var results []*packcalcv1.CalculateResult
+	for range 2 {
+		if err := stream.Send(order); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		result, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		results = append(results, result)
+	}
+	stream.CloseSend()
+	if results[0].GetResponse() == nil || results[1].GetError().GetCode() != models.ErrorCodeRateLimited {
+		t.Errorf("Expected the second streamed order rate limited, got %v", results)
+	}
+
+	// Unary calls fail once the bucket is empty
+	_, err = ts.client.Calculate(ctx, order)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 {
+		t.Errorf("Expected a RetryInfo detail, got %v", status.Convert(err).Details())
+	}
+
+	// Methods outside the calculate group are not limited by it
+	if _, err := ts.client.GetPackConfig(ctx, &packcalcv1.GetPackConfigRequest{}); err != nil {
+		t.Errorf("Expected GetPackConfig to pass, got %v", err)
+	}
+}
+
+// usage counts requests per API key in memory
+type usage map[int64]int64
+
+func (u usage) IncrementAPIKeyUsage(keyID int64, _ time.Time) (int64, error) {
+	u[keyID]++
+	return u[keyID], nil
+}
+
+func TestQuota(t *testing.T) {
+	store := keyStore{auth.HashKey("pk_calc"): {ID: 7, Name: "ci", Scopes: []string{auth.ScopeCalculate}, DailyQuota: 2}}
+	cfg := ratelimit.Config{Enabled: true, Limits: map[string]ratelimit.Limit{ratelimit.GroupCalculate: {Rate: 0.01, Burst: 1}}}
+	ts := startServer(t,
+		api.WithAuth(auth.New(store, auth.Config{Enabled: true})),
+		api.WithRateLimiter(ratelimit.New(ratelimit.NewMemoryStore(), usage{}, cfg)),
+	)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "pk_calc")
+	order := &packcalcv1.CalculateRequest{Items: 1, PackSizes: []int32{250, 500}}
+
+	// Health checks and rate limited calls are not charged
+	if _, err := healthpb.NewHealthClient(ts.conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if _, err := ts.client.Calculate(ctx, order); err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	if _, err := ts.client.Calculate(ctx, order); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected the rate limit exceeded, got %v", err)
+	}
+	if _, err := ts.client.GetPackConfig(ctx, &packcalcv1.GetPackConfigRequest{}); err != nil {
+		t.Fatalf("Expected the quota to have one request left, got %v", err)
+	}
+	if _, err := ts.client.GetPackConfig(ctx, &packcalcv1.GetPackConfigRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected the quota exceeded, got %v", err)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	ts := startServer(t)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", key)
+	}
+	batch := &packcalcv1.CalculateBatchRequest{Requests: []*packcalcv1.CalculateRequest{
+		{Items: 1, PackSizes: []int32{250, 500}},
+		{Items: 501, PackSizes: []int32{250, 500}},
+	}}
+
+	first, err := ts.client.CalculateBatch(withKey("erp-batch-1"), batch)
+	if err != nil {
+		t.Fatalf("CalculateBatch failed: %v", err)
+	}
+
+	// A retried batch is replayed rather than recorded twice
+	var header metadata.MD
+	retry, err := ts.client.CalculateBatch(withKey("erp-batch-1"), batch, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if !proto.Equal(first, retry) || first.Results[0].GetResponse() == nil {
+		t.Errorf("Expected the first response replayed, got %v", retry)
+	}
+	if got := header.Get("idempotent-replayed"); len(got) != 1 || got[0] != "true" {
+		t.Errorf("Expected the idempotent-replayed header, got %v", header)
+	}
+	if entries, _ := ts.repo.GetHistory(10); len(entries) != 2 {
+		t.Errorf("Expected 2 history entries, got %d", len(entries))
+	}
+
+	// Reusing a key for another request is rejected
+	_, err = ts.client.Calculate(withKey("erp-batch-1"), &packcalcv1.CalculateRequest{Items: 1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a reused key, got %v", err)
+	}
+
+	// Invalid requests are replayed with their error
+	invalid := &packcalcv1.CalculateRequest{Items: -1}
+	for i := 0; i < 2; i++ {
+		var header metadata.MD
+		_, err := ts.client.Calculate(withKey("erp-invalid"), invalid, grpc.Header(&header))
+		if status.Code(err) != codes.InvalidArgument || len(status.Convert(err).Details()) != 1 {
+			t.Errorf("Request %d: expected InvalidArgument with details, got %v", i+1, err)
+		}
+		if replayed := len(header.Get("idempotent-replayed")) > 0; replayed != (i == 1) {
+			t.Errorf("Request %d: expected replayed %v, got %v", i+1, i == 1, replayed)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	checker := &health.Checker{}
+	ts := startServer(t, api.WithHealthChecker(checker))
+	client := healthpb.NewHealthClient(ts.conn)
+	service := packcalcv1.PackCalculator_ServiceDesc.ServiceName
+
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return resp.Status
+	}
+
+	if got := check(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING while starting, got %s", got)
+	}
+
+	checker.MarkStarted()
+	ts.server.updateHealth(context.Background())
+	if got := check(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected SERVING once started, got %s", got)
+	}
+
+	checker.Add("database", func(context.Context) (health.Status, error) {
+		return health.StatusUnhealthy, errors.New("connection refused")
+	})
+	ts.server.updateHealth(context.Background())
+	if got := check(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING with an unhealthy dependency, got %s", got)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	ts := startServer(t)
+
+	stream, err := reflectionpb.NewServerReflectionClient(ts.conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo failed: %v", err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+
+	services := map[string]bool{}
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services[s.Name] = true
+	}
+	for _, want := range []string{"packcalc.v1.PackCalculator", "grpc.health.v1.Health"} {
+		if !services[want] {
+			t.Errorf("Expected %s to be listed, got %v", want, services)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/sander-remitly/pack-calc/internal/api"
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/grpcapi/packcalcv1"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/ratelimit"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MaxBatchSize is the most orders one CalculateBatch call may hold
+const MaxBatchSize = 100
+
+// service implements the PackCalculator RPCs on top of api.Handler
+type service struct {
+	packcalcv1.UnimplementedPackCalculatorServer
+	handler *api.Handler
+	limiter *ratelimit.Limiter
+}
+
+// Calculate answers one order
+func (s *service) Calculate(ctx context.Context, req *packcalcv1.CalculateRequest) (*packcalcv1.CalculateResponse, error) {
+	response, err := s.handler.Calculate(ctx, calculateRequest(req), historyMetadata(ctx, models.SourceAPI))
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return calculateResponse(response), nil
+}
+
+// CalculateBatch answers each order of the batch in turn; a failed order,
+// e.g. one over the rate limit, gets an error result and the rest are
+// still answered
+func (s *service) CalculateBatch(ctx context.Context, req *packcalcv1.CalculateBatchRequest) (*packcalcv1.CalculateBatchResponse, error) {
+	if len(req.GetRequests()) > MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "a batch must hold at most %d requests, got %d", MaxBatchSize, len(req.GetRequests()))
+	}
+
+	meta := historyMetadata(ctx, models.SourceBatch)
+	results := make([]*packcalcv1.CalculateResult, len(req.GetRequests()))
+	for i, r := range req.GetRequests() {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		results[i] = s.calculateResult(ctx, r, meta)
+	}
+
+	return &packcalcv1.CalculateBatchResponse{Results: results}, nil
+}
+
+// CalculateStream answers every order received until the client closes
+// its side of the stream. Like batches, each order is charged against the
+// rate limit and quota.
+func (s *service) CalculateStream(stream packcalcv1.PackCalculator_CalculateStreamServer) error {
+	ctx := stream.Context()
+	meta := historyMetadata(ctx, models.SourceAPI)
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(s.calculateResult(ctx, req, meta)); err != nil {
+			return err
+		}
+	}
+}
+
+// calculateResult charges and answers one order of a batch or stream
+func (s *service) calculateResult(ctx context.Context, req *packcalcv1.CalculateRequest, meta models.HistoryEntry) *packcalcv1.CalculateResult {
+	var exceeded *ratelimit.Exceeded
+	if err := s.limiter.Charge(ctx, ratelimit.GroupCalculate, peerAddress(ctx)); errors.As(err, &exceeded) {
+		return &packcalcv1.CalculateResult{Outcome: &packcalcv1.CalculateResult_Error{Error: &packcalcv1.Error{Code: exceeded.Code, Message: exceeded.Message}}}
+	}
+
+	response, err := s.handler.Calculate(ctx, calculateRequest(req), meta)
+	if err != nil {
+		return &packcalcv1.CalculateResult{Outcome: &packcalcv1.CalculateResult_Error{Error: resultError(ctx, err)}}
+	}
+	return &packcalcv1.CalculateResult{Outcome: &packcalcv1.CalculateResult_Response{Response: calculateResponse(response)}}
+}
+
+// GetPackConfig returns the configured pack sizes
+func (s *service) GetPackConfig(ctx context.Context, _ *packcalcv1.GetPackConfigRequest) (*packcalcv1.PackConfig, error) {
+	config, err := s.handler.PackConfig(ctx)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &packcalcv1.PackConfig{
+		PackSizes: int32s(config.PackSizes),
+		UpdatedAt: timestamp(config.UpdatedAt),
+	}, nil
+}
+
+// UpdatePackConfig replaces the configured pack sizes
+func (s *service) UpdatePackConfig(ctx context.Context, req *packcalcv1.UpdatePackConfigRequest) (*packcalcv1.UpdatePackConfigResponse, error) {
+	response, err := s.handler.UpdatePackConfig(ctx, models.ConfigUpdateRequest{PackSizes: ints(req.GetPackSizes())})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &packcalcv1.UpdatePackConfigResponse{
+		PackSizes: int32s(response.PackSizes),
+		UpdatedAt: timestamp(response.UpdatedAt),
+		Message:   response.Message,
+	}, nil
+}
+
+// GetHistory returns a page of the calculation history
+func (s *service) GetHistory(ctx context.Context, req *packcalcv1.GetHistoryRequest) (*packcalcv1.GetHistoryResponse, error) {
+	query, err := historyQuery(req)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	response, err := s.handler.History(ctx, query)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	entries := make([]*packcalcv1.HistoryEntry, len(response.History))
+	for i, e := range response.History {
+		entries[i] = historyEntry(e)
+	}
+	return &packcalcv1.GetHistoryResponse{History: entries, NextCursor: response.NextCursor}, nil
+}
+
+// historyQuery converts a history request, checking what parseHistoryQuery
+// checks for GET /api/history
+func historyQuery(req *packcalcv1.GetHistoryRequest) (repo.HistoryQuery, error) {
+	var errs []models.FieldError
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"limit", int64(req.GetLimit())},
+		{"min_items", int64(req.GetMinItems())},
+		{"max_items", int64(req.GetMaxItems())},
+		{"min_waste", int64(req.GetMinWaste())},
+		{"min_duration_us", req.GetMinDurationUs()},
+	} {
+		if f.value < 0 {
+			errs = append(errs, models.FieldError{Field: f.name, Code: models.FieldTooSmall, Message: "must be at least 0"})
+		}
+	}
+	if req.GetLimit() > repo.MaxHistoryLimit {
+		errs = append(errs, models.FieldError{Field: "limit", Code: models.FieldTooLarge, Message: fmt.Sprintf("must be at most %d", repo.MaxHistoryLimit)})
+	}
+	if req.GetMaxItems() > 0 && req.GetMinItems() > req.GetMaxItems() {
+		errs = append(errs, models.FieldError{Field: "min_items", Code: models.FieldInvalid, Message: "must not exceed max_items"})
+	}
+	if len(errs) > 0 {
+		return repo.HistoryQuery{}, &api.ValidationError{Fields: errs}
+	}
+
+	query := repo.HistoryQuery{
+		MinItems:         int(req.GetMinItems()),
+		MaxItems:         int(req.GetMaxItems()),
+		PackSizes:        ints(req.GetPackSizes()),
+		MinWaste:         int(req.GetMinWaste()),
+		RequestID:        req.GetRequestId(),
+		Client:           req.GetClient(),
+		Source:           req.GetSource(),
+		AlgorithmVersion: req.GetAlgorithmVersion(),
+		MinDurationUs:    req.GetMinDurationUs(),
+		Sort:             req.GetSort(),
+		Order:            req.GetOrder(),
+		Limit:            int(req.GetLimit()),
+		Cursor:           req.GetCursor(),
+	}
+	if req.From != nil {
+		query.From = req.GetFrom().AsTime()
+	}
+	if req.To != nil {
+		query.To = req.GetTo().AsTime()
+	}
+	if req.Cached != nil {
+		cached := req.GetCached()
+		query.Cached = &cached
+	}
+	return query, nil
+}
+
+// historyMetadata returns the history metadata of an RPC, like the REST
+// API does: the client is the API key name, the common name of a verified
+// client certificate, the x-client-id metadata or the peer address, and
+// the source is the x-source metadata or source
+func historyMetadata(ctx context.Context, source string) models.HistoryEntry {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	client := first(md, "x-client-id")
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			if cn := info.State.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+				client = cn
+			}
+		}
+	}
+	if client == "" {
+		client = peerAddress(ctx)
+	}
+	if key, ok := auth.FromContext(ctx); ok {
+		client = key.Name
+	}
+
+	if s := first(md, "x-source"); s != "" {
+		source = s
+	}
+
+	return api.HistoryMetadata(requestID(ctx), client, source)
+}
+
+// peerAddress returns the host of the client's address, or "" if unknown
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// statusError converts an error of api.Handler to a gRPC status. Invalid
+// fields are listed in a BadRequest detail.
+func statusError(ctx context.Context, err error) error {
+	var invalid *api.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		st := status.New(codes.InvalidArgument, err.Error())
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(invalid.Fields))
+		for i, f := range invalid.Fields {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message, Reason: f.Code}
+		}
+		if detailed, derr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); derr == nil {
+			st = detailed
+		}
+		return st.Err()
+	case errors.Is(err, api.ErrInvalidPackSizes), errors.Is(err, repo.ErrInvalidQuery), errors.Is(err, repo.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		logger.FromContext(ctx).Error("Request error", zap.Error(err))
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// resultError converts an error of api.Handler to the error of a batch or
+// stream result, with the REST API's error codes
+func resultError(ctx context.Context, err error) *packcalcv1.Error {
+	var invalid *api.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		details := make([]*packcalcv1.FieldError, len(invalid.Fields))
+		for i, f := range invalid.Fields {
+			details[i] = &packcalcv1.FieldError{Field: f.Field, Code: f.Code, Message: f.Message}
+		}
+		return &packcalcv1.Error{Code: models.ErrorCodeValidation, Message: err.Error(), Details: details}
+	case errors.Is(err, api.ErrInvalidPackSizes):
+		return &packcalcv1.Error{Code: models.ErrorCodeBadRequest, Message: err.Error()}
+	default:
+		logger.FromContext(ctx).Error("Request error", zap.Error(err))
+		return &packcalcv1.Error{Code: models.ErrorCodeInternal, Message: err.Error()}
+	}
+}
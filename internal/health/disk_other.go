@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package health
+
+// freeBytes is not implemented on this platform
+func freeBytes(string) (uint64, error) {
+	return 0, errDiskUnsupported
+}
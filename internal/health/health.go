@@ -0,0 +1,294 @@
+// Package health runs the dependency checks behind the readiness probe
+// and tracks whether the service has finished starting up.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/history"
+)
+
+// Status of a check or of the service as a whole
+type Status string
+
+const (
+	// StatusOK means the dependency works
+	StatusOK Status = "ok"
+	// StatusDegraded means requests are still answered, but slower or
+	// with less durability, e.g. without the cache
+	StatusDegraded Status = "degraded"
+	// StatusUnhealthy means requests fail; the instance should not get
+	// traffic
+	StatusUnhealthy Status = "unhealthy"
+)
+
+// errDiskUnsupported is returned where free disk space cannot be read
+var errDiskUnsupported = errors.New("disk space check not supported on this platform")
+
+// severity orders statuses from best to worst
+var severity = map[Status]int{StatusOK: 0, StatusDegraded: 1, StatusUnhealthy: 2}
+
+// CheckFunc checks one dependency. The error explains a status other
+// than ok.
+type CheckFunc func(ctx context.Context) (Status, error)
+
+// Pinger is implemented by the repository and the Redis caches
+type Pinger interface {
+	Ping() error
+}
+
+// Backlog is implemented by the history writer
+type Backlog interface {
+	Stats() history.Stats
+}
+
+// Config controls the readiness checks
+type Config struct {
+	Timeout        time.Duration // Longest a single check may take
+	DiskMinFreeMB  uint64        // Below this the disk check is unhealthy
+	DiskWarnFreeMB uint64        // Below this the disk check is degraded
+	BacklogWarn    float64       // History queue fill ratio at which the backlog check is degraded
+}
+
+// LoadConfig reads the health check configuration from the environment
+func LoadConfig() Config {
+	var cfg Config
+
+	if v, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+
+	if v, err := strconv.ParseUint(os.Getenv("HEALTH_DISK_MIN_FREE_MB"), 10, 64); err == nil && v > 0 {
+		cfg.DiskMinFreeMB = v
+	}
+
+	if v, err := strconv.ParseUint(os.Getenv("HEALTH_DISK_WARN_FREE_MB"), 10, 64); err == nil && v > 0 {
+		cfg.DiskWarnFreeMB = v
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv("HEALTH_HISTORY_BACKLOG_WARN"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.BacklogWarn = v
+	}
+
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Second
+	}
+	if c.DiskMinFreeMB == 0 {
+		c.DiskMinFreeMB = 100
+	}
+	if c.DiskWarnFreeMB < c.DiskMinFreeMB {
+		c.DiskWarnFreeMB = max(1024, c.DiskMinFreeMB)
+	}
+	if c.BacklogWarn <= 0 || c.BacklogWarn > 1 {
+		c.BacklogWarn = 0.8
+	}
+	return c
+}
+
+// Dependencies are the parts of the service checked for readiness
+type Dependencies struct {
+	Database Pinger          // Always checked
+	Cache    cache.Cache     // Checked when it is backed by Redis
+	History  *history.Writer // Checked when history goes through the batching writer
+	DataDir  string          // Directory of the SQLite database; empty for PostgreSQL
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name    string
+	Status  Status
+	Latency time.Duration
+	Error   string
+}
+
+// Report is the outcome of all checks. Its status is the worst of theirs.
+type Report struct {
+	Status Status
+	Checks []Result
+}
+
+// check is a named CheckFunc
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the readiness checks and holds the startup state
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+	started atomic.Bool
+}
+
+// New creates a checker for deps. It reports the service as starting
+// until MarkStarted is called.
+func New(cfg Config, deps Dependencies) *Checker {
+	cfg = cfg.withDefaults()
+	c := &Checker{timeout: cfg.Timeout}
+
+	c.Add("database", DatabaseCheck(deps.Database))
+	if pinger, ok := deps.Cache.(Pinger); ok {
+		c.Add("cache", CacheCheck(pinger))
+	}
+	if deps.DataDir != "" {
+		c.Add("disk", DiskCheck(deps.DataDir, cfg.DiskMinFreeMB, cfg.DiskWarnFreeMB))
+	}
+	if deps.History != nil {
+		c.Add("history_backlog", BacklogCheck(deps.History, cfg.BacklogWarn))
+	}
+
+	return c
+}
+
+// Add registers a check, run after the existing ones
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// MarkStarted records that startup, i.e. migrations and the cache
+// warm-up, has finished
+func (c *Checker) MarkStarted() {
+	c.started.Store(true)
+}
+
+// Started reports whether MarkStarted has been called
+func (c *Checker) Started() bool {
+	return c.started.Load()
+}
+
+// Run runs all checks concurrently. A check that outlives the timeout is
+// reported unhealthy; it keeps running in the background until it
+// returns.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make([]Result, len(c.checks))}
+
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if severity[result.Status] > severity[report.Status] {
+			report.Status = result.Status
+		}
+	}
+	return report
+}
+
+// run runs one check within the timeout
+func (c *Checker) run(ctx context.Context, chk check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		status Status
+		err    error
+	}
+	done := make(chan outcome, 1)
+
+	start := time.Now()
+	go func() {
+		status, err := chk.fn(ctx)
+		done <- outcome{status, err}
+	}()
+
+	result := Result{Name: chk.name}
+	select {
+	case o := <-done:
+		result.Status = o.status
+		if o.err != nil {
+			result.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = StatusUnhealthy
+		result.Error = fmt.Sprintf("check timed out after %s", c.timeout)
+	}
+	result.Latency = time.Since(start)
+
+	return result
+}
+
+// DatabaseCheck fails when the database does not answer: without it no
+// calculation can be saved nor pack configuration read
+func DatabaseCheck(db Pinger) CheckFunc {
+	return func(context.Context) (Status, error) {
+		if err := db.Ping(); err != nil {
+			return StatusUnhealthy, err
+		}
+		return StatusOK, nil
+	}
+}
+
+// CacheCheck degrades when Redis does not answer. Requests still succeed
+// by calculating every result.
+func CacheCheck(redis Pinger) CheckFunc {
+	return func(context.Context) (Status, error) {
+		if err := redis.Ping(); err != nil {
+			return StatusDegraded, err
+		}
+		return StatusOK, nil
+	}
+}
+
+// DiskCheck degrades when the free space in dir drops below warnMB and
+// fails below minMB. On platforms where free space cannot be read it
+// always passes.
+func DiskCheck(dir string, minMB, warnMB uint64) CheckFunc {
+	return func(context.Context) (Status, error) {
+		free, err := freeBytes(dir)
+		if errors.Is(err, errDiskUnsupported) {
+			return StatusOK, nil
+		}
+		if err != nil {
+			return StatusUnhealthy, err
+		}
+
+		freeMB := free / (1 << 20)
+		switch {
+		case freeMB < minMB:
+			return StatusUnhealthy, fmt.Errorf("%d MB free in %s, below the minimum of %d MB", freeMB, dir, minMB)
+		case freeMB < warnMB:
+			return StatusDegraded, fmt.Errorf("%d MB free in %s, below the warning level of %d MB", freeMB, dir, warnMB)
+		}
+		return StatusOK, nil
+	}
+}
+
+// BacklogCheck degrades when the history writer's queue is fuller than
+// the warn ratio. A full queue is unhealthy under the block policy,
+// because requests then wait for the database.
+func BacklogCheck(w Backlog, warn float64) CheckFunc {
+	return func(context.Context) (Status, error) {
+		stats := w.Stats()
+		if stats.QueueCapacity == 0 {
+			return StatusOK, nil
+		}
+
+		fill := float64(stats.QueueDepth) / float64(stats.QueueCapacity)
+		switch {
+		case stats.QueueDepth >= stats.QueueCapacity && stats.Policy == history.PolicyBlock:
+			return StatusUnhealthy, fmt.Errorf("history queue full (%d entries); requests are blocked", stats.QueueDepth)
+		case fill >= warn:
+			return StatusDegraded, fmt.Errorf("history queue %.0f%% full (%d of %d entries)", fill*100, stats.QueueDepth, stats.QueueCapacity)
+		}
+		return StatusOK, nil
+	}
+}
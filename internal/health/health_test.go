@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/history"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// pinger answers Ping with err
+type pinger struct{ err error }
+
+func (p pinger) Ping() error { return p.err }
+
+// backlog reports fixed history writer stats
+type backlog history.Stats
+
+func (b backlog) Stats() history.Stats { return history.Stats(b) }
+
+// fixed returns a check with a fixed outcome
+func fixed(status Status, err error) CheckFunc {
+	return func(context.Context) (Status, error) { return status, err }
+}
+
+func TestChecker_Run(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Status
+		want   Status
+	}{
+		{"all ok", []Status{StatusOK, StatusOK}, StatusOK},
+		{"one degraded", []Status{StatusOK, StatusDegraded}, StatusDegraded},
+		{"unhealthy wins", []Status{StatusUnhealthy, StatusDegraded, StatusOK}, StatusUnhealthy},
+		{"no checks", nil, StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Checker{timeout: time.Second}
+			for i, status := range tt.checks {
+				c.Add(string(rune('a'+i)), fixed(status, nil))
+			}
+
+			report := c.Run(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, report.Status)
+			}
+			// Results keep the order the checks were added in
+			for i, result := range report.Checks {
+				if result.Name != string(rune('a'+i)) || result.Status != tt.checks[i] {
+					t.Errorf("Expected check %c to be %s, got %+v", 'a'+i, tt.checks[i], result)
+				}
+			}
+		})
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := &Checker{timeout: 20 * time.Millisecond}
+	release := make(chan struct{})
+	defer close(release)
+	c.Add("slow", func(context.Context) (Status, error) {
+		<-release
+		return StatusOK, nil
+	})
+	c.Add("fast", fixed(StatusOK, nil))
+
+	report := c.Run(context.Background())
+	if report.Status != StatusUnhealthy {
+		t.Errorf("Expected a timed out check to be unhealthy, got %s", report.Status)
+	}
+	slow := report.Checks[0]
+	if slow.Error == "" || slow.Latency < 20*time.Millisecond {
+		t.Errorf("Expected a timeout error after 20ms, got %+v", slow)
+	}
+}
+
+func TestNew(t *testing.T) {
+	writer := history.New(nil, history.Config{})
+	defer writer.Close(context.Background())
+
+	c := New(Config{}, Dependencies{
+		Database: pinger{},
+		Cache:    cache.NewMemoryCache(10, 0),
+		History:  writer,
+		DataDir:  t.TempDir(),
+	})
+
+	// The in-memory cache has no connection to check
+	var names []string
+	for _, chk := range c.checks {
+		names = append(names, chk.name)
+	}
+	if len(names) != 3 || names[0] != "database" || names[1] != "disk" || names[2] != "history_backlog" {
+		t.Errorf("Expected database, disk and history_backlog checks, got %v", names)
+	}
+
+	if c.Started() {
+		t.Error("Expected the checker to start out starting")
+	}
+	c.MarkStarted()
+	if !c.Started() {
+		t.Error("Expected the checker to be started")
+	}
+}
+
+func TestDatabaseAndCacheChecks(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name  string
+		check CheckFunc
+		want  Status
+	}{
+		{"database up", DatabaseCheck(pinger{}), StatusOK},
+		{"database down", DatabaseCheck(pinger{down}), StatusUnhealthy},
+		{"cache up", CacheCheck(pinger{}), StatusOK},
+		{"cache down", CacheCheck(pinger{down}), StatusDegraded},
+	}
+
+	for _, tt := range tests {
+		if got, _ := tt.check(context.Background()); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDiskCheck(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := freeBytes(dir); err != nil {
+		t.Skipf("Free disk space not available: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		minMB, warnMB uint64
+		want          Status
+	}{
+		{"plenty of space", 1, 1, StatusOK},
+		{"below warning", 1, 1 << 40, StatusDegraded},
+		{"below minimum", 1 << 40, 1 << 40, StatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		got, err := DiskCheck(dir, tt.minMB, tt.warnMB)(context.Background())
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.name, tt.want, got, err)
+		}
+	}
+
+	if got, _ := DiskCheck(dir+"/missing", 1, 1)(context.Background()); got != StatusUnhealthy {
+		t.Errorf("Expected a missing directory to be unhealthy, got %s", got)
+	}
+}
+
+func TestBacklogCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats history.Stats
+		want  Status
+	}{
+		{"empty", history.Stats{Policy: history.PolicyBlock, QueueCapacity: 100}, StatusOK},
+		{"below warning", history.Stats{Policy: history.PolicyBlock, QueueDepth: 79, QueueCapacity: 100}, StatusOK},
+		{"filling up", history.Stats{Policy: history.PolicyBlock, QueueDepth: 80, QueueCapacity: 100}, StatusDegraded},
+		{"full, blocking", history.Stats{Policy: history.PolicyBlock, QueueDepth: 100, QueueCapacity: 100}, StatusUnhealthy},
+		{"full, dropping", history.Stats{Policy: history.PolicyDrop, QueueDepth: 100, QueueCapacity: 100}, StatusDegraded},
+	}
+
+	for _, tt := range tests {
+		if got, _ := BacklogCheck(backlog(tt.stats), 0.8)(context.Background()); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "")
+	t.Setenv("HEALTH_DISK_MIN_FREE_MB", "")
+	t.Setenv("HEALTH_DISK_WARN_FREE_MB", "")
+	t.Setenv("HEALTH_HISTORY_BACKLOG_WARN", "")
+
+	want := Config{Timeout: 2 * time.Second, DiskMinFreeMB: 100, DiskWarnFreeMB: 1024, BacklogWarn: 0.8}
+	if cfg := LoadConfig(); cfg != want {
+		t.Errorf("Expected defaults %+v, got %+v", want, cfg)
+	}
+
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "500ms")
+	t.Setenv("HEALTH_DISK_MIN_FREE_MB", "2048")
+	t.Setenv("HEALTH_HISTORY_BACKLOG_WARN", "1.5")
+
+	// The warning level is raised to the minimum; invalid ratios are ignored
+	want = Config{Timeout: 500 * time.Millisecond, DiskMinFreeMB: 2048, DiskWarnFreeMB: 2048, BacklogWarn: 0.8}
+	if cfg := LoadConfig(); cfg != want {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrQueueFull is returned when an entry is dropped because the queue
+	// is full
+	ErrQueueFull = errors.New("history queue full")
+	// ErrClosed is returned for entries written after Close
+	ErrClosed = errors.New("history writer closed")
+)
+
+// Policies for a full queue
+const (
+	// PolicyBlock makes writers wait for room in the queue, which slows
+	// requests down to the rate the database can keep up with
+	PolicyBlock = "block"
+	// PolicyDrop discards entries while the queue is full, so requests
+	// are never held up by history writes
+	PolicyDrop = "drop"
+)
+
+// Store saves batches of entries. It is satisfied by *repo.Repository.
+type Store interface {
+	SaveHistoryEntries(entries []models.HistoryEntry) error
+}
+
+// Config controls the history writer
+type Config struct {
+	QueueSize     int           // Entries buffered before the policy applies
+	BatchSize     int           // Entries saved per transaction at most
+	FlushInterval time.Duration // Longest an entry waits for a batch to fill
+	Policy        string        // block or drop
+}
+
+// LoadConfig reads the history writer configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		Policy: strings.ToLower(os.Getenv("HISTORY_WRITER_POLICY")),
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("HISTORY_WRITER_QUEUE_SIZE")); err == nil && v > 0 {
+		cfg.QueueSize = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("HISTORY_WRITER_BATCH_SIZE")); err == nil && v > 0 {
+		cfg.BatchSize = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("HISTORY_WRITER_FLUSH_INTERVAL")); err == nil && v > 0 {
+		cfg.FlushInterval = v
+	}
+
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields
+func (c Config) withDefaults() Config {
+	if c.QueueSize <= 0 {
+		c.QueueSize = 10000
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 200
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 100 * time.Millisecond
+	}
+	if c.Policy != PolicyDrop {
+		c.Policy = PolicyBlock
+	}
+	return c
+}
+
+// Stats reports the writer's queue and counters since it started
+type Stats struct {
+	Policy        string
+	QueueDepth    int   // Entries queued or in the batch being filled or saved
+	QueueCapacity int   // Entries the queue holds
+	Written       int64 // Entries saved
+	Dropped       int64 // Entries discarded because the queue was full
+	Failed        int64 // Entries lost to database errors
+	Batches       int64 // Transactions committed
+}
+
+// Writer saves history entries in the background, batching inserts into
+// transactions so that the database sees one write per batch rather than
+// one per request
+type Writer struct {
+	store Store
+	cfg   Config
+	queue chan models.HistoryEntry
+
+	mu     sync.RWMutex // Held for reading while sending to queue
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+
+	batched atomic.Int64 // Entries taken off the queue but not yet saved
+	written atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+	batches atomic.Int64
+}
+
+// New creates a writer and starts its flush loop
+func New(store Store, cfg Config) *Writer {
+	cfg = cfg.withDefaults()
+	w := &Writer{
+		store: store,
+		cfg:   cfg,
+		queue: make(chan models.HistoryEntry, cfg.QueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go w.loop()
+	return w
+}
+
+// Write queues an entry, stamping it with the current time if it has
+// none. When the queue is full it waits for room or ctx (PolicyBlock) or
+// drops the entry (PolicyDrop); dropped entries return ErrQueueFull.
+func (w *Writer) Write(ctx context.Context, entry models.HistoryEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrClosed
+	}
+
+	select {
+	case w.queue <- entry:
+		return nil
+	default:
+	}
+
+	if w.cfg.Policy == PolicyBlock {
+		select {
+		case w.queue <- entry:
+			return nil
+		case <-ctx.Done():
+		}
+	}
+
+	w.dropped.Add(1)
+	metrics.HistoryEntriesDropped.Inc()
+	return ErrQueueFull
+}
+
+// Close stops accepting entries and saves the queued ones, waiting until
+// they are saved or ctx is done
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the queue depth and counters
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Policy:        w.cfg.Policy,
+		QueueDepth:    len(w.queue) + int(w.batched.Load()),
+		QueueCapacity: cap(w.queue),
+		Written:       w.written.Load(),
+		Dropped:       w.dropped.Load(),
+		Failed:        w.failed.Load(),
+		Batches:       w.batches.Load(),
+	}
+}
+
+// loop saves a batch when it is full or FlushInterval after its first
+// entry, and the remaining entries on Close
+func (w *Writer) loop() {
+	defer close(w.done)
+
+	batch := make([]models.HistoryEntry, 0, w.cfg.BatchSize)
+	timer := time.NewTimer(w.cfg.FlushInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case entry := <-w.queue:
+			if len(batch) == 0 {
+				timer.Reset(w.cfg.FlushInterval)
+			}
+			batch = append(batch, entry)
+			w.batched.Add(1)
+			if len(batch) >= w.cfg.BatchSize {
+				timer.Stop()
+				batch = w.flush(batch)
+			}
+
+		case <-timer.C:
+			batch = w.flush(batch)
+
+		case <-w.stop:
+			timer.Stop()
+			// No Write is sending anymore: Close holds the lock first
+			for {
+				select {
+				case entry := <-w.queue:
+					batch = append(batch, entry)
+					w.batched.Add(1)
+					if len(batch) >= w.cfg.BatchSize {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush saves a batch and returns it emptied for reuse
+func (w *Writer) flush(batch []models.HistoryEntry) []models.HistoryEntry {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// Batches mix entries from many requests, so each is a trace of its own
+	_, span := tracing.Start(context.Background(), "Repository.SaveHistoryEntries",
+		attribute.Int("entries", len(batch)),
+	)
+	defer span.End()
+
+	if err := w.store.SaveHistoryEntries(batch); err != nil {
+		tracing.RecordError(span, err)
+		w.failed.Add(int64(len(batch)))
+		logger.Log.Warn("Failed to save history batch",
+			zap.Int("entries", len(batch)),
+			zap.Error(err),
+		)
+	} else {
+		w.written.Add(int64(len(batch)))
+		w.batches.Add(1)
+	}
+	w.batched.Add(-int64(len(batch)))
+
+	return batch[:0]
+}
@@ -0,0 +1,276 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// fakeStore records the batches it saves. With a gate, each save waits
+// for a value on it.
+type fakeStore struct {
+	mu      sync.Mutex
+	batches [][]models.HistoryEntry
+	err     error
+	gate    chan struct{}
+	saving  atomic.Int32 // Saves started
+}
+
+func (s *fakeStore) SaveHistoryEntries(entries []models.HistoryEntry) error {
+	s.saving.Add(1)
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, append([]models.HistoryEntry(nil), entries...))
+	return nil
+}
+
+func (s *fakeStore) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := make([]int, len(s.batches))
+	for i, b := range s.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+func entry(items int) models.HistoryEntry {
+	return models.HistoryEntry{Items: items, PackSizes: []int{250, 500}, Result: map[int]int{500: 1}, TotalItems: 500, TotalPacks: 1}
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the writer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriter_BatchesBySize(t *testing.T) {
+	store := &fakeStore{}
+	w := New(store, Config{BatchSize: 3, FlushInterval: time.Hour})
+
+	for i := 1; i <= 7; i++ {
+		if err := w.Write(context.Background(), entry(i)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return len(store.batchSizes()) == 2 })
+
+	// The partial batch is saved on Close
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if sizes := store.batchSizes(); !reflect.DeepEqual(sizes, []int{3, 3, 1}) {
+		t.Errorf("Expected batches of [3 3 1], got %v", sizes)
+	}
+
+	for i, e := range store.batches[0] {
+		if e.Items != i+1 || e.Timestamp.IsZero() {
+			t.Errorf("Expected entry %d in order with a timestamp, got %+v", i+1, e)
+		}
+	}
+
+	stats := w.Stats()
+	if stats.Written != 7 || stats.Batches != 3 || stats.QueueDepth != 0 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestWriter_FlushesOnInterval(t *testing.T) {
+	store := &fakeStore{}
+	w := New(store, Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer w.Close(context.Background())
+
+	w.Write(context.Background(), entry(1))
+	w.Write(context.Background(), entry(2))
+
+	waitFor(t, func() bool { return len(store.batchSizes()) == 1 })
+	if sizes := store.batchSizes(); !reflect.DeepEqual(sizes, []int{2}) {
+		t.Errorf("Expected one batch of 2, got %v", sizes)
+	}
+}
+
+func TestWriter_QueueFull(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"drop", PolicyDrop},
+		{"block", PolicyBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{gate: make(chan struct{})}
+			w := New(store, Config{QueueSize: 2, BatchSize: 1, Policy: tt.policy})
+
+			// The first entry is held in a save, the next two fill the queue
+			w.Write(context.Background(), entry(1))
+			waitFor(t, func() bool { return store.saving.Load() == 1 })
+			w.Write(context.Background(), entry(2))
+			w.Write(context.Background(), entry(3))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			if err := w.Write(ctx, entry(4)); !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Expected ErrQueueFull, got %v", err)
+			}
+			if waited := time.Since(start); tt.policy == PolicyBlock && waited < 20*time.Millisecond {
+				t.Errorf("Expected the block policy to wait for the context, returned after %v", waited)
+			}
+
+			stats := w.Stats()
+			if stats.Dropped != 1 || stats.QueueDepth != 3 || stats.QueueCapacity != 2 || stats.Policy != tt.policy {
+				t.Errorf("Unexpected stats: %+v", stats)
+			}
+
+			close(store.gate)
+			if err := w.Close(context.Background()); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if stats := w.Stats(); stats.Written != 3 {
+				t.Errorf("Expected 3 entries written, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestWriter_BlockWaitsForRoom(t *testing.T) {
+	store := &fakeStore{gate: make(chan struct{})}
+	w := New(store, Config{QueueSize: 1, BatchSize: 1, Policy: PolicyBlock})
+
+	w.Write(context.Background(), entry(1))
+	waitFor(t, func() bool { return store.saving.Load() == 1 })
+	w.Write(context.Background(), entry(2))
+
+	result := make(chan error)
+	go func() { result <- w.Write(context.Background(), entry(3)) }()
+
+	select {
+	case err := <-result:
+		t.Fatalf("Expected Write to block on a full queue, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(store.gate)
+	if err := <-result; err != nil {
+		t.Errorf("Expected the blocked Write to succeed, got %v", err)
+	}
+
+	w.Close(context.Background())
+	if sizes := store.batchSizes(); len(sizes) != 3 {
+		t.Errorf("Expected 3 batches, got %v", sizes)
+	}
+}
+
+func TestWriter_Close(t *testing.T) {
+	store := &fakeStore{gate: make(chan struct{})}
+	w := New(store, Config{BatchSize: 1})
+	w.Write(context.Background(), entry(1))
+
+	// Close waits for the queued entries until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to time out, got %v", err)
+	}
+
+	if err := w.Write(context.Background(), entry(2)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+
+	close(store.gate)
+	if err := w.Close(context.Background()); err != nil {
+		t.Errorf("Expected the second Close to finish, got %v", err)
+	}
+	if stats := w.Stats(); stats.Written != 1 {
+		t.Errorf("Expected 1 entry written, got %+v", stats)
+	}
+}
+
+func TestWriter_StoreError(t *testing.T) {
+	store := &fakeStore{err: errors.New("database is locked")}
+	w := New(store, Config{BatchSize: 2})
+
+	w.Write(context.Background(), entry(1))
+	w.Write(context.Background(), entry(2))
+	w.Write(context.Background(), entry(3))
+	w.Close(context.Background())
+
+	stats := w.Stats()
+	if stats.Failed != 3 || stats.Written != 0 || stats.Batches != 0 {
+		t.Errorf("Expected 3 failed entries, got %+v", stats)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Config
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{},
+			want: Config{QueueSize: 10000, BatchSize: 200, FlushInterval: 100 * time.Millisecond, Policy: PolicyBlock},
+		},
+		{
+			name: "custom",
+			env: map[string]string{
+				"HISTORY_WRITER_QUEUE_SIZE":     "500",
+				"HISTORY_WRITER_BATCH_SIZE":     "50",
+				"HISTORY_WRITER_FLUSH_INTERVAL": "1s",
+				"HISTORY_WRITER_POLICY":         "DROP",
+			},
+			want: Config{QueueSize: 500, BatchSize: 50, FlushInterval: time.Second, Policy: PolicyDrop},
+		},
+		{
+			name: "invalid",
+			env: map[string]string{
+				"HISTORY_WRITER_QUEUE_SIZE": "-1",
+				"HISTORY_WRITER_POLICY":     "spill",
+			},
+			want: Config{QueueSize: 10000, BatchSize: 200, FlushInterval: 100 * time.Millisecond, Policy: PolicyBlock},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"HISTORY_WRITER_QUEUE_SIZE", "HISTORY_WRITER_BATCH_SIZE", "HISTORY_WRITER_FLUSH_INTERVAL", "HISTORY_WRITER_POLICY"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			if cfg := LoadConfig(); cfg != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, cfg)
+			}
+		})
+	}
+}
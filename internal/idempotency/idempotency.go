@@ -0,0 +1,294 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+)
+
+const (
+	// Header is the request header carrying the idempotency key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// Backends accepted by IDEMPOTENCY_BACKEND
+const (
+	BackendSQL   = "sql"
+	BackendRedis = "redis"
+)
+
+// maxKeyLength bounds the idempotency keys accepted
+const maxKeyLength = 255
+
+// lockTimeout is how long a key stays reserved by a request that has not
+// completed, e.g. because the server crashed, before retries may run it
+const lockTimeout = time.Minute
+
+// Store keeps idempotency records
+type Store interface {
+	// Reserve stores rec as in progress unless its key is taken by a record
+	// that has not expired, and returns the record holding the key and
+	// whether it is rec
+	Reserve(ctx context.Context, rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error)
+	// Complete stores the response of the request holding rec.Key
+	Complete(ctx context.Context, rec repo.IdempotencyRecord) error
+	// Release frees a key whose request is still in progress
+	Release(ctx context.Context, key string) error
+}
+
+// Config controls idempotency keys
+type Config struct {
+	TTL     time.Duration // How long responses are kept for replay
+	Backend string        // sql or redis
+}
+
+// LoadConfig reads the idempotency configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		Backend: strings.ToLower(os.Getenv("IDEMPOTENCY_BACKEND")),
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && v > 0 {
+		cfg.TTL = v
+	}
+
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields
+func (c Config) withDefaults() Config {
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.Backend != BackendRedis {
+		c.Backend = BackendSQL
+	}
+	return c
+}
+
+// Errors of Run for requests that cannot run
+var (
+	// ErrKeyTooLong is returned for a key longer than 255 characters
+	ErrKeyTooLong = errors.New("idempotency key must be at most " + strconv.Itoa(maxKeyLength) + " characters")
+	// ErrKeyReused is returned when a key is reused for another request
+	ErrKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrInProgress is returned while the first request with a key runs
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+// Response is the stored outcome of a request
+type Response struct {
+	StatusCode  int // HTTP status; 5xx responses are not stored
+	ContentType string
+	Body        []byte
+}
+
+// Guard makes requests with an Idempotency-Key header safe to retry: the
+// first request runs and its response is stored, and retries with the same
+// key and payload get that response instead of running again
+type Guard struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// New creates a guard keeping its records in store
+func New(store Store, cfg Config) *Guard {
+	return &Guard{store: store, cfg: cfg.withDefaults(), now: time.Now}
+}
+
+// Middleware applies idempotency keys to a route. Keys are scoped to the
+// API key of the request, so clients cannot replay each other's responses;
+// it must run after auth.Authenticator.Middleware. Reusing a key with a
+// different method, path or body gets 422, and retrying while the first
+// request runs gets 409. Responses with a 5xx status are not stored, so
+// those requests can be retried.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			respond(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Idempotency-Key must be at most "+strconv.Itoa(maxKeyLength)+" characters")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respond(w, http.StatusBadRequest, models.ErrorCodeBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		response, replayed, err := g.run(r.Context(), scope(r)+":"+key, requestHash(r, body), func() Response {
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			return Response{StatusCode: recorder.status, ContentType: recorder.Header().Get("Content-Type"), Body: recorder.body.Bytes()}
+		})
+		switch {
+		case errors.Is(err, ErrKeyReused):
+			respond(w, http.StatusUnprocessableEntity, models.ErrorCodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request")
+		case errors.Is(err, ErrInProgress):
+			w.Header().Set("Retry-After", "1")
+			respond(w, http.StatusConflict, models.ErrorCodeIdempotencyInProgress, "A request with this Idempotency-Key is in progress")
+		case err != nil:
+			logger.Log.Error("Failed to reserve idempotency key", zap.Error(err))
+			respond(w, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Failed to check Idempotency-Key")
+		case replayed:
+			if response.ContentType != "" {
+				w.Header().Set("Content-Type", response.ContentType)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(response.StatusCode)
+			w.Write(response.Body)
+		}
+	})
+}
+
+// Run applies an idempotency key to a request of another transport, with
+// the rules of Middleware: method names the operation and payload is the
+// encoded request, and without an API key in ctx keys are scoped to the
+// client address addr. fn runs the request unless an earlier one with the
+// key completed, whose response is returned with replayed set. Requests
+// that cannot run fail with ErrKeyTooLong, ErrKeyReused or ErrInProgress,
+// or the error of the store.
+func (g *Guard) Run(ctx context.Context, key, addr, method string, payload []byte, fn func() Response) (response Response, replayed bool, err error) {
+	if len(key) > maxKeyLength {
+		return Response{}, false, ErrKeyTooLong
+	}
+
+	h := sha256.New()
+	io.WriteString(h, method+"\n")
+	h.Write(payload)
+	return g.run(ctx, clientScope(ctx, addr)+":"+key, hex.EncodeToString(h.Sum(nil)), fn)
+}
+
+// run reserves key for a request with the payload hash, runs fn and
+// stores its response, or returns the stored response of an earlier
+// request
+func (g *Guard) run(ctx context.Context, key, hash string, fn func() Response) (Response, bool, error) {
+	// Storing the outcome must not depend on the client waiting for it
+	ctx = context.WithoutCancel(ctx)
+	rec := repo.IdempotencyRecord{
+		Key:         key,
+		RequestHash: hash,
+		ExpiresAt:   g.now().Add(lockTimeout),
+	}
+
+	existing, reserved, err := g.store.Reserve(ctx, rec)
+	if err != nil {
+		return Response{}, false, err
+	}
+	if !reserved {
+		switch {
+		case existing.RequestHash != hash:
+			return Response{}, false, ErrKeyReused
+		case existing.StatusCode == 0:
+			return Response{}, false, ErrInProgress
+		}
+		return Response{StatusCode: existing.StatusCode, ContentType: existing.ContentType, Body: existing.Body}, true, nil
+	}
+
+	completed := false
+	defer func() {
+		// Also reached when fn panics
+		if !completed {
+			if err := g.store.Release(ctx, rec.Key); err != nil {
+				logger.Log.Warn("Failed to release idempotency key", zap.Error(err))
+			}
+		}
+	}()
+
+	response := fn()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return response, false, nil
+	}
+
+	rec.StatusCode = response.StatusCode
+	rec.ContentType = response.ContentType
+	rec.Body = response.Body
+	rec.ExpiresAt = g.now().Add(g.cfg.TTL)
+	if err := g.store.Complete(ctx, rec); err != nil {
+		logger.Log.Warn("Failed to store idempotent response", zap.Error(err))
+		return response, false, nil
+	}
+	completed = true
+	return response, false, nil
+}
+
+// scope returns the namespace of a request's idempotency keys: the API
+// key, or the client address without one, as the rate limiter keys
+// clients, so that anonymous clients cannot replay each other's responses
+func scope(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return clientScope(r.Context(), host)
+}
+
+// clientScope returns the namespace of the keys of the API key in ctx, or
+// of the client at addr
+func clientScope(ctx context.Context, addr string) string {
+	if key, ok := auth.FromContext(ctx); ok {
+		return "key:" + strconv.FormatInt(key.ID, 10)
+	}
+	return "ip:" + addr
+}
+
+// requestHash identifies the payload of a request
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// respond writes an error in the API's ErrorResponse shape
+func respond(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: status, ErrorCode: code})
+}
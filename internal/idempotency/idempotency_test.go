@@ -0,0 +1,393 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// fakeStore keeps records in a map
+type fakeStore struct {
+	records map[string]repo.IdempotencyRecord
+	err     error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{records: make(map[string]repo.IdempotencyRecord)}
+}
+
+func (s *fakeStore) Reserve(ctx context.Context, rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error) {
+	if s.err != nil {
+		return rec, false, s.err
+	}
+	if existing, ok := s.records[rec.Key]; ok {
+		return existing, false, nil
+	}
+	s.records[rec.Key] = rec
+	return rec, true, nil
+}
+
+func (s *fakeStore) Complete(ctx context.Context, rec repo.IdempotencyRecord) error {
+	s.records[rec.Key] = rec
+	return nil
+}
+
+func (s *fakeStore) Release(ctx context.Context, key string) error {
+	if s.records[key].StatusCode == 0 {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// countingHandler answers with a numbered response and counts its calls
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(h.status)
+	w.Write([]byte(`{"call":` + strconv.Itoa(h.calls) + `,"body":` + string(body) + `}`))
+}
+
+// send posts body to the guarded handler with an Idempotency-Key
+func send(handler http.Handler, key, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestGuard_Replay(t *testing.T) {
+	store := newFakeStore()
+	next := &countingHandler{status: http.StatusOK}
+	handler := New(store, Config{}).Middleware(next)
+
+	first := send(handler, "order-1", "/api/calculate", `{"items":251}`)
+	if first.Code != http.StatusOK || first.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("Expected the first request to run, got %d %v", first.Code, first.Header())
+	}
+
+	retry := send(handler, "order-1", "/api/calculate", `{"items":251}`)
+	if next.calls != 1 {
+		t.Errorf("Expected the retry not to run the handler, got %d calls", next.calls)
+	}
+	if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the first response replayed, got %d %s", retry.Code, retry.Body.String())
+	}
+	if got := retry.Header().Get(ReplayedHeader); got != "true" {
+		t.Errorf("Expected %s: true, got %q", ReplayedHeader, got)
+	}
+	if got := retry.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected the stored content type, got %q", got)
+	}
+
+	// Another key runs again
+	send(handler, "order-2", "/api/calculate", `{"items":251}`)
+	if next.calls != 2 {
+		t.Errorf("Expected a new key to run the handler, got %d calls", next.calls)
+	}
+}
+
+func TestGuard_Rejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   repo.IdempotencyRecord
+		path       string
+		body       string
+		key        string
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "different body",
+			existing:   repo.IdempotencyRecord{StatusCode: http.StatusOK},
+			path:       "/api/calculate",
+			body:       `{"items":500}`,
+			key:        "order-1",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   models.ErrorCodeIdempotencyKeyReused,
+		},
+		{
+			name:       "different path",
+			existing:   repo.IdempotencyRecord{StatusCode: http.StatusOK},
+			path:       "/api/packs/config",
+			body:       `{"items":251}`,
+			key:        "order-1",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   models.ErrorCodeIdempotencyKeyReused,
+		},
+		{
+			name:       "in progress",
+			existing:   repo.IdempotencyRecord{},
+			path:       "/api/calculate",
+			body:       `{"items":251}`,
+			key:        "order-1",
+			wantStatus: http.StatusConflict,
+			wantCode:   models.ErrorCodeIdempotencyInProgress,
+		},
+		{
+			name:       "key too long",
+			path:       "/api/calculate",
+			body:       `{"items":251}`,
+			key:        strings.Repeat("k", maxKeyLength+1),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.ErrorCodeBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			existing := tt.existing
+			existing.Key = "ip:192.0.2.1:order-1"
+			existing.RequestHash = requestHash(httptest.NewRequest(http.MethodPost, "/api/calculate", nil), []byte(`{"items":251}`))
+			store.records[existing.Key] = existing
+
+			next := &countingHandler{status: http.StatusOK}
+			w := send(New(store, Config{}).Middleware(next), tt.key, tt.path, tt.body)
+
+			var response models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&response)
+			if w.Code != tt.wantStatus || response.ErrorCode != tt.wantCode {
+				t.Errorf("Expected status %d with %s, got %d with %+v", tt.wantStatus, tt.wantCode, w.Code, response)
+			}
+			if next.calls != 0 {
+				t.Errorf("Expected the handler not to run, got %d calls", next.calls)
+			}
+		})
+	}
+}
+
+func TestGuard_NotStored(t *testing.T) {
+	t.Run("without key", func(t *testing.T) {
+		store := newFakeStore()
+		next := &countingHandler{status: http.StatusOK}
+		handler := New(store, Config{}).Middleware(next)
+
+		send(handler, "", "/api/calculate", `{"items":251}`)
+		send(handler, "", "/api/calculate", `{"items":251}`)
+		if next.calls != 2 || len(store.records) != 0 {
+			t.Errorf("Expected requests without a key to pass through, got %d calls and %v", next.calls, store.records)
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		store := newFakeStore()
+		next := &countingHandler{status: http.StatusServiceUnavailable}
+		handler := New(store, Config{}).Middleware(next)
+
+		send(handler, "order-1", "/api/calculate", `{"items":251}`)
+		send(handler, "order-1", "/api/calculate", `{"items":251}`)
+		if next.calls != 2 || len(store.records) != 0 {
+			t.Errorf("Expected 5xx responses to be retried, got %d calls and %v", next.calls, store.records)
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		store := newFakeStore()
+		next := &countingHandler{status: http.StatusBadRequest}
+		handler := New(store, Config{}).Middleware(next)
+
+		send(handler, "order-1", "/api/calculate", `{"items":-1}`)
+		if w := send(handler, "order-1", "/api/calculate", `{"items":-1}`); w.Code != http.StatusBadRequest || next.calls != 1 {
+			t.Errorf("Expected 4xx responses to be replayed, got %d after %d calls", w.Code, next.calls)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		store := newFakeStore()
+		handler := New(store, Config{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+		func() {
+			defer func() { recover() }()
+			send(handler, "order-1", "/api/calculate", `{"items":251}`)
+		}()
+		if len(store.records) != 0 {
+			t.Errorf("Expected the key released after a panic, got %v", store.records)
+		}
+	})
+
+	t.Run("store down", func(t *testing.T) {
+		store := newFakeStore()
+		store.err = errors.New("database is locked")
+		next := &countingHandler{status: http.StatusOK}
+
+		w := send(New(store, Config{}).Middleware(next), "order-1", "/api/calculate", `{"items":251}`)
+		if w.Code != http.StatusServiceUnavailable || next.calls != 0 {
+			t.Errorf("Expected 503 without running the handler, got %d after %d calls", w.Code, next.calls)
+		}
+	})
+}
+
+func TestGuard_ExpiresAt(t *testing.T) {
+	now := time.Date(2025, 11, 2, 12, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	g := New(store, Config{TTL: time.Hour})
+	g.now = func() time.Time { return now }
+
+	send(g.Middleware(&countingHandler{status: http.StatusOK}), "order-1", "/api/calculate", `{"items":251}`)
+	if got := store.records["ip:192.0.2.1:order-1"].ExpiresAt; !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the response kept for the TTL, until %v, got %v", now.Add(time.Hour), got)
+	}
+}
+
+func TestGuard_ScopedToAPIKey(t *testing.T) {
+	store := newFakeStore()
+	next := &countingHandler{status: http.StatusOK}
+	guarded := New(store, Config{}).Middleware(next)
+
+	for _, id := range []int64{1, 2} {
+		key := models.APIKey{ID: id, Name: "erp", Scopes: []string{auth.ScopeCalculate}}
+		a := auth.New(keyStore{key}, auth.Config{Enabled: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items":251}`))
+		req.Header.Set("X-API-Key", "pk_test")
+		req.Header.Set(Header, "order-1")
+		w := httptest.NewRecorder()
+		a.Middleware(guarded).ServeHTTP(w, req)
+
+		if w.Header().Get(ReplayedHeader) != "" {
+			t.Errorf("Key %d: expected its own response, got a replay", id)
+		}
+	}
+
+	if next.calls != 2 {
+		t.Errorf("Expected each API key to run the request, got %d calls", next.calls)
+	}
+	for _, k := range []string{"key:1:order-1", "key:2:order-1"} {
+		if _, ok := store.records[k]; !ok {
+			t.Errorf("Expected a record under %s, got %v", k, store.records)
+		}
+	}
+}
+
+func TestGuard_ScopedToClientAddress(t *testing.T) {
+	store := newFakeStore()
+	next := &countingHandler{status: http.StatusOK}
+	guarded := New(store, Config{}).Middleware(next)
+
+	for _, addr := range []string{"192.0.2.1:1234", "198.51.100.7:1234"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"items":251}`))
+		req.RemoteAddr = addr
+		req.Header.Set(Header, "order-1")
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, req)
+
+		if w.Header().Get(ReplayedHeader) != "" {
+			t.Errorf("Client %s: expected its own response, got a replay", addr)
+		}
+	}
+
+	if next.calls != 2 {
+		t.Errorf("Expected each anonymous client to run the request, got %d calls", next.calls)
+	}
+	for _, k := range []string{"ip:192.0.2.1:order-1", "ip:198.51.100.7:order-1"} {
+		if _, ok := store.records[k]; !ok {
+			t.Errorf("Expected a record under %s, got %v", k, store.records)
+		}
+	}
+}
+
+func TestGuard_Run(t *testing.T) {
+	store := newFakeStore()
+	g := New(store, Config{})
+	ctx := context.Background()
+
+	calls := 0
+	fn := func() Response {
+		calls++
+		return Response{StatusCode: http.StatusOK, Body: []byte(strconv.Itoa(calls))}
+	}
+
+	first, replayed, err := g.Run(ctx, "batch-1", "192.0.2.1", "/packcalc.v1.PackCalculator/CalculateBatch", []byte("orders"), fn)
+	if err != nil || replayed || string(first.Body) != "1" {
+		t.Fatalf("Expected the first request to run, got %+v %v %v", first, replayed, err)
+	}
+
+	retry, replayed, err := g.Run(ctx, "batch-1", "192.0.2.1", "/packcalc.v1.PackCalculator/CalculateBatch", []byte("orders"), fn)
+	if err != nil || !replayed || string(retry.Body) != "1" || calls != 1 {
+		t.Errorf("Expected the first response replayed, got %+v %v %v after %d calls", retry, replayed, err, calls)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		addr    string
+		payload string
+		want    error
+	}{
+		{"other payload", "batch-1", "192.0.2.1", "other orders", ErrKeyReused},
+		{"key too long", strings.Repeat("k", maxKeyLength+1), "192.0.2.1", "orders", ErrKeyTooLong},
+		{"other client", "batch-1", "198.51.100.7", "orders", nil},
+	}
+	for _, tt := range tests {
+		if _, _, err := g.Run(ctx, tt.key, tt.addr, "/packcalc.v1.PackCalculator/CalculateBatch", []byte(tt.payload), fn); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Server errors are not stored
+	store.records = map[string]repo.IdempotencyRecord{}
+	g.Run(ctx, "batch-2", "192.0.2.1", "", nil, func() Response { return Response{StatusCode: http.StatusInternalServerError} })
+	if len(store.records) != 0 {
+		t.Errorf("Expected server errors not stored, got %v", store.records)
+	}
+}
+
+// keyStore returns one key for any hash
+type keyStore struct {
+	key models.APIKey
+}
+
+func (s keyStore) GetAPIKey(hash string) (models.APIKey, error) {
+	return s.key, nil
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     string
+		backend string
+		want    Config
+	}{
+		{"defaults", "", "", Config{TTL: 24 * time.Hour, Backend: BackendSQL}},
+		{"redis", "1h", "Redis", Config{TTL: time.Hour, Backend: BackendRedis}},
+		{"invalid", "-1h", "memcached", Config{TTL: 24 * time.Hour, Backend: BackendSQL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("IDEMPOTENCY_TTL", tt.ttl)
+			t.Setenv("IDEMPOTENCY_BACKEND", tt.backend)
+			if cfg := LoadConfig(); cfg != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, cfg)
+			}
+		})
+	}
+}
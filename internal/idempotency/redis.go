@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+// redisKeyPrefix namespaces the idempotency records in Redis
+const redisKeyPrefix = "packcalc:idempotency:"
+
+// reserveScript stores an in progress record unless the key exists, and
+// otherwise returns the fields of the existing record
+var reserveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('HMGET', KEYS[1], 'hash', 'status', 'content_type', 'body')
+end
+redis.call('HSET', KEYS[1], 'hash', ARGV[1], 'status', '0')
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return false
+`)
+
+// releaseScript deletes a record that is still in progress
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') == '0' then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps idempotency records in Redis, so that retries are
+// recognised on any replica. Records expire with their Redis keys.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates a store on a Redis client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Reserve stores rec as in progress unless its key is taken
+func (s *RedisStore) Reserve(ctx context.Context, rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error) {
+	reply, err := reserveScript.Run(ctx, s.client, []string{redisKeyPrefix + rec.Key}, rec.RequestHash, ttl(rec.ExpiresAt)).Slice()
+	if errors.Is(err, redis.Nil) {
+		rec.StatusCode, rec.ContentType, rec.Body = 0, "", nil
+		return rec, true, nil
+	}
+	if err != nil {
+		return rec, false, err
+	}
+	if len(reply) != 4 {
+		return rec, false, fmt.Errorf("unexpected idempotency reply %v", reply)
+	}
+
+	existing := repo.IdempotencyRecord{Key: rec.Key}
+	existing.RequestHash, _ = reply[0].(string)
+	status, _ := reply[1].(string)
+	if existing.StatusCode, err = strconv.Atoi(status); err != nil {
+		return rec, false, fmt.Errorf("unexpected idempotency status %q: %w", status, err)
+	}
+	existing.ContentType, _ = reply[2].(string)
+	if body, ok := reply[3].(string); ok {
+		existing.Body = []byte(body)
+	}
+	return existing, false, nil
+}
+
+// Complete stores the response of the request holding rec.Key
+func (s *RedisStore) Complete(ctx context.Context, rec repo.IdempotencyRecord) error {
+	key := redisKeyPrefix + rec.Key
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "hash", rec.RequestHash, "status", rec.StatusCode, "content_type", rec.ContentType, "body", rec.Body)
+		pipe.PExpire(ctx, key, time.Duration(ttl(rec.ExpiresAt))*time.Millisecond)
+		return nil
+	})
+	return err
+}
+
+// Release frees a key whose request is still in progress
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return releaseScript.Run(ctx, s.client, []string{redisKeyPrefix + key}).Err()
+}
+
+// Close closes the Redis client
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// ttl returns the milliseconds until t, at least one
+func ttl(t time.Time) int64 {
+	return max(time.Until(t).Milliseconds(), 1)
+}
@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisStore) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}))
+	t.Cleanup(func() { store.Close() })
+
+	return mr, store
+}
+
+func TestRedisStore(t *testing.T) {
+	mr, store := setupTestRedis(t)
+	ctx := context.Background()
+
+	rec := repo.IdempotencyRecord{Key: "key:1:order-1", RequestHash: "abc", ExpiresAt: time.Now().Add(time.Minute)}
+	if _, reserved, err := store.Reserve(ctx, rec); err != nil || !reserved {
+		t.Fatalf("Expected the key reserved, got %v (%v)", reserved, err)
+	}
+
+	held, reserved, err := store.Reserve(ctx, repo.IdempotencyRecord{Key: rec.Key, RequestHash: "def", ExpiresAt: rec.ExpiresAt})
+	if err != nil || reserved {
+		t.Fatalf("Expected the key taken, got %v (%v)", reserved, err)
+	}
+	if held.RequestHash != "abc" || held.StatusCode != 0 {
+		t.Errorf("Expected the in progress record, got %+v", held)
+	}
+
+	// Release frees an in progress key
+	if err := store.Release(ctx, rec.Key); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if mr.Exists(redisKeyPrefix + rec.Key) {
+		t.Error("Expected the released key deleted")
+	}
+
+	store.Reserve(ctx, rec)
+	completed := rec
+	completed.StatusCode = 201
+	completed.ContentType = "application/json"
+	completed.Body = []byte(`{"ok":true}`)
+	completed.ExpiresAt = time.Now().Add(time.Hour)
+	if err := store.Complete(ctx, completed); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	// Completed records are kept by Release and replayed by Reserve
+	store.Release(ctx, rec.Key)
+	held, reserved, err = store.Reserve(ctx, rec)
+	if err != nil || reserved {
+		t.Fatalf("Expected the key taken, got %v (%v)", reserved, err)
+	}
+	completed.ExpiresAt = time.Time{}
+	if !reflect.DeepEqual(held, completed) {
+		t.Errorf("Expected %+v, got %+v", completed, held)
+	}
+	if ttl := mr.TTL(redisKeyPrefix + rec.Key); ttl <= time.Minute || ttl > time.Hour {
+		t.Errorf("Expected the record to expire after the TTL, got %v", ttl)
+	}
+
+	// Expired records free their key
+	mr.FastForward(time.Hour)
+	if _, reserved, err := store.Reserve(ctx, rec); err != nil || !reserved {
+		t.Errorf("Expected the expired key reserved again, got %v (%v)", reserved, err)
+	}
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	mr, store := setupTestRedis(t)
+	mr.Close()
+
+	if _, _, err := store.Reserve(context.Background(), repo.IdempotencyRecord{Key: "ip:192.0.2.1:order-1", ExpiresAt: time.Now().Add(time.Minute)}); err == nil {
+		t.Error("Expected an error with Redis down")
+	}
+}
@@ -0,0 +1,73 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+)
+
+// sweepInterval is how often the SQL store deletes expired records
+const sweepInterval = time.Hour
+
+// Repository is the part of repo.Store the SQL store needs
+type Repository interface {
+	ReserveIdempotencyKey(rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(rec repo.IdempotencyRecord) error
+	ReleaseIdempotencyKey(key string) error
+	DeleteExpiredIdempotencyKeys(t time.Time) (int64, error)
+}
+
+// SQLStore keeps idempotency records in the database. Expired records are
+// replaced when their key is reused and deleted hourly otherwise.
+type SQLStore struct {
+	repo      Repository
+	mu        sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewSQLStore creates a store on a repository
+func NewSQLStore(r Repository) *SQLStore {
+	return &SQLStore{repo: r, now: time.Now}
+}
+
+// Reserve stores rec as in progress unless its key is taken
+func (s *SQLStore) Reserve(ctx context.Context, rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error) {
+	s.sweep()
+	return s.repo.ReserveIdempotencyKey(rec)
+}
+
+// Complete stores the response of the request holding rec.Key
+func (s *SQLStore) Complete(ctx context.Context, rec repo.IdempotencyRecord) error {
+	return s.repo.CompleteIdempotencyKey(rec)
+}
+
+// Release frees a key whose request is still in progress
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	return s.repo.ReleaseIdempotencyKey(key)
+}
+
+// sweep deletes expired records if the last sweep was long enough ago
+func (s *SQLStore) sweep() {
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	deleted, err := s.repo.DeleteExpiredIdempotencyKeys(now)
+	if err != nil {
+		logger.Log.Warn("Failed to delete expired idempotency keys", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		logger.Log.Debug("Deleted expired idempotency keys", zap.Int64("deleted", deleted))
+	}
+}
@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+// sweepRepository counts expired record deletions
+type sweepRepository struct {
+	Repository
+	sweeps []time.Time
+}
+
+func (r *sweepRepository) ReserveIdempotencyKey(rec repo.IdempotencyRecord) (repo.IdempotencyRecord, bool, error) {
+	return rec, true, nil
+}
+
+func (r *sweepRepository) DeleteExpiredIdempotencyKeys(t time.Time) (int64, error) {
+	r.sweeps = append(r.sweeps, t)
+	return 1, nil
+}
+
+func TestSQLStore_Sweep(t *testing.T) {
+	now := time.Date(2025, 11, 2, 12, 0, 0, 0, time.UTC)
+	r := &sweepRepository{}
+	store := NewSQLStore(r)
+	store.now = func() time.Time { return now }
+
+	store.Reserve(context.Background(), repo.IdempotencyRecord{Key: "a"})
+	now = now.Add(sweepInterval / 2)
+	store.Reserve(context.Background(), repo.IdempotencyRecord{Key: "b"})
+	now = now.Add(sweepInterval / 2)
+	store.Reserve(context.Background(), repo.IdempotencyRecord{Key: "c"})
+
+	if len(r.sweeps) != 2 {
+		t.Errorf("Expected a sweep on the first reservation and one an interval later, got %v", r.sweeps)
+	}
+}
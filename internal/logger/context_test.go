@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFromContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	Log = zap.New(core)
+
+	FromContext(context.Background()).Info("no span")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	FromContext(ctx).Info("with span")
+
+	entries := logs.All()
+	if fields := entries[0].ContextMap(); len(fields) != 0 {
+		t.Errorf("Expected no fields without a span, got %v", fields)
+	}
+	fields := entries[1].ContextMap()
+	if fields["trace_id"] != traceID.String() || fields["span_id"] != spanID.String() {
+		t.Errorf("Expected the trace and span IDs, got %v", fields)
+	}
+}
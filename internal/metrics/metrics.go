@@ -0,0 +1,167 @@
+// Package metrics holds the Prometheus metrics of the service and serves
+// them on /metrics. The instrumented packages update the metrics here
+// directly, so this package must not import them.
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sander-remitly/pack-calc/internal/algorithm"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "packcalc"
+
+// Version is the release of the binary, set at build time with
+// -ldflags "-X github.com/sander-remitly/pack-calc/internal/metrics.Version=v1.2.3"
+var Version = "dev"
+
+// Registry holds the service metrics plus the Go runtime and process
+// collectors. Tests read metrics from it with prometheus/testutil.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// HTTP metrics, labelled by method, chi route pattern and status code
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Calculation metrics
+var (
+	CalculationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "calculation_duration_seconds",
+		Help:      "Time spent in the optimizer by order size bucket.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to 2.6s
+	}, []string{"order_size"})
+
+	DPTableSize = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "dp_table_entries",
+		Help:      "Entries in the dynamic programming table of each calculation.",
+		Buckets:   prometheus.ExponentialBuckets(100, 10, 6), // 100 to 10M
+	})
+)
+
+// Cache metrics, as seen by this process. Each backend counts its own
+// lookups, so in tiered mode L1 counts under memory and L2 under redis.
+var (
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by backend and result (hit or miss).",
+	}, []string{"backend", "result"})
+
+	CacheErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "cache_errors_total",
+		Help:      "Failed cache operations by backend.",
+	}, []string{"backend"})
+)
+
+// History metrics
+var (
+	HistoryWriteDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "history_write_duration_seconds",
+		Help:      "Latency of history write transactions.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	HistoryWriteFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "history_write_failures_total",
+		Help:      "History write transactions that failed.",
+	})
+
+	HistoryEntriesWritten = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "history_entries_written_total",
+		Help:      "History entries saved.",
+	})
+
+	HistoryEntriesDropped = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "history_entries_dropped_total",
+		Help:      "History entries discarded because the writer queue was full.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo(),
+		newDBCollector(),
+	)
+}
+
+// buildInfo returns a gauge that is always 1, labelled with the version,
+// VCS revision, Go version and algorithm version of the binary
+func buildInfo() prometheus.Collector {
+	revision := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				revision = s.Value
+			}
+		}
+	}
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "build_info",
+		Help:      "Build information; always 1.",
+		ConstLabels: prometheus.Labels{
+			"version":           Version,
+			"revision":          revision,
+			"go_version":        runtime.Version(),
+			"algorithm_version": algorithm.Version,
+		},
+	}, func() float64 { return 1 })
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveCalculation records one run of the optimizer
+func ObserveCalculation(items int, duration time.Duration, result algorithm.Result) {
+	CalculationDuration.WithLabelValues(OrderSizeBucket(items)).Observe(duration.Seconds())
+	DPTableSize.Observe(float64(result.TableSize))
+}
+
+// OrderSizeBucket groups order sizes by order of magnitude, keeping the
+// order_size label to a handful of values
+func OrderSizeBucket(items int) string {
+	switch {
+	case items < 1000:
+		return "1-999"
+	case items < 10000:
+		return "1000-9999"
+	case items < 100000:
+		return "10000-99999"
+	default:
+		return "100000+"
+	}
+}
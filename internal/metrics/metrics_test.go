@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sander-remitly/pack-calc/internal/algorithm"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Post("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		route  string
+		status string
+	}{
+		{http.MethodGet, "/items/1", "/items/{id}", "200"},
+		{http.MethodGet, "/items/2", "/items/{id}", "200"},
+		{http.MethodPost, "/items", "/items", "201"},
+		{http.MethodGet, "/nowhere", unmatchedRoute, "404"},
+	}
+
+	before := make([]float64, len(tests))
+	for i, tt := range tests {
+		before[i] = testutil.ToFloat64(HTTPRequests.WithLabelValues(tt.method, tt.route, tt.status))
+	}
+	for _, tt := range tests {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+	}
+
+	// Both /items requests share the route pattern
+	want := map[string]float64{"/items/{id}": 2, "/items": 1, unmatchedRoute: 1}
+	for i, tt := range tests {
+		got := testutil.ToFloat64(HTTPRequests.WithLabelValues(tt.method, tt.route, tt.status)) - before[i]
+		if got != want[tt.route] {
+			t.Errorf("Expected %v requests to %s %s, got %v", want[tt.route], tt.method, tt.route, got)
+		}
+	}
+}
+
+func TestOrderSizeBucket(t *testing.T) {
+	tests := []struct {
+		items int
+		want  string
+	}{
+		{1, "1-999"},
+		{999, "1-999"},
+		{1000, "1000-9999"},
+		{99999, "10000-99999"},
+		{500000, "100000+"},
+	}
+
+	for _, tt := range tests {
+		if got := OrderSizeBucket(tt.items); got != tt.want {
+			t.Errorf("OrderSizeBucket(%d) = %q, want %q", tt.items, got, tt.want)
+		}
+	}
+}
+
+func TestObserveCalculation(t *testing.T) {
+	duration := CalculationDuration.WithLabelValues("100000+").(prometheus.Histogram)
+	before, beforeTable := sampleCount(t, duration), sampleCount(t, DPTableSize)
+
+	ObserveCalculation(500000, 20*time.Millisecond, algorithm.Result{TableSize: 500054})
+
+	if got := sampleCount(t, duration) - before; got != 1 {
+		t.Errorf("Expected one calculation in the 100000+ bucket, got %d", got)
+	}
+	if got := sampleCount(t, DPTableSize) - beforeTable; got != 1 {
+		t.Errorf("Expected one DP table size, got %d", got)
+	}
+}
+
+// sampleCount returns the number of observations of a histogram
+func sampleCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestHandler(t *testing.T) {
+	SetDBStats(func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}
+	})
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`packcalc_build_info{algorithm_version="` + algorithm.Version + `"`,
+		"packcalc_db_open_connections 3",
+		"packcalc_db_idle_connections 2",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", want, body)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package models
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 // CalculateRequest represents the API request for pack calculation
 type CalculateRequest struct {
-	Items     int   `json:"items"`
-	PackSizes []int `json:"pack_sizes,omitempty"` // Optional: use default if not provided
+	Items     int   `json:"items" openapi:"minimum=1,maximum=1000000"`
+	PackSizes []int `json:"pack_sizes,omitempty" openapi:"maxItems=20,uniqueItems=true,items.minimum=1,items.maximum=1000000"` // Optional: use default if not provided
 }
 
 // CalculateResponse represents the API response for pack calculation
@@ -18,8 +21,9 @@ type CalculateResponse struct {
 	Waste             int         `json:"waste"`                     // Excess items
 	CalculationTimeMs int64       `json:"calculation_time_ms"`       // Time taken in milliseconds
 	Cached            bool        `json:"cached"`                    // Whether result was from cache
-	CacheTTL          string      `json:"cache_ttl,omitempty"`       // Current cache TTL (if cached)
+	CacheTTL          string      `json:"cache_ttl,omitempty"`       // Current cache TTL, or "never" (if cached)
 	CacheHitCount     int         `json:"cache_hit_count,omitempty"` // Number of times this result was cached
+	Coalesced         bool        `json:"coalesced,omitempty"`       // Whether result was shared with a concurrent identical request
 }
 
 // PackConfig represents the pack size configuration
@@ -41,10 +45,36 @@ type PresetsResponse struct {
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Database  string    `json:"database,omitempty"`
-	Uptime    string    `json:"uptime,omitempty"`
+	Status       string    `json:"status"` // ok, degraded or unhealthy; starting before startup completes`
+	Timestamp    time.Time `json:"timestamp"`
+	Database     string    `json:"database,omitempty"`
+	Cache        string    `json:"cache,omitempty"`         // enabled or disabled
+	CacheCircuit string    `json:"cache_circuit,omitempty"` // Redis circuit breaker: closed, open or half-open
+	Uptime       string    `json:"uptime,omitempty"`
+
+	HistoryWriter *HistoryWriterStats `json:"history_writer,omitempty"`
+
+	// Checks holds the outcome of each readiness check
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	Name      string  `json:"name"`   // database, cache, disk or history_backlog
+	Status    string  `json:"status"` // ok, degraded or unhealthy
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HistoryWriterStats reports the batching history writer
+type HistoryWriterStats struct {
+	Policy        string `json:"policy"`      // block or drop when the queue is full
+	QueueDepth    int    `json:"queue_depth"` // Entries waiting to be saved
+	QueueCapacity int    `json:"queue_capacity"`
+	Written       int64  `json:"written"`
+	Dropped       int64  `json:"dropped"` // Discarded because the queue was full
+	Failed        int64  `json:"failed"`  // Lost to database errors
+	Batches       int64  `json:"batches"`
 }
 
 // HistoryEntry represents a calculation history entry
@@ -56,25 +86,161 @@ type HistoryEntry struct {
 	TotalItems int         `json:"total_items"`
 	TotalPacks int         `json:"total_packs"`
 	Waste      int         `json:"waste"`
+	Cached     bool        `json:"cached"`
 	Timestamp  time.Time   `json:"timestamp"`
+
+	RequestID        string `json:"request_id,omitempty"`        // X-Request-Id of the calculate request
+	Client           string `json:"client,omitempty"`            // Who asked, e.g. an API client or IP address
+	Source           string `json:"source,omitempty"`            // ui, api, batch or cli
+	DurationUs       int64  `json:"duration_us"`                 // Time to calculate, or to read from the cache
+	AlgorithmVersion string `json:"algorithm_version,omitempty"` // algorithm.Version that produced the result
 }
 
+// Calculation sources recorded in HistoryEntry.Source
+const (
+	SourceUI    = "ui"
+	SourceAPI   = "api"
+	SourceBatch = "batch"
+	SourceCLI   = "cli"
+)
+
 // HistoryResponse represents the API response for history
 type HistoryResponse struct {
-	History []HistoryEntry `json:"history"`
-	Count   int            `json:"count"`
+	History    []HistoryEntry `json:"history"`
+	Count      int            `json:"count"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// HistoryStats aggregates the history over a time window
+type HistoryStats struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Bucket string    `json:"bucket"` // hour or day
+
+	Calculations       int     `json:"calculations"`
+	CachedCalculations int     `json:"cached_calculations"`
+	CacheHitShare      float64 `json:"cache_hit_share"` // Cached / all calculations, 0-1
+	ItemsOrdered       int64   `json:"items_ordered"`
+	ItemsShipped       int64   `json:"items_shipped"`
+	TotalWaste         int64   `json:"total_waste"`
+	AverageWaste       float64 `json:"average_waste"` // Per calculation
+	WastePercent       float64 `json:"waste_percent"` // Waste / items shipped, 0-100
+
+	Series     []StatsBucket     `json:"series"`      // Every bucket in the window, oldest first
+	OrderSizes []OrderSizeBucket `json:"order_sizes"` // Calculations per order size range
+	PackSizes  []PackSizeUsage   `json:"pack_sizes"`  // Most-used pack sizes, most packs first
+}
+
+// StatsBucket holds the calculations of one hour or day
+type StatsBucket struct {
+	Start        time.Time `json:"start"`
+	Calculations int       `json:"calculations"`
+	Cached       int       `json:"cached"`
+	Waste        int64     `json:"waste"`
+}
+
+// OrderSizeBucket counts calculations with Min <= items <= Max
+type OrderSizeBucket struct {
+	Min          int `json:"min"`
+	Max          int `json:"max"`
+	Calculations int `json:"calculations"`
+}
+
+// PackSizeUsage counts how often a pack size was used
+type PackSizeUsage struct {
+	Size         int   `json:"size"`
+	Packs        int64 `json:"packs"`        // Packs of this size shipped
+	Calculations int   `json:"calculations"` // Calculations using at least one
+}
+
+// StatsResponse represents the API response for history analytics
+type StatsResponse struct {
+	HistoryStats
+	AllTime AllTimeStats `json:"all_time"`
+}
+
+// AllTimeStats summarizes the whole history
+type AllTimeStats struct {
+	TotalCalculations int        `json:"total_calculations"`
+	PackSizesCount    int        `json:"pack_sizes_count"`
+	LatestCalculation *time.Time `json:"latest_calculation,omitempty"`
 }
 
 // ErrorResponse represents an API error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code,omitempty"`
+	Error     string       `json:"error"`
+	Message   string       `json:"message,omitempty"`
+	Code      int          `json:"code,omitempty"`       // HTTP status
+	ErrorCode string       `json:"error_code,omitempty"` // One of the ErrorCode constants
+	Details   []FieldError `json:"details,omitempty"`    // Invalid fields of the request
+}
+
+// Error codes in ErrorResponse.ErrorCode, for clients to switch on
+const (
+	ErrorCodeValidation            = "validation_failed" // Details lists the invalid fields
+	ErrorCodeInvalidJSON           = "invalid_json"      // The body is not a single JSON value
+	ErrorCodeBodyTooLarge          = "body_too_large"
+	ErrorCodeBadRequest            = "bad_request" // Other invalid requests, e.g. an unknown history cursor
+	ErrorCodeUnauthorized          = "unauthorized"
+	ErrorCodeForbidden             = "forbidden"
+	ErrorCodeNotFound              = "not_found"
+	ErrorCodeConflict              = "conflict"
+	ErrorCodeIdempotencyKeyReused  = "idempotency_key_reused"
+	ErrorCodeIdempotencyInProgress = "idempotency_key_in_progress"
+	ErrorCodeRateLimited           = "rate_limited"
+	ErrorCodeQuotaExceeded         = "quota_exceeded"
+	ErrorCodeInternal              = "internal_error"
+	ErrorCodeUnavailable           = "unavailable"
+)
+
+// ErrorCodeForStatus returns the error code for errors that have no more
+// specific one
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodeBodyTooLarge
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrorCodeInternal
+	}
+	return ErrorCodeBadRequest
+}
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field,omitempty"` // JSON path or query parameter, e.g. pack_sizes[1]; empty for the whole body
+	Code    string `json:"code"`            // One of the FieldError codes
+	Message string `json:"message"`
 }
 
+// FieldError codes
+const (
+	FieldRequired  = "required"      // Missing
+	FieldUnknown   = "unknown_field" // Not part of the request
+	FieldType      = "invalid_type"  // Wrong JSON type, e.g. a string for an integer
+	FieldTooSmall  = "too_small"     // Below the minimum, or a list with too few items
+	FieldTooLarge  = "too_large"     // Above the maximum, or a list with too many items
+	FieldDuplicate = "duplicate"     // Repeats an earlier item of the list
+	FieldInvalid   = "invalid_value" // Not one of the allowed values, or badly formatted
+)
+
 // ConfigUpdateRequest represents a request to update pack sizes
 type ConfigUpdateRequest struct {
-	PackSizes []int `json:"pack_sizes"`
+	PackSizes []int `json:"pack_sizes" openapi:"minItems=1,maxItems=20,uniqueItems=true,items.minimum=1,items.maximum=1000000"`
 }
 
 // ConfigUpdateResponse represents the response after updating pack sizes
@@ -86,13 +252,92 @@ type ConfigUpdateResponse struct {
 
 // CacheStatsResponse represents cache statistics
 type CacheStatsResponse struct {
-	Enabled    bool    `json:"enabled"`
-	Hits       int64   `json:"hits"`
-	Misses     int64   `json:"misses"`
-	HitRate    float64 `json:"hit_rate"`
-	TotalKeys  int64   `json:"total_keys"`
-	MemoryUsed string  `json:"memory_used"`
-	Uptime     string  `json:"uptime"`
+	Enabled            bool    `json:"enabled"`
+	Backend            string  `json:"backend"` // none, memory, redis or tiered
+	Hits               int64   `json:"hits"`
+	Misses             int64   `json:"misses"`
+	HitRate            float64 `json:"hit_rate"`
+	TotalKeys          int64   `json:"total_keys"`
+	TotalKeysEstimated bool    `json:"total_keys_estimated"` // True when TotalKeys is sampled
+	MemoryUsed         string  `json:"memory_used"`
+	Uptime             string  `json:"uptime"`
+	TTLPolicy          string  `json:"ttl_policy,omitempty"`    // Effective TTL policy and its parameters
+	Codec              string  `json:"codec,omitempty"`         // Redis entry encoding, e.g. binary or json+deflate
+	CircuitState       string  `json:"circuit_state,omitempty"` // Redis circuit breaker: closed, open or half-open
+
+	Tiers      []CacheTierStats `json:"tiers,omitempty"` // Per-tier stats (tiered backend only, L1 first)
+	Coalescing CoalescingStats  `json:"coalescing"`      // Request coalescing on cache misses
+}
+
+// CoalescingStats represents request coalescing counters since startup
+type CoalescingStats struct {
+	Calculations int64 `json:"calculations"` // Calculations actually run on cache misses
+	Coalesced    int64 `json:"coalesced"`    // Requests that shared a concurrent calculation
+	InFlight     int   `json:"in_flight"`    // Calculations currently running
+}
+
+// CacheTierStats represents the statistics of one tier of a tiered cache
+type CacheTierStats struct {
+	Backend   string  `json:"backend"`
+	Enabled   bool    `json:"enabled"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	TotalKeys int64   `json:"total_keys"`
+}
+
+// CacheClearResponse represents the response after clearing the cache
+type CacheClearResponse struct {
+	Message   string `json:"message"`
+	PackSizes []int  `json:"pack_sizes,omitempty"` // Pack set cleared (scoped clear only)
+	Deleted   int64  `json:"deleted,omitempty"`    // Entries removed (scoped clear only)
+}
+
+// CacheWarmRequest represents a request to warm the cache. History, the
+// items list and the range can be combined; an empty request warms the
+// most frequent combinations from history.
+type CacheWarmRequest struct {
+	Top       int   `json:"top,omitempty" openapi:"minimum=0"`                                                                 // Most frequent (items, pack sizes) combinations from history
+	Items     []int `json:"items,omitempty" openapi:"items.minimum=1,items.maximum=1000000"`                                   // Explicit order sizes
+	From      int   `json:"from,omitempty" openapi:"minimum=0,maximum=1000000"`                                                // First order size of a range
+	To        int   `json:"to,omitempty" openapi:"minimum=0,maximum=1000000"`                                                  // Last order size of a range (inclusive)
+	Step      int   `json:"step,omitempty" openapi:"minimum=0"`                                                                // Range step (default 1)
+	PackSizes []int `json:"pack_sizes,omitempty" openapi:"maxItems=20,uniqueItems=true,items.minimum=1,items.maximum=1000000"` // Pack sizes for items and the range (default: current config)
+}
+
+// CacheWarmStatus represents the progress of the current or last cache warm-up
+type CacheWarmStatus struct {
+	State      string     `json:"state"` // idle, running, completed, cancelled or failed
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Warmed     int        `json:"warmed"`  // Results computed and stored
+	Skipped    int        `json:"skipped"` // Results that were already cached
+	Failed     int        `json:"failed"`  // Results the cache rejected
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// APIKey describes an API key. The key itself is only shown when it is
+// created; the repository keeps a hash of it.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the key
+	Scopes     []string   `json:"scopes"`
+	DailyQuota int64      `json:"daily_quota,omitempty"` // Requests per UTC day; 0 is unlimited
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // GetDefaultPackSizes returns the standard pack sizes
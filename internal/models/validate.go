@@ -0,0 +1,94 @@
+package models
+
+import "fmt"
+
+// Request limits. The openapi tags of the request models declare the same
+// limits, which TestOpenAPI_MatchesModelValidation checks.
+const (
+	MaxItems     = 1000000 // Largest order
+	MaxPackSize  = 1000000 // Largest pack size
+	MaxPackSizes = 20      // Most pack sizes in one set
+)
+
+// Validate checks the request against the request limits
+func (r CalculateRequest) Validate() []FieldError {
+	errs := checkItems(nil, "items", r.Items)
+	if r.PackSizes != nil {
+		errs = checkPackSizes(errs, "pack_sizes", r.PackSizes)
+	}
+	return errs
+}
+
+// Validate checks the request against the request limits
+func (r ConfigUpdateRequest) Validate() []FieldError {
+	if len(r.PackSizes) == 0 {
+		return []FieldError{{Field: "pack_sizes", Code: FieldTooSmall, Message: "must not be empty"}}
+	}
+	return checkPackSizes(nil, "pack_sizes", r.PackSizes)
+}
+
+// Validate checks the request against the request limits. Whether the
+// range is ordered and how many calculations it asks for is left to the
+// warmer.
+func (r CacheWarmRequest) Validate() []FieldError {
+	var errs []FieldError
+	if r.Top < 0 {
+		errs = append(errs, FieldError{Field: "top", Code: FieldTooSmall, Message: "must be at least 0"})
+	}
+	for i, items := range r.Items {
+		errs = checkItems(errs, fmt.Sprintf("items[%d]", i), items)
+	}
+	for _, f := range []struct {
+		name  string
+		value int
+	}{{"from", r.From}, {"to", r.To}} {
+		switch {
+		case f.value < 0:
+			errs = append(errs, FieldError{Field: f.name, Code: FieldTooSmall, Message: "must be at least 0"})
+		case f.value > MaxItems:
+			errs = append(errs, FieldError{Field: f.name, Code: FieldTooLarge, Message: fmt.Sprintf("must be at most %d", MaxItems)})
+		}
+	}
+	if r.Step < 0 {
+		errs = append(errs, FieldError{Field: "step", Code: FieldTooSmall, Message: "must be at least 0"})
+	}
+	if r.PackSizes != nil {
+		errs = checkPackSizes(errs, "pack_sizes", r.PackSizes)
+	}
+	return errs
+}
+
+// checkItems appends the problems with an order size to errs
+func checkItems(errs []FieldError, field string, items int) []FieldError {
+	switch {
+	case items < 1:
+		return append(errs, FieldError{Field: field, Code: FieldTooSmall, Message: "must be at least 1"})
+	case items > MaxItems:
+		return append(errs, FieldError{Field: field, Code: FieldTooLarge, Message: fmt.Sprintf("must be at most %d", MaxItems)})
+	}
+	return errs
+}
+
+// checkPackSizes appends the problems with a set of pack sizes to errs
+func checkPackSizes(errs []FieldError, field string, sizes []int) []FieldError {
+	if len(sizes) > MaxPackSizes {
+		errs = append(errs, FieldError{Field: field, Code: FieldTooLarge, Message: fmt.Sprintf("must have at most %d items", MaxPackSizes)})
+	}
+
+	seen := make(map[int]int, len(sizes))
+	for i, size := range sizes {
+		path := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case size < 1:
+			errs = append(errs, FieldError{Field: path, Code: FieldTooSmall, Message: "must be at least 1"})
+		case size > MaxPackSize:
+			errs = append(errs, FieldError{Field: path, Code: FieldTooLarge, Message: fmt.Sprintf("must be at most %d", MaxPackSize)})
+		}
+		if first, ok := seen[size]; ok {
+			errs = append(errs, FieldError{Field: path, Code: FieldDuplicate, Message: fmt.Sprintf("repeats %s[%d]", field, first)})
+		} else {
+			seen[size] = i
+		}
+	}
+	return errs
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCalculateRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CalculateRequest
+		want []FieldError
+	}{
+		{"Valid", CalculateRequest{Items: 251, PackSizes: []int{250, 500}}, nil},
+		{"Default pack sizes", CalculateRequest{Items: MaxItems}, nil},
+		{"No items", CalculateRequest{Items: 0}, []FieldError{{Field: "items", Code: FieldTooSmall, Message: "must be at least 1"}}},
+		{"Too many items", CalculateRequest{Items: MaxItems + 1}, []FieldError{{Field: "items", Code: FieldTooLarge, Message: "must be at most 1000000"}}},
+		{
+			name: "Invalid pack sizes",
+			req:  CalculateRequest{Items: 1, PackSizes: []int{250, 0, MaxPackSize + 1, 250}},
+			want: []FieldError{
+				{Field: "pack_sizes[1]", Code: FieldTooSmall, Message: "must be at least 1"},
+				{Field: "pack_sizes[2]", Code: FieldTooLarge, Message: "must be at most 1000000"},
+				{Field: "pack_sizes[3]", Code: FieldDuplicate, Message: "repeats pack_sizes[0]"},
+			},
+		},
+		{
+			name: "Too many pack sizes",
+			req:  CalculateRequest{Items: 1, PackSizes: sequence(MaxPackSizes + 1)},
+			want: []FieldError{{Field: "pack_sizes", Code: FieldTooLarge, Message: "must have at most 20 items"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigUpdateRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ConfigUpdateRequest
+		want []FieldError
+	}{
+		{"Valid", ConfigUpdateRequest{PackSizes: []int{23, 31, 53}}, nil},
+		{"Empty", ConfigUpdateRequest{}, []FieldError{{Field: "pack_sizes", Code: FieldTooSmall, Message: "must not be empty"}}},
+		{
+			name: "Duplicates",
+			req:  ConfigUpdateRequest{PackSizes: []int{5, 3, 5, 3}},
+			want: []FieldError{
+				{Field: "pack_sizes[2]", Code: FieldDuplicate, Message: "repeats pack_sizes[0]"},
+				{Field: "pack_sizes[3]", Code: FieldDuplicate, Message: "repeats pack_sizes[1]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCacheWarmRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CacheWarmRequest
+		want []FieldError
+	}{
+		{"Empty", CacheWarmRequest{}, nil},
+		{"Range", CacheWarmRequest{From: 1, To: MaxItems, Step: 10, PackSizes: []int{250, 500}}, nil},
+		{
+			name: "Out of range",
+			req:  CacheWarmRequest{Top: -1, Items: []int{0, 5}, To: MaxItems + 1},
+			want: []FieldError{
+				{Field: "top", Code: FieldTooSmall, Message: "must be at least 0"},
+				{Field: "items[0]", Code: FieldTooSmall, Message: "must be at least 1"},
+				{Field: "to", Code: FieldTooLarge, Message: "must be at most 1000000"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestErrorCodeForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusBadRequest, ErrorCodeBadRequest},
+		{http.StatusUnauthorized, ErrorCodeUnauthorized},
+		{http.StatusForbidden, ErrorCodeForbidden},
+		{http.StatusConflict, ErrorCodeConflict},
+		{http.StatusRequestEntityTooLarge, ErrorCodeBodyTooLarge},
+		{http.StatusTooManyRequests, ErrorCodeRateLimited},
+		{http.StatusServiceUnavailable, ErrorCodeUnavailable},
+		{http.StatusInternalServerError, ErrorCodeInternal},
+		{http.StatusBadGateway, ErrorCodeInternal},
+		{http.StatusTeapot, ErrorCodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCodeForStatus(tt.status); got != tt.want {
+			t.Errorf("ErrorCodeForStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+// sequence returns 1, 2, ..., n
+func sequence(n int) []int {
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = i + 1
+	}
+	return sizes
+}
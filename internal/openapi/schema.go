@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaRefPrefix starts references to component schemas
+const schemaRefPrefix = "#/components/schemas/"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schemas generates schemas from Go types, following encoding/json: fields
+// are named by their json tag, embedded structs are flattened, and fields
+// without omitempty are required. Named structs become component schemas,
+// referenced by name.
+//
+// Constraints come from the openapi struct tag, a comma-separated list of
+// minimum, maximum, minItems, maxItems, uniqueItems and enum (values
+// separated by |), with an items. prefix for the elements of a slice:
+//
+//	PackSizes []int `json:"pack_sizes" openapi:"minItems=1,items.minimum=1"`
+type Schemas struct {
+	components map[string]*Schema
+}
+
+// NewSchemas creates a generator with no component schemas
+func NewSchemas() *Schemas {
+	return &Schemas{components: make(map[string]*Schema)}
+}
+
+// Components returns the component schemas generated so far
+func (g *Schemas) Components() map[string]*Schema {
+	return g.components
+}
+
+// For returns the schema of the type of v
+func (g *Schemas) For(v any) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Schemas) schema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if s.Ref != "" {
+			// Siblings of $ref are ignored, so wrap it
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// nil slices encode as null
+		return &Schema{Type: "array", Items: g.schema(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first, in case the type refers to itself
+			g.components[t.Name()] = &Schema{}
+			*g.components[t.Name()] = *g.object(t)
+		}
+		return &Schema{Ref: schemaRefPrefix + t.Name()}
+	default:
+		// Interfaces and anything else can hold any value
+		return &Schema{}
+	}
+}
+
+// object returns the schema of a struct
+func (g *Schemas) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	g.addFields(s, t)
+	return s
+}
+
+// addFields adds the fields of struct t to s
+func (g *Schemas) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(f.Type)
+		if err := constrain(prop, f.Tag.Get("openapi")); err != nil {
+			panic(fmt.Sprintf("openapi: %s.%s: %v", t.Name(), f.Name, err))
+		}
+		if prop.MinItems != nil {
+			// An empty list is invalid, so null is too
+			prop.Nullable = false
+		}
+		s.Properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// constrain applies the constraints of an openapi struct tag to s
+func constrain(s *Schema, tag string) error {
+	if tag == "" {
+		return nil
+	}
+
+	for _, c := range strings.Split(tag, ",") {
+		key, value, ok := strings.Cut(c, "=")
+		if !ok {
+			return fmt.Errorf("constraint %q has no value", c)
+		}
+
+		target := s
+		if rest, ok := strings.CutPrefix(key, "items."); ok {
+			if s.Items == nil {
+				return fmt.Errorf("constraint %q on a field that is not a list", c)
+			}
+			target, key = s.Items, rest
+		}
+
+		var err error
+		switch key {
+		case "minimum":
+			target.Minimum, err = parseFloat(value)
+		case "maximum":
+			target.Maximum, err = parseFloat(value)
+		case "minItems":
+			target.MinItems, err = parseInt(value)
+		case "maxItems":
+			target.MaxItems, err = parseInt(value)
+		case "uniqueItems":
+			target.UniqueItems, err = strconv.ParseBool(value)
+		case "enum":
+			target.Enum = strings.Split(value, "|")
+		default:
+			err = fmt.Errorf("unknown constraint %q", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseInt(value string) (*int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func parseFloat(value string) (*float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
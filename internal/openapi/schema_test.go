@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID int64 `json:"id"`
+}
+
+type testChild struct {
+	Name string `json:"name"`
+}
+
+type testModel struct {
+	testBase
+	Items    int         `json:"items" openapi:"minimum=1"`
+	Sizes    []int       `json:"sizes,omitempty" openapi:"minItems=1,maxItems=5,uniqueItems=true,items.minimum=1"`
+	Tags     []string    `json:"tags"`
+	Counts   map[int]int `json:"counts"`
+	Child    *testChild  `json:"child,omitempty"`
+	When     time.Time   `json:"when"`
+	Ratio    float64     `json:"ratio"`
+	Mode     string      `json:"mode" openapi:"enum=fast|slow"`
+	Enabled  bool        `json:"enabled"`
+	Skipped  string      `json:"-"`
+	internal string
+}
+
+func TestSchemas_For(t *testing.T) {
+	g := NewSchemas()
+	ref := g.For(testModel{})
+	if ref.Ref != schemaRefPrefix+"testModel" {
+		t.Fatalf("Expected a reference to testModel, got %+v", ref)
+	}
+
+	s := g.Components()["testModel"]
+	if s == nil {
+		t.Fatal("Expected testModel in the components")
+	}
+
+	wantRequired := []string{"id", "items", "tags", "counts", "when", "ratio", "mode", "enabled"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("Expected required %v, got %v", wantRequired, s.Required)
+	}
+	if s.AdditionalProperties != false {
+		t.Errorf("Expected no additional properties, got %v", s.AdditionalProperties)
+	}
+	if _, ok := s.Properties["Skipped"]; ok || len(s.Properties) != 10 {
+		t.Errorf("Expected the exported, non-skipped fields only, got %d properties", len(s.Properties))
+	}
+
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{"id", `{"type":"integer","format":"int64"}`},
+		{"items", `{"type":"integer","format":"int64","minimum":1}`},
+		{"sizes", `{"type":"array","minItems":1,"maxItems":5,"uniqueItems":true,"items":{"type":"integer","format":"int64","minimum":1}}`},
+		{"tags", `{"type":"array","nullable":true,"items":{"type":"string"}}`},
+		{"counts", `{"type":"object","nullable":true,"additionalProperties":{"type":"integer","format":"int64"}}`},
+		{"child", `{"allOf":[{"$ref":"#/components/schemas/testChild"}],"nullable":true}`},
+		{"when", `{"type":"string","format":"date-time"}`},
+		{"ratio", `{"type":"number","format":"double"}`},
+		{"mode", `{"type":"string","enum":["fast","slow"]}`},
+		{"enabled", `{"type":"boolean"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			got, err := json.Marshal(s.Properties[tt.property])
+			if err != nil {
+				t.Fatalf("Failed to encode schema: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, ok := g.Components()["testChild"]; !ok {
+		t.Error("Expected nested structs in the components")
+	}
+}
+
+func TestSchemas_InvalidTag(t *testing.T) {
+	type invalid struct {
+		Items int `json:"items" openapi:"items.minimum=1"`
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for an items constraint on an integer")
+		}
+	}()
+	NewSchemas().For(invalid{})
+}
@@ -0,0 +1,286 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+// Middleware validates the query parameters and JSON body of requests to
+// the operations in d, answering 400 with a FieldError per problem, or 413
+// if the body is over the limit set by http.MaxBytesReader. Requests to
+// other paths and methods pass through.
+func (d *Document) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := d.Operation(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if errs := d.ValidateQuery(op, r.URL.Query()); len(errs) > 0 {
+			respond(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid query parameters", ErrorCode: models.ErrorCodeValidation, Details: errs})
+			return
+		}
+
+		if op.RequestBody != nil {
+			body, err := io.ReadAll(r.Body)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respond(w, http.StatusRequestEntityTooLarge, models.ErrorResponse{
+					Error:     "Request body too large",
+					Message:   fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+					ErrorCode: models.ErrorCodeBodyTooLarge,
+				})
+				return
+			}
+			if err != nil {
+				respond(w, http.StatusBadRequest, models.ErrorResponse{Error: "Failed to read request body", ErrorCode: models.ErrorCodeBadRequest})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			errs, err := d.ValidateBody(op.RequestBody, body)
+			if err != nil {
+				respond(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid request body", Message: err.Error(), ErrorCode: models.ErrorCodeInvalidJSON})
+				return
+			}
+			if len(errs) > 0 {
+				respond(w, http.StatusBadRequest, models.ErrorResponse{Error: "Invalid request body", ErrorCode: models.ErrorCodeValidation, Details: errs})
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ValidateQuery checks query parameters against the parameters of op
+func (d *Document) ValidateQuery(op *Operation, query url.Values) []models.FieldError {
+	var errs []models.FieldError
+	for _, p := range op.Parameters {
+		values, ok := query[p.Name]
+		if !ok {
+			if p.Required {
+				errs = append(errs, models.FieldError{Field: p.Name, Code: models.FieldRequired, Message: "is required"})
+			}
+			continue
+		}
+
+		for _, raw := range values {
+			var value any = raw
+			switch d.Resolve(p.Schema).Type {
+			case "integer", "number":
+				value = json.Number(raw)
+			case "boolean":
+				b, err := strconv.ParseBool(raw)
+				if err != nil {
+					errs = append(errs, models.FieldError{Field: p.Name, Code: models.FieldType, Message: "must be true or false"})
+					continue
+				}
+				value = b
+			}
+			d.validate(p.Schema, value, p.Name, &errs)
+		}
+	}
+	return errs
+}
+
+// ValidateBody checks a JSON request body against body. It returns an
+// error if data is not a single JSON value.
+func (d *Document) ValidateBody(body *RequestBody, data []byte) ([]models.FieldError, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return []models.FieldError{{Code: models.FieldRequired, Message: "request body is required"}}, nil
+		}
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("request body must be valid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("request body must contain a single JSON value")
+	}
+
+	return d.Validate(body.Content["application/json"].Schema, value), nil
+}
+
+// Validate checks a value decoded by encoding/json with UseNumber against
+// s, and returns a FieldError for each problem
+func (d *Document) Validate(s *Schema, value any) []models.FieldError {
+	var errs []models.FieldError
+	d.validate(s, value, "", &errs)
+	return errs
+}
+
+func (d *Document) validate(s *Schema, value any, path string, errs *[]models.FieldError) {
+	fail := func(code, format string, args ...any) {
+		*errs = append(*errs, models.FieldError{Field: path, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	s = d.Resolve(s)
+	if s == nil {
+		return
+	}
+	if value == nil {
+		if !s.Nullable && (s.Type != "" || len(s.AllOf) > 0) {
+			fail(models.FieldType, "must not be null")
+		}
+		return
+	}
+
+	for _, sub := range s.AllOf {
+		d.validate(sub, value, path, errs)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			fail(models.FieldType, "must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, models.FieldError{Field: join(path, name), Code: models.FieldRequired, Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				d.validate(prop, obj[key], join(path, key), errs)
+				continue
+			}
+			switch extra := s.AdditionalProperties.(type) {
+			case *Schema:
+				d.validate(extra, obj[key], join(path, key), errs)
+			case bool:
+				if !extra {
+					*errs = append(*errs, models.FieldError{Field: join(path, key), Code: models.FieldUnknown, Message: "is not a known field"})
+				}
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			fail(models.FieldType, "must be a list")
+			return
+		}
+		switch {
+		case s.MinItems != nil && len(arr) < *s.MinItems:
+			if *s.MinItems == 1 {
+				fail(models.FieldTooSmall, "must not be empty")
+			} else {
+				fail(models.FieldTooSmall, "must have at least %d items", *s.MinItems)
+			}
+		case s.MaxItems != nil && len(arr) > *s.MaxItems:
+			fail(models.FieldTooLarge, "must have at most %d items", *s.MaxItems)
+		}
+
+		seen := make(map[string]int, len(arr))
+		for i, item := range arr {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			d.validate(s.Items, item, itemPath, errs)
+
+			if s.UniqueItems {
+				key, _ := json.Marshal(item)
+				if first, ok := seen[string(key)]; ok {
+					*errs = append(*errs, models.FieldError{Field: itemPath, Code: models.FieldDuplicate, Message: fmt.Sprintf("repeats %s[%d]", path, first)})
+				} else {
+					seen[string(key)] = i
+				}
+			}
+		}
+
+	case "integer", "number":
+		f, err := parseNumber(value, s.Type == "integer")
+		if err != nil {
+			fail(models.FieldType, "%s", err)
+			return
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail(models.FieldTooSmall, "must be at least %s", formatFloat(*s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail(models.FieldTooLarge, "must be at most %s", formatFloat(*s.Maximum))
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail(models.FieldType, "must be a string")
+			return
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				fail(models.FieldInvalid, "must be an RFC 3339 date-time")
+			}
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			fail(models.FieldInvalid, "must be one of %s", strings.Join(s.Enum, ", "))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail(models.FieldType, "must be true or false")
+		}
+	}
+}
+
+// join appends a property name to a path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// parseNumber reads a json.Number, requiring an integer if integer is set
+func parseNumber(value any, integer bool) (float64, error) {
+	n, ok := value.(json.Number)
+	if integer {
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if !ok || err != nil {
+			return 0, errors.New("must be an integer")
+		}
+		return float64(i), nil
+	}
+
+	f, err := n.Float64()
+	if !ok || err != nil {
+		return 0, errors.New("must be a number")
+	}
+	return f, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// respond writes an error response with the given status
+func respond(w http.ResponseWriter, status int, response models.ErrorResponse) {
+	response.Code = status
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+type testRequest struct {
+	Items     int   `json:"items" openapi:"minimum=1,maximum=1000"`
+	PackSizes []int `json:"pack_sizes,omitempty" openapi:"maxItems=3,uniqueItems=true,items.minimum=1"`
+}
+
+// testDocument has one operation, POST /calculate?mode=, taking a testRequest
+func testDocument() *Document {
+	g := NewSchemas()
+	min := 1.0
+	op := &Operation{
+		OperationID: "calculate",
+		Parameters: []Parameter{
+			{Name: "mode", In: "query", Schema: &Schema{Type: "string", Enum: []string{"fast", "slow"}}},
+			{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: &min}},
+			{Name: "cached", In: "query", Schema: &Schema{Type: "boolean"}},
+		},
+		RequestBody: &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: g.For(testRequest{})}},
+		},
+	}
+	return &Document{
+		OpenAPI:    Version,
+		Paths:      map[string]*PathItem{"/calculate": {"post": op}},
+		Components: Components{Schemas: g.Components()},
+	}
+}
+
+func TestDocument_ValidateBody(t *testing.T) {
+	d := testDocument()
+	body := d.Operation(http.MethodPost, "/calculate").RequestBody
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []models.FieldError
+		wantErr string
+	}{
+		{name: "valid", body: `{"items": 251, "pack_sizes": [250, 500]}`},
+		{name: "optional field omitted", body: `{"items": 1}`},
+		{name: "empty", body: ``, want: []models.FieldError{{Code: models.FieldRequired, Message: "request body is required"}}},
+		{name: "not JSON", body: `{"items": `, wantErr: "request body must be valid JSON: unexpected EOF"},
+		{name: "trailing data", body: `{"items": 1} {"items": 2}`, wantErr: "request body must contain a single JSON value"},
+		{name: "not an object", body: `[1]`, want: []models.FieldError{{Code: models.FieldType, Message: "must be an object"}}},
+		{name: "missing field", body: `{"pack_sizes": [250]}`, want: []models.FieldError{{Field: "items", Code: models.FieldRequired, Message: "is required"}}},
+		{name: "unknown field", body: `{"items": 1, "size": 2}`, want: []models.FieldError{{Field: "size", Code: models.FieldUnknown, Message: "is not a known field"}}},
+		{name: "wrong type", body: `{"items": "251"}`, want: []models.FieldError{{Field: "items", Code: models.FieldType, Message: "must be an integer"}}},
+		{name: "fraction", body: `{"items": 2.5}`, want: []models.FieldError{{Field: "items", Code: models.FieldType, Message: "must be an integer"}}},
+		{name: "null", body: `{"items": null}`, want: []models.FieldError{{Field: "items", Code: models.FieldType, Message: "must not be null"}}},
+		{name: "below minimum", body: `{"items": 0}`, want: []models.FieldError{{Field: "items", Code: models.FieldTooSmall, Message: "must be at least 1"}}},
+		{name: "above maximum", body: `{"items": 1001}`, want: []models.FieldError{{Field: "items", Code: models.FieldTooLarge, Message: "must be at most 1000"}}},
+		{
+			name: "too many items",
+			body: `{"items": 1, "pack_sizes": [1, 2, 3, 4]}`,
+			want: []models.FieldError{{Field: "pack_sizes", Code: models.FieldTooLarge, Message: "must have at most 3 items"}},
+		},
+		{
+			name: "duplicate",
+			body: `{"items": 1, "pack_sizes": [250, 500, 250]}`,
+			want: []models.FieldError{{Field: "pack_sizes[2]", Code: models.FieldDuplicate, Message: "repeats pack_sizes[0]"}},
+		},
+		{
+			name: "several problems",
+			body: `{"items": -1, "pack_sizes": [250, 0, "x"]}`,
+			want: []models.FieldError{
+				{Field: "items", Code: models.FieldTooSmall, Message: "must be at least 1"},
+				{Field: "pack_sizes[1]", Code: models.FieldTooSmall, Message: "must be at least 1"},
+				{Field: "pack_sizes[2]", Code: models.FieldType, Message: "must be an integer"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.ValidateBody(body, []byte(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDocument_ValidateQuery(t *testing.T) {
+	d := testDocument()
+	op := d.Operation(http.MethodPost, "/calculate")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []models.FieldError
+	}{
+		{"none", "", nil},
+		{"valid", "mode=fast&limit=10&cached=true&other=x", nil},
+		{"not in enum", "mode=quick", []models.FieldError{{Field: "mode", Code: models.FieldInvalid, Message: "must be one of fast, slow"}}},
+		{"not an integer", "limit=ten", []models.FieldError{{Field: "limit", Code: models.FieldType, Message: "must be an integer"}}},
+		{"below minimum", "limit=0", []models.FieldError{{Field: "limit", Code: models.FieldTooSmall, Message: "must be at least 1"}}},
+		{"not a boolean", "cached=maybe", []models.FieldError{{Field: "cached", Code: models.FieldType, Message: "must be true or false"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/calculate?"+tt.query, nil)
+			got := d.ValidateQuery(op, req.URL.Query())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDocument_Middleware(t *testing.T) {
+	d := testDocument()
+	var received string
+	handler := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}))
+
+	// Valid requests reach the handler with their body
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(`{"items": 251}`)))
+	if w.Code != http.StatusOK || received != `{"items": 251}` {
+		t.Errorf("Expected the request passed on with its body, got %d and %q", w.Code, received)
+	}
+
+	// Invalid requests get field details
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/calculate?limit=0", strings.NewReader(`{"items": 251}`)))
+	var response models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := models.ErrorResponse{
+		Error:     "Invalid query parameters",
+		Code:      http.StatusBadRequest,
+		ErrorCode: models.ErrorCodeValidation,
+		Details:   []models.FieldError{{Field: "limit", Code: models.FieldTooSmall, Message: "must be at least 1"}},
+	}
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(response, want) {
+		t.Errorf("Expected 400 with %+v, got %d with %+v", want, w.Code, response)
+	}
+
+	// Malformed JSON has its own error code
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(`{"items": `)))
+	response = models.ErrorResponse{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusBadRequest || response.ErrorCode != models.ErrorCodeInvalidJSON {
+		t.Errorf("Expected 400 with %s, got %d with %+v", models.ErrorCodeInvalidJSON, w.Code, response)
+	}
+
+	// Bodies over the limit are rejected
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(`{"items": 251}`))
+	req.Body = http.MaxBytesReader(w, req.Body, 4)
+	handler.ServeHTTP(w, req)
+	response = models.ErrorResponse{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusRequestEntityTooLarge || response.ErrorCode != models.ErrorCodeBodyTooLarge {
+		t.Errorf("Expected 413 with %s, got %d with %+v", models.ErrorCodeBodyTooLarge, w.Code, response)
+	}
+
+	// Undocumented routes pass through
+	received = ""
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/calculate", strings.NewReader(`not JSON`)))
+	if w.Code != http.StatusOK || received != "not JSON" {
+		t.Errorf("Expected undocumented methods passed on, got %d and %q", w.Code, received)
+	}
+}
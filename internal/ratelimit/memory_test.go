@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Date(2025, 11, 2, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	steps := []struct {
+		name          string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+		wantReset     time.Duration
+	}{
+		{"full bucket", 0, true, 2, 0, 500 * time.Millisecond},
+		{"second", 0, true, 1, 0, time.Second},
+		{"third", 0, true, 0, 0, 1500 * time.Millisecond},
+		{"empty", 0, false, 0, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{"partly refilled", 250 * time.Millisecond, false, 0, 250 * time.Millisecond, 1250 * time.Millisecond},
+		{"one token refilled", 250 * time.Millisecond, true, 0, 0, 1500 * time.Millisecond},
+		{"refilled to burst", time.Hour, true, 2, 0, 500 * time.Millisecond},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		result, err := store.Take(context.Background(), "calculate:ip:192.0.2.1", limit)
+		if err != nil {
+			t.Fatalf("%s: Take failed: %v", step.name, err)
+		}
+
+		want := Result{Allowed: step.wantAllowed, Remaining: step.wantRemaining, RetryAfter: step.wantRetry, Reset: step.wantReset}
+		if result != want {
+			t.Errorf("%s: expected %+v, got %+v", step.name, want, result)
+		}
+	}
+
+	// Buckets are separate per key
+	if result, _ := store.Take(context.Background(), "calculate:ip:192.0.2.2", limit); result.Remaining != 2 {
+		t.Errorf("Expected a new bucket for another client, got %+v", result)
+	}
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	now := time.Date(2025, 11, 2, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+
+	store.Take(context.Background(), "fast", Limit{Rate: 100, Burst: 1})
+	store.Take(context.Background(), "slow", Limit{Rate: 0.001, Burst: 1})
+
+	now = now.Add(sweepInterval)
+	store.Take(context.Background(), "other", Limit{Rate: 1, Burst: 1})
+
+	if _, ok := store.buckets["fast"]; ok {
+		t.Error("Expected the refilled bucket to be dropped")
+	}
+	if _, ok := store.buckets["slow"]; !ok {
+		t.Error("Expected the bucket still refilling to be kept")
+	}
+}
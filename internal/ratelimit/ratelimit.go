@@ -0,0 +1,271 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"go.uber.org/zap"
+)
+
+// Route groups with separate limits
+const (
+	GroupCalculate = "calculate" // POST /api/calculate
+	GroupAdmin     = "admin"     // Endpoints that need an admin scope
+)
+
+// Backends accepted by RATE_LIMIT_BACKEND
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Limit is a token bucket: it holds up to Burst requests and refills at
+// Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit allows a finite number of requests
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the state of a bucket after taking a request from it
+type Result struct {
+	Allowed    bool
+	Remaining  int           // Requests left in the bucket
+	RetryAfter time.Duration // Until the next request is allowed, if this one was not
+	Reset      time.Duration // Until the bucket is full again
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take takes a request from the bucket at key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// QuotaStore counts requests per API key and day. It is satisfied by
+// *repo.Repository.
+type QuotaStore interface {
+	IncrementAPIKeyUsage(keyID int64, t time.Time) (int64, error)
+}
+
+// Config controls rate limiting
+type Config struct {
+	Enabled bool
+	Backend string           // memory or redis
+	Limits  map[string]Limit // By route group; groups without one are not limited
+}
+
+// LoadConfig reads the rate limiting configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		Enabled: os.Getenv("RATE_LIMIT_ENABLED") == "true",
+		Backend: strings.ToLower(os.Getenv("RATE_LIMIT_BACKEND")),
+		Limits: map[string]Limit{
+			GroupCalculate: {Rate: 10, Burst: 20},
+			GroupAdmin:     {Rate: 1, Burst: 5},
+		},
+	}
+
+	for group, limit := range cfg.Limits {
+		env := "RATE_LIMIT_" + strings.ToUpper(group)
+		if v, err := strconv.ParseFloat(os.Getenv(env+"_RATE"), 64); err == nil && v >= 0 {
+			limit.Rate = v
+		}
+		if v, err := strconv.Atoi(os.Getenv(env + "_BURST")); err == nil && v >= 0 {
+			limit.Burst = v
+		}
+		cfg.Limits[group] = limit
+	}
+
+	if cfg.Backend != BackendRedis {
+		cfg.Backend = BackendMemory
+	}
+	return cfg
+}
+
+// Limiter enforces the rate limits per client and the daily quotas of API
+// keys
+type Limiter struct {
+	store  Store
+	quotas QuotaStore
+	cfg    Config
+	now    func() time.Time
+}
+
+// New creates a limiter keeping its buckets in store and counting quota
+// usage in quotas
+func New(store Store, quotas QuotaStore, cfg Config) *Limiter {
+	return &Limiter{store: store, quotas: quotas, cfg: cfg, now: time.Now}
+}
+
+// Exceeded is returned by Charge for a request over its rate limit or
+// its API key's daily quota
+type Exceeded struct {
+	Code       string // models.ErrorCodeRateLimited or models.ErrorCodeQuotaExceeded
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *Exceeded) Error() string {
+	return e.Message
+}
+
+// Limit returns middleware that rate limits the requests of a route group
+// per client: the API key that authenticated the request, otherwise the
+// client address. It must run after auth.Authenticator.Middleware and,
+// for the client address, middleware.RealIP.
+func (l *Limiter) Limit(group string) func(http.Handler) http.Handler {
+	limit := l.cfg.Limits[group]
+
+	return func(next http.Handler) http.Handler {
+		if !l.cfg.Enabled || !limit.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, ok := l.take(r.Context(), group, clientKey(r))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("X-RateLimit-Reset", seconds(result.Reset))
+
+			if !result.Allowed {
+				h.Set("Retry-After", seconds(result.RetryAfter))
+				respond(w, http.StatusTooManyRequests, models.ErrorCodeRateLimited, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Quota is middleware that counts the requests of API keys with a daily
+// quota and rejects them once it is used up, until the next UTC day. It
+// must run after auth.Authenticator.Middleware.
+func (l *Limiter) Quota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := auth.FromContext(r.Context())
+		used, reset, ok := l.count(key)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("X-Quota-Limit", strconv.FormatInt(key.DailyQuota, 10))
+		h.Set("X-Quota-Remaining", strconv.FormatInt(max(key.DailyQuota-used, 0), 10))
+		h.Set("X-Quota-Reset", seconds(reset))
+
+		if used > key.DailyQuota {
+			h.Set("Retry-After", seconds(reset))
+			respond(w, http.StatusTooManyRequests, models.ErrorCodeQuotaExceeded, quotaMessage(key))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Charge counts one request against the rate limit of group, unless it
+// is empty, and then the daily quota of the API key in ctx, as Limit and
+// Quota do for HTTP; rate limited requests do not count towards the
+// quota. It is for other transports, which identify the client by its
+// address addr when there is no API key. A request over a limit gets an
+// *Exceeded; when a store fails, the request is let through.
+func (l *Limiter) Charge(ctx context.Context, group, addr string) error {
+	if group != "" && l.cfg.Enabled && l.cfg.Limits[group].Enabled() {
+		if result, ok := l.take(ctx, group, clientID(ctx, addr)); ok && !result.Allowed {
+			return &Exceeded{Code: models.ErrorCodeRateLimited, Message: "Rate limit exceeded", RetryAfter: result.RetryAfter}
+		}
+	}
+
+	key, _ := auth.FromContext(ctx)
+	if used, reset, ok := l.count(key); ok && used > key.DailyQuota {
+		return &Exceeded{Code: models.ErrorCodeQuotaExceeded, Message: quotaMessage(key), RetryAfter: reset}
+	}
+	return nil
+}
+
+// take takes a request of a route group from the bucket of client. It
+// reports false when the store failed: failing open keeps the API up when
+// the store is down.
+func (l *Limiter) take(ctx context.Context, group, client string) (Result, bool) {
+	result, err := l.store.Take(ctx, group+":"+client, l.cfg.Limits[group])
+	if err != nil {
+		logger.Log.Warn("Rate limit check failed", zap.String("group", group), zap.Error(err))
+		return Result{}, false
+	}
+	return result, true
+}
+
+// count counts a request by key towards its daily quota and returns the
+// requests that day and the time until the quota resets. It reports false
+// when key has no quota or the usage could not be counted.
+func (l *Limiter) count(key models.APIKey) (int64, time.Duration, bool) {
+	if key.DailyQuota <= 0 {
+		return 0, 0, false
+	}
+
+	now := l.now()
+	used, err := l.quotas.IncrementAPIKeyUsage(key.ID, now)
+	if err != nil {
+		logger.Log.Warn("Quota check failed", zap.String("key", key.Name), zap.Error(err))
+		return 0, 0, false
+	}
+
+	y, m, d := now.UTC().Date()
+	return used, time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Sub(now), true
+}
+
+// quotaMessage describes a used up quota
+func quotaMessage(key models.APIKey) string {
+	return fmt.Sprintf("Daily quota of %d requests exceeded", key.DailyQuota)
+}
+
+// clientKey identifies the client of a request for its buckets
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return clientID(r.Context(), host)
+}
+
+// clientID identifies a client by the API key in ctx, otherwise by its
+// address
+func clientID(ctx context.Context, addr string) string {
+	if key, ok := auth.FromContext(ctx); ok {
+		return "key:" + strconv.FormatInt(key.ID, 10)
+	}
+	return "ip:" + addr
+}
+
+// seconds formats a duration as whole seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// respond writes an error in the API's ErrorResponse shape
+func respond(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: status, ErrorCode: code})
+}
@@ -0,0 +1,255 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/auth"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// failingStore fails every Take
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+// fakeQuotas counts usage per key in memory
+type fakeQuotas struct {
+	used map[int64]int64
+	err  error
+}
+
+func (q *fakeQuotas) IncrementAPIKeyUsage(keyID int64, t time.Time) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	q.used[keyID]++
+	return q.used[keyID], nil
+}
+
+// keyStore returns one key for any hash
+type keyStore struct {
+	key models.APIKey
+}
+
+func (s keyStore) GetAPIKey(hash string) (models.APIKey, error) {
+	return s.key, nil
+}
+
+// serve sends a request through a middleware, with key in the request
+// context if it has a name
+func serve(t *testing.T, middleware func(http.Handler) http.Handler, remoteAddr string, key models.APIKey) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/calculate", nil)
+	req.RemoteAddr = remoteAddr
+	if key.Name != "" {
+		// Authenticate through the auth middleware, as the router does
+		store := keyStore{key}
+		req.Header.Set("X-API-Key", "pk_test")
+		a := auth.New(store, auth.Config{Enabled: true})
+		w := httptest.NewRecorder()
+		a.Middleware(middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+	return w
+}
+
+func TestLimiter_Limit(t *testing.T) {
+	cfg := Config{Enabled: true, Limits: map[string]Limit{GroupCalculate: {Rate: 0.01, Burst: 2}}}
+	l := New(NewMemoryStore(), nil, cfg)
+	limit := l.Limit(GroupCalculate)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := serve(t, limit, "192.0.2.1:1234", models.APIKey{})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("Request %d: expected %s remaining, got %q", i+1, wantRemaining, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("Request %d: expected a limit of 2, got %q", i+1, got)
+		}
+	}
+
+	w := serve(t, limit, "192.0.2.1:5678", models.APIKey{})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 once the bucket is empty, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "100" {
+		t.Errorf("Expected Retry-After of 100 seconds, got %q", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Reset"); got != "200" {
+		t.Errorf("Expected X-RateLimit-Reset of 200 seconds, got %q", got)
+	}
+
+	var response models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.Code != http.StatusTooManyRequests || response.ErrorCode != models.ErrorCodeRateLimited {
+		t.Errorf("Expected a 429 error response, got %+v (%v)", response, err)
+	}
+
+	// Other addresses and API keys have their own buckets
+	if w := serve(t, limit, "192.0.2.2:1234", models.APIKey{}); w.Code != http.StatusOK {
+		t.Errorf("Expected another address to be allowed, got %d", w.Code)
+	}
+	if w := serve(t, limit, "192.0.2.1:1234", models.APIKey{ID: 1, Name: "ci"}); w.Code != http.StatusOK {
+		t.Errorf("Expected an API key to be allowed from the same address, got %d", w.Code)
+	}
+}
+
+func TestLimiter_LimitPassThrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		store Store
+		group string
+	}{
+		{"disabled", Config{Limits: map[string]Limit{GroupCalculate: {Rate: 0.01, Burst: 1}}}, NewMemoryStore(), GroupCalculate},
+		{"group without limit", Config{Enabled: true, Limits: map[string]Limit{GroupCalculate: {Rate: 0.01, Burst: 1}}}, NewMemoryStore(), GroupAdmin},
+		{"store down", Config{Enabled: true, Limits: map[string]Limit{GroupCalculate: {Rate: 0.01, Burst: 1}}}, failingStore{}, GroupCalculate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := New(tt.store, nil, tt.cfg).Limit(tt.group)
+			for i := 0; i < 3; i++ {
+				w := serve(t, limit, "192.0.2.1:1234", models.APIKey{})
+				if w.Code != http.StatusOK {
+					t.Fatalf("Request %d: expected status 200, got %d", i+1, w.Code)
+				}
+				if w.Header().Get("X-RateLimit-Limit") != "" {
+					t.Errorf("Expected no rate limit headers, got %v", w.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_Quota(t *testing.T) {
+	quotas := &fakeQuotas{used: map[int64]int64{}}
+	l := New(NewMemoryStore(), quotas, Config{})
+	l.now = func() time.Time { return time.Date(2025, 11, 2, 23, 0, 0, 0, time.UTC) }
+	key := models.APIKey{ID: 7, Name: "ci", Scopes: []string{auth.ScopeCalculate}, DailyQuota: 2}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := serve(t, l.Quota, "192.0.2.1:1234", key)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != wantRemaining {
+			t.Errorf("Request %d: expected %s remaining, got %q", i+1, wantRemaining, got)
+		}
+	}
+
+	w := serve(t, l.Quota, "192.0.2.1:1234", key)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 once the quota is used, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Expected Retry-After until midnight UTC, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `"error_code":"`+models.ErrorCodeQuotaExceeded+`"`) {
+		t.Errorf("Expected a quota error, got %s", w.Body.String())
+	}
+
+	// Anonymous requests and keys without a quota are not counted
+	serve(t, l.Quota, "192.0.2.1:1234", models.APIKey{})
+	serve(t, l.Quota, "192.0.2.1:1234", models.APIKey{ID: 8, Name: "ops"})
+	if want := map[int64]int64{7: 3}; !reflect.DeepEqual(quotas.used, want) {
+		t.Errorf("Expected usage %v, got %v", want, quotas.used)
+	}
+
+	// Quotas fail open
+	quotas.err = errors.New("database is locked")
+	if w := serve(t, l.Quota, "192.0.2.1:1234", key); w.Code != http.StatusOK {
+		t.Errorf("Expected requests through when usage cannot be counted, got %d", w.Code)
+	}
+}
+
+func TestLimiter_Charge(t *testing.T) {
+	quotas := &fakeQuotas{used: map[int64]int64{}}
+	cfg := Config{Enabled: true, Limits: map[string]Limit{GroupCalculate: {Rate: 0.01, Burst: 2}}}
+	l := New(NewMemoryStore(), quotas, cfg)
+	l.now = func() time.Time { return time.Date(2025, 11, 2, 23, 0, 0, 0, time.UTC) }
+
+	// Anonymous clients are limited by address
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := l.Charge(ctx, GroupCalculate, "192.0.2.1"); err != nil {
+			t.Fatalf("Request %d: unexpected error %v", i+1, err)
+		}
+	}
+	var exceeded *Exceeded
+	if err := l.Charge(ctx, GroupCalculate, "192.0.2.1"); !errors.As(err, &exceeded) || exceeded.Code != models.ErrorCodeRateLimited || seconds(exceeded.RetryAfter) != "100" {
+		t.Errorf("Expected the rate limit exceeded, got %v", err)
+	}
+	if err := l.Charge(ctx, GroupCalculate, "192.0.2.2"); err != nil {
+		t.Errorf("Expected another address to be allowed, got %v", err)
+	}
+	if err := l.Charge(ctx, "", "192.0.2.1"); err != nil {
+		t.Errorf("Expected requests outside a group not to be rate limited, got %v", err)
+	}
+
+	// API keys have their own bucket and count towards their quota, except
+	// for rate limited requests
+	key := models.APIKey{ID: 7, Name: "ci", Scopes: []string{auth.ScopeCalculate}, DailyQuota: 3}
+	a := auth.New(keyStore{key}, auth.Config{Enabled: true})
+	ctx, err := a.Authorize(ctx, "pk_test", auth.ScopeCalculate)
+	if err != nil {
+		t.Fatalf("Failed to authorize: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.Charge(ctx, GroupCalculate, "192.0.2.1"); err != nil {
+			t.Errorf("Expected an API key to be allowed from the same address, got %v", err)
+		}
+	}
+	if err := l.Charge(ctx, GroupCalculate, "192.0.2.1"); !errors.As(err, &exceeded) || exceeded.Code != models.ErrorCodeRateLimited {
+		t.Errorf("Expected the rate limit of the key exceeded, got %v", err)
+	}
+	if err := l.Charge(ctx, "", "192.0.2.1"); err != nil {
+		t.Errorf("Expected the rate limited request not to count towards the quota, got %v", err)
+	}
+	if err := l.Charge(ctx, "", "192.0.2.1"); !errors.As(err, &exceeded) || exceeded.Code != models.ErrorCodeQuotaExceeded || exceeded.RetryAfter != time.Hour {
+		t.Errorf("Expected the quota exceeded, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ENABLED", "true")
+	t.Setenv("RATE_LIMIT_BACKEND", "Redis")
+	t.Setenv("RATE_LIMIT_CALCULATE_RATE", "2.5")
+	t.Setenv("RATE_LIMIT_CALCULATE_BURST", "invalid")
+	t.Setenv("RATE_LIMIT_ADMIN_RATE", "0")
+	t.Setenv("RATE_LIMIT_ADMIN_BURST", "3")
+
+	want := Config{
+		Enabled: true,
+		Backend: BackendRedis,
+		Limits: map[string]Limit{
+			GroupCalculate: {Rate: 2.5, Burst: 20},
+			GroupAdmin:     {Rate: 0, Burst: 3},
+		},
+	}
+	if cfg := LoadConfig(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+}
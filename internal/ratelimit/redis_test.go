@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisStore) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}))
+	t.Cleanup(func() { store.Close() })
+
+	return mr, store
+}
+
+func TestRedisStore_Take(t *testing.T) {
+	mr, store := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Slow enough not to refill during the test
+	limit := Limit{Rate: 0.01, Burst: 2}
+
+	for i, wantRemaining := range []int{1, 0} {
+		result, err := store.Take(ctx, "admin:key:7", limit)
+		if err != nil {
+			t.Fatalf("Take %d failed: %v", i+1, err)
+		}
+		if !result.Allowed || result.Remaining != wantRemaining {
+			t.Errorf("Take %d: expected allowed with %d remaining, got %+v", i+1, wantRemaining, result)
+		}
+	}
+
+	result, err := store.Take(ctx, "admin:key:7", limit)
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 100*time.Second || result.Reset <= result.RetryAfter {
+		t.Errorf("Expected the empty bucket to reject with a retry time, got %+v", result)
+	}
+
+	// A second store shares the buckets, as replicas do
+	other := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer other.Close()
+	if result, _ := other.Take(ctx, "admin:key:7", limit); result.Allowed {
+		t.Errorf("Expected the bucket to be shared between stores, got %+v", result)
+	}
+
+	if !mr.Exists(redisKeyPrefix + "admin:key:7") {
+		t.Error("Expected the bucket under the rate limit prefix")
+	}
+	if ttl := mr.TTL(redisKeyPrefix + "admin:key:7"); ttl <= 0 {
+		t.Errorf("Expected the bucket to expire, got TTL %v", ttl)
+	}
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	mr, store := setupTestRedis(t)
+	mr.Close()
+
+	if _, err := store.Take(context.Background(), "calculate:ip:192.0.2.1", Limit{Rate: 1, Burst: 1}); err == nil {
+		t.Error("Expected an error with Redis down")
+	}
+}
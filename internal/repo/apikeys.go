@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for an unknown or revoked API key
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAPIKeyExists is returned when creating a key with the name of an
+	// active one
+	ErrAPIKeyExists = errors.New("API key name already in use")
+)
+
+// CreateAPIKey stores a new key under the hash of its secret and returns
+// it with its ID and creation time
+func (r *Repository) CreateAPIKey(key models.APIKey, hash string) (models.APIKey, error) {
+	scopesJSON, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return key, fmt.Errorf("failed to marshal scopes: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return key, err
+	}
+	defer tx.Rollback()
+
+	var active int
+	err = tx.QueryRow(r.dialect.rebind("SELECT COUNT(*) FROM api_keys WHERE name = ? AND revoked_at IS NULL"), key.Name).Scan(&active)
+	if err != nil {
+		return key, err
+	}
+	if active > 0 {
+		return key, fmt.Errorf("%w: %s", ErrAPIKeyExists, key.Name)
+	}
+
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	key.RevokedAt = nil
+	err = tx.QueryRow(r.dialect.rebind(`
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, daily_quota, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id`),
+		key.Name, key.Prefix, hash, string(scopesJSON), key.DailyQuota, r.dialect.timeParam(key.CreatedAt),
+	).Scan(&key.ID)
+	if err != nil {
+		return key, fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return key, tx.Commit()
+}
+
+// GetAPIKey returns the active key with the given hash, or
+// ErrAPIKeyNotFound
+func (r *Repository) GetAPIKey(hash string) (models.APIKey, error) {
+	row := r.db.QueryRow(r.dialect.rebind(`
+		SELECT id, name, prefix, scopes, daily_quota, created_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL`), hash)
+
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// ListAPIKeys returns all keys, including revoked ones, oldest first
+func (r *Repository) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := r.db.Query(`
+		SELECT id, name, prefix, scopes, daily_quota, created_at, revoked_at
+		FROM api_keys
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes the active key with the given name, or returns
+// ErrAPIKeyNotFound
+func (r *Repository) RevokeAPIKey(name string) error {
+	res, err := r.db.Exec(r.dialect.rebind("UPDATE api_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL"),
+		r.dialect.timeParam(time.Now()), name)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+	return nil
+}
+
+// SetAPIKeyQuota changes the daily quota of the active key with the given
+// name; 0 removes the quota
+func (r *Repository) SetAPIKeyQuota(name string, quota int64) error {
+	res, err := r.db.Exec(r.dialect.rebind("UPDATE api_keys SET daily_quota = ? WHERE name = ? AND revoked_at IS NULL"), quota, name)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+	return nil
+}
+
+// IncrementAPIKeyUsage counts a request by a key on the UTC day of t and
+// returns the key's requests that day, including this one
+func (r *Repository) IncrementAPIKeyUsage(keyID int64, t time.Time) (int64, error) {
+	var requests int64
+	err := r.db.QueryRow(r.dialect.rebind(`
+		INSERT INTO api_key_usage (key_id, day, requests)
+		VALUES (?, ?, 1)
+		ON CONFLICT (key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+		RETURNING requests`), keyID, usageDay(t)).Scan(&requests)
+	return requests, err
+}
+
+// GetAPIKeyUsage returns the requests by a key on the UTC day of t
+func (r *Repository) GetAPIKeyUsage(keyID int64, t time.Time) (int64, error) {
+	var requests int64
+	err := r.db.QueryRow(r.dialect.rebind("SELECT requests FROM api_key_usage WHERE key_id = ? AND day = ?"), keyID, usageDay(t)).Scan(&requests)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return requests, err
+}
+
+// usageDay returns the api_key_usage day of t
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// scanAPIKey reads an api_keys row selected by id, name, prefix, scopes,
+// daily_quota, created_at and revoked_at
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var scopesJSON string
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &scopesJSON, &key.DailyQuota, &key.CreatedAt, &revokedAt); err != nil {
+		return key, err
+	}
+
+	if err := json.Unmarshal([]byte(scopesJSON), &key.Scopes); err != nil {
+		return key, fmt.Errorf("failed to unmarshal scopes: %w", err)
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
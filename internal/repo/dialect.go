@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect holds what differs between the supported database engines
+type dialect struct {
+	name            string
+	driver          string
+	migrationsTable string                             // Creates the schema_migrations table
+	lock            string                             // Serializes migrations within a transaction, if needed
+	placeholder     func(n int) string                 // Bind parameter n (1-based)
+	timeParam       func(t time.Time) interface{}      // Time as compared with stored timestamps
+	bucketStart     func(bucket, column string) string // Start of a timestamp column's hour or day, as bucketTimeFormat text
+	rollupDay       string                             // Start of calculations.timestamp's day, as stored in calculation_rollups.day
+	resultPacks     string                             // Table of (key, value) pack counts in calculations.result
+	setup           string                             // Run when the database is opened, if set
+	vacuum          string                             // Reclaims the space of deleted rows
+	vacuumPages     string                             // Reclaims free pages without a full vacuum, if supported
+}
+
+// sqliteDialect is the default, file-based engine
+var sqliteDialect = dialect{
+	name:   "sqlite",
+	driver: "sqlite3",
+	migrationsTable: `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	placeholder: func(int) string { return "?" },
+	// CURRENT_TIMESTAMP is stored as UTC text, which compares as a string
+	timeParam: func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeFormat) },
+	bucketStart: func(bucket, column string) string {
+		if bucket == BucketDay {
+			return "strftime('%Y-%m-%d 00:00:00', " + column + ")"
+		}
+		return "strftime('%Y-%m-%d %H:00:00', " + column + ")"
+	},
+	rollupDay:   "strftime('%Y-%m-%d 00:00:00', calculations.timestamp)",
+	resultPacks: "json_each(calculations.result) AS packs",
+	// Lets pruning return free pages to the file system with
+	// incremental_vacuum. It only takes effect on new databases or after
+	// a full VACUUM.
+	setup:       "PRAGMA auto_vacuum = INCREMENTAL",
+	vacuum:      "VACUUM",
+	vacuumPages: "PRAGMA incremental_vacuum",
+}
+
+// sqliteTimeFormat is the format of SQLite's CURRENT_TIMESTAMP
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// rebind rewrites the ? placeholders of a query for the dialect
+func (d dialect) rebind(query string) string {
+	if d.placeholder(1) == "?" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// numberedPlaceholder returns PostgreSQL-style $n placeholders
+func numberedPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
@@ -0,0 +1,398 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"go.uber.org/zap"
+)
+
+// History sort fields accepted by HistoryQuery.Sort
+const (
+	SortTimestamp  = "timestamp"
+	SortItems      = "items"
+	SortWaste      = "waste"
+	SortTotalPacks = "total_packs"
+	SortDuration   = "duration"
+)
+
+// History sort orders accepted by HistoryQuery.Order
+const (
+	OrderDesc = "desc"
+	OrderAsc  = "asc"
+)
+
+const (
+	// DefaultHistoryLimit is the page size when none is given
+	DefaultHistoryLimit = 20
+	// MaxHistoryLimit bounds the page size
+	MaxHistoryLimit = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned for cursors that were not issued for
+	// the query's sort field and order
+	ErrInvalidCursor = errors.New("invalid history cursor")
+	// ErrInvalidQuery is returned for unknown sort fields or orders
+	ErrInvalidQuery = errors.New("invalid history query")
+)
+
+// HistoryQuery filters, sorts and pages the calculation history. Zero
+// values leave a filter unset.
+type HistoryQuery struct {
+	From      time.Time // Calculated at or after
+	To        time.Time // Calculated before
+	MinItems  int
+	MaxItems  int
+	PackSizes []int // Exact pack set, in any order
+	MinWaste  int
+	Cached    *bool // Only cache hits (true) or computed results (false)
+
+	RequestID        string
+	Client           string
+	Source           string
+	AlgorithmVersion string
+	MinDurationUs    int64
+
+	Sort   string // timestamp (default), items, waste, total_packs or duration
+	Order  string // desc (default) or asc
+	Limit  int    // Page size, DefaultHistoryLimit if 0
+	Cursor string // NextCursor of the previous page
+}
+
+// HistoryPage is one page of history. NextCursor is empty on the last page.
+type HistoryPage struct {
+	Entries    []models.HistoryEntry
+	NextCursor string
+}
+
+// historyCursor is the position after the last entry of a page: the value
+// of the sort column and the ID, which breaks ties
+type historyCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// sortColumns maps sort fields to columns
+var sortColumns = map[string]string{
+	SortTimestamp:  "timestamp",
+	SortItems:      "items",
+	SortWaste:      "waste",
+	SortTotalPacks: "total_packs",
+	SortDuration:   "duration_us",
+}
+
+// packSet returns the canonical form of a pack set stored in pack_set
+func packSet(packSizes []int) string {
+	sorted := make([]int, len(packSizes))
+	copy(sorted, packSizes)
+	sort.Ints(sorted)
+
+	parts := make([]string, len(sorted))
+	for i, size := range sorted {
+		parts[i] = strconv.Itoa(size)
+	}
+	return strings.Join(parts, ",")
+}
+
+// SaveHistoryEntry records a calculation, computed or served from the
+// cache. ID is assigned by the database, and Timestamp too when zero.
+func (r *Repository) SaveHistoryEntry(entry models.HistoryEntry) error {
+	return r.SaveHistoryEntries([]models.HistoryEntry{entry})
+}
+
+// SaveHistoryEntries records several calculations in one transaction
+func (r *Repository) SaveHistoryEntries(entries []models.HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := r.saveHistoryEntries(entries)
+	metrics.HistoryWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.HistoryWriteFailures.Inc()
+		return err
+	}
+	metrics.HistoryEntriesWritten.Add(float64(len(entries)))
+	return nil
+}
+
+func (r *Repository) saveHistoryEntries(entries []models.HistoryEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(r.dialect.rebind(`
+		INSERT INTO calculations (
+			items, pack_sizes, pack_set, result, total_items, total_packs, waste, cached, timestamp,
+			request_id, client, source, duration_us, algorithm_version
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		packSizesJSON, err := json.Marshal(entry.PackSizes)
+		if err != nil {
+			return err
+		}
+
+		resultJSON, err := json.Marshal(entry.Result)
+		if err != nil {
+			return err
+		}
+
+		timestamp := entry.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+
+		_, err = stmt.Exec(
+			entry.Items,
+			string(packSizesJSON),
+			packSet(entry.PackSizes),
+			string(resultJSON),
+			entry.TotalItems,
+			entry.TotalPacks,
+			entry.Waste,
+			entry.Cached,
+			r.dialect.timeParam(timestamp),
+			entry.RequestID,
+			entry.Client,
+			entry.Source,
+			entry.DurationUs,
+			entry.AlgorithmVersion,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// QueryHistory returns a page of history matching q
+func (r *Repository) QueryHistory(q HistoryQuery) (HistoryPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortTimestamp
+	}
+	if q.Order == "" {
+		q.Order = OrderDesc
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultHistoryLimit
+	}
+	if q.Limit > MaxHistoryLimit {
+		q.Limit = MaxHistoryLimit
+	}
+
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		return HistoryPage{}, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, q.Sort)
+	}
+	if q.Order != OrderDesc && q.Order != OrderAsc {
+		return HistoryPage{}, fmt.Errorf("%w: unknown order %q", ErrInvalidQuery, q.Order)
+	}
+
+	var where []string
+	var args []interface{}
+	filter := func(cond string, values ...interface{}) {
+		where = append(where, cond)
+		args = append(args, values...)
+	}
+
+	if !q.From.IsZero() {
+		filter("timestamp >= ?", r.dialect.timeParam(q.From))
+	}
+	if !q.To.IsZero() {
+		filter("timestamp < ?", r.dialect.timeParam(q.To))
+	}
+	if q.MinItems > 0 {
+		filter("items >= ?", q.MinItems)
+	}
+	if q.MaxItems > 0 {
+		filter("items <= ?", q.MaxItems)
+	}
+	if len(q.PackSizes) > 0 {
+		filter("pack_set = ?", packSet(q.PackSizes))
+	}
+	if q.MinWaste > 0 {
+		filter("waste >= ?", q.MinWaste)
+	}
+	if q.Cached != nil {
+		filter("cached = ?", *q.Cached)
+	}
+	if q.RequestID != "" {
+		filter("request_id = ?", q.RequestID)
+	}
+	if q.Client != "" {
+		filter("client = ?", q.Client)
+	}
+	if q.Source != "" {
+		filter("source = ?", q.Source)
+	}
+	if q.AlgorithmVersion != "" {
+		filter("algorithm_version = ?", q.AlgorithmVersion)
+	}
+	if q.MinDurationUs > 0 {
+		filter("duration_us >= ?", q.MinDurationUs)
+	}
+
+	// Keyset pagination: continue after the cursor's (value, id)
+	cmp := "<"
+	if q.Order == OrderAsc {
+		cmp = ">"
+	}
+	if q.Cursor != "" {
+		value, id, err := r.decodeCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return HistoryPage{}, err
+		}
+		filter(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, cmp), value, value, id)
+	}
+
+	query := `
+		SELECT
+			id, items, pack_sizes, result, total_items, total_packs, waste, cached, timestamp,
+			request_id, client, source, duration_us, algorithm_version
+		FROM calculations`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY %[1]s %[2]s, id %[2]s\n\t\tLIMIT ?", column, strings.ToUpper(q.Order))
+
+	// Fetch one more row to know whether there is a next page
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.Query(r.dialect.rebind(query), args...)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	defer rows.Close()
+
+	var page HistoryPage
+	var last models.HistoryEntry
+	scanned := 0
+	for rows.Next() {
+		scanned++
+		if scanned > q.Limit {
+			page.NextCursor = encodeCursor(q.Sort, q.Order, last)
+			break
+		}
+
+		entry, err := scanHistoryEntry(rows)
+		last = entry
+		if err != nil {
+			logger.Log.Warn("Error reading history entry", zap.Int("id", entry.ID), zap.Error(err))
+			continue
+		}
+
+		page.Entries = append(page.Entries, entry)
+	}
+
+	return page, rows.Err()
+}
+
+// scanHistoryEntry reads a row selected by QueryHistory. On JSON errors
+// the returned entry still holds the sort columns.
+func scanHistoryEntry(rows *sql.Rows) (models.HistoryEntry, error) {
+	var entry models.HistoryEntry
+	var packSizesJSON, resultJSON string
+
+	err := rows.Scan(
+		&entry.ID,
+		&entry.Items,
+		&packSizesJSON,
+		&resultJSON,
+		&entry.TotalItems,
+		&entry.TotalPacks,
+		&entry.Waste,
+		&entry.Cached,
+		&entry.Timestamp,
+		&entry.RequestID,
+		&entry.Client,
+		&entry.Source,
+		&entry.DurationUs,
+		&entry.AlgorithmVersion,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	if err := json.Unmarshal([]byte(packSizesJSON), &entry.PackSizes); err != nil {
+		return entry, fmt.Errorf("unmarshaling pack sizes: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(resultJSON), &entry.Result); err != nil {
+		return entry, fmt.Errorf("unmarshaling result: %w", err)
+	}
+
+	return entry, nil
+}
+
+// encodeCursor returns the cursor positioned after entry
+func encodeCursor(sortField, order string, entry models.HistoryEntry) string {
+	c := historyCursor{Sort: sortField, Order: order, ID: entry.ID}
+
+	switch sortField {
+	case SortTimestamp:
+		c.Value = entry.Timestamp.UTC().Format(time.RFC3339Nano)
+	case SortItems:
+		c.Value = strconv.Itoa(entry.Items)
+	case SortWaste:
+		c.Value = strconv.Itoa(entry.Waste)
+	case SortTotalPacks:
+		c.Value = strconv.Itoa(entry.TotalPacks)
+	case SortDuration:
+		c.Value = strconv.FormatInt(entry.DurationUs, 10)
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the sort value and ID of a cursor issued for the
+// same sort field and order
+func (r *Repository) decodeCursor(cursor, sortField, order string) (interface{}, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	var c historyCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sortField || c.Order != order {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	if sortField == SortTimestamp {
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return r.dialect.timeParam(t), c.ID, nil
+	}
+
+	v, err := strconv.Atoi(c.Value)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	return v, c.ID, nil
+}
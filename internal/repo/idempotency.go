@@ -0,0 +1,84 @@
+package repo
+
+import "time"
+
+// IdempotencyRecord is a request made with an idempotency key and, once it
+// has completed, its response
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int // 0 while the request is in progress
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// ReserveIdempotencyKey stores rec as in progress unless its key is taken
+// by a record that has not expired. It returns the record holding the key
+// and whether it is rec.
+func (r *Repository) ReserveIdempotencyKey(rec IdempotencyRecord) (IdempotencyRecord, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return rec, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(r.dialect.rebind("DELETE FROM idempotency_keys WHERE idempotency_key = ? AND expires_at <= ?"),
+		rec.Key, r.dialect.timeParam(time.Now()))
+	if err != nil {
+		return rec, false, err
+	}
+
+	res, err := tx.Exec(r.dialect.rebind(`
+		INSERT INTO idempotency_keys (idempotency_key, request_hash, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (idempotency_key) DO NOTHING`),
+		rec.Key, rec.RequestHash, r.dialect.timeParam(rec.ExpiresAt))
+	if err != nil {
+		return rec, false, err
+	}
+
+	if n, _ := res.RowsAffected(); n == 1 {
+		rec.StatusCode, rec.ContentType, rec.Body = 0, "", nil
+		return rec, true, tx.Commit()
+	}
+
+	existing := IdempotencyRecord{Key: rec.Key}
+	err = tx.QueryRow(r.dialect.rebind(`
+		SELECT request_hash, status_code, content_type, body, expires_at
+		FROM idempotency_keys
+		WHERE idempotency_key = ?`), rec.Key,
+	).Scan(&existing.RequestHash, &existing.StatusCode, &existing.ContentType, &existing.Body, &existing.ExpiresAt)
+	if err != nil {
+		return rec, false, err
+	}
+
+	return existing, false, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response of the request holding
+// rec.Key and keeps it until rec.ExpiresAt
+func (r *Repository) CompleteIdempotencyKey(rec IdempotencyRecord) error {
+	_, err := r.db.Exec(r.dialect.rebind(`
+		UPDATE idempotency_keys
+		SET status_code = ?, content_type = ?, body = ?, expires_at = ?
+		WHERE idempotency_key = ?`),
+		rec.StatusCode, rec.ContentType, rec.Body, r.dialect.timeParam(rec.ExpiresAt), rec.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a key whose request is still in progress, so
+// that it can be retried
+func (r *Repository) ReleaseIdempotencyKey(key string) error {
+	_, err := r.db.Exec(r.dialect.rebind("DELETE FROM idempotency_keys WHERE idempotency_key = ? AND status_code = 0"), key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes the records that expired before t
+func (r *Repository) DeleteExpiredIdempotencyKeys(t time.Time) (int64, error) {
+	res, err := r.db.Exec(r.dialect.rebind("DELETE FROM idempotency_keys WHERE expires_at <= ?"), r.dialect.timeParam(t))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,293 @@
+package repo
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"go.uber.org/zap"
+)
+
+// migrationFiles holds the schema migrations of every dialect, in
+// migrations/<dialect>/<version>_<name>.(up|down).sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFilename matches e.g. 0002_calculations_items_index.up.sql
+var migrationFilename = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change. Down is empty for migrations
+// that cannot be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a migration and whether it is applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Known     bool // False for versions applied by a newer release
+}
+
+// loadMigrations reads the migrations in dir, ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilename.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations in order, each in its own
+// transaction, and returns the ones it applied
+func (r *Repository) Migrate() ([]Migration, error) {
+	if err := r.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range r.migrations {
+		done, err := r.inMigration(func(tx *sql.Tx) (bool, error) {
+			if isApplied, err := r.isApplied(tx, m.Version); err != nil || isApplied {
+				return false, err
+			}
+
+			if _, err := tx.Exec(m.Up); err != nil {
+				return false, err
+			}
+
+			_, err := tx.Exec(r.dialect.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), m.Version, m.Name)
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+
+		if done {
+			logger.Log.Info("Applied schema migration",
+				zap.Int("version", m.Version),
+				zap.String("name", m.Name),
+			)
+			applied = append(applied, m)
+		}
+	}
+
+	return applied, nil
+}
+
+// Rollback reverts the latest steps applied migrations, newest first,
+// and returns the ones it reverted
+func (r *Repository) Rollback(steps int) ([]Migration, error) {
+	if err := r.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]Migration, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Version] = m
+	}
+
+	var reverted []Migration
+	for len(reverted) < steps {
+		var m Migration
+		done, err := r.inMigration(func(tx *sql.Tx) (bool, error) {
+			var version int
+			err := tx.QueryRow("SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1").Scan(&version)
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+
+			var ok bool
+			if m, ok = known[version]; !ok {
+				return false, fmt.Errorf("migration %d is unknown to this release", version)
+			}
+			if m.Down == "" {
+				return false, fmt.Errorf("migration %04d_%s cannot be rolled back", m.Version, m.Name)
+			}
+
+			if _, err := tx.Exec(m.Down); err != nil {
+				return false, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+
+			_, err = tx.Exec(r.dialect.rebind("DELETE FROM schema_migrations WHERE version = ?"), version)
+			return err == nil, err
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if !done {
+			break
+		}
+
+		logger.Log.Info("Rolled back schema migration",
+			zap.Int("version", m.Version),
+			zap.String("name", m.Name),
+		)
+		reverted = append(reverted, m)
+	}
+
+	return reverted, nil
+}
+
+// MigrationStatus lists the known migrations and those recorded in the
+// database, ordered by version
+func (r *Repository) MigrationStatus() ([]MigrationStatus, error) {
+	if err := r.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byVersion := make(map[int]*MigrationStatus)
+	for _, m := range r.migrations {
+		byVersion[m.Version] = &MigrationStatus{Version: m.Version, Name: m.Name, Known: true}
+	}
+
+	for rows.Next() {
+		var version int
+		var name string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &name, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		s, ok := byVersion[version]
+		if !ok {
+			s = &MigrationStatus{Version: version, Name: name}
+			byVersion[version] = s
+		}
+		s.Applied = true
+		s.AppliedAt = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(byVersion))
+	for _, s := range byVersion {
+		status = append(status, *s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+
+	return status, nil
+}
+
+// PendingMigrations returns the number of known migrations not applied
+func (r *Repository) PendingMigrations() (int, error) {
+	status, err := r.MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, s := range status {
+		if !s.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations table
+func (r *Repository) ensureMigrationsTable() error {
+	_, err := r.inMigration(func(tx *sql.Tx) (bool, error) {
+		_, err := tx.Exec(r.dialect.migrationsTable)
+		return err == nil, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// inMigration runs fn in a transaction holding the dialect's migration
+// lock. The transaction is committed when fn returns true.
+func (r *Repository) inMigration(fn func(tx *sql.Tx) (bool, error)) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if r.dialect.lock != "" {
+		if _, err := tx.Exec(r.dialect.lock); err != nil {
+			return false, err
+		}
+	}
+
+	done, err := fn(tx)
+	if err != nil || !done {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// isApplied reports whether a migration version is recorded
+func (r *Repository) isApplied(tx *sql.Tx, version int) (bool, error) {
+	var count int
+	err := tx.QueryRow(r.dialect.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), version).Scan(&count)
+	return count > 0, err
+}
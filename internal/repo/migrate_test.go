@@ -0,0 +1,254 @@
+package repo
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// baselineSchema is the schema created by releases before migrations
+const baselineSchema = `
+	CREATE TABLE IF NOT EXISTS pack_sizes (
+		size INTEGER PRIMARY KEY,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS calculations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		items INTEGER NOT NULL,
+		pack_sizes TEXT NOT NULL,
+		result TEXT NOT NULL,
+		total_items INTEGER NOT NULL,
+		total_packs INTEGER NOT NULL,
+		waste INTEGER NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_calculations_timestamp ON calculations(timestamp DESC);
+`
+
+// sqliteObjectExists reports whether a table or index exists
+func sqliteObjectExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&count); err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+func TestMigrate_UpgradesBaselineDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "baseline.db")
+
+	// Create a database the way earlier releases did
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := db.Exec(baselineSchema); err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO pack_sizes (size) VALUES (23), (31), (53)"); err != nil {
+		t.Fatalf("Failed to insert pack sizes: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO calculations (items, pack_sizes, result, total_items, total_packs, waste)
+		VALUES (263, '[23,31,53]', '{"23":2,"31":7}', 263, 9, 0)`)
+	if err != nil {
+		t.Fatalf("Failed to insert calculation: %v", err)
+	}
+	db.Close()
+
+	repo, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open baseline database: %v", err)
+	}
+	defer repo.Close()
+
+	status, err := repo.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, s := range status {
+		if !s.Applied || !s.Known {
+			t.Errorf("Expected migration %04d_%s to be applied, got %+v", s.Version, s.Name, s)
+		}
+	}
+
+	if !sqliteObjectExists(t, repo.db, "idx_calculations_items_pack_sizes") {
+		t.Error("Expected migration 2 to create idx_calculations_items_pack_sizes")
+	}
+
+	// Existing data is preserved
+	sizes, err := repo.GetPackSizes()
+	if err != nil || !reflect.DeepEqual(sizes, []int{23, 31, 53}) {
+		t.Errorf("Expected pack sizes [23 31 53], got %v (%v)", sizes, err)
+	}
+
+	history, err := repo.GetHistory(10)
+	if err != nil || len(history) != 1 || history[0].Result[31] != 7 {
+		t.Errorf("Expected the existing calculation, got %+v (%v)", history, err)
+	}
+
+	// pack_set is filled in for existing rows
+	page, err := repo.QueryHistory(HistoryQuery{PackSizes: []int{53, 31, 23}})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Cached {
+		t.Errorf("Expected the existing calculation by pack set, got %+v (%v)", page.Entries, err)
+	}
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	repo, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	applied, err := repo.Migrate()
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("Expected no migrations on an up to date database, got %d", len(applied))
+	}
+}
+
+func TestRollback(t *testing.T) {
+	repo, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	total := len(repo.migrations)
+	latest := repo.migrations[total-1]
+
+	reverted, err := repo.Rollback(1)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != latest.Version {
+		t.Fatalf("Expected migration %d to be rolled back, got %+v", latest.Version, reverted)
+	}
+
+	pending, err := repo.PendingMigrations()
+	if err != nil || pending != 1 {
+		t.Errorf("Expected 1 pending migration, got %d (%v)", pending, err)
+	}
+
+	// Rolling back more steps than applied stops at an empty schema
+	reverted, err = repo.Rollback(100)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if len(reverted) != total-1 || sqliteObjectExists(t, repo.db, "calculations") {
+		t.Errorf("Expected the remaining migrations to drop the tables, reverted %+v", reverted)
+	}
+	if sqliteObjectExists(t, repo.db, "idx_calculations_items_pack_sizes") {
+		t.Error("Expected indexes to be dropped")
+	}
+
+	applied, err := repo.Migrate()
+	if err != nil {
+		t.Fatalf("Failed to migrate again: %v", err)
+	}
+	if len(applied) != total {
+		t.Errorf("Expected all %d migrations to be applied again, got %d", total, len(applied))
+	}
+}
+
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	repo, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	extra, err := loadMigrations(fstest.MapFS{
+		"m/9999_broken.up.sql": {Data: []byte(`
+			CREATE TABLE broken (id INTEGER);
+			INSERT INTO missing_table VALUES (1);
+		`)},
+	}, "m")
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	repo.migrations = append(repo.migrations, extra...)
+
+	if _, err := repo.Migrate(); err == nil || !strings.Contains(err.Error(), "9999_broken") {
+		t.Fatalf("Expected migration 9999 to fail, got %v", err)
+	}
+
+	if sqliteObjectExists(t, repo.db, "broken") {
+		t.Error("Expected the failed migration's changes to be rolled back")
+	}
+
+	pending, _ := repo.PendingMigrations()
+	if pending != 1 {
+		t.Errorf("Expected the failed migration to stay pending, got %d pending", pending)
+	}
+
+	// Without a down script the migration cannot be reverted
+	repo.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (9999, 'broken')")
+	if _, err := repo.Rollback(1); err == nil {
+		t.Error("Expected rollback without a down script to fail")
+	}
+}
+
+func TestWithoutMigrations(t *testing.T) {
+	repo, err := New(filepath.Join(t.TempDir(), "empty.db"), WithoutMigrations())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer repo.Close()
+
+	pending, err := repo.PendingMigrations()
+	if err != nil {
+		t.Fatalf("Failed to count pending migrations: %v", err)
+	}
+
+	if pending != len(repo.migrations) {
+		t.Errorf("Expected %d pending migrations, got %d", len(repo.migrations), pending)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"bad file name", fstest.MapFS{"m/add_column.sql": {}}},
+		{"missing up script", fstest.MapFS{"m/0001_init.down.sql": {Data: []byte("DROP TABLE t;")}}},
+		{"two names for one version", fstest.MapFS{
+			"m/0001_init.up.sql":  {Data: []byte("CREATE TABLE t (id INTEGER);")},
+			"m/0001_other.up.sql": {Data: []byte("CREATE TABLE u (id INTEGER);")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.files, "m"); err == nil {
+				t.Error("Expected error for invalid migrations")
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// Every dialect must define the same versions
+	var versions [][]int
+	for _, d := range []dialect{sqliteDialect, postgresDialect} {
+		migrations, err := loadMigrations(migrationFiles, "migrations/"+d.name)
+		if err != nil {
+			t.Fatalf("Failed to load %s migrations: %v", d.name, err)
+		}
+
+		var v []int
+		for _, m := range migrations {
+			if m.Down == "" {
+				t.Errorf("Expected %s migration %04d_%s to have a down script", d.name, m.Version, m.Name)
+			}
+			v = append(v, m.Version)
+		}
+		versions = append(versions, v)
+	}
+
+	if !reflect.DeepEqual(versions[0], versions[1]) {
+		t.Errorf("Expected the same migration versions for every dialect, got %v", versions)
+	}
+}
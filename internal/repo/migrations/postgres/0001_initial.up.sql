@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS pack_sizes (
+	size INTEGER PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS calculations (
+	id BIGSERIAL PRIMARY KEY,
+	items BIGINT NOT NULL,
+	pack_sizes TEXT NOT NULL,
+	result TEXT NOT NULL,
+	total_items BIGINT NOT NULL,
+	total_packs BIGINT NOT NULL,
+	waste BIGINT NOT NULL,
+	timestamp TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_calculations_timestamp ON calculations(timestamp DESC);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_calculations_items_pack_sizes;
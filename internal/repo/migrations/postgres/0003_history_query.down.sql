@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_calculations_cached;
+DROP INDEX IF EXISTS idx_calculations_waste;
+DROP INDEX IF EXISTS idx_calculations_pack_set;
+
+ALTER TABLE calculations DROP COLUMN IF EXISTS pack_set;
+ALTER TABLE calculations DROP COLUMN IF EXISTS cached;
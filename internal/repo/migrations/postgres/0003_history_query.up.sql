@@ -0,0 +1,15 @@
+-- Cache hits are recorded too, flagged as cached
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS cached BOOLEAN NOT NULL DEFAULT false;
+
+-- Sorted, comma-separated pack sizes, e.g. "23,31,53", so a pack set can be
+-- filtered on regardless of the order it was requested in
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS pack_set TEXT NOT NULL DEFAULT '';
+
+UPDATE calculations SET pack_set = COALESCE((
+	SELECT string_agg(size, ',' ORDER BY size::bigint)
+	FROM jsonb_array_elements_text(pack_sizes::jsonb) AS size
+), '');
+
+CREATE INDEX IF NOT EXISTS idx_calculations_pack_set ON calculations(pack_set, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_calculations_waste ON calculations(waste DESC);
+CREATE INDEX IF NOT EXISTS idx_calculations_cached ON calculations(cached, timestamp DESC);
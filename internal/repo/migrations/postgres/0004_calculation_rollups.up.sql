@@ -0,0 +1,12 @@
+-- Daily aggregates of calculations removed by history pruning, so the
+-- analytics totals and series survive retention
+CREATE TABLE IF NOT EXISTS calculation_rollups (
+	day TIMESTAMPTZ NOT NULL,
+	pack_set TEXT NOT NULL,
+	calculations BIGINT NOT NULL,
+	cached BIGINT NOT NULL,
+	items_ordered BIGINT NOT NULL,
+	items_shipped BIGINT NOT NULL,
+	waste BIGINT NOT NULL,
+	PRIMARY KEY (day, pack_set)
+);
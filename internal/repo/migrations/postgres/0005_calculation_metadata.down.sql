@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_calculations_source;
+DROP INDEX IF EXISTS idx_calculations_client;
+DROP INDEX IF EXISTS idx_calculations_request_id;
+
+ALTER TABLE calculations DROP COLUMN IF EXISTS algorithm_version;
+ALTER TABLE calculations DROP COLUMN IF EXISTS duration_us;
+ALTER TABLE calculations DROP COLUMN IF EXISTS source;
+ALTER TABLE calculations DROP COLUMN IF EXISTS client;
+ALTER TABLE calculations DROP COLUMN IF EXISTS request_id;
@@ -0,0 +1,10 @@
+-- Who asked for a calculation, through which path, and how it was answered
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS client TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS duration_us BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS algorithm_version TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_calculations_request_id ON calculations(request_id);
+CREATE INDEX IF NOT EXISTS idx_calculations_client ON calculations(client, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_calculations_source ON calculations(source, timestamp DESC);
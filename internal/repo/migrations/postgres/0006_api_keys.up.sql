@@ -0,0 +1,15 @@
+-- API keys for authenticated access. Only a SHA-256 hash of each key is
+-- stored; prefix is its first characters, shown to tell keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
+-- Names identify keys in the CLI and the history, and can be reused once
+-- revoked
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_name ON api_keys(name) WHERE revoked_at IS NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_key_usage;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS daily_quota;
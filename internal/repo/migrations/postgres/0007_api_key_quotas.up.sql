@@ -0,0 +1,10 @@
+-- Daily request quotas per API key; 0 leaves a key unlimited
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS daily_quota BIGINT NOT NULL DEFAULT 0;
+
+-- Requests per key and UTC day (YYYY-MM-DD)
+CREATE TABLE IF NOT EXISTS api_key_usage (
+	key_id BIGINT NOT NULL,
+	day TEXT NOT NULL,
+	requests BIGINT NOT NULL,
+	PRIMARY KEY (key_id, day)
+);
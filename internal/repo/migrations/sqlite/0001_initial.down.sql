@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_calculations_timestamp;
+DROP TABLE IF EXISTS calculations;
+DROP TABLE IF EXISTS pack_sizes;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS pack_sizes (
+	size INTEGER PRIMARY KEY,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS calculations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	items INTEGER NOT NULL,
+	pack_sizes TEXT NOT NULL,
+	result TEXT NOT NULL,
+	total_items INTEGER NOT NULL,
+	total_packs INTEGER NOT NULL,
+	waste INTEGER NOT NULL,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_calculations_timestamp ON calculations(timestamp DESC);
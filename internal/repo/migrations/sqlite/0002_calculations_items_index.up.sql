@@ -0,0 +1,2 @@
+-- Groups calculations by (items, pack sizes) for cache warming
+CREATE INDEX IF NOT EXISTS idx_calculations_items_pack_sizes ON calculations(items, pack_sizes);
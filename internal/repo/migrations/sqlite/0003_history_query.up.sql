@@ -0,0 +1,15 @@
+-- Cache hits are recorded too, flagged as cached
+ALTER TABLE calculations ADD COLUMN cached INTEGER NOT NULL DEFAULT 0;
+
+-- Sorted, comma-separated pack sizes, e.g. "23,31,53", so a pack set can be
+-- filtered on regardless of the order it was requested in
+ALTER TABLE calculations ADD COLUMN pack_set TEXT NOT NULL DEFAULT '';
+
+UPDATE calculations SET pack_set = (
+	SELECT COALESCE(group_concat(value, ','), '')
+	FROM (SELECT value FROM json_each(calculations.pack_sizes) ORDER BY value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_calculations_pack_set ON calculations(pack_set, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_calculations_waste ON calculations(waste DESC);
+CREATE INDEX IF NOT EXISTS idx_calculations_cached ON calculations(cached, timestamp DESC);
@@ -0,0 +1,12 @@
+-- Daily aggregates of calculations removed by history pruning, so the
+-- analytics totals and series survive retention
+CREATE TABLE IF NOT EXISTS calculation_rollups (
+	day DATETIME NOT NULL,
+	pack_set TEXT NOT NULL,
+	calculations INTEGER NOT NULL,
+	cached INTEGER NOT NULL,
+	items_ordered INTEGER NOT NULL,
+	items_shipped INTEGER NOT NULL,
+	waste INTEGER NOT NULL,
+	PRIMARY KEY (day, pack_set)
+);
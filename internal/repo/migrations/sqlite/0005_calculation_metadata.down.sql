@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_calculations_source;
+DROP INDEX IF EXISTS idx_calculations_client;
+DROP INDEX IF EXISTS idx_calculations_request_id;
+
+ALTER TABLE calculations DROP COLUMN algorithm_version;
+ALTER TABLE calculations DROP COLUMN duration_us;
+ALTER TABLE calculations DROP COLUMN source;
+ALTER TABLE calculations DROP COLUMN client;
+ALTER TABLE calculations DROP COLUMN request_id;
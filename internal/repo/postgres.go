@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDialect stores the same tables in PostgreSQL, so that several
+// API replicas can share one database
+var postgresDialect = dialect{
+	name:   "postgres",
+	driver: "pgx",
+	migrationsTable: `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// Replicas starting together must not apply the same migration twice
+	lock:        "SELECT pg_advisory_xact_lock(4207183942)",
+	placeholder: numberedPlaceholder,
+	timeParam:   func(t time.Time) interface{} { return t },
+	bucketStart: func(bucket, column string) string {
+		return "to_char(date_trunc('" + bucket + "', " + column + " AT TIME ZONE 'UTC'), 'YYYY-MM-DD HH24:MI:SS')"
+	},
+	rollupDay:   "date_trunc('day', calculations.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'",
+	resultPacks: "jsonb_each_text(calculations.result::jsonb) AS packs(key, value)",
+	// Autovacuum reclaims dead rows; a manual vacuum also refreshes the
+	// planner statistics after a large prune
+	vacuum: "VACUUM ANALYZE calculations",
+}
+
+// NewPostgres creates a repository backed by PostgreSQL. dsn is a
+// connection URL or key/value string, e.g.
+// postgres://packcalc:secret@db:5432/packcalc?sslmode=require
+func NewPostgres(dsn string, opts ...Option) (*Repository, error) {
+	repo, err := open(postgresDialect, dsn, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.db.SetMaxOpenConns(20)
+	repo.db.SetMaxIdleConns(5)
+	repo.db.SetConnMaxIdleTime(5 * time.Minute)
+
+	return repo, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"path"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,52 +13,144 @@ import (
 	"go.uber.org/zap"
 )
 
-// Repository handles data persistence
+// CalculationFrequency is an (items, pack sizes) combination and the
+// number of times it appears in the history
+type CalculationFrequency struct {
+	Items     int
+	PackSizes []int
+	Count     int
+}
+
+// Store persists the pack configuration, the calculation history, the API
+// keys and idempotent responses. It is implemented by Repository for SQLite and PostgreSQL.
+type Store interface {
+	// GetPackSizes returns the configured pack sizes, or the defaults
+	GetPackSizes() ([]int, error)
+	// SetPackSizes replaces the configured pack sizes
+	SetPackSizes(sizes []int) error
+	// SaveCalculation appends a computed calculation to the history
+	SaveCalculation(items int, packSizes []int, result map[int]int, totalItems, totalPacks, waste int) error
+	// SaveHistoryEntry appends a computed or cached calculation
+	SaveHistoryEntry(entry models.HistoryEntry) error
+	// SaveHistoryEntries appends several calculations in one transaction
+	SaveHistoryEntries(entries []models.HistoryEntry) error
+	// GetHistory returns the latest calculations, newest first
+	GetHistory(limit int) ([]models.HistoryEntry, error)
+	// QueryHistory returns a filtered, sorted page of history
+	QueryHistory(q HistoryQuery) (HistoryPage, error)
+	// GetTopCalculations returns the most frequent calculations
+	GetTopCalculations(limit int) ([]CalculationFrequency, error)
+	// ClearHistory removes all calculations and their rollups
+	ClearHistory() error
+	// GetStats returns statistics about the stored data
+	GetStats() (map[string]interface{}, error)
+	// GetHistoryStats aggregates the calculations in a time window
+	GetHistoryStats(q StatsQuery) (models.HistoryStats, error)
+	// PruneHistory removes the calculations outside a retention policy
+	PruneHistory(p RetentionPolicy) (PruneResult, error)
+	// Vacuum reclaims the space of deleted rows
+	Vacuum(full bool) error
+	// CreateAPIKey stores a new API key under the hash of its secret
+	CreateAPIKey(key models.APIKey, hash string) (models.APIKey, error)
+	// GetAPIKey returns the active API key with the given hash
+	GetAPIKey(hash string) (models.APIKey, error)
+	// ListAPIKeys returns all API keys, including revoked ones
+	ListAPIKeys() ([]models.APIKey, error)
+	// RevokeAPIKey revokes the active API key with the given name
+	RevokeAPIKey(name string) error
+	// SetAPIKeyQuota changes the daily quota of an active API key
+	SetAPIKeyQuota(name string, quota int64) error
+	// IncrementAPIKeyUsage counts a request by an API key on the day of t
+	IncrementAPIKeyUsage(keyID int64, t time.Time) (int64, error)
+	// GetAPIKeyUsage returns the requests by an API key on the day of t
+	GetAPIKeyUsage(keyID int64, t time.Time) (int64, error)
+	// ReserveIdempotencyKey claims an idempotency key for a request
+	ReserveIdempotencyKey(rec IdempotencyRecord) (IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey stores the response to an idempotent request
+	CompleteIdempotencyKey(rec IdempotencyRecord) error
+	// ReleaseIdempotencyKey frees the key of a request that did not complete
+	ReleaseIdempotencyKey(key string) error
+	// DeleteExpiredIdempotencyKeys removes the expired idempotency records
+	DeleteExpiredIdempotencyKeys(t time.Time) (int64, error)
+	// Ping checks the database connection
+	Ping() error
+	// Close closes the database connection
+	Close() error
+}
+
+// Repository handles data persistence in a SQL database
 type Repository struct {
-	db *sql.DB
+	db          *sql.DB
+	dialect     dialect
+	migrations  []Migration
+	autoMigrate bool
 }
 
-// New creates a new repository instance
-func New(dbPath string) (*Repository, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+var _ Store = (*Repository)(nil)
+
+// Option configures a Repository
+type Option func(*Repository)
+
+// WithoutMigrations opens the database without applying pending schema
+// migrations, e.g. to inspect or roll them back
+func WithoutMigrations() Option {
+	return func(r *Repository) {
+		r.autoMigrate = false
+	}
+}
+
+// New creates a new SQLite repository instance
+func New(dbPath string, opts ...Option) (*Repository, error) {
+	return open(sqliteDialect, dbPath, opts)
+}
+
+// open connects to a database and brings its schema up to date
+func open(d dialect, dsn string, opts []Option) (*Repository, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", d.name))
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(d.driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	repo := &Repository{db: db}
+	repo := &Repository{db: db, dialect: d, migrations: migrations, autoMigrate: true}
+	for _, opt := range opts {
+		opt(repo)
+	}
+
+	if d.setup != "" {
+		if _, err := db.Exec(d.setup); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set up database: %w", err)
+		}
+	}
+
 	if err := repo.initialize(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
 	return repo, nil
 }
 
-// initialize creates the database schema
+// initialize applies pending schema migrations unless disabled
 func (r *Repository) initialize() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS pack_sizes (
-		size INTEGER PRIMARY KEY,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS calculations (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		items INTEGER NOT NULL,
-		pack_sizes TEXT NOT NULL,
-		result TEXT NOT NULL,
-		total_items INTEGER NOT NULL,
-		total_packs INTEGER NOT NULL,
-		waste INTEGER NOT NULL,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_calculations_timestamp ON calculations(timestamp DESC);
-	`
+	if !r.autoMigrate {
+		return r.db.Ping()
+	}
 
-	_, err := r.db.Exec(schema)
+	_, err := r.Migrate()
 	return err
 }
 
+// Dialect returns the name of the database engine, sqlite or postgres
+func (r *Repository) Dialect() string {
+	return r.dialect.name
+}
+
 // Close closes the database connection
 func (r *Repository) Close() error {
 	return r.db.Close()
@@ -65,7 +158,7 @@ func (r *Repository) Close() error {
 
 // GetPackSizes retrieves the current pack sizes from the database
 func (r *Repository) GetPackSizes() ([]int, error) {
-	rows, err := r.db.Query("SELECT size FROM pack_sizes ORDER BY size")
+	rows, err := r.db.Query(r.dialect.rebind("SELECT size FROM pack_sizes ORDER BY size"))
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +195,7 @@ func (r *Repository) SetPackSizes(sizes []int) error {
 	}
 
 	// Insert new pack sizes
-	stmt, err := tx.Prepare("INSERT INTO pack_sizes (size) VALUES (?)")
+	stmt, err := tx.Prepare(r.dialect.rebind("INSERT INTO pack_sizes (size) VALUES (?)"))
 	if err != nil {
 		return err
 	}
@@ -117,69 +210,57 @@ func (r *Repository) SetPackSizes(sizes []int) error {
 	return tx.Commit()
 }
 
-// SaveCalculation saves a calculation to the history
+// SaveCalculation saves a computed calculation to the history
 func (r *Repository) SaveCalculation(
 	items int,
 	packSizes []int,
 	result map[int]int,
 	totalItems, totalPacks, waste int,
 ) error {
-	packSizesJSON, err := json.Marshal(packSizes)
-	if err != nil {
-		return err
-	}
-
-	resultJSON, err := json.Marshal(result)
-	if err != nil {
-		return err
-	}
-
-	query := `
-		INSERT INTO calculations (items, pack_sizes, result, total_items, total_packs, waste)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`
-
-	_, err = r.db.Exec(query, items, packSizesJSON, resultJSON, totalItems, totalPacks, waste)
-	return err
+	return r.SaveHistoryEntry(models.HistoryEntry{
+		Items:      items,
+		PackSizes:  packSizes,
+		Result:     result,
+		TotalItems: totalItems,
+		TotalPacks: totalPacks,
+		Waste:      waste,
+	})
 }
 
-// GetHistory retrieves the calculation history
+// GetHistory retrieves the latest calculations, newest first
 func (r *Repository) GetHistory(limit int) ([]models.HistoryEntry, error) {
+	page, err := r.QueryHistory(HistoryQuery{Limit: limit})
+	return page.Entries, err
+}
+
+// GetTopCalculations returns the most frequently calculated (items, pack
+// sizes) combinations, most frequent first
+func (r *Repository) GetTopCalculations(limit int) ([]CalculationFrequency, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
 	query := `
-		SELECT id, items, pack_sizes, result, total_items, total_packs, waste, timestamp
+		SELECT items, pack_sizes, COUNT(*) AS requests
 		FROM calculations
-		ORDER BY timestamp DESC
+		GROUP BY items, pack_sizes
+		ORDER BY requests DESC, MAX(timestamp) DESC
 		LIMIT ?
 	`
 
-	rows, err := r.db.Query(query, limit)
+	rows, err := r.db.Query(r.dialect.rebind(query), limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var history []models.HistoryEntry
+	var top []CalculationFrequency
 	for rows.Next() {
-		var entry models.HistoryEntry
-		var packSizesJSON, resultJSON string
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Items,
-			&packSizesJSON,
-			&resultJSON,
-			&entry.TotalItems,
-			&entry.TotalPacks,
-			&entry.Waste,
-			&entry.Timestamp,
-		)
-		if err != nil {
-			logger.Log.Warn("Error scanning row", zap.Error(err))
-			continue
+		var entry CalculationFrequency
+		var packSizesJSON string
+
+		if err := rows.Scan(&entry.Items, &packSizesJSON, &entry.Count); err != nil {
+			return nil, err
 		}
 
 		if err := json.Unmarshal([]byte(packSizesJSON), &entry.PackSizes); err != nil {
@@ -187,30 +268,40 @@ func (r *Repository) GetHistory(limit int) ([]models.HistoryEntry, error) {
 			continue
 		}
 
-		if err := json.Unmarshal([]byte(resultJSON), &entry.Result); err != nil {
-			logger.Log.Warn("Error unmarshaling result", zap.Error(err))
-			continue
-		}
-
-		history = append(history, entry)
+		top = append(top, entry)
 	}
 
-	return history, nil
+	return top, rows.Err()
 }
 
-// ClearHistory clears all calculation history
+// ClearHistory clears all calculation history, including the rollups
 func (r *Repository) ClearHistory() error {
-	_, err := r.db.Exec("DELETE FROM calculations")
-	return err
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM calculations"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM calculation_rollups"); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetStats returns statistics about the database
 func (r *Repository) GetStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
-	// Count total calculations
+	// Count total calculations, including those rolled up by pruning
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM calculations").Scan(&count)
+	err := r.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM calculations) +
+			(SELECT COALESCE(SUM(calculations), 0) FROM calculation_rollups)
+	`).Scan(&count)
 	if err != nil {
 		return nil, err
 	}
@@ -224,9 +315,10 @@ func (r *Repository) GetStats() (map[string]interface{}, error) {
 	}
 	stats["pack_sizes_count"] = packSizesCount
 
-	// Get latest calculation time
+	// Get latest calculation time. Selecting the column rather than
+	// MAX(timestamp) keeps its type, which SQLite drops for aggregates.
 	var latestTime time.Time
-	err = r.db.QueryRow("SELECT MAX(timestamp) FROM calculations").Scan(&latestTime)
+	err = r.db.QueryRow("SELECT timestamp FROM calculations ORDER BY timestamp DESC LIMIT 1").Scan(&latestTime)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
@@ -241,3 +333,8 @@ func (r *Repository) GetStats() (map[string]interface{}, error) {
 func (r *Repository) Ping() error {
 	return r.db.Ping()
 }
+
+// PoolStats returns the connection pool stats of the database
+func (r *Repository) PoolStats() sql.DBStats {
+	return r.db.Stats()
+}
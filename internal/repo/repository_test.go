@@ -41,6 +41,20 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_IncrementalAutoVacuum(t *testing.T) {
+	repo, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	// 2 is INCREMENTAL, which lets pruning return pages to the file system
+	var mode int
+	if err := repo.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		t.Fatalf("Failed to read auto_vacuum: %v", err)
+	}
+	if mode != 2 {
+		t.Errorf("Expected incremental auto-vacuum on a new database, got mode %d", mode)
+	}
+}
+
 func TestGetPackSizes_Default(t *testing.T) {
 	repo, cleanup := setupTestRepo(t)
 	defer cleanup()
@@ -207,6 +221,46 @@ func TestGetHistory_Empty(t *testing.T) {
 	}
 }
 
+func TestGetTopCalculations(t *testing.T) {
+	repo, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	calculations := []struct {
+		items     int
+		packSizes []int
+		times     int
+	}{
+		{items: 500, packSizes: []int{250, 500}, times: 3},
+		{items: 250, packSizes: []int{250, 500}, times: 1},
+		{items: 500, packSizes: []int{23, 31, 53}, times: 2},
+	}
+
+	for _, c := range calculations {
+		for i := 0; i < c.times; i++ {
+			if err := repo.SaveCalculation(c.items, c.packSizes, map[int]int{}, c.items, 1, 0); err != nil {
+				t.Fatalf("Failed to save calculation: %v", err)
+			}
+		}
+	}
+
+	top, err := repo.GetTopCalculations(2)
+	if err != nil {
+		t.Fatalf("Failed to get top calculations: %v", err)
+	}
+
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 combinations, got %d", len(top))
+	}
+
+	if top[0].Items != 500 || top[0].Count != 3 || len(top[0].PackSizes) != 2 {
+		t.Errorf("Expected 500 items x [250 500] (3 times) first, got %+v", top[0])
+	}
+
+	if top[1].Items != 500 || top[1].Count != 2 || len(top[1].PackSizes) != 3 {
+		t.Errorf("Expected 500 items x [23 31 53] (2 times) second, got %+v", top[1])
+	}
+}
+
 func TestClearHistory(t *testing.T) {
 	repo, cleanup := setupTestRepo(t)
 	defer cleanup()
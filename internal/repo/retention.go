@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy bounds the calculation history. Zero values leave a
+// limit unset.
+type RetentionPolicy struct {
+	MaxAge  time.Duration // Prune calculations older than this
+	MaxRows int           // Keep at most this many of the latest calculations
+	Rollup  bool          // Aggregate pruned calculations into daily rollups
+}
+
+// Enabled reports whether the policy limits the history at all
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxRows > 0
+}
+
+// PruneResult describes what PruneHistory removed
+type PruneResult struct {
+	Deleted  int64 // Calculations removed
+	RolledUp int64 // Daily rollup rows created or updated
+}
+
+// PruneHistory removes the calculations outside the retention policy in
+// one transaction, first adding them to the daily rollups if p.Rollup
+func (r *Repository) PruneHistory(p RetentionPolicy) (PruneResult, error) {
+	var result PruneResult
+	if !p.Enabled() {
+		return result, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var where []string
+	var args []interface{}
+
+	if p.MaxAge > 0 {
+		where = append(where, "timestamp < ?")
+		args = append(args, r.dialect.timeParam(time.Now().Add(-p.MaxAge)))
+	}
+
+	if p.MaxRows > 0 {
+		// IDs grow with insertion, so everything up to the first ID past
+		// the newest MaxRows goes
+		var lastID int64
+		err := tx.QueryRow(r.dialect.rebind("SELECT id FROM calculations ORDER BY id DESC LIMIT 1 OFFSET ?"), p.MaxRows).Scan(&lastID)
+		if err != nil && err != sql.ErrNoRows {
+			return result, fmt.Errorf("failed to find the row limit: %w", err)
+		}
+		if err == nil {
+			where = append(where, "id <= ?")
+			args = append(args, lastID)
+		}
+	}
+
+	if len(where) == 0 {
+		return result, nil
+	}
+	cond := strings.Join(where, " OR ")
+
+	if p.Rollup {
+		query := fmt.Sprintf(`
+			INSERT INTO calculation_rollups (day, pack_set, calculations, cached, items_ordered, items_shipped, waste)
+			SELECT
+				%s,
+				pack_set,
+				COUNT(*),
+				SUM(CASE WHEN cached THEN 1 ELSE 0 END),
+				SUM(items),
+				SUM(total_items),
+				SUM(waste)
+			FROM calculations
+			WHERE %s
+			GROUP BY 1, 2
+			ON CONFLICT (day, pack_set) DO UPDATE SET
+				calculations = calculation_rollups.calculations + excluded.calculations,
+				cached = calculation_rollups.cached + excluded.cached,
+				items_ordered = calculation_rollups.items_ordered + excluded.items_ordered,
+				items_shipped = calculation_rollups.items_shipped + excluded.items_shipped,
+				waste = calculation_rollups.waste + excluded.waste`, r.dialect.rollupDay, cond)
+
+		res, err := tx.Exec(r.dialect.rebind(query), args...)
+		if err != nil {
+			return result, fmt.Errorf("failed to roll up calculations: %w", err)
+		}
+		result.RolledUp, _ = res.RowsAffected()
+	}
+
+	res, err := tx.Exec(r.dialect.rebind("DELETE FROM calculations WHERE "+cond), args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to delete calculations: %w", err)
+	}
+	result.Deleted, _ = res.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return PruneResult{}, err
+	}
+	return result, nil
+}
+
+// Vacuum reclaims the space of deleted rows. Without full it only returns
+// free pages where the engine supports that cheaply (SQLite with
+// incremental auto-vacuum); a full vacuum rewrites the SQLite file and
+// blocks writers while it runs.
+func (r *Repository) Vacuum(full bool) error {
+	stmt := r.dialect.vacuumPages
+	if full {
+		stmt = r.dialect.vacuum
+	}
+	if stmt == "" {
+		return nil
+	}
+
+	_, err := r.db.Exec(stmt)
+	return err
+}
@@ -0,0 +1,291 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/models"
+)
+
+// Stats bucket sizes accepted by StatsQuery.Bucket
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+const (
+	// DefaultStatsWindow is the window aggregated when From is not set
+	DefaultStatsWindow = 7 * 24 * time.Hour
+	// MaxStatsBuckets bounds the series, e.g. 41 days of hourly buckets
+	MaxStatsBuckets = 1000
+	// topPackSizes is the number of pack sizes in HistoryStats.PackSizes
+	topPackSizes = 10
+	// orderSizeDecades is the number of order size buckets: 1-9, 10-99,
+	// ..., 1,000,000,000 and more
+	orderSizeDecades = 10
+)
+
+// bucketTimeFormat is the format bucket starts are selected in
+const bucketTimeFormat = "2006-01-02 15:04:05"
+
+// StatsQuery selects the window aggregated by GetHistoryStats. Zero
+// values select the last DefaultStatsWindow, with hourly buckets for
+// windows up to two days and daily buckets otherwise.
+type StatsQuery struct {
+	From   time.Time
+	To     time.Time
+	Bucket string // hour or day
+}
+
+// GetHistoryStats aggregates the calculations in a time window. Days
+// rolled up by PruneHistory count in the totals and the series; the order
+// size and pack size breakdowns cover retained calculations only.
+func (r *Repository) GetHistoryStats(q StatsQuery) (models.HistoryStats, error) {
+	if q.To.IsZero() {
+		// Timestamps have second resolution; include the current second
+		q.To = time.Now().Truncate(time.Second).Add(time.Second)
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultStatsWindow)
+	}
+	if !q.From.Before(q.To) {
+		return models.HistoryStats{}, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	step := 24 * time.Hour
+	switch q.Bucket {
+	case "":
+		q.Bucket = BucketDay
+		if q.To.Sub(q.From) <= 48*time.Hour {
+			q.Bucket, step = BucketHour, time.Hour
+		}
+	case BucketHour:
+		step = time.Hour
+	case BucketDay:
+	default:
+		return models.HistoryStats{}, fmt.Errorf("%w: unknown bucket %q", ErrInvalidQuery, q.Bucket)
+	}
+
+	first := q.From.UTC().Truncate(step)
+	if buckets := int(q.To.Sub(first)/step) + 1; buckets > MaxStatsBuckets {
+		return models.HistoryStats{}, fmt.Errorf("%w: %d %s buckets exceed the maximum of %d", ErrInvalidQuery, buckets, q.Bucket, MaxStatsBuckets)
+	}
+
+	stats := models.HistoryStats{From: q.From, To: q.To, Bucket: q.Bucket}
+	window := "calculations.timestamp >= ? AND calculations.timestamp < ?"
+	rollupWindow := "day >= ? AND day < ?"
+	from, to := r.dialect.timeParam(q.From), r.dialect.timeParam(q.To)
+
+	// Totals
+	query := `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN cached THEN 1 ELSE 0 END), 0),
+			CAST(COALESCE(SUM(items), 0) AS BIGINT),
+			CAST(COALESCE(SUM(total_items), 0) AS BIGINT),
+			CAST(COALESCE(SUM(waste), 0) AS BIGINT)
+		FROM calculations
+		WHERE ` + window
+
+	err := r.db.QueryRow(r.dialect.rebind(query), from, to).Scan(
+		&stats.Calculations,
+		&stats.CachedCalculations,
+		&stats.ItemsOrdered,
+		&stats.ItemsShipped,
+		&stats.TotalWaste,
+	)
+	if err != nil {
+		return stats, fmt.Errorf("failed to aggregate totals: %w", err)
+	}
+
+	// Days rolled up by pruning, by the start of the day
+	var rolledUp, rolledUpCached int
+	var rolledUpOrdered, rolledUpShipped, rolledUpWaste int64
+	query = `
+		SELECT
+			CAST(COALESCE(SUM(calculations), 0) AS BIGINT),
+			CAST(COALESCE(SUM(cached), 0) AS BIGINT),
+			CAST(COALESCE(SUM(items_ordered), 0) AS BIGINT),
+			CAST(COALESCE(SUM(items_shipped), 0) AS BIGINT),
+			CAST(COALESCE(SUM(waste), 0) AS BIGINT)
+		FROM calculation_rollups
+		WHERE ` + rollupWindow
+
+	err = r.db.QueryRow(r.dialect.rebind(query), from, to).Scan(
+		&rolledUp,
+		&rolledUpCached,
+		&rolledUpOrdered,
+		&rolledUpShipped,
+		&rolledUpWaste,
+	)
+	if err != nil {
+		return stats, fmt.Errorf("failed to aggregate rollups: %w", err)
+	}
+	stats.Calculations += rolledUp
+	stats.CachedCalculations += rolledUpCached
+	stats.ItemsOrdered += rolledUpOrdered
+	stats.ItemsShipped += rolledUpShipped
+	stats.TotalWaste += rolledUpWaste
+
+	if stats.Calculations > 0 {
+		stats.CacheHitShare = float64(stats.CachedCalculations) / float64(stats.Calculations)
+		stats.AverageWaste = float64(stats.TotalWaste) / float64(stats.Calculations)
+	}
+	if stats.ItemsShipped > 0 {
+		stats.WastePercent = float64(stats.TotalWaste) / float64(stats.ItemsShipped) * 100
+	}
+
+	if stats.Series, err = r.statsSeries(window, rollupWindow, from, to, q.Bucket, first, step, q.To); err != nil {
+		return stats, err
+	}
+	if stats.OrderSizes, err = r.orderSizeDistribution(window, from, to); err != nil {
+		return stats, err
+	}
+	if stats.PackSizes, err = r.packSizeUsage(window, from, to); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// statsSeries counts calculations per bucket, including empty buckets.
+// Rolled-up days count in the bucket their day starts in.
+func (r *Repository) statsSeries(window, rollupWindow string, from, to interface{}, bucket string, first time.Time, step time.Duration, end time.Time) ([]models.StatsBucket, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS bucket,
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN cached THEN 1 ELSE 0 END), 0),
+			CAST(COALESCE(SUM(waste), 0) AS BIGINT)
+		FROM calculations
+		WHERE %s
+		GROUP BY 1
+		UNION ALL
+		SELECT
+			%s AS bucket,
+			CAST(SUM(calculations) AS BIGINT),
+			CAST(SUM(cached) AS BIGINT),
+			CAST(SUM(waste) AS BIGINT)
+		FROM calculation_rollups
+		WHERE %s
+		GROUP BY 1`, r.dialect.bucketStart(bucket, "timestamp"), window, r.dialect.bucketStart(bucket, "day"), rollupWindow)
+
+	rows, err := r.db.Query(r.dialect.rebind(query), from, to, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate series: %w", err)
+	}
+	defer rows.Close()
+
+	byStart := make(map[time.Time]models.StatsBucket)
+	for rows.Next() {
+		var start string
+		var b models.StatsBucket
+		if err := rows.Scan(&start, &b.Calculations, &b.Cached, &b.Waste); err != nil {
+			return nil, err
+		}
+		if b.Start, err = time.Parse(bucketTimeFormat, start); err != nil {
+			return nil, fmt.Errorf("invalid bucket start %q: %w", start, err)
+		}
+
+		sum := byStart[b.Start]
+		sum.Calculations += b.Calculations
+		sum.Cached += b.Cached
+		sum.Waste += b.Waste
+		byStart[b.Start] = sum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var series []models.StatsBucket
+	for start := first; start.Before(end); start = start.Add(step) {
+		b := byStart[start]
+		b.Start = start
+		series = append(series, b)
+	}
+	return series, nil
+}
+
+// orderSizeDistribution counts calculations per decade of order size,
+// from 1-9 up to the largest non-empty decade
+func (r *Repository) orderSizeDistribution(window string, from, to interface{}) ([]models.OrderSizeBucket, error) {
+	var decade strings.Builder
+	decade.WriteString("CASE")
+	limit := 10
+	for i := 0; i < orderSizeDecades-1; i++ {
+		fmt.Fprintf(&decade, " WHEN items < %d THEN %d", limit, i)
+		limit *= 10
+	}
+	fmt.Fprintf(&decade, " ELSE %d END", orderSizeDecades-1)
+
+	query := fmt.Sprintf(`
+		SELECT %s AS decade, COUNT(*)
+		FROM calculations
+		WHERE %s
+		GROUP BY 1`, decade.String(), window)
+
+	rows, err := r.db.Query(r.dialect.rebind(query), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate order sizes: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]int, orderSizeDecades)
+	largest := -1
+	for rows.Next() {
+		var d, count int
+		if err := rows.Scan(&d, &count); err != nil {
+			return nil, err
+		}
+		counts[d] = count
+		if d > largest {
+			largest = d
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	buckets := make([]models.OrderSizeBucket, 0, largest+1)
+	low := 1
+	for d := 0; d <= largest; d++ {
+		high := low*10 - 1
+		if d == orderSizeDecades-1 {
+			high = int(^uint(0) >> 1)
+		}
+		buckets = append(buckets, models.OrderSizeBucket{Min: low, Max: high, Calculations: counts[d]})
+		low *= 10
+	}
+	return buckets, nil
+}
+
+// packSizeUsage returns the pack sizes shipped most, from the results
+func (r *Repository) packSizeUsage(window string, from, to interface{}) ([]models.PackSizeUsage, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			CAST(packs.key AS INTEGER) AS size,
+			CAST(SUM(CAST(packs.value AS BIGINT)) AS BIGINT) AS shipped,
+			COUNT(*)
+		FROM calculations, %s
+		WHERE %s
+		GROUP BY 1
+		ORDER BY shipped DESC, size
+		LIMIT %d`, r.dialect.resultPacks, window, topPackSizes)
+
+	rows, err := r.db.Query(r.dialect.rebind(query), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate pack sizes: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []models.PackSizeUsage{}
+	for rows.Next() {
+		var u models.PackSizeUsage
+		if err := rows.Scan(&u.Size, &u.Packs, &u.Calculations); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
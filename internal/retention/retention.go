@@ -0,0 +1,173 @@
+package retention
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+)
+
+// Store is the part of the repository the pruner needs. It is satisfied
+// by *repo.Repository.
+type Store interface {
+	PruneHistory(p repo.RetentionPolicy) (repo.PruneResult, error)
+	Vacuum(full bool) error
+}
+
+// Config controls history retention
+type Config struct {
+	Policy         repo.RetentionPolicy
+	Interval       time.Duration // Time between prunes
+	VacuumInterval time.Duration // Time between full vacuums; 0 disables them
+}
+
+// LoadConfig reads the retention configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		Policy: repo.RetentionPolicy{
+			Rollup: os.Getenv("HISTORY_ROLLUP") == "true",
+		},
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("HISTORY_MAX_AGE")); err == nil && v > 0 {
+		cfg.Policy.MaxAge = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("HISTORY_MAX_ROWS")); err == nil && v > 0 {
+		cfg.Policy.MaxRows = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("HISTORY_PRUNE_INTERVAL")); err == nil && v > 0 {
+		cfg.Interval = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("HISTORY_VACUUM_INTERVAL")); err == nil && v > 0 {
+		cfg.VacuumInterval = v
+	}
+
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+	return c
+}
+
+// Pruner enforces the retention policy in the background
+type Pruner struct {
+	store Store
+	cfg   Config
+
+	mu         sync.Mutex
+	stop       chan struct{}
+	done       chan struct{}
+	lastVacuum time.Time
+}
+
+// New creates a pruner for the given store
+func New(store Store, cfg Config) *Pruner {
+	return &Pruner{
+		store:      store,
+		cfg:        cfg.withDefaults(),
+		lastVacuum: time.Now(),
+	}
+}
+
+// Start prunes now and then every Config.Interval until Stop. It does
+// nothing if the policy sets no limit.
+func (p *Pruner) Start() {
+	if !p.cfg.Policy.Enabled() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	logger.Log.Info("History retention enabled",
+		zap.Duration("max_age", p.cfg.Policy.MaxAge),
+		zap.Int("max_rows", p.cfg.Policy.MaxRows),
+		zap.Bool("rollup", p.cfg.Policy.Rollup),
+		zap.Duration("interval", p.cfg.Interval),
+	)
+
+	go p.loop(p.stop, p.done)
+}
+
+// Stop stops the background pruning and waits for a running prune
+func (p *Pruner) Stop() {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// loop prunes on every tick until stop is closed
+func (p *Pruner) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Run(); err != nil {
+			logger.Log.Warn("History pruning failed", zap.Error(err))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run prunes the history once. Space freed by deleted rows is returned
+// incrementally, and with a full vacuum once Config.VacuumInterval has
+// passed since the last one.
+func (p *Pruner) Run() (repo.PruneResult, error) {
+	start := time.Now()
+	result, err := p.store.PruneHistory(p.cfg.Policy)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Deleted > 0 {
+		logger.Log.Info("Pruned history",
+			zap.Int64("deleted", result.Deleted),
+			zap.Int64("rolled_up", result.RolledUp),
+			zap.Duration("duration", time.Since(start)),
+		)
+
+		if err := p.store.Vacuum(false); err != nil {
+			logger.Log.Warn("Incremental vacuum failed", zap.Error(err))
+		}
+	}
+
+	if p.cfg.VacuumInterval > 0 && time.Since(p.lastVacuum) >= p.cfg.VacuumInterval {
+		p.lastVacuum = time.Now()
+		if err := p.store.Vacuum(true); err != nil {
+			logger.Log.Warn("Vacuum failed", zap.Error(err))
+		} else {
+			logger.Log.Info("Vacuumed database", zap.Duration("duration", time.Since(p.lastVacuum)))
+		}
+	}
+
+	return result, nil
+}
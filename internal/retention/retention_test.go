@@ -0,0 +1,148 @@
+package retention
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// fakeStore records prunes and vacuums
+type fakeStore struct {
+	mu       sync.Mutex
+	result   repo.PruneResult
+	err      error
+	policies []repo.RetentionPolicy
+	vacuums  []bool
+}
+
+func (s *fakeStore) PruneHistory(p repo.RetentionPolicy) (repo.PruneResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = append(s.policies, p)
+	return s.result, s.err
+}
+
+func (s *fakeStore) Vacuum(full bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vacuums = append(s.vacuums, full)
+	return nil
+}
+
+func (s *fakeStore) prunes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.policies)
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		result      repo.PruneResult
+		err         error
+		lastVacuum  time.Duration // Before now
+		wantVacuums []bool
+	}{
+		{"nothing pruned", repo.PruneResult{}, nil, 0, nil},
+		{"rows pruned", repo.PruneResult{Deleted: 10}, nil, 0, []bool{false}},
+		{"vacuum due", repo.PruneResult{Deleted: 10}, nil, 2 * time.Hour, []bool{false, true}},
+		{"vacuum due, nothing pruned", repo.PruneResult{}, nil, 2 * time.Hour, []bool{true}},
+		{"prune failed", repo.PruneResult{}, errors.New("database is locked"), 2 * time.Hour, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{result: tt.result, err: tt.err}
+			policy := repo.RetentionPolicy{MaxAge: time.Hour, Rollup: true}
+			p := New(store, Config{Policy: policy, VacuumInterval: time.Hour})
+			p.lastVacuum = time.Now().Add(-tt.lastVacuum)
+
+			result, err := p.Run()
+			if err != tt.err {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if result != tt.result {
+				t.Errorf("Expected result %+v, got %+v", tt.result, result)
+			}
+
+			if len(store.policies) != 1 || store.policies[0] != policy {
+				t.Errorf("Expected one prune with %+v, got %+v", policy, store.policies)
+			}
+			if len(store.vacuums) != len(tt.wantVacuums) {
+				t.Fatalf("Expected vacuums %v, got %v", tt.wantVacuums, store.vacuums)
+			}
+			for i, full := range tt.wantVacuums {
+				if store.vacuums[i] != full {
+					t.Errorf("Expected vacuums %v, got %v", tt.wantVacuums, store.vacuums)
+				}
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	store := &fakeStore{}
+	p := New(store, Config{Policy: repo.RetentionPolicy{MaxRows: 100}, Interval: 10 * time.Millisecond})
+
+	p.Start()
+	p.Start() // Already running
+
+	deadline := time.Now().Add(time.Second)
+	for store.prunes() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.Stop()
+
+	n := store.prunes()
+	if n < 3 {
+		t.Fatalf("Expected repeated prunes, got %d", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if store.prunes() != n {
+		t.Error("Expected no prunes after Stop")
+	}
+
+	p.Stop() // Not running
+}
+
+func TestStart_NoPolicy(t *testing.T) {
+	store := &fakeStore{}
+	p := New(store, Config{Interval: 10 * time.Millisecond})
+
+	p.Start()
+	time.Sleep(30 * time.Millisecond)
+	p.Stop()
+
+	if store.prunes() != 0 {
+		t.Errorf("Expected no prunes without a retention limit, got %d", store.prunes())
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("HISTORY_MAX_AGE", "720h")
+	t.Setenv("HISTORY_MAX_ROWS", "500000")
+	t.Setenv("HISTORY_ROLLUP", "true")
+	t.Setenv("HISTORY_PRUNE_INTERVAL", "invalid")
+	t.Setenv("HISTORY_VACUUM_INTERVAL", "24h")
+
+	cfg := LoadConfig()
+
+	want := Config{
+		Policy:         repo.RetentionPolicy{MaxAge: 720 * time.Hour, MaxRows: 500000, Rollup: true},
+		Interval:       time.Hour,
+		VacuumInterval: 24 * time.Hour,
+	}
+	if cfg != want {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+}
@@ -0,0 +1,151 @@
+// Package servertls builds the TLS configuration of the HTTP server from
+// certificate files that can be reloaded while the server runs, with
+// optional client certificate authentication (mTLS).
+package servertls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Client authentication modes accepted by TLS_CLIENT_AUTH
+const (
+	// ClientAuthNone asks for no client certificate
+	ClientAuthNone = "none"
+	// ClientAuthRequest verifies a client certificate when one is sent,
+	// so that browsers and service callers can share a port
+	ClientAuthRequest = "request"
+	// ClientAuthRequire rejects connections without a valid client
+	// certificate
+	ClientAuthRequire = "require"
+)
+
+// Config locates the server certificate and the client CA
+type Config struct {
+	CertFile     string // PEM certificate chain; TLS is off when empty
+	KeyFile      string // PEM private key
+	ClientCAFile string // PEM bundle that client certificates must chain to
+	ClientAuth   string // none, request or require
+}
+
+// LoadConfig reads the TLS configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		ClientAuth:   strings.ToLower(os.Getenv("TLS_CLIENT_AUTH")),
+	}
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields. A client CA without a mode requires
+// client certificates.
+func (c Config) withDefaults() Config {
+	if c.ClientAuth == "" {
+		c.ClientAuth = ClientAuthNone
+		if c.ClientCAFile != "" {
+			c.ClientAuth = ClientAuthRequire
+		}
+	}
+	return c
+}
+
+// Enabled reports whether the server should serve TLS
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// validate checks the settings that do not depend on the files
+func (c Config) validate() error {
+	if c.KeyFile == "" {
+		return fmt.Errorf("TLS_KEY_FILE is required with TLS_CERT_FILE")
+	}
+	switch c.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if c.ClientCAFile == "" {
+			return fmt.Errorf("TLS_CLIENT_AUTH=%s needs TLS_CLIENT_CA_FILE", c.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("unknown TLS_CLIENT_AUTH %q (want %s, %s or %s)",
+			c.ClientAuth, ClientAuthNone, ClientAuthRequest, ClientAuthRequire)
+	}
+	return nil
+}
+
+// Reloader serves the TLS configuration built from the files in Config
+// and rebuilds it on Reload. Connections opened after a reload use the new
+// certificate and client CA; open connections keep the old ones.
+type Reloader struct {
+	cfg     Config
+	current atomic.Pointer[tls.Config]
+}
+
+// New loads the certificate and client CA named by cfg
+func New(cfg Config) (*Reloader, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. On error the previous configuration stays
+// in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.cfg.ClientAuth != ClientAuthNone {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in TLS client CA file %s", r.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.ClientAuth == ClientAuthRequire {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r.current.Store(tlsConfig)
+	return nil
+}
+
+// Certificate returns the leaf certificate in use
+func (r *Reloader) Certificate() *x509.Certificate {
+	return r.current.Load().Certificates[0].Leaf
+}
+
+// TLSConfig returns a configuration for http.Server that picks up reloads
+// on every new connection
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
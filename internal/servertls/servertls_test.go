@@ -0,0 +1,212 @@
+package servertls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for name signed by parent, or a self-signed
+// CA when parent is nil
+func issue(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writePEM writes the certificate and key of cert to dir and returns
+// their paths
+func writePEM(t *testing.T, dir, name string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"certificate only", Config{CertFile: "a", KeyFile: "b"}, false},
+		{"missing key", Config{CertFile: "a"}, true},
+		{"client CA requires by default", Config{CertFile: "a", KeyFile: "b", ClientCAFile: "c"}, false},
+		{"request without CA", Config{CertFile: "a", KeyFile: "b", ClientAuth: ClientAuthRequest}, true},
+		{"unknown mode", Config{CertFile: "a", KeyFile: "b", ClientCAFile: "c", ClientAuth: "maybe"}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.cfg.withDefaults().validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	if got := (Config{ClientCAFile: "c"}).withDefaults().ClientAuth; got != ClientAuthRequire {
+		t.Errorf("Expected a client CA to default to %s, got %s", ClientAuthRequire, got)
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "Test CA", nil)
+	first := issue(t, "localhost", &ca)
+	certFile, keyFile := writePEM(t, dir, "server", first)
+
+	r, err := New(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if r.Certificate().SerialNumber.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Error("Expected the first certificate to be in use")
+	}
+
+	// A rotated certificate is picked up by Reload
+	second := issue(t, "localhost", &ca)
+	writePEM(t, dir, "server", second)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if r.Certificate().SerialNumber.Cmp(second.Leaf.SerialNumber) != 0 {
+		t.Error("Expected the rotated certificate to be in use")
+	}
+
+	// A broken file keeps the previous certificate
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Expected reloading a broken certificate to fail")
+	}
+	if r.Certificate().SerialNumber.Cmp(second.Leaf.SerialNumber) != 0 {
+		t.Error("Expected the previous certificate to stay in use")
+	}
+}
+
+func TestReloader_ClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "Test CA", nil)
+	certFile, keyFile := writePEM(t, dir, "server", issue(t, "localhost", &ca))
+	caFile, _ := writePEM(t, dir, "ca", ca)
+	client := issue(t, "client-1", &ca)
+	other := issue(t, "Other CA", nil)
+	stranger := issue(t, "stranger", &other)
+
+	r, err := New(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{"no client certificate", nil, true},
+		{"certificate from another CA", []tls.Certificate{stranger}, true},
+		{"trusted client certificate", []tls.Certificate{client}, false},
+	}
+
+	for _, tt := range tests {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: tt.certs,
+		}}}
+
+		resp, err := c.Get(srv.URL)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_CLIENT_CA_FILE", "")
+	t.Setenv("TLS_CLIENT_AUTH", "")
+
+	if cfg := LoadConfig(); cfg.Enabled() || cfg.ClientAuth != ClientAuthNone {
+		t.Errorf("Expected TLS off by default, got %+v", cfg)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "server.crt")
+	t.Setenv("TLS_KEY_FILE", "server.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "ca.crt")
+	t.Setenv("TLS_CLIENT_AUTH", "Request")
+
+	want := Config{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt", ClientAuth: ClientAuthRequest}
+	if cfg := LoadConfig(); cfg != want || !cfg.Enabled() {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+}
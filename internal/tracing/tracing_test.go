@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	if cfg := LoadConfig(); cfg.Exporter != ExporterNone || cfg.ServiceName != "packcalc" {
+		t.Errorf("Expected the none exporter and service packcalc by default, got %+v", cfg)
+	}
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "STDOUT")
+	t.Setenv("OTEL_SERVICE_NAME", "packcalc-eu")
+	if cfg := LoadConfig(); cfg.Exporter != ExporterStdout || cfg.ServiceName != "packcalc-eu" {
+		t.Errorf("Expected the stdout exporter and service packcalc-eu, got %+v", cfg)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{ExporterNone, false},
+		{ExporterStdout, false},
+		{"zipkin", true},
+	}
+
+	for _, tt := range tests {
+		shutdown, err := Setup(context.Background(), Config{Exporter: tt.exporter, ServiceName: "packcalc"})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Setup(%s) error = %v, wantErr %v", tt.exporter, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("Setup(%s) shutdown error = %v", tt.exporter, err)
+			}
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	spans := InMemory()
+
+	var handlerSpan trace.SpanContext
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+	})
+	r.Post("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+
+	got := spans.GetSpans()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(got))
+	}
+
+	get := got[0]
+	if get.Name != "GET /items/{id}" {
+		t.Errorf("Expected span GET /items/{id}, got %s", get.Name)
+	}
+	if get.SpanContext.TraceID().String() != traceID || get.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the span to continue the incoming trace, got trace %s parent %s",
+			get.SpanContext.TraceID(), get.Parent.SpanID())
+	}
+	if handlerSpan.SpanID() != get.SpanContext.SpanID() {
+		t.Errorf("Expected the handler to see the request span")
+	}
+	if !hasAttribute(get.Attributes, attribute.Int("http.response.status_code", 200)) {
+		t.Errorf("Expected status code 200 on the span, got %v", get.Attributes)
+	}
+
+	post := got[1]
+	if post.Parent.IsValid() {
+		t.Errorf("Expected a new trace without traceparent")
+	}
+	if post.Status.Code != codes.Error {
+		t.Errorf("Expected a 500 to mark the span as failed, got %v", post.Status)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
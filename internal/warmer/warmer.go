@@ -0,0 +1,456 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/algorithm"
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/metrics"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRunning is returned when a warm-up is started while another runs
+	ErrRunning = errors.New("cache warm-up already running")
+	// ErrCacheDisabled is returned when there is no cache to warm
+	ErrCacheDisabled = errors.New("cache is disabled")
+	// ErrInvalidJob is returned for jobs that cannot be run
+	ErrInvalidJob = errors.New("invalid warm-up job")
+)
+
+// Warm-up states
+const (
+	StateIdle      = "idle"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateCancelled = "cancelled"
+	StateFailed    = "failed"
+)
+
+// progressLogInterval is the number of targets between progress log lines
+const progressLogInterval = 100
+
+// Source supplies the history and configuration a warm-up is built from.
+// It is satisfied by *repo.Repository.
+type Source interface {
+	GetTopCalculations(limit int) ([]repo.CalculationFrequency, error)
+	GetPackSizes() ([]int, error)
+}
+
+// Config controls the warmer
+type Config struct {
+	OnStartup  bool    // Warm the cache when the server starts
+	Top        int     // Combinations taken from history when a job names none
+	Rate       float64 // Calculations per second; 0 or less means unlimited
+	MaxTargets int     // Upper bound on the calculations in one job
+}
+
+// LoadConfig reads the warmer configuration from the environment
+func LoadConfig() Config {
+	cfg := Config{
+		OnStartup: os.Getenv("CACHE_WARM_ON_STARTUP") == "true",
+		Rate:      50,
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("CACHE_WARM_TOP")); err == nil && v > 0 {
+		cfg.Top = v
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv("CACHE_WARM_RATE"), 64); err == nil && v >= 0 {
+		cfg.Rate = v
+	}
+
+	return cfg.withDefaults()
+}
+
+// withDefaults fills in unset fields
+func (c Config) withDefaults() Config {
+	if c.Top <= 0 {
+		c.Top = 100
+	}
+	if c.MaxTargets <= 0 {
+		c.MaxTargets = 100000
+	}
+	return c
+}
+
+// Job describes what to warm. History, explicit items and the range can
+// be combined; a job that names nothing warms the Config.Top most
+// frequent combinations from history.
+type Job struct {
+	Top       int   // Most frequent (items, pack sizes) combinations from history
+	Items     []int // Explicit order sizes
+	From      int   // First order size of a range
+	To        int   // Last order size of a range (inclusive)
+	Step      int   // Range step; defaults to 1
+	PackSizes []int // Pack sizes for Items and the range; current configuration when empty
+}
+
+// isEmpty reports whether the job names no targets
+func (j Job) isEmpty() bool {
+	return j.Top == 0 && len(j.Items) == 0 && j.From == 0 && j.To == 0
+}
+
+// validate checks the parts of a job that do not need the source
+func (j Job) validate(maxTargets int) error {
+	if j.Top < 0 {
+		return fmt.Errorf("%w: top must not be negative", ErrInvalidJob)
+	}
+
+	for _, items := range j.Items {
+		if items <= 0 {
+			return fmt.Errorf("%w: items must be greater than 0", ErrInvalidJob)
+		}
+		if items > models.MaxItems {
+			return fmt.Errorf("%w: items must be at most %d", ErrInvalidJob, models.MaxItems)
+		}
+	}
+
+	if j.From != 0 || j.To != 0 {
+		if j.From <= 0 || j.To < j.From {
+			return fmt.Errorf("%w: range must satisfy 0 < from <= to", ErrInvalidJob)
+		}
+		if j.To > models.MaxItems {
+			return fmt.Errorf("%w: to must be at most %d", ErrInvalidJob, models.MaxItems)
+		}
+		if j.Step < 0 {
+			return fmt.Errorf("%w: step must not be negative", ErrInvalidJob)
+		}
+	}
+
+	if len(j.PackSizes) > 0 && !algorithm.Validate(j.PackSizes) {
+		return fmt.Errorf("%w: invalid pack sizes", ErrInvalidJob)
+	}
+
+	if n := j.Top + len(j.Items) + j.rangeLen(); n > maxTargets {
+		return fmt.Errorf("%w: %d calculations requested, the limit is %d", ErrInvalidJob, n, maxTargets)
+	}
+
+	return nil
+}
+
+// rangeLen returns the number of order sizes in the job's range
+func (j Job) rangeLen() int {
+	if j.From <= 0 || j.To < j.From {
+		return 0
+	}
+	step := j.Step
+	if step <= 0 {
+		step = 1
+	}
+	return (j.To-j.From)/step + 1
+}
+
+// Progress reports the state of the current or last warm-up
+type Progress struct {
+	State      string
+	Total      int // Calculations to warm
+	Processed  int // Calculations handled so far
+	Warmed     int // Results computed and stored
+	Skipped    int // Results that were already cached
+	Failed     int // Results the cache rejected
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Error      string
+}
+
+// target is a single calculation to warm
+type target struct {
+	items     int
+	packSizes []int
+}
+
+// Warmer precomputes calculations into the cache in the background,
+// at a limited rate so that warming does not starve live requests
+type Warmer struct {
+	cache  cache.Cache
+	source Source
+	cfg    Config
+
+	mu       sync.Mutex
+	progress Progress
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// New creates a warmer for the given cache
+func New(c cache.Cache, source Source, cfg Config) *Warmer {
+	return &Warmer{
+		cache:    c,
+		source:   source,
+		cfg:      cfg.withDefaults(),
+		progress: Progress{State: StateIdle},
+	}
+}
+
+// Start validates the job and runs it in the background
+func (w *Warmer) Start(job Job) error {
+	ctx, job, err := w.begin(context.Background(), job)
+	if err != nil {
+		return err
+	}
+
+	go w.run(ctx, job)
+	return nil
+}
+
+// Run runs the job and waits for it to finish
+func (w *Warmer) Run(ctx context.Context, job Job) (Progress, error) {
+	runCtx, job, err := w.begin(ctx, job)
+	if err != nil {
+		return w.Progress(), err
+	}
+
+	w.run(runCtx, job)
+
+	progress := w.Progress()
+	if progress.Error != "" {
+		return progress, errors.New(progress.Error)
+	}
+	return progress, nil
+}
+
+// Progress returns the state of the current or last warm-up
+func (w *Warmer) Progress() Progress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress
+}
+
+// Stop cancels a running warm-up and waits for it to exit
+func (w *Warmer) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// begin checks that a job may start and marks the warmer as running. It
+// returns the job with defaults applied.
+func (w *Warmer) begin(parent context.Context, job Job) (context.Context, Job, error) {
+	if job.isEmpty() {
+		job.Top = w.cfg.Top
+	}
+	if err := job.validate(w.cfg.MaxTargets); err != nil {
+		return nil, job, err
+	}
+
+	if !w.cache.IsEnabled() {
+		return nil, job, ErrCacheDisabled
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.progress.State == StateRunning {
+		return nil, job, ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	w.progress = Progress{State: StateRunning, StartedAt: time.Now()}
+
+	return ctx, job, nil
+}
+
+// run warms every target of the job
+func (w *Warmer) run(ctx context.Context, job Job) {
+	targets, err := w.targets(job)
+	if err != nil {
+		w.finish(err)
+		return
+	}
+
+	w.update(func(p *Progress) { p.Total = len(targets) })
+	logger.Log.Info("Cache warm-up started",
+		zap.Int("calculations", len(targets)),
+		zap.Float64("rate", w.cfg.Rate),
+	)
+
+	var tick <-chan time.Time
+	if w.cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / w.cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for i, t := range targets {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			w.finish(ctx.Err())
+			return
+		}
+
+		w.warm(t)
+
+		if processed := i + 1; processed%progressLogInterval == 0 {
+			logger.Log.Info("Cache warm-up progress",
+				zap.Int("processed", processed),
+				zap.Int("total", len(targets)),
+			)
+		}
+	}
+
+	w.finish(nil)
+}
+
+// warm computes and caches a single target unless it is already cached
+func (w *Warmer) warm(t target) {
+	if w.cache.Contains(t.items, t.packSizes) {
+		w.update(func(p *Progress) {
+			p.Processed++
+			p.Skipped++
+		})
+		return
+	}
+
+	start := time.Now()
+	result := algorithm.Calculate(t.items, t.packSizes)
+	duration := time.Since(start)
+	metrics.ObserveCalculation(t.items, duration, result)
+
+	err := w.cache.Set(
+		t.items,
+		t.packSizes,
+		result.PackCounts,
+		result.TotalItems,
+		result.TotalPacks,
+		result.Waste,
+		duration.Milliseconds(),
+	)
+	if err != nil {
+		logger.Log.Warn("Failed to warm cache entry",
+			zap.Int("items", t.items),
+			zap.Ints("pack_sizes", t.packSizes),
+			zap.Error(err),
+		)
+	}
+
+	w.update(func(p *Progress) {
+		p.Processed++
+		if err != nil {
+			p.Failed++
+		} else {
+			p.Warmed++
+		}
+	})
+}
+
+// targets resolves a job into a de-duplicated list of calculations
+func (w *Warmer) targets(job Job) ([]target, error) {
+	var targets []target
+	seen := make(map[string]bool)
+	add := func(items int, packSizes []int) {
+		key := targetKey(items, packSizes)
+		if !seen[key] {
+			seen[key] = true
+			targets = append(targets, target{items: items, packSizes: packSizes})
+		}
+	}
+
+	if job.Top > 0 {
+		top, err := w.source.GetTopCalculations(job.Top)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		for _, c := range top {
+			if c.Items > 0 && algorithm.Validate(c.PackSizes) {
+				add(c.Items, c.PackSizes)
+			}
+		}
+	}
+
+	if len(job.Items) > 0 || job.rangeLen() > 0 {
+		packSizes := job.PackSizes
+		if len(packSizes) == 0 {
+			var err error
+			packSizes, err = w.source.GetPackSizes()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get pack sizes: %w", err)
+			}
+		}
+
+		for _, items := range job.Items {
+			add(items, packSizes)
+		}
+
+		// Count the steps rather than compare against To, which cannot
+		// overflow however close To is to the largest int
+		step := job.Step
+		if step <= 0 {
+			step = 1
+		}
+		for i, n := 0, job.rangeLen(); i < n; i++ {
+			add(job.From+i*step, packSizes)
+		}
+	}
+
+	return targets, nil
+}
+
+// finish records the outcome of a warm-up and releases its context. The
+// state change and the release happen together so that a new warm-up
+// cannot start in between.
+func (w *Warmer) finish(err error) {
+	w.update(func(p *Progress) {
+		w.cancel()
+		close(w.done)
+		w.cancel, w.done = nil, nil
+
+		p.FinishedAt = time.Now()
+		switch {
+		case err == nil:
+			p.State = StateCompleted
+		case errors.Is(err, context.Canceled):
+			p.State = StateCancelled
+			p.Error = err.Error()
+		default:
+			p.State = StateFailed
+			p.Error = err.Error()
+		}
+	})
+
+	progress := w.Progress()
+	logger.Log.Info("Cache warm-up finished",
+		zap.String("state", progress.State),
+		zap.Int("warmed", progress.Warmed),
+		zap.Int("skipped", progress.Skipped),
+		zap.Int("failed", progress.Failed),
+		zap.Duration("duration", progress.FinishedAt.Sub(progress.StartedAt)),
+	)
+}
+
+// update applies fn to the progress under the lock
+func (w *Warmer) update(fn func(p *Progress)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn(&w.progress)
+}
+
+// targetKey normalizes a calculation for de-duplication
+func targetKey(items int, packSizes []int) string {
+	sorted := make([]int, len(packSizes))
+	copy(sorted, packSizes)
+	sort.Ints(sorted)
+	return fmt.Sprintf("%d:%v", items, sorted)
+}
@@ -0,0 +1,217 @@
+package warmer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sander-remitly/pack-calc/internal/cache"
+	"github.com/sander-remitly/pack-calc/internal/logger"
+	"github.com/sander-remitly/pack-calc/internal/models"
+	"github.com/sander-remitly/pack-calc/internal/repo"
+)
+
+func init() {
+	// Initialize logger for tests
+	logger.Initialize()
+}
+
+// fakeSource serves a fixed history and pack configuration
+type fakeSource struct {
+	top       []repo.CalculationFrequency
+	packSizes []int
+	err       error
+}
+
+func (s *fakeSource) GetTopCalculations(limit int) ([]repo.CalculationFrequency, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if limit < len(s.top) {
+		return s.top[:limit], nil
+	}
+	return s.top, nil
+}
+
+func (s *fakeSource) GetPackSizes() ([]int, error) {
+	return s.packSizes, nil
+}
+
+func newTestSource() *fakeSource {
+	return &fakeSource{
+		top: []repo.CalculationFrequency{
+			{Items: 500, PackSizes: []int{250, 500}, Count: 3},
+			{Items: 263, PackSizes: []int{23, 31, 53}, Count: 2},
+			{Items: 12001, PackSizes: []int{250, 500, 1000, 2000, 5000}, Count: 1},
+		},
+		packSizes: []int{250, 500, 1000},
+	}
+}
+
+func TestRun_FromHistory(t *testing.T) {
+	c := cache.NewMemoryCache(100, 0)
+	w := New(c, newTestSource(), Config{Top: 2})
+
+	progress, err := w.Run(context.Background(), Job{})
+	if err != nil {
+		t.Fatalf("Warm-up failed: %v", err)
+	}
+
+	if progress.State != StateCompleted {
+		t.Errorf("Expected state %q, got %q", StateCompleted, progress.State)
+	}
+
+	if progress.Total != 2 || progress.Warmed != 2 {
+		t.Errorf("Expected 2 of 2 warmed, got %d of %d", progress.Warmed, progress.Total)
+	}
+
+	if !c.Contains(500, []int{250, 500}) || !c.Contains(263, []int{23, 31, 53}) {
+		t.Error("Expected the top combinations to be cached")
+	}
+
+	if c.Contains(12001, []int{250, 500, 1000, 2000, 5000}) {
+		t.Error("Expected combinations beyond the default top to be left out")
+	}
+}
+
+func TestRun_ItemsAndRange(t *testing.T) {
+	c := cache.NewMemoryCache(100, 0)
+	w := New(c, newTestSource(), Config{})
+
+	job := Job{Items: []int{1, 250}, From: 250, To: 1000, Step: 250}
+	progress, err := w.Run(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Warm-up failed: %v", err)
+	}
+
+	// 250 appears in both the list and the range
+	if progress.Total != 5 {
+		t.Errorf("Expected 5 distinct calculations, got %d", progress.Total)
+	}
+
+	for _, items := range []int{1, 250, 500, 750, 1000} {
+		if !c.Contains(items, []int{250, 500, 1000}) {
+			t.Errorf("Expected %d items to be cached with the configured pack sizes", items)
+		}
+	}
+}
+
+func TestRun_SkipsCachedEntries(t *testing.T) {
+	c := cache.NewMemoryCache(100, 0)
+	c.Set(500, []int{250, 500}, map[int]int{500: 1}, 500, 1, 0, 0)
+	c.Get(500, []int{250, 500})
+
+	w := New(c, newTestSource(), Config{})
+	progress, err := w.Run(context.Background(), Job{Top: 1})
+	if err != nil {
+		t.Fatalf("Warm-up failed: %v", err)
+	}
+
+	if progress.Skipped != 1 || progress.Warmed != 0 {
+		t.Errorf("Expected the cached entry to be skipped, got %+v", progress)
+	}
+
+	// The existing entry keeps its hit count
+	cached, _ := c.Get(500, []int{250, 500})
+	if cached.HitCount != 2 {
+		t.Errorf("Expected hit count 2, got %d", cached.HitCount)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache cache.Cache
+		job   Job
+		want  error
+	}{
+		{"negative top", cache.NewMemoryCache(10, 0), Job{Top: -1}, ErrInvalidJob},
+		{"zero items", cache.NewMemoryCache(10, 0), Job{Items: []int{0}}, ErrInvalidJob},
+		{"reversed range", cache.NewMemoryCache(10, 0), Job{From: 10, To: 5}, ErrInvalidJob},
+		{"invalid pack sizes", cache.NewMemoryCache(10, 0), Job{Items: []int{1}, PackSizes: []int{0}}, ErrInvalidJob},
+		{"too many targets", cache.NewMemoryCache(10, 0), Job{From: 1, To: 1000}, ErrInvalidJob},
+		{"too many items", cache.NewMemoryCache(10, 0), Job{Items: []int{models.MaxItems + 1}}, ErrInvalidJob},
+		{"range beyond max items", cache.NewMemoryCache(10, 0), Job{From: math.MaxInt - 1, To: math.MaxInt}, ErrInvalidJob},
+		{"cache disabled", cache.New(cache.Config{Backend: cache.BackendNone}), Job{}, ErrCacheDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New(tt.cache, newTestSource(), Config{MaxTargets: 100})
+			if _, err := w.Run(context.Background(), tt.job); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRun_SourceError(t *testing.T) {
+	source := newTestSource()
+	source.err = errors.New("database is locked")
+	w := New(cache.NewMemoryCache(10, 0), source, Config{})
+
+	progress, err := w.Run(context.Background(), Job{})
+	if err == nil {
+		t.Fatal("Expected an error when history cannot be read")
+	}
+
+	if progress.State != StateFailed {
+		t.Errorf("Expected state %q, got %q", StateFailed, progress.State)
+	}
+}
+
+func TestStart_RateLimitedAndStoppable(t *testing.T) {
+	// One calculation per minute: the first runs at once, then the job waits
+	w := New(cache.NewMemoryCache(100, 0), newTestSource(), Config{Rate: 1.0 / 60})
+
+	if err := w.Start(Job{Items: []int{100, 200, 300}}); err != nil {
+		t.Fatalf("Failed to start warm-up: %v", err)
+	}
+
+	if err := w.Start(Job{}); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning for a second warm-up, got %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Progress().Processed < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.Stop()
+
+	progress := w.Progress()
+	if progress.State != StateCancelled {
+		t.Errorf("Expected state %q, got %q", StateCancelled, progress.State)
+	}
+	if progress.Processed != 1 || progress.Total != 3 {
+		t.Errorf("Expected 1 of 3 processed before the rate limit, got %d of %d", progress.Processed, progress.Total)
+	}
+
+	// A new warm-up may start once the previous one has stopped
+	if err := w.Start(Job{Items: []int{100}}); err != nil {
+		t.Errorf("Expected a new warm-up to start, got %v", err)
+	}
+	w.Stop()
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("CACHE_WARM_ON_STARTUP", "true")
+	t.Setenv("CACHE_WARM_TOP", "25")
+	t.Setenv("CACHE_WARM_RATE", "0")
+
+	cfg := LoadConfig()
+	if !cfg.OnStartup || cfg.Top != 25 || cfg.Rate != 0 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	t.Setenv("CACHE_WARM_ON_STARTUP", "")
+	t.Setenv("CACHE_WARM_TOP", "")
+	t.Setenv("CACHE_WARM_RATE", "")
+
+	cfg = LoadConfig()
+	if cfg.OnStartup || cfg.Top != 100 || cfg.Rate != 50 {
+		t.Errorf("Unexpected default config: %+v", cfg)
+	}
+}